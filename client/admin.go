@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// TargetPolicyInput is the body of SaveTargetPolicy
+type TargetPolicyInput struct {
+	Scope            string  `json:"scope"`                       // host or task
+	Target           string  `json:"target"`                      // Host (and port) or task ID the policy applies to
+	FailureThreshold int     `json:"failure_threshold,omitempty"` // Consecutive failures opening the breaker, 0 disables the breaker
+	OpenSeconds      int     `json:"open_seconds,omitempty"`      // How long the breaker stays open
+	OpenPolicy       string  `json:"open_policy,omitempty"`       // fail_fast or wait
+	MaxWaitSeconds   int     `json:"max_wait_seconds,omitempty"`  // Longest a call waits on an open breaker or a full concurrency limit
+	MaxConcurrency   int     `json:"max_concurrency,omitempty"`   // Most calls in flight at once, 0 for unlimited
+	RatePerSecond    float64 `json:"rate_per_second,omitempty"`   // Sustained calls per second, 0 for unlimited
+	Burst            int     `json:"burst,omitempty"`             // Calls allowed above the rate in a burst
+}
+
+// QuotaInput is the body of SaveTenantQuota. Zero means unlimited.
+type QuotaInput struct {
+	MaxConcurrentExecutions int `json:"max_concurrent_executions"`
+	MaxWorkflows            int `json:"max_workflows"`
+	MaxNodes                int `json:"max_nodes"`
+	MaxTasks                int `json:"max_tasks"`
+}
+
+// TenantQuotaUsage is the quota of a tenant with what it currently runs and stores
+type TenantQuotaUsage struct {
+	workflow.TenantQuota
+	Usage workflow.TenantUsage `json:"usage"`
+}
+
+// APIKeyInput is the body of CreateAPIKey
+type APIKeyInput struct {
+	Name     string   `json:"name"`                // Client the key is issued to
+	Roles    []string `json:"roles,omitempty"`     // Roles of the client, viewer when empty
+	TenantID string   `json:"tenant_id,omitempty"` // Tenant of the key, only for admins of the default tenant
+}
+
+// CreatedAPIKey is an issued API key, with the key itself
+type CreatedAPIKey struct {
+	workflow.APIKey
+	Key string `json:"key"` // The credential, only returned when the key is created
+}
+
+// ListBreakers returns the circuit breaker and limit state of every task target, as seen by
+// the instance answering
+func (c *Client) ListBreakers(ctx context.Context) ([]workflow.BreakerStatus, error) {
+	var statuses []workflow.BreakerStatus
+	err := c.get(ctx, "/admin/breakers", nil, &statuses)
+	return statuses, err
+}
+
+func (c *Client) ListTargetPolicies(ctx context.Context) ([]workflow.TargetPolicy, error) {
+	var policies []workflow.TargetPolicy
+	err := c.get(ctx, "/admin/target-policies", nil, &policies)
+	return policies, err
+}
+
+// SaveTargetPolicy creates the policy of a target, or replaces it
+func (c *Client) SaveTargetPolicy(ctx context.Context, policy TargetPolicyInput) (workflow.TargetPolicy, error) {
+	var saved workflow.TargetPolicy
+	err := c.put(ctx, "/admin/target-policies", policy, &saved)
+	return saved, err
+}
+
+func (c *Client) DeleteTargetPolicy(ctx context.Context, policyID uuid.UUID) error {
+	return c.delete(ctx, "/admin/target-policies/"+policyID.String())
+}
+
+// ListTenantQuotas returns every quota that was set
+func (c *Client) ListTenantQuotas(ctx context.Context) ([]workflow.TenantQuota, error) {
+	var quotas []workflow.TenantQuota
+	err := c.get(ctx, "/admin/tenants", nil, &quotas)
+	return quotas, err
+}
+
+func (c *Client) GetTenantQuota(ctx context.Context, tenant string) (TenantQuotaUsage, error) {
+	var quota TenantQuotaUsage
+	err := c.get(ctx, "/admin/tenants/"+url.PathEscape(tenant)+"/quota", nil, &quota)
+	return quota, err
+}
+
+func (c *Client) SaveTenantQuota(ctx context.Context, tenant string, quota QuotaInput) (workflow.TenantQuota, error) {
+	var saved workflow.TenantQuota
+	err := c.put(ctx, "/admin/tenants/"+url.PathEscape(tenant)+"/quota", quota, &saved)
+	return saved, err
+}
+
+// ListAuditEntries iterates over the audit entries matching filter, newest first. Limit is the
+// size of the pages fetched and Offset the number of entries skipped.
+func (c *Client) ListAuditEntries(ctx context.Context, filter workflow.AuditFilter) *AuditIterator {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"actor": filter.Actor, "action": filter.Action, "resource_type": filter.ResourceType,
+		"resource_id": filter.ResourceID, "outcome": filter.Outcome, "request_id": filter.RequestID,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if filter.Since != nil {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if filter.Until != nil {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	return &AuditIterator{pager: newPager(c, ctx, "/audit", query, filter.Limit, filter.Offset)}
+}
+
+// CreateAPIKey issues an API key. The key is only returned here.
+func (c *Client) CreateAPIKey(ctx context.Context, key APIKeyInput) (CreatedAPIKey, error) {
+	var created CreatedAPIKey
+	err := c.post(ctx, "/auth/keys", key, &created)
+	return created, err
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]workflow.APIKey, error) {
+	var keys []workflow.APIKey
+	err := c.get(ctx, "/auth/keys", nil, &keys)
+	return keys, err
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, keyID uuid.UUID) error {
+	return c.delete(ctx, "/auth/keys/"+keyID.String())
+}
+
+// CreateWorkflowGrant gives subject a role on one workflow and its executions
+func (c *Client) CreateWorkflowGrant(ctx context.Context, workflowID uuid.UUID, subject, role string) (workflow.WorkflowGrant, error) {
+	var grant workflow.WorkflowGrant
+	err := c.post(ctx, "/auth/grants", struct {
+		WorkflowID uuid.UUID `json:"workflow_id"`
+		Subject    string    `json:"subject"`
+		Role       string    `json:"role"`
+	}{workflowID, subject, role}, &grant)
+	return grant, err
+}
+
+// ListWorkflowGrants returns the grants on a workflow, or every grant when workflowID is uuid.Nil
+func (c *Client) ListWorkflowGrants(ctx context.Context, workflowID uuid.UUID) ([]workflow.WorkflowGrant, error) {
+	query := url.Values{}
+	if workflowID != uuid.Nil {
+		query.Set("workflow_id", workflowID.String())
+	}
+	var grants []workflow.WorkflowGrant
+	err := c.get(ctx, "/auth/grants", query, &grants)
+	return grants, err
+}
+
+func (c *Client) DeleteWorkflowGrant(ctx context.Context, grantID uuid.UUID) error {
+	return c.delete(ctx, "/auth/grants/"+grantID.String())
+}
@@ -0,0 +1,251 @@
+// Package client calls the frosty HTTP API. Responses decode into the model types of the
+// workflow package, and error responses into *Error, which matches the error kinds of the
+// workflow package with errors.Is:
+//
+//	c := client.New("http://localhost:8080", os.Getenv("FROSTY_API_KEY"))
+//	execution, err := c.CreateExecution(ctx, client.ExecutionInput{WorkflowID: workflowID, ReferenceNumber: "ORD-1"})
+//	if errors.Is(err, workflow.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kadzany/frosty/workflow"
+)
+
+// Client calls the API of one frosty server. It is safe for concurrent use.
+type Client struct {
+	BaseURL    string       // URL of the server, e.g. http://localhost:8080
+	Credential string       // API key or JWT sent as a bearer token, none when empty
+	HTTPClient *http.Client // Client sending the requests, http.DefaultClient when nil
+	Retry      RetryPolicy  // How failed requests are retried
+}
+
+// RetryPolicy retries requests failing with a network error or a 429, 502, 503 or 504 response.
+// Only requests safe to repeat are retried: GET, PUT and DELETE requests, and POST requests
+// carrying an Idempotency-Key.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts of a request, the first included; 1 disables retries
+	MinBackoff  time.Duration // Wait before the first retry, doubled before every other
+	MaxBackoff  time.Duration // Longest wait between attempts, unless the server asks for longer with Retry-After
+}
+
+// DefaultRetryPolicy is the retry policy of clients returned by New
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, MinBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second}
+
+// New returns a client of the server at baseURL authenticating with credential
+func New(baseURL, credential string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Credential: credential, Retry: DefaultRetryPolicy}
+}
+
+// Codes of error responses, see the README
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeInvalidTransition = "invalid_state_transition"
+	CodeValidation        = "validation_failed"
+	CodeCycle             = "cycle"
+	CodeQuotaExceeded     = "quota_exceeded"
+	CodeInternal          = "internal"
+)
+
+// codeKinds are the workflow error kinds matched by errors of each code
+var codeKinds = map[string]error{
+	CodeNotFound:          workflow.ErrNotFound,
+	CodeConflict:          workflow.ErrConflict,
+	CodeInvalidTransition: workflow.ErrInvalidTransition,
+	CodeValidation:        workflow.ErrValidation,
+	CodeCycle:             workflow.ErrCycle,
+	CodeQuotaExceeded:     workflow.ErrQuotaExceeded,
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int          `json:"-"`          // HTTP status of the response
+	Message    string       `json:"error"`      // Human readable message
+	Code       string       `json:"code"`       // Stable machine readable code
+	RequestID  string       `json:"request_id"` // ID of the request, to look it up in the server logs and audit log
+	Fields     []FieldError `json:"fields"`     // Invalid fields of the request body
+}
+
+// FieldError tells what is wrong with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`   // JSON name of the field, empty when the body as a whole is wrong
+	Code    string `json:"code"`    // required, unknown_field, invalid_type, invalid, too_long, out_of_range or malformed
+	Message string `json:"message"` // Human readable message
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	for _, field := range e.Fields {
+		message += fmt.Sprintf("; %s", field.Message)
+	}
+	return message
+}
+
+// Is reports whether the error is of the workflow error kind target, e.g. workflow.ErrNotFound
+func (e *Error) Is(target error) bool {
+	kind, ok := codeKinds[e.Code]
+	return ok && kind == target
+}
+
+// call is one request to the API
+type call struct {
+	method string
+	path   string     // Path below BaseURL, with its variables escaped
+	query  url.Values // Query parameters, if any
+	body   interface{}
+	header http.Header // Headers besides Authorization and Content-Type
+}
+
+// do sends the call, retrying it as the retry policy allows, and decodes a successful
+// response into out unless it is nil. It returns the status of the response.
+func (c *Client) do(ctx context.Context, req call, out interface{}) (int, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return 0, fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+
+	retryable := req.method != http.MethodPost || req.header.Get("Idempotency-Key") != ""
+	attempts := c.Retry.MaxAttempts
+	if attempts < 1 || !retryable {
+		attempts = 1
+	}
+
+	backoff := c.Retry.MinBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err == nil && !retryStatus(resp.StatusCode) || attempt == attempts || ctx.Err() != nil {
+			if err != nil {
+				return 0, err
+			}
+			defer resp.Body.Close()
+			return resp.StatusCode, decodeResponse(resp, out)
+		}
+
+		wait := backoff
+		if err == nil {
+			if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && time.Duration(seconds)*time.Second > wait {
+				wait = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if backoff *= 2; c.Retry.MaxBackoff > 0 && backoff > c.Retry.MaxBackoff {
+			backoff = c.Retry.MaxBackoff
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req call, body []byte) (*http.Response, error) {
+	target := c.BaseURL + req.path
+	if len(req.query) > 0 {
+		target += "?" + req.query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.Credential != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.Credential)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(httpReq)
+}
+
+func retryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// decodeResponse decodes a successful response into out, and an error response into *Error
+func decodeResponse(resp *http.Response, out interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(body))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		if apiErr.RequestID == "" {
+			apiErr.RequestID = resp.Header.Get("X-Request-ID")
+		}
+		return apiErr
+	}
+
+	if out == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	_, err := c.do(ctx, call{method: http.MethodGet, path: path, query: query}, out)
+	return err
+}
+
+func (c *Client) post(ctx context.Context, path string, body, out interface{}) error {
+	_, err := c.do(ctx, call{method: http.MethodPost, path: path, body: body}, out)
+	return err
+}
+
+func (c *Client) put(ctx context.Context, path string, body, out interface{}) error {
+	_, err := c.do(ctx, call{method: http.MethodPut, path: path, body: body}, out)
+	return err
+}
+
+func (c *Client) delete(ctx context.Context, path string) error {
+	_, err := c.do(ctx, call{method: http.MethodDelete, path: path}, nil)
+	return err
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/internal"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer serves the API on a fresh SQLite database, returning a client authenticated
+// as an admin
+func newTestServer(t *testing.T) *Client {
+	app := internal.App{}
+	app.InitializeSQLite(":memory:")
+	if err := app.Migrate([]string{"up"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	key, apiKey, err := workflow.GenerateAPIKey("client-test", []string{workflow.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Store.CreateAPIKey(apiKey); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(app.Router)
+	t.Cleanup(func() {
+		server.Close()
+		app.DB.Close()
+	})
+	return New(server.URL, key)
+}
+
+func TestClient_ExecutionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c := newTestServer(t)
+
+	start, err := c.CreateNode(ctx, NodeInput{Title: "Start", Type: workflow.NodeTypeStart})
+	if err != nil {
+		t.Fatal(err)
+	}
+	approval, err := c.CreateNode(ctx, NodeInput{Title: "Approval", Type: workflow.NodeTypeWait, Config: json.RawMessage(`{"signal":"approved"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := c.CreateNode(ctx, NodeInput{Title: "End", Type: workflow.NodeTypeEnd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, edge := range [][2]uuid.UUID{{start, approval}, {approval, end}} {
+		if _, err := c.AddRelationship(ctx, edge[0], edge[1], ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workflowID, err := c.CreateWorkflow(ctx, WorkflowInput{Name: "approval", StartingNodeID: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wf, err := c.GetWorkflow(ctx, workflowID)
+	assert.NoError(t, err)
+	assert.Equal(t, "approval", wf.Name)
+
+	// Retrying the creation with the same key gets the same execution back
+	input := ExecutionInput{WorkflowID: workflowID, ReferenceNumber: "ORD-1", IdempotencyKey: "order-1"}
+	created, err := c.CreateExecution(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "pending", created.Status)
+	assert.Equal(t, "ORD-1", created.ReferenceNumber)
+	replayed, err := c.CreateExecution(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, replayed.ID)
+	executionID := created.ID
+
+	assert.NoError(t, c.RunExecution(ctx, executionID))
+	execution, err := c.GetExecution(ctx, executionID)
+	assert.NoError(t, err)
+	assert.Equal(t, workflow.WaitStatusWaiting, execution.Status)
+
+	assert.NoError(t, c.SignalExecution(ctx, executionID, "approved", map[string]string{"approver": "ops"}))
+	execution, err = c.GetExecution(ctx, executionID)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", execution.Status)
+
+	logs, err := c.GetExecutionLogs(ctx, executionID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, logs)
+
+	timeline, err := c.GetExecutionTimeline(ctx, executionID)
+	assert.NoError(t, err)
+	assert.Equal(t, executionID, timeline.ExecutionID)
+	assert.Equal(t, "completed", timeline.Status)
+
+	assert.NoError(t, c.RollbackExecution(ctx, executionID))
+}
+
+func TestClient_ListExecutions(t *testing.T) {
+	ctx := context.Background()
+	c := newTestServer(t)
+
+	start, err := c.CreateNode(ctx, NodeInput{Title: "Start", Type: workflow.NodeTypeStart})
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflowID, err := c.CreateWorkflow(ctx, WorkflowInput{Name: "orders", StartingNodeID: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var created []uuid.UUID
+	for i := 0; i < 5; i++ {
+		execution, err := c.CreateExecution(ctx, ExecutionInput{WorkflowID: workflowID, ReferenceNumber: fmt.Sprintf("ORD-%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, execution.ID)
+	}
+
+	// Pages of two are fetched until the server runs out of executions
+	executions, err := c.ListExecutions(ctx, workflow.ExecutionFilter{WorkflowID: workflowID, Limit: 2}).All()
+	assert.NoError(t, err)
+	var listed []uuid.UUID
+	for _, execution := range executions {
+		listed = append(listed, execution.ID)
+	}
+	assert.ElementsMatch(t, created, listed)
+
+	executions, err = c.ListExecutions(ctx, workflow.ExecutionFilter{ReferenceNumber: "ORD-3"}).All()
+	assert.NoError(t, err)
+	if assert.Len(t, executions, 1) {
+		assert.Equal(t, created[3], executions[0].ID)
+	}
+
+	workflows, err := c.ListWorkflows(ctx, workflow.WorkflowFilter{Name: "orders"}).All()
+	assert.NoError(t, err)
+	if assert.Len(t, workflows, 1) {
+		assert.Equal(t, workflowID, workflows[0].ID)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestServer(t)
+
+	_, err := c.GetWorkflow(ctx, uuid.New())
+	assert.True(t, errors.Is(err, workflow.ErrNotFound), "unexpected error: %v", err)
+
+	_, err = c.CreateNode(ctx, NodeInput{Title: "Loop", Type: "Loop"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	assert.Equal(t, CodeValidation, apiErr.Code)
+	assert.NotEmpty(t, apiErr.RequestID)
+	if assert.Len(t, apiErr.Fields, 1) {
+		assert.Equal(t, "type", apiErr.Fields[0].Field)
+	}
+	assert.True(t, errors.Is(err, workflow.ErrValidation))
+
+	unauthenticated := New(c.BaseURL, "")
+	_, err = unauthenticated.GetWorkflow(ctx, uuid.New())
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(resw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			resw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		resw.Header().Set("Content-Type", "application/json")
+		resw.Write([]byte(`{"id":"4a7f1a3e-6f0b-4a0e-8a43-3c3b1f0f2d55","name":"orders"}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, "key")
+	c.Retry = RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	wf, err := c.GetWorkflow(context.Background(), uuid.New())
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", wf.Name)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// POST requests without an idempotency key are sent once
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.CreateNode(context.Background(), NodeInput{Title: "Start", Type: workflow.NodeTypeStart})
+	var apiErr *Error
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// NodeInput is the body of CreateNode
+type NodeInput struct {
+	Title       string          `json:"title"`                 // Title of the node
+	Type        string          `json:"type"`                  // One of workflow.NodeTypes
+	Description string          `json:"description,omitempty"` // Description of the node
+	Config      json.RawMessage `json:"config,omitempty"`      // Type specific settings, e.g. workflow.WaitConfig of a Wait node
+}
+
+// TaskInput is the body of CreateTask
+type TaskInput struct {
+	Title      string `json:"title"`                 // Title of the task
+	Type       string `json:"type"`                  // Type of the task, e.g. API
+	HttpMethod string `json:"http_method"`           // Method of the call
+	Action     string `json:"action"`                // Absolute http or https URL called
+	Params     string `json:"params,omitempty"`      // JSON body of the call
+	MaxRetries int    `json:"max_retries,omitempty"` // Retries of a failed call, at most 100
+}
+
+// WorkflowInput is the body of CreateWorkflow
+type WorkflowInput struct {
+	Name            string    `json:"name"`                       // Name of the workflow; a workflow with the name of another is its next version
+	Description     string    `json:"description,omitempty"`      // Description of the workflow
+	StartingNodeID  uuid.UUID `json:"starting_node_id"`           // Node executions start at
+	UniqueReference bool      `json:"unique_reference,omitempty"` // Allow only one execution per reference number
+}
+
+func (c *Client) CreateNode(ctx context.Context, node NodeInput) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := c.post(ctx, "/workflow/node", node, &id)
+	return id, err
+}
+
+func (c *Client) GetNode(ctx context.Context, nodeID uuid.UUID) (workflow.Node, error) {
+	var node workflow.Node
+	err := c.get(ctx, "/workflow/node/"+nodeID.String(), nil, &node)
+	return node, err
+}
+
+// AddRelationship makes descendant a child of ancestor. The condition labels the edge, and
+// workflow.ConditionTimeout marks the branch a Wait node takes when it times out.
+func (c *Client) AddRelationship(ctx context.Context, ancestor, descendant uuid.UUID, condition string) (workflow.NodeClosure, error) {
+	var relationship workflow.NodeClosure
+	err := c.post(ctx, "/workflow/node/"+ancestor.String()+"/relationship", struct {
+		Ancestor   uuid.UUID `json:"ancestor"`
+		Descendant uuid.UUID `json:"descendant"`
+		Condition  string    `json:"condition,omitempty"`
+	}{ancestor, descendant, condition}, &relationship)
+	return relationship, err
+}
+
+func (c *Client) CreateTask(ctx context.Context, task TaskInput) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := c.post(ctx, "/workflow/task", task, &id)
+	return id, err
+}
+
+func (c *Client) GetTask(ctx context.Context, taskID uuid.UUID) (workflow.Task, error) {
+	var task workflow.Task
+	err := c.get(ctx, "/workflow/task/"+taskID.String(), nil, &task)
+	return task, err
+}
+
+// AddTaskToNode adds a task to a node, run in ascending order
+func (c *Client) AddTaskToNode(ctx context.Context, nodeID, taskID uuid.UUID, order int) (workflow.NodeTask, error) {
+	var nodeTask workflow.NodeTask
+	err := c.post(ctx, "/workflow/node/task", struct {
+		NodeID    uuid.UUID `json:"node_id"`
+		TaskID    uuid.UUID `json:"task_id"`
+		TaskOrder int       `json:"task_order"`
+	}{nodeID, taskID, order}, &nodeTask)
+	return nodeTask, err
+}
+
+func (c *Client) CreateWorkflow(ctx context.Context, wf WorkflowInput) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := c.post(ctx, "/workflow", wf, &id)
+	return id, err
+}
+
+func (c *Client) GetWorkflow(ctx context.Context, workflowID uuid.UUID) (workflow.Workflow, error) {
+	var wf workflow.Workflow
+	err := c.get(ctx, "/workflow/"+workflowID.String(), nil, &wf)
+	return wf, err
+}
+
+// ListWorkflows iterates over the workflows matching filter, newest first. Limit is the size
+// of the pages fetched and Offset the number of workflows skipped.
+func (c *Client) ListWorkflows(ctx context.Context, filter workflow.WorkflowFilter) *WorkflowIterator {
+	query := url.Values{}
+	if filter.Name != "" {
+		query.Set("name", filter.Name)
+	}
+	return &WorkflowIterator{pager: newPager(c, ctx, "/workflow", query, filter.Limit, filter.Offset)}
+}
+
+// GetWorkflowGraph returns the nodes and edges of a workflow, with the state of an execution
+// of it unless executionID is uuid.Nil
+func (c *Client) GetWorkflowGraph(ctx context.Context, workflowID, executionID uuid.UUID) (workflow.Graph, error) {
+	query := url.Values{}
+	if executionID != uuid.Nil {
+		query.Set("execution_id", executionID.String())
+	}
+	var graph workflow.Graph
+	err := c.get(ctx, "/workflow/"+workflowID.String()+"/graph", query, &graph)
+	return graph, err
+}
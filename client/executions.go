@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// ExecutionInput is the body of CreateExecution
+type ExecutionInput struct {
+	WorkflowID      uuid.UUID       `json:"workflow_id"`                // Workflow to execute
+	ReferenceNumber string          `json:"reference_number,omitempty"` // Reference of the execution, e.g. an order ID
+	Data            json.RawMessage `json:"data,omitempty"`             // Input data, a JSON object
+	IdempotencyKey  string          `json:"-"`                          // Retries with the same key get the execution created first; also makes the request retryable
+}
+
+// CreateExecution creates a pending execution of a workflow, run with RunExecution. With an
+// IdempotencyKey, a request repeating an earlier one returns the execution it created.
+func (c *Client) CreateExecution(ctx context.Context, execution ExecutionInput) (workflow.WorkflowExecution, error) {
+	header := http.Header{}
+	if execution.IdempotencyKey != "" {
+		header.Set("Idempotency-Key", execution.IdempotencyKey)
+	}
+
+	var created workflow.WorkflowExecution
+	_, err := c.do(ctx, call{method: http.MethodPost, path: "/workflow/execution", body: execution, header: header}, &created)
+	return created, err
+}
+
+// GetExecution returns an execution with the child executions started by its SubWorkflow nodes
+func (c *Client) GetExecution(ctx context.Context, executionID uuid.UUID) (workflow.ExecutionTree, error) {
+	var tree workflow.ExecutionTree
+	err := c.get(ctx, "/workflow/execution/"+executionID.String(), nil, &tree)
+	return tree, err
+}
+
+// ListExecutions iterates over the executions matching filter, newest first. Limit is the size
+// of the pages fetched and Offset the number of executions skipped.
+func (c *Client) ListExecutions(ctx context.Context, filter workflow.ExecutionFilter) *ExecutionIterator {
+	query := url.Values{}
+	if filter.WorkflowID != uuid.Nil {
+		query.Set("workflow_id", filter.WorkflowID.String())
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	if filter.ReferenceNumber != "" {
+		query.Set("reference_number", filter.ReferenceNumber)
+	}
+	return &ExecutionIterator{pager: newPager(c, ctx, "/workflow/execution", query, filter.Limit, filter.Offset)}
+}
+
+// ExecuteWorkflow runs a workflow from its starting node without an execution record
+func (c *Client) ExecuteWorkflow(ctx context.Context, workflowID uuid.UUID) error {
+	return c.post(ctx, "/workflow/"+workflowID.String()+"/execute", nil, nil)
+}
+
+// RunExecution runs a pending execution; executions in any other status are refused with
+// ErrInvalidTransition. It returns once the execution completed, failed or parked on a Wait
+// or Timer node.
+func (c *Client) RunExecution(ctx context.Context, executionID uuid.UUID) error {
+	return c.post(ctx, "/workflow/execution/"+executionID.String()+"/execute", nil, nil)
+}
+
+// RollbackExecution rolls back the completed nodes of an execution
+func (c *Client) RollbackExecution(ctx context.Context, executionID uuid.UUID) error {
+	return c.post(ctx, "/workflow/execution/"+executionID.String()+"/rollback", nil, nil)
+}
+
+// CancelExecution cancels a pending or waiting execution, with the waits, timers and child
+// executions it is parked on
+func (c *Client) CancelExecution(ctx context.Context, executionID uuid.UUID) error {
+	return c.post(ctx, "/workflow/execution/"+executionID.String()+"/cancel", nil, nil)
+}
+
+// ResumeExecution fires the pending timers of an execution now instead of at their fire time
+// and resumes the execution after them. Executions without a pending timer are refused with
+// ErrInvalidTransition; waits are resumed with SignalExecution.
+func (c *Client) ResumeExecution(ctx context.Context, executionID uuid.UUID) error {
+	return c.post(ctx, "/workflow/execution/"+executionID.String()+"/resume", nil, nil)
+}
+
+// SignalExecution resumes an execution waiting for the signal. The payload, a JSON object or
+// a value encoding to one, is merged into the execution data; nil sends none.
+func (c *Client) SignalExecution(ctx context.Context, executionID uuid.UUID, signal string, payload interface{}) error {
+	return c.post(ctx, "/workflow/execution/"+executionID.String()+"/signal/"+url.PathEscape(signal), payload, nil)
+}
+
+// GetExecutionLogs returns the log entries of an execution, oldest first
+func (c *Client) GetExecutionLogs(ctx context.Context, executionID uuid.UUID) ([]workflow.WorkflowLog, error) {
+	var logs []workflow.WorkflowLog
+	err := c.get(ctx, "/workflow/execution/"+executionID.String()+"/logs", nil, &logs)
+	return logs, err
+}
+
+// GetExecutionTimeline returns the nodes, tasks and attempts of an execution over time
+func (c *Client) GetExecutionTimeline(ctx context.Context, executionID uuid.UUID) (workflow.Timeline, error) {
+	var timeline workflow.Timeline
+	err := c.get(ctx, "/workflow/execution/"+executionID.String()+"/timeline", nil, &timeline)
+	return timeline, err
+}
+
+// ListTimers returns the timers with status, of one execution unless executionID is
+// uuid.Nil. An empty status lists pending timers.
+func (c *Client) ListTimers(ctx context.Context, executionID uuid.UUID, status string) ([]workflow.Timer, error) {
+	query := url.Values{}
+	if executionID != uuid.Nil {
+		query.Set("execution_id", executionID.String())
+	}
+	if status != "" {
+		query.Set("status", status)
+	}
+	var timers []workflow.Timer
+	err := c.get(ctx, "/workflow/timer", query, &timers)
+	return timers, err
+}
+
+func (c *Client) GetTimer(ctx context.Context, timerID uuid.UUID) (workflow.Timer, error) {
+	var timer workflow.Timer
+	err := c.get(ctx, "/workflow/timer/"+timerID.String(), nil, &timer)
+	return timer, err
+}
+
+// CancelTimer cancels a pending timer. Its branch ends there, and the execution is cancelled
+// when nothing else of it is parked.
+func (c *Client) CancelTimer(ctx context.Context, timerID uuid.UUID) error {
+	return c.delete(ctx, "/workflow/timer/"+timerID.String())
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/kadzany/frosty/workflow"
+)
+
+// maxPageSize is the largest page the server returns
+const maxPageSize = 1000
+
+// pager fetches the pages of a list route, newest rows first. Rows created while iterating
+// shift the pages, so a row may be returned twice.
+type pager struct {
+	client *Client
+	ctx    context.Context
+	path   string
+	query  url.Values
+	limit  int
+	offset int
+	done   bool
+	err    error
+}
+
+func newPager(c *Client, ctx context.Context, path string, query url.Values, limit, offset int) pager {
+	if limit <= 0 {
+		limit = workflow.DefaultListLimit
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return pager{client: c, ctx: ctx, path: path, query: query, limit: limit, offset: offset}
+}
+
+// fetch decodes the next page into page, a pointer to a slice whose length is given by size,
+// and returns whether it has rows
+func (p *pager) fetch(page interface{}, size func() int) bool {
+	if p.done || p.err != nil {
+		return false
+	}
+
+	query := url.Values{}
+	for name, values := range p.query {
+		query[name] = values
+	}
+	query.Set("limit", strconv.Itoa(p.limit))
+	query.Set("offset", strconv.Itoa(p.offset))
+	if p.err = p.client.get(p.ctx, p.path, query, page); p.err != nil {
+		return false
+	}
+
+	n := size()
+	p.offset += n
+	p.done = n < p.limit
+	return n > 0
+}
+
+// Err returns the error that ended the iteration, nil when every page was read
+func (p *pager) Err() error {
+	return p.err
+}
+
+// WorkflowIterator iterates over workflows, fetching a page at a time:
+//
+//	it := c.ListWorkflows(ctx, workflow.WorkflowFilter{Name: "checkout"})
+//	for it.Next() {
+//		wf := it.Workflow()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type WorkflowIterator struct {
+	pager
+	page    []workflow.Workflow
+	current workflow.Workflow
+}
+
+// Next advances to the next workflow and returns false when there is none or a page failed
+func (it *WorkflowIterator) Next() bool {
+	if len(it.page) == 0 && !it.fetch(&it.page, func() int { return len(it.page) }) {
+		return false
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Workflow returns the workflow Next advanced to
+func (it *WorkflowIterator) Workflow() workflow.Workflow {
+	return it.current
+}
+
+// All returns the remaining workflows
+func (it *WorkflowIterator) All() ([]workflow.Workflow, error) {
+	workflows := []workflow.Workflow{}
+	for it.Next() {
+		workflows = append(workflows, it.current)
+	}
+	return workflows, it.Err()
+}
+
+// ExecutionIterator iterates over executions, fetching a page at a time, see WorkflowIterator
+type ExecutionIterator struct {
+	pager
+	page    []workflow.WorkflowExecution
+	current workflow.WorkflowExecution
+}
+
+// Next advances to the next execution and returns false when there is none or a page failed
+func (it *ExecutionIterator) Next() bool {
+	if len(it.page) == 0 && !it.fetch(&it.page, func() int { return len(it.page) }) {
+		return false
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Execution returns the execution Next advanced to
+func (it *ExecutionIterator) Execution() workflow.WorkflowExecution {
+	return it.current
+}
+
+// All returns the remaining executions
+func (it *ExecutionIterator) All() ([]workflow.WorkflowExecution, error) {
+	executions := []workflow.WorkflowExecution{}
+	for it.Next() {
+		executions = append(executions, it.current)
+	}
+	return executions, it.Err()
+}
+
+// AuditIterator iterates over audit entries, fetching a page at a time, see WorkflowIterator
+type AuditIterator struct {
+	pager
+	page    []workflow.AuditEntry
+	current workflow.AuditEntry
+}
+
+// Next advances to the next entry and returns false when there is none or a page failed
+func (it *AuditIterator) Next() bool {
+	if len(it.page) == 0 && !it.fetch(&it.page, func() int { return len(it.page) }) {
+		return false
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Entry returns the entry Next advanced to
+func (it *AuditIterator) Entry() workflow.AuditEntry {
+	return it.current
+}
+
+// All returns the remaining entries
+func (it *AuditIterator) All() ([]workflow.AuditEntry, error) {
+	entries := []workflow.AuditEntry{}
+	for it.Next() {
+		entries = append(entries, it.current)
+	}
+	return entries, it.Err()
+}
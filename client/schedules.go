@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// ScheduleInput is the body of CreateSchedule and UpdateSchedule. Fields left nil keep their
+// current value on update.
+type ScheduleInput struct {
+	WorkflowID        *uuid.UUID `json:"workflow_id,omitempty"`        // Workflow to execute
+	CronExpression    *string    `json:"cron_expression,omitempty"`    // Standard 5 field cron expression
+	IntervalSeconds   *int       `json:"interval_seconds,omitempty"`   // Fixed interval between runs, instead of a cron expression
+	Timezone          *string    `json:"timezone,omitempty"`           // IANA timezone the cron expression is evaluated in
+	PayloadTemplate   *string    `json:"payload_template,omitempty"`   // text/template rendering the execution data
+	ReferenceTemplate *string    `json:"reference_template,omitempty"` // text/template rendering the execution reference number
+	MisfirePolicy     *string    `json:"misfire_policy,omitempty"`     // skip or catch_up
+	Enabled           *bool      `json:"enabled,omitempty"`            // Disabled schedules never fire
+}
+
+func (c *Client) CreateSchedule(ctx context.Context, schedule ScheduleInput) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := c.post(ctx, "/workflow/schedule", schedule, &id)
+	return id, err
+}
+
+// ListSchedules returns the schedules of a workflow, or every schedule when workflowID is uuid.Nil
+func (c *Client) ListSchedules(ctx context.Context, workflowID uuid.UUID) ([]workflow.Schedule, error) {
+	query := url.Values{}
+	if workflowID != uuid.Nil {
+		query.Set("workflow_id", workflowID.String())
+	}
+	var schedules []workflow.Schedule
+	err := c.get(ctx, "/workflow/schedule", query, &schedules)
+	return schedules, err
+}
+
+func (c *Client) GetSchedule(ctx context.Context, scheduleID uuid.UUID) (workflow.Schedule, error) {
+	var schedule workflow.Schedule
+	err := c.get(ctx, "/workflow/schedule/"+scheduleID.String(), nil, &schedule)
+	return schedule, err
+}
+
+func (c *Client) UpdateSchedule(ctx context.Context, scheduleID uuid.UUID, changes ScheduleInput) (workflow.Schedule, error) {
+	var schedule workflow.Schedule
+	err := c.put(ctx, "/workflow/schedule/"+scheduleID.String(), changes, &schedule)
+	return schedule, err
+}
+
+func (c *Client) DeleteSchedule(ctx context.Context, scheduleID uuid.UUID) error {
+	return c.delete(ctx, "/workflow/schedule/"+scheduleID.String())
+}
@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/client"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// finishedStatuses are the statuses an execution does not leave on its own
+var finishedStatuses = []string{"completed", "error", "cancelled", "rolled_back"}
+
+func (c *cli) apply(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	file := flags.String("f", "", "definition file")
+	if _, err := parseArgs(flags, args, 0); err != nil || *file == "" {
+		return errUsage
+	}
+
+	def, err := readDefinition(*file)
+	if err != nil {
+		return err
+	}
+	workflowID, err := applyDefinition(c.ctx, c.client, def)
+	if err != nil {
+		return err
+	}
+	wf, err := c.client.GetWorkflow(c.ctx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(wf)
+	}
+	fmt.Fprintf(c.out, "created workflow %s version %d (%s)\n", wf.Name, wf.Version, wf.ID)
+	return nil
+}
+
+func (c *cli) export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	file := flags.String("f", "", "file to write, standard output when empty")
+	rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	workflowID, err := parseID("workflow", rest[0])
+	if err != nil {
+		return err
+	}
+
+	def, err := exportDefinition(c.ctx, c.client, workflowID)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(def, "", "  ")
+	if err != nil {
+		return err
+	}
+	encoded = append(encoded, '\n')
+
+	if *file == "" || *file == "-" {
+		_, err = c.out.Write(encoded)
+		return err
+	}
+	return os.WriteFile(*file, encoded, 0o644)
+}
+
+func (c *cli) validate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	file := flags.String("f", "", "definition file")
+	if _, err := parseArgs(flags, args, 0); err != nil || *file == "" {
+		return errUsage
+	}
+
+	def, err := readDefinition(*file)
+	if err != nil {
+		return err
+	}
+	problems := def.Validate()
+
+	if c.json {
+		if err := c.printJSON(struct {
+			Valid    bool     `json:"valid"`
+			Problems []string `json:"problems"`
+		}{len(problems) == 0, append([]string{}, problems...)}); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range problems {
+			fmt.Fprintln(c.out, problem)
+		}
+		if len(problems) == 0 {
+			fmt.Fprintf(c.out, "%s is valid: workflow %s with %d nodes and %d edges\n", *file, def.Name, len(def.Nodes), len(def.Edges))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is invalid: %d problems", *file, len(problems))
+	}
+	return nil
+}
+
+func (c *cli) list(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "workflows":
+		return c.listWorkflows(args[1:])
+	case "executions":
+		return c.listExecutions(args[1:])
+	}
+	return errUsage
+}
+
+func (c *cli) listWorkflows(args []string) error {
+	flags := flag.NewFlagSet("list workflows", flag.ContinueOnError)
+	name := flags.String("name", "", "only versions of the workflow with this name")
+	limit := flags.Int("limit", 50, "most workflows listed")
+	if _, err := parseArgs(flags, args, 0); err != nil || *limit < 1 {
+		return errUsage
+	}
+
+	it := c.client.ListWorkflows(c.ctx, workflow.WorkflowFilter{Name: *name, Limit: *limit})
+	workflows := []workflow.Workflow{}
+	for len(workflows) < *limit && it.Next() {
+		workflows = append(workflows, it.Workflow())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(workflows)
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tNAME\tVERSION\tCREATED AT")
+	for _, wf := range workflows {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", wf.ID, wf.Name, wf.Version, formatTime(wf.CreatedAt))
+	}
+	return w.Flush()
+}
+
+func (c *cli) listExecutions(args []string) error {
+	flags := flag.NewFlagSet("list executions", flag.ContinueOnError)
+	workflowID := flags.String("workflow", "", "only executions of this workflow")
+	status := flags.String("status", "", "only executions with this status")
+	reference := flags.String("reference", "", "only executions with this reference number")
+	limit := flags.Int("limit", 50, "most executions listed")
+	if _, err := parseArgs(flags, args, 0); err != nil || *limit < 1 {
+		return errUsage
+	}
+
+	filter := workflow.ExecutionFilter{Status: *status, ReferenceNumber: *reference, Limit: *limit}
+	if *workflowID != "" {
+		var err error
+		if filter.WorkflowID, err = parseID("workflow", *workflowID); err != nil {
+			return err
+		}
+	}
+
+	it := c.client.ListExecutions(c.ctx, filter)
+	executions := []workflow.WorkflowExecution{}
+	for len(executions) < *limit && it.Next() {
+		executions = append(executions, it.Execution())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(executions)
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tWORKFLOW\tREFERENCE\tSTATUS\tCREATED AT\tUPDATED AT")
+	for _, execution := range executions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", execution.ID, execution.WorkflowID, orDash(execution.ReferenceNumber), execution.Status,
+			formatTime(&execution.CreatedAt), formatTime(&execution.UpdatedAt))
+	}
+	return w.Flush()
+}
+
+func (c *cli) describe(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "workflow":
+		return c.describeWorkflow(args[1:])
+	case "execution":
+		return c.describeExecution(args[1:])
+	}
+	return errUsage
+}
+
+func (c *cli) describeWorkflow(args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("describe workflow", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	workflowID, err := parseID("workflow", rest[0])
+	if err != nil {
+		return err
+	}
+
+	wf, err := c.client.GetWorkflow(c.ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	graph, err := c.client.GetWorkflowGraph(c.ctx, workflowID, uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(struct {
+			Workflow workflow.Workflow `json:"workflow"`
+			Graph    workflow.Graph    `json:"graph"`
+		}{wf, graph})
+	}
+
+	w := c.table()
+	fmt.Fprintf(w, "ID:\t%s\n", wf.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", wf.Name)
+	fmt.Fprintf(w, "Version:\t%d\n", wf.Version)
+	fmt.Fprintf(w, "Description:\t%s\n", orDash(wf.Description))
+	fmt.Fprintf(w, "Unique reference:\t%t\n", wf.UniqueReference)
+	fmt.Fprintf(w, "Tenant:\t%s\n", orDash(wf.TenantID))
+	fmt.Fprintf(w, "Created at:\t%s\n", formatTime(wf.CreatedAt))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return c.printGraph(graph, false)
+}
+
+func (c *cli) describeExecution(args []string) error {
+	rest, err := parseArgs(flag.NewFlagSet("describe execution", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	executionID, err := parseID("execution", rest[0])
+	if err != nil {
+		return err
+	}
+
+	tree, err := c.client.GetExecution(c.ctx, executionID)
+	if err != nil {
+		return err
+	}
+	graph, err := c.client.GetWorkflowGraph(c.ctx, tree.WorkflowID, executionID)
+	if err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(struct {
+			Execution workflow.ExecutionTree `json:"execution"`
+			Graph     workflow.Graph         `json:"graph"`
+		}{tree, graph})
+	}
+
+	w := c.table()
+	fmt.Fprintf(w, "ID:\t%s\n", tree.ID)
+	fmt.Fprintf(w, "Workflow:\t%s (%s)\n", graph.Name, tree.WorkflowID)
+	fmt.Fprintf(w, "Reference:\t%s\n", orDash(tree.ReferenceNumber))
+	fmt.Fprintf(w, "Status:\t%s\n", tree.Status)
+	fmt.Fprintf(w, "Message:\t%s\n", orDash(tree.Message))
+	if tree.ParentExecutionID != nil {
+		fmt.Fprintf(w, "Parent execution:\t%s\n", tree.ParentExecutionID)
+	}
+	fmt.Fprintf(w, "Created at:\t%s\n", formatTime(&tree.CreatedAt))
+	fmt.Fprintf(w, "Updated at:\t%s\n", formatTime(&tree.UpdatedAt))
+	fmt.Fprintf(w, "Data:\t%s\n", orDash(string(tree.Data)))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := c.printGraph(graph, true); err != nil {
+		return err
+	}
+
+	if len(tree.Children) == 0 {
+		return nil
+	}
+	fmt.Fprintln(c.out)
+	w = c.table()
+	fmt.Fprintln(w, "CHILD EXECUTION\tWORKFLOW\tREFERENCE\tSTATUS")
+	for _, child := range tree.Children {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", child.ID, child.WorkflowID, orDash(child.ReferenceNumber), child.Status)
+	}
+	return w.Flush()
+}
+
+// printGraph prints the nodes and edges of a workflow, with the outcome of every node when
+// the graph is of an execution
+func (c *cli) printGraph(graph workflow.Graph, outcomes bool) error {
+	titles := make(map[uuid.UUID]string)
+	for _, node := range graph.Nodes {
+		titles[node.ID] = node.Title
+	}
+
+	fmt.Fprintln(c.out)
+	w := c.table()
+	if outcomes {
+		fmt.Fprintln(w, "NODE\tTYPE\tTASKS\tOUTCOME")
+	} else {
+		fmt.Fprintln(w, "NODE\tTYPE\tTASKS")
+	}
+	for _, node := range graph.Nodes {
+		var tasks []string
+		for _, task := range node.Tasks {
+			tasks = append(tasks, task.Title)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s", node.Title, node.Type, orDash(strings.Join(tasks, ", ")))
+		if outcomes {
+			fmt.Fprintf(w, "\t%s", node.Outcome)
+		}
+		fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(graph.Edges) == 0 {
+		return nil
+	}
+	fmt.Fprintln(c.out)
+	w = c.table()
+	fmt.Fprintln(w, "FROM\tTO\tCONDITION")
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", titles[edge.From], titles[edge.To], orDash(edge.Condition))
+	}
+	return w.Flush()
+}
+
+func (c *cli) start(args []string) error {
+	flags := flag.NewFlagSet("start", flag.ContinueOnError)
+	reference := flags.String("reference", "", "reference number of the execution")
+	data := flags.String("data", "", "input data, a JSON object")
+	key := flags.String("idempotency-key", "", "key making retries return the execution created first")
+	noRun := flags.Bool("no-run", false, "only create the execution, leaving it pending")
+	rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	workflowID, err := parseID("workflow", rest[0])
+	if err != nil {
+		return err
+	}
+	if *data != "" && !json.Valid([]byte(*data)) {
+		return fmt.Errorf("--data must be valid JSON")
+	}
+
+	input := client.ExecutionInput{WorkflowID: workflowID, ReferenceNumber: *reference, IdempotencyKey: *key}
+	if *data != "" {
+		input.Data = json.RawMessage(*data)
+	}
+	execution, err := c.client.CreateExecution(c.ctx, input)
+	if err != nil {
+		return err
+	}
+	if !*noRun {
+		if err := c.client.RunExecution(c.ctx, execution.ID); err != nil {
+			return fmt.Errorf("execution %s was created but did not run: %w", execution.ID, err)
+		}
+	}
+	return c.printExecution(execution.ID)
+}
+
+// runExecution runs a pending execution. Stopped executions are not run again, that would
+// start them over from the starting node.
+func (c *cli) runExecution(args []string) error {
+	return c.executionAction("run", args, c.client.RunExecution)
+}
+
+// resume fires the pending timers of a parked execution now. Waits are resumed with signal.
+func (c *cli) resume(args []string) error {
+	return c.executionAction("resume", args, c.client.ResumeExecution)
+}
+
+func (c *cli) cancel(args []string) error {
+	return c.executionAction("cancel", args, c.client.CancelExecution)
+}
+
+func (c *cli) rollback(args []string) error {
+	return c.executionAction("rollback", args, c.client.RollbackExecution)
+}
+
+func (c *cli) signal(args []string) error {
+	flags := flag.NewFlagSet("signal", flag.ContinueOnError)
+	data := flags.String("data", "", "payload merged into the execution data, a JSON object")
+	rest, err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+	executionID, err := parseID("execution", rest[0])
+	if err != nil {
+		return err
+	}
+
+	var payload interface{}
+	if *data != "" {
+		if !json.Valid([]byte(*data)) {
+			return fmt.Errorf("--data must be valid JSON")
+		}
+		payload = json.RawMessage(*data)
+	}
+	if err := c.client.SignalExecution(c.ctx, executionID, rest[1], payload); err != nil {
+		return err
+	}
+	return c.printExecution(executionID)
+}
+
+// executionAction runs an action taking nothing but the ID of an execution, then prints the
+// execution
+func (c *cli) executionAction(name string, args []string, action func(ctx context.Context, executionID uuid.UUID) error) error {
+	rest, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	executionID, err := parseID("execution", rest[0])
+	if err != nil {
+		return err
+	}
+	if err := action(c.ctx, executionID); err != nil {
+		return err
+	}
+	return c.printExecution(executionID)
+}
+
+// printExecution prints the current state of an execution
+func (c *cli) printExecution(executionID uuid.UUID) error {
+	tree, err := c.client.GetExecution(c.ctx, executionID)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(tree.WorkflowExecution)
+	}
+	w := c.table()
+	fmt.Fprintln(w, "ID\tWORKFLOW\tREFERENCE\tSTATUS\tMESSAGE")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", tree.ID, tree.WorkflowID, orDash(tree.ReferenceNumber), tree.Status, orDash(tree.Message))
+	return w.Flush()
+}
+
+// tail prints the log entries of an execution as they are written, until the execution
+// finishes or the command is interrupted
+func (c *cli) tail(args []string) error {
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	interval := flags.Duration("interval", time.Second, "time between polls")
+	rest, err := parseArgs(flags, args, 1)
+	if err != nil || *interval <= 0 {
+		return errUsage
+	}
+	executionID, err := parseID("execution", rest[0])
+	if err != nil {
+		return err
+	}
+
+	execution, err := c.client.GetExecution(c.ctx, executionID)
+	if err != nil {
+		return err
+	}
+
+	// Titles of the nodes and tasks the entries refer to, IDs are printed when unknown
+	titles := make(map[uuid.UUID]string)
+	if graph, err := c.client.GetWorkflowGraph(c.ctx, execution.WorkflowID, uuid.Nil); err == nil {
+		for _, node := range graph.Nodes {
+			titles[node.ID] = node.Title
+			for _, task := range node.Tasks {
+				titles[task.ID] = task.Title
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(c.out)
+	seen := make(map[uuid.UUID]bool)
+	for {
+		// The status is read first so every entry written before it finished is printed
+		finished := contains(finishedStatuses, execution.Status)
+		logs, err := c.client.GetExecutionLogs(c.ctx, executionID)
+		if err != nil {
+			return err
+		}
+		for _, entry := range logs {
+			if seen[entry.ID] {
+				continue
+			}
+			seen[entry.ID] = true
+			if c.json {
+				if err := encoder.Encode(entry); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintln(c.out, formatLogEntry(entry, titles))
+		}
+
+		if finished {
+			if !c.json {
+				fmt.Fprintf(c.out, "execution %s %s\n", executionID, execution.Status)
+			}
+			return nil
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+		tree, err := c.client.GetExecution(c.ctx, executionID)
+		if err != nil {
+			return err
+		}
+		execution = tree
+	}
+}
+
+// formatLogEntry renders a log entry on one line: time, action, status, node or task, message
+func formatLogEntry(entry workflow.WorkflowLog, titles map[uuid.UUID]string) string {
+	subject := "-"
+	title := func(id uuid.UUID) string {
+		if t, ok := titles[id]; ok {
+			return t
+		}
+		return id.String()
+	}
+	switch {
+	case entry.TaskID != nil:
+		subject = "task " + title(*entry.TaskID)
+		if entry.Attempt != nil {
+			subject += fmt.Sprintf(" (attempt %d)", *entry.Attempt)
+		}
+	case entry.NodeID != nil:
+		subject = "node " + title(*entry.NodeID)
+	}
+
+	line := fmt.Sprintf("%s  %-9s  %-11s  %-24s  %s", entry.ExecutedAt.Local().Format(time.RFC3339), entry.ActionType, entry.Status, subject, entry.Message)
+	if entry.ErrorMessage.Valid && entry.ErrorMessage.String != "" {
+		line += ": " + entry.ErrorMessage.String
+	}
+	return line
+}
+
+func (c *cli) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+}
+
+func (c *cli) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func parseID(kind, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid %s id %q", kind, value)
+	}
+	return id, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/client"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// Definition is a workflow as written in a definition file: its nodes, their tasks and the
+// edges between them, with nodes referring to each other by key instead of ID
+type Definition struct {
+	Name            string           `json:"name"`                       // Name of the workflow; applying it again creates the next version
+	Description     string           `json:"description,omitempty"`      // Description of the workflow
+	UniqueReference bool             `json:"unique_reference,omitempty"` // Allow only one execution per reference number
+	Start           string           `json:"start"`                      // Key of the node executions start at
+	Nodes           []NodeDefinition `json:"nodes"`                      // Nodes of the workflow
+	Edges           []EdgeDefinition `json:"edges"`                      // Direct relationships between the nodes
+}
+
+type NodeDefinition struct {
+	Key         string           `json:"key"`                   // Name the edges and start refer to the node by, unique within the file
+	Title       string           `json:"title"`                 // Title of the node
+	Type        string           `json:"type"`                  // One of workflow.NodeTypes
+	Description string           `json:"description,omitempty"` // Description of the node
+	Config      json.RawMessage  `json:"config,omitempty"`      // Type specific settings, e.g. the signal of a Wait node
+	Tasks       []TaskDefinition `json:"tasks,omitempty"`       // Tasks of the node in execution order
+}
+
+type TaskDefinition struct {
+	Title      string `json:"title"`                 // Title of the task
+	Type       string `json:"type"`                  // Type of the task, e.g. API
+	HttpMethod string `json:"http_method"`           // Method of the call
+	Action     string `json:"action"`                // Absolute http or https URL called
+	Params     string `json:"params,omitempty"`      // JSON body of the call
+	MaxRetries int    `json:"max_retries,omitempty"` // Retries of a failed call, at most 100
+}
+
+type EdgeDefinition struct {
+	From      string `json:"from"`                // Key of the ancestor node
+	To        string `json:"to"`                  // Key of the descendant node
+	Condition string `json:"condition,omitempty"` // Condition of the relationship, e.g. timeout, or a template Decision nodes evaluate
+}
+
+// Limits enforced by the server, checked offline so a definition does not fail half applied
+const (
+	maxTitleLength = 255
+	maxTypeLength  = 50
+	maxTaskRetries = 100
+)
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// readDefinition reads a definition file, or standard input when path is -
+func readDefinition(path string) (Definition, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return Definition{}, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var def Definition
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&def); err != nil {
+		return Definition{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return def, nil
+}
+
+// Validate checks the definition without a server, returning every problem found
+func (d Definition) Validate() []string {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(d.Name) == "" {
+		problem("name is required")
+	} else if len(d.Name) > maxTitleLength {
+		problem("name cannot be longer than %d characters", maxTitleLength)
+	}
+	if len(d.Nodes) == 0 {
+		problem("nodes are required")
+	}
+
+	nodes := make(map[string]bool)
+	for i, node := range d.Nodes {
+		name := fmt.Sprintf("nodes[%d]", i)
+		if node.Key == "" {
+			problem("%s: key is required", name)
+		} else if nodes[node.Key] {
+			problem("%s: key %q is used by another node", name, node.Key)
+		} else {
+			name = fmt.Sprintf("node %q", node.Key)
+		}
+		nodes[node.Key] = true
+
+		if strings.TrimSpace(node.Title) == "" {
+			problem("%s: title is required", name)
+		} else if len(node.Title) > maxTitleLength {
+			problem("%s: title cannot be longer than %d characters", name, maxTitleLength)
+		}
+		if !contains(workflow.NodeTypes, node.Type) {
+			problem("%s: type must be one of %s", name, strings.Join(workflow.NodeTypes, ", "))
+		} else if err := workflow.ValidateNodeConfig(workflow.Node{Type: node.Type, Config: node.Config}); err != nil {
+			problem("%s: %v", name, err)
+		}
+
+		for j, task := range node.Tasks {
+			for _, p := range task.validate() {
+				problem("%s: tasks[%d]: %s", name, j, p)
+			}
+		}
+	}
+
+	if d.Start == "" {
+		problem("start is required")
+	} else if !nodes[d.Start] {
+		problem("start %q is not a node", d.Start)
+	}
+
+	edges := make(map[[2]string]bool)
+	for i, edge := range d.Edges {
+		name := fmt.Sprintf("edges[%d]", i)
+		if !nodes[edge.From] {
+			problem("%s: from %q is not a node", name, edge.From)
+		}
+		if !nodes[edge.To] {
+			problem("%s: to %q is not a node", name, edge.To)
+		}
+		if edge.From == edge.To {
+			problem("%s: a node cannot descend from itself", name)
+		}
+		if edges[[2]string{edge.From, edge.To}] {
+			problem("%s: %s -> %s is listed twice", name, edge.From, edge.To)
+		}
+		edges[[2]string{edge.From, edge.To}] = true
+		if len(edge.Condition) > maxTitleLength {
+			problem("%s: condition cannot be longer than %d characters", name, maxTitleLength)
+		}
+		if err := workflow.ValidateBranchCondition(edge.Condition); err != nil {
+			problem("%s: %v", name, err)
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	order, err := d.order()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	// Nodes the starting node does not lead to would never run
+	reachable := map[string]bool{d.Start: true}
+	for _, key := range order {
+		for _, edge := range d.Edges {
+			if edge.From == key && reachable[key] {
+				reachable[edge.To] = true
+			}
+		}
+	}
+	for _, node := range d.Nodes {
+		if !reachable[node.Key] {
+			problem("node %q cannot be reached from start %q", node.Key, d.Start)
+		}
+	}
+	return problems
+}
+
+func (t TaskDefinition) validate() []string {
+	var problems []string
+	if strings.TrimSpace(t.Title) == "" {
+		problems = append(problems, "title is required")
+	} else if len(t.Title) > maxTitleLength {
+		problems = append(problems, fmt.Sprintf("title cannot be longer than %d characters", maxTitleLength))
+	}
+	if strings.TrimSpace(t.Type) == "" {
+		problems = append(problems, "type is required")
+	} else if len(t.Type) > maxTypeLength {
+		problems = append(problems, fmt.Sprintf("type cannot be longer than %d characters", maxTypeLength))
+	}
+	if !contains(httpMethods, strings.ToUpper(t.HttpMethod)) {
+		problems = append(problems, "http_method must be one of "+strings.Join(httpMethods, ", "))
+	}
+	if u, err := url.Parse(t.Action); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "action must be an absolute http or https URL")
+	}
+	if t.Params != "" && !json.Valid([]byte(t.Params)) {
+		problems = append(problems, "params must be valid JSON")
+	}
+	if t.MaxRetries < 0 || t.MaxRetries > maxTaskRetries {
+		problems = append(problems, fmt.Sprintf("max_retries must be between 0 and %d", maxTaskRetries))
+	}
+	return problems
+}
+
+// order returns the node keys so that every node comes after the nodes leading to it, or an
+// error naming a node on a cycle
+func (d Definition) order() ([]string, error) {
+	incoming := make(map[string]int)
+	for _, edge := range d.Edges {
+		incoming[edge.To]++
+	}
+
+	var order, ready []string
+	for _, node := range d.Nodes {
+		if incoming[node.Key] == 0 {
+			ready = append(ready, node.Key)
+		}
+	}
+	for len(ready) > 0 {
+		key := ready[0]
+		ready = ready[1:]
+		order = append(order, key)
+		for _, edge := range d.Edges {
+			if edge.From != key {
+				continue
+			}
+			if incoming[edge.To]--; incoming[edge.To] == 0 {
+				ready = append(ready, edge.To)
+			}
+		}
+	}
+
+	if len(order) < len(d.Nodes) {
+		for _, node := range d.Nodes {
+			if incoming[node.Key] > 0 {
+				return nil, fmt.Errorf("node %q is part of a cycle", node.Key)
+			}
+		}
+	}
+	return order, nil
+}
+
+// applyDefinition creates the tasks, nodes and relationships of a definition and then the
+// workflow, the next version of any workflow with the same name. Nothing is rolled back when
+// a step fails; the workflow is only created once everything else was.
+func applyDefinition(ctx context.Context, c *client.Client, def Definition) (uuid.UUID, error) {
+	if problems := def.Validate(); len(problems) > 0 {
+		return uuid.Nil, fmt.Errorf("invalid definition: %s", strings.Join(problems, "; "))
+	}
+
+	ids := make(map[string]uuid.UUID)
+	for _, node := range def.Nodes {
+		nodeID, err := c.CreateNode(ctx, client.NodeInput{Title: node.Title, Type: node.Type, Description: node.Description, Config: node.Config})
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("failed to create node %q: %w", node.Key, err)
+		}
+		ids[node.Key] = nodeID
+
+		for i, task := range node.Tasks {
+			taskID, err := c.CreateTask(ctx, client.TaskInput{
+				Title: task.Title, Type: task.Type, HttpMethod: strings.ToUpper(task.HttpMethod), Action: task.Action, Params: task.Params, MaxRetries: task.MaxRetries,
+			})
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("failed to create task %q of node %q: %w", task.Title, node.Key, err)
+			}
+			if _, err := c.AddTaskToNode(ctx, nodeID, taskID, i+1); err != nil {
+				return uuid.Nil, fmt.Errorf("failed to add task %q to node %q: %w", task.Title, node.Key, err)
+			}
+		}
+	}
+
+	// A relationship links the descendant to the ancestors known so far, so relationships are
+	// added from the top of the workflow down
+	order, err := def.order()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	for _, key := range order {
+		for _, edge := range def.Edges {
+			if edge.From != key {
+				continue
+			}
+			if _, err := c.AddRelationship(ctx, ids[edge.From], ids[edge.To], edge.Condition); err != nil {
+				return uuid.Nil, fmt.Errorf("failed to add relationship %s -> %s: %w", edge.From, edge.To, err)
+			}
+		}
+	}
+
+	workflowID, err := c.CreateWorkflow(ctx, client.WorkflowInput{
+		Name: def.Name, Description: def.Description, StartingNodeID: ids[def.Start], UniqueReference: def.UniqueReference,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to create workflow: %w", err)
+	}
+	return workflowID, nil
+}
+
+var nonKeyCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// exportDefinition reads a workflow back into a definition. Node keys are derived from the
+// node titles.
+func exportDefinition(ctx context.Context, c *client.Client, workflowID uuid.UUID) (Definition, error) {
+	wf, err := c.GetWorkflow(ctx, workflowID)
+	if err != nil {
+		return Definition{}, err
+	}
+	graph, err := c.GetWorkflowGraph(ctx, workflowID, uuid.Nil)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	def := Definition{Name: wf.Name, Description: wf.Description, UniqueReference: wf.UniqueReference, Nodes: []NodeDefinition{}, Edges: []EdgeDefinition{}}
+	keys := make(map[uuid.UUID]string)
+	used := make(map[string]bool)
+	for _, graphNode := range graph.Nodes {
+		node, err := c.GetNode(ctx, graphNode.ID)
+		if err != nil {
+			return Definition{}, fmt.Errorf("failed to fetch node %s: %w", graphNode.ID, err)
+		}
+
+		key := strings.Trim(nonKeyCharacters.ReplaceAllString(strings.ToLower(node.Title), "-"), "-")
+		if key == "" {
+			key = "node"
+		}
+		for i, base := 2, key; used[key]; i++ {
+			key = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[key] = true
+		keys[node.ID] = key
+
+		nodeDef := NodeDefinition{Key: key, Title: node.Title, Type: node.Type, Description: node.Description, Config: node.Config}
+		for _, graphTask := range graphNode.Tasks {
+			task, err := c.GetTask(ctx, graphTask.ID)
+			if err != nil {
+				return Definition{}, fmt.Errorf("failed to fetch task %s: %w", graphTask.ID, err)
+			}
+			nodeDef.Tasks = append(nodeDef.Tasks, TaskDefinition{
+				Title: task.Title, Type: task.Type, HttpMethod: task.HttpMethod, Action: task.Action, Params: task.Params, MaxRetries: task.MaxRetries,
+			})
+		}
+		def.Nodes = append(def.Nodes, nodeDef)
+	}
+
+	def.Start = keys[wf.StartingNodeID]
+	for _, edge := range graph.Edges {
+		def.Edges = append(def.Edges, EdgeDefinition{From: keys[edge.From], To: keys[edge.To], Condition: edge.Condition})
+	}
+	return def, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
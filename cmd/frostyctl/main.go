@@ -0,0 +1,134 @@
+// Command frostyctl operates a frosty server through its HTTP API: it applies and exports
+// workflow definitions, lists and describes workflows and executions, starts, runs,
+// resumes, cancels, signals and rolls back executions, and tails their events.
+//
+// The server and credential are taken from --server and --key, or the FROSTY_URL and
+// FROSTY_API_KEY environment variables. Output is a table, or JSON with -o json.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/kadzany/frosty/client"
+)
+
+const usage = `usage: frostyctl [--server <url>] [--key <api key>] [-o table|json] <command> [<args>]
+
+Definitions:
+  apply -f <file>                   create a workflow from a definition file, - for standard input
+  export <workflow-id> [-f <file>]  write the definition of a workflow
+  validate -f <file>                check a definition file without a server
+
+Workflows and executions:
+  list workflows [--name <name>] [--limit <n>]
+  list executions [--workflow <id>] [--status <status>] [--reference <ref>] [--limit <n>]
+  describe workflow <workflow-id>
+  describe execution <execution-id>
+
+Executions:
+  start <workflow-id> [--reference <ref>] [--data <json>] [--idempotency-key <key>] [--no-run]
+  run <execution-id>                run an execution created with start --no-run
+  resume <execution-id>             fire the pending timers of a parked execution now
+  signal <execution-id> <signal> [--data <json>]
+  cancel <execution-id>
+  rollback <execution-id>
+  tail <execution-id> [--interval <duration>]
+`
+
+// errUsage is returned for invalid command lines, which print the usage
+var errUsage = errors.New("invalid command line")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdout)
+	switch {
+	case errors.Is(err, errUsage):
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "frostyctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// cli is what every command runs with
+type cli struct {
+	ctx    context.Context
+	client *client.Client
+	out    io.Writer
+	json   bool // Print JSON instead of tables
+}
+
+// commands are the subcommands by name
+var commands = map[string]func(c *cli, args []string) error{
+	"apply":    (*cli).apply,
+	"export":   (*cli).export,
+	"validate": (*cli).validate,
+	"list":     (*cli).list,
+	"describe": (*cli).describe,
+	"start":    (*cli).start,
+	"run":      (*cli).runExecution,
+	"resume":   (*cli).resume,
+	"signal":   (*cli).signal,
+	"cancel":   (*cli).cancel,
+	"rollback": (*cli).rollback,
+	"tail":     (*cli).tail,
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("frostyctl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	server := flags.String("server", envOr("FROSTY_URL", "http://localhost:8080"), "URL of the frosty server")
+	key := flags.String("key", os.Getenv("FROSTY_API_KEY"), "API key or JWT")
+	output := flags.String("o", "table", "output format, table or json")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		return errUsage
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q, use table or json", *output)
+	}
+
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		return errUsage
+	}
+	c := &cli{ctx: ctx, client: client.New(*server, *key), out: out, json: *output == "json"}
+	return command(c, flags.Args()[1:])
+}
+
+// parseArgs parses the flags of a command, wherever they are among its arguments, and
+// returns the other arguments. It fails unless there are exactly positional of those.
+func parseArgs(flags *flag.FlagSet, args []string, positional int) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	var rest []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		rest = append(rest, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(rest) != positional {
+		return nil, errUsage
+	}
+	return rest, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/internal"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer serves the API on a fresh SQLite database and returns a function running
+// frostyctl against it as an admin
+func newTestServer(t *testing.T) func(args ...string) (string, error) {
+	app := internal.App{}
+	app.InitializeSQLite(":memory:")
+	if err := app.Migrate([]string{"up"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	key, apiKey, err := workflow.GenerateAPIKey("frostyctl-test", []string{workflow.RoleAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.Store.CreateAPIKey(apiKey); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(app.Router)
+	t.Cleanup(func() {
+		server.Close()
+		app.DB.Close()
+	})
+
+	return func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := run(context.Background(), append([]string{"--server", server.URL, "--key", key}, args...), &out)
+		return out.String(), err
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var out bytes.Buffer
+	assert.NoError(t, run(context.Background(), []string{"validate", "-f", "testdata/approval.json"}, &out))
+	assert.Contains(t, out.String(), "is valid: workflow order-approval with 5 nodes and 4 edges")
+
+	out.Reset()
+	err := run(context.Background(), []string{"-o", "json", "validate", "-f", "testdata/invalid.json"}, &out)
+	assert.EqualError(t, err, "testdata/invalid.json is invalid: 7 problems")
+
+	var result struct {
+		Valid    bool     `json:"valid"`
+		Problems []string `json:"problems"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	assert.False(t, result.Valid)
+	assert.Contains(t, result.Problems, `node "wait": wait node config requires a signal`)
+	assert.Contains(t, result.Problems, `start "begin" is not a node`)
+	assert.Contains(t, result.Problems, `edges[1]: to "nowhere" is not a node`)
+}
+
+func TestDefinitionValidate_Cycles(t *testing.T) {
+	def := Definition{
+		Name:  "loop",
+		Start: "start",
+		Nodes: []NodeDefinition{{Key: "start", Title: "Start", Type: "Start"}, {Key: "a", Title: "A", Type: "Task"}, {Key: "b", Title: "B", Type: "Task"}},
+		Edges: []EdgeDefinition{{From: "start", To: "a"}, {From: "a", To: "b"}, {From: "b", To: "a"}},
+	}
+	assert.Equal(t, []string{`node "a" is part of a cycle`}, def.Validate())
+
+	def.Edges = def.Edges[:1]
+	assert.Equal(t, []string{`node "b" cannot be reached from start "start"`}, def.Validate())
+}
+
+func TestApplyAndExport(t *testing.T) {
+	frostyctl := newTestServer(t)
+
+	out, err := frostyctl("-o", "json", "apply", "-f", "testdata/approval.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wf workflow.Workflow
+	assert.NoError(t, json.Unmarshal([]byte(out), &wf))
+	assert.Equal(t, "order-approval", wf.Name)
+	assert.Equal(t, 1, wf.Version)
+
+	// Applying again creates the next version
+	out, err = frostyctl("apply", "-f", "testdata/approval.json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "created workflow order-approval version 2")
+
+	exported := filepath.Join(t.TempDir(), "exported.json")
+	_, err = frostyctl("export", wf.ID.String(), "-f", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := readDefinition("testdata/approval.json")
+	got, err := readDefinition(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, want.Name, got.Name)
+	assert.Equal(t, want.Description, got.Description)
+	assert.Equal(t, want.Start, got.Start)
+	assert.ElementsMatch(t, normalizeNodes(want.Nodes), normalizeNodes(got.Nodes))
+	assert.ElementsMatch(t, want.Edges, got.Edges)
+
+	out, err = frostyctl("list", "workflows", "--name", "order-approval")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(out, "\n"), out)
+
+	out, err = frostyctl("describe", "workflow", wf.ID.String())
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Charge card")
+	assert.Contains(t, out, "timeout")
+}
+
+// normalizeNodes compacts the node configs, which the server may store reformatted
+func normalizeNodes(nodes []NodeDefinition) []NodeDefinition {
+	normalized := make([]NodeDefinition, len(nodes))
+	for i, node := range nodes {
+		if len(node.Config) > 0 {
+			var compact bytes.Buffer
+			json.Compact(&compact, node.Config)
+			node.Config = compact.Bytes()
+		}
+		normalized[i] = node
+	}
+	return normalized
+}
+
+func TestExecutionCommands(t *testing.T) {
+	frostyctl := newTestServer(t)
+
+	out, err := frostyctl("-o", "json", "apply", "-f", "testdata/approval.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wf workflow.Workflow
+	assert.NoError(t, json.Unmarshal([]byte(out), &wf))
+
+	// The execution parks on the approval
+	out, err = frostyctl("-o", "json", "start", wf.ID.String(), "--reference", "ORD-1", "--data", `{"amount":42}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var execution workflow.WorkflowExecution
+	assert.NoError(t, json.Unmarshal([]byte(out), &execution))
+	assert.Equal(t, workflow.WaitStatusWaiting, execution.Status)
+	id := execution.ID.String()
+
+	out, err = frostyctl("list", "executions", "--workflow", wf.ID.String(), "--status", "waiting")
+	assert.NoError(t, err)
+	assert.Contains(t, out, id)
+
+	out, err = frostyctl("describe", "execution", id)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "ORD-1")
+	assert.Regexp(t, `Approval\s+Wait\s+-\s+waiting`, out)
+
+	_, err = frostyctl("signal", id, "rejected")
+	assert.True(t, errors.Is(err, workflow.ErrNotFound), "unexpected error: %v", err)
+
+	// Waits are resumed by their signal, not by resume
+	_, err = frostyctl("resume", id)
+	assert.ErrorIs(t, err, workflow.ErrInvalidTransition)
+
+	out, err = frostyctl("cancel", id)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "cancelled")
+
+	_, err = frostyctl("cancel", id)
+	assert.True(t, errors.Is(err, workflow.ErrInvalidTransition), "unexpected error: %v", err)
+
+	// A finished execution is tailed up to its end
+	out, err = frostyctl("tail", id)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "node Approval")
+	assert.True(t, strings.HasSuffix(out, "execution "+id+" cancelled\n"), out)
+
+	out, err = frostyctl("rollback", id)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "rolled_back")
+
+	// Cancelled executions cannot be run again
+	_, err = frostyctl("run", id)
+	assert.ErrorIs(t, err, workflow.ErrInvalidTransition)
+
+	// Executions started with --no-run are run later
+	out, err = frostyctl("-o", "json", "start", wf.ID.String(), "--no-run")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal([]byte(out), &execution))
+	assert.Equal(t, "pending", execution.Status)
+
+	out, err = frostyctl("run", execution.ID.String())
+	assert.NoError(t, err)
+	assert.Contains(t, out, "waiting")
+}
+
+func TestResumeCommand(t *testing.T) {
+	frostyctl := newTestServer(t)
+
+	definition := filepath.Join(t.TempDir(), "delay.json")
+	err := os.WriteFile(definition, []byte(`{"name": "delay", "start": "start",
+		"nodes": [{"key": "start", "title": "Start", "type": "Start"}, {"key": "delay", "title": "Delay", "type": "Timer", "config": {"duration": "24h"}}, {"key": "end", "title": "End", "type": "End"}],
+		"edges": [{"from": "start", "to": "delay"}, {"from": "delay", "to": "end"}]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := frostyctl("-o", "json", "apply", "-f", definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wf workflow.Workflow
+	assert.NoError(t, json.Unmarshal([]byte(out), &wf))
+
+	out, err = frostyctl("-o", "json", "start", wf.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var execution workflow.WorkflowExecution
+	assert.NoError(t, json.Unmarshal([]byte(out), &execution))
+	assert.Equal(t, workflow.WaitStatusWaiting, execution.Status)
+
+	// The timer fires now rather than in a day
+	out, err = frostyctl("resume", execution.ID.String())
+	assert.NoError(t, err)
+	assert.Contains(t, out, "completed")
+
+	_, err = frostyctl("resume", execution.ID.String())
+	assert.ErrorIs(t, err, workflow.ErrInvalidTransition)
+}
+
+func TestUsage(t *testing.T) {
+	for _, args := range [][]string{{}, {"launch"}, {"list"}, {"describe", "node", uuid.NewString()}, {"cancel"}, {"apply"}} {
+		assert.ErrorIs(t, run(context.Background(), args, io.Discard), errUsage, "%v", args)
+	}
+	_, err := parseID("execution", "ORD-1")
+	assert.EqualError(t, err, `invalid execution id "ORD-1"`)
+	assert.NoError(t, run(context.Background(), []string{"validate", "-f", "testdata/approval.json"}, io.Discard))
+	assert.Error(t, run(context.Background(), []string{"validate", "-f", filepath.Join(os.TempDir(), "missing.json")}, io.Discard))
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// ListBreakers shows the circuit breaker and limit state of every task target, as seen by this instance
+func (wh *WorkflowHandler) ListBreakers(resw http.ResponseWriter, req *http.Request) {
+	statuses, err := workflow.Targets.Status(wh.Store)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, statuses)
+}
+
+func (wh *WorkflowHandler) ListTargetPolicies(resw http.ResponseWriter, req *http.Request) {
+	policies, err := wh.Store.ListTargetPolicies()
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, policies)
+}
+
+// SaveTargetPolicy creates the policy of a target or replaces the existing one
+func (wh *WorkflowHandler) SaveTargetPolicy(resw http.ResponseWriter, req *http.Request) {
+	var body targetPolicyRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+
+	// Validate fills in the defaults
+	policy := body.policy()
+	if err := policy.Validate(); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	before := wh.targetPolicyState(req, func(saved workflow.TargetPolicy) bool {
+		return saved.Scope == policy.Scope && saved.Target == policy.Target
+	})
+	id, err := wh.Store.SaveTargetPolicy(policy)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+	workflow.Targets.Reload()
+
+	policy.ID = id
+	auditResource(req, "target_policy", id, before, policy)
+	responseJson(resw, http.StatusOK, policy)
+}
+
+func (wh *WorkflowHandler) DeleteTargetPolicy(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Policy Id")
+		return
+	}
+
+	before := wh.targetPolicyState(req, func(saved workflow.TargetPolicy) bool { return saved.ID == id })
+	err = wh.Store.DeleteTargetPolicy(id)
+	workflow.Targets.Reload()
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "target_policy", id, before, nil)
+	responseJson(resw, http.StatusOK, nil)
+}
+
+// targetPolicyState is the policy matching match for the audit entry of req, see auditState
+func (wh *WorkflowHandler) targetPolicyState(req *http.Request, match func(workflow.TargetPolicy) bool) interface{} {
+	return auditState(req, func() (interface{}, error) {
+		policies, err := wh.Store.ListTargetPolicies()
+		if err != nil {
+			return nil, err
+		}
+		for _, policy := range policies {
+			if match(policy) {
+				return policy, nil
+			}
+		}
+		return nil, nil
+	})
+}
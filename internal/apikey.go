@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+var errAPIKeyUsage = errors.New("usage: apikey create [--tenant <tenant>] <name> <role>... | list | revoke <id>")
+
+// APIKey runs the apikey subcommand, which manages API keys without going through the API.
+// It is how the first admin key is issued.
+func (app *App) APIKey(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errAPIKeyUsage
+	}
+
+	switch args[0] {
+	case "create":
+		tenant := workflow.DefaultTenant
+		if len(args) > 2 && args[1] == "--tenant" {
+			tenant, args = args[2], append(args[:1:1], args[3:]...)
+		}
+		if len(args) < 3 || tenant == "" {
+			return errAPIKeyUsage
+		}
+		if err := workflow.ValidateRoles(args[2:]); err != nil {
+			return err
+		}
+		key, apiKey, err := workflow.GenerateAPIKey(args[1], args[2:])
+		if err != nil {
+			return err
+		}
+		id, err := app.Store.ForTenant(tenant).CreateAPIKey(apiKey)
+		if err != nil {
+			return fmt.Errorf("failed to store api key: %v", err)
+		}
+		apiKey.ID, apiKey.TenantID = id, tenant
+		app.auditCommand(tenant, "apikey create", id, apiKey)
+		fmt.Fprintln(out, key)
+		return nil
+
+	case "list":
+		keys, err := app.Store.ListAPIKeys()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTENANT\tPREFIX\tROLES\tREVOKED AT")
+		for _, key := range keys {
+			revokedAt := "-"
+			if key.RevokedAt != nil {
+				revokedAt = key.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.TenantID, key.Prefix, strings.Join(key.Roles, ","), revokedAt)
+		}
+		return w.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return errAPIKeyUsage
+		}
+		id, err := uuid.Parse(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid key id: %v", err)
+		}
+		if err := app.Store.RevokeAPIKey(id); err != nil {
+			return fmt.Errorf("failed to revoke api key: %v", err)
+		}
+		app.auditCommand("", "apikey revoke", id, nil)
+		fmt.Fprintf(out, "revoked %s\n", id)
+		return nil
+	}
+
+	return errAPIKeyUsage
+}
+
+// auditCommand appends the audit entry of a command that changed an API key. The actor is the
+// operating system user running the command.
+func (app *App) auditCommand(tenant, action string, id uuid.UUID, after interface{}) {
+	actor := "cli"
+	if u, err := user.Current(); err == nil {
+		actor += ":" + u.Username
+	}
+
+	entry := workflow.AuditEntry{
+		TenantID:     tenant,
+		Actor:        actor,
+		Action:       action,
+		ResourceType: "api_key",
+		ResourceID:   id.String(),
+		Outcome:      workflow.AuditOutcomeSucceeded,
+		After:        workflow.AuditState(after),
+	}
+	if err := app.Store.InsertAuditEntry(entry); err != nil {
+		slog.Error("failed to write audit entry", "error", err)
+	}
+}
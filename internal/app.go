@@ -1,52 +1,212 @@
 package internal
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/pqinit/migrations"
+	"github.com/kadzany/frosty/workflow"
 	_ "github.com/lib/pq"
 )
 
+// shutdownTimeout bounds how long in-flight requests are drained on shutdown
+const shutdownTimeout = 15 * time.Second
+
 type App struct {
 	Router *mux.Router
 	DB     *sql.DB
+	Driver string
+	Store  workflow.Store
 }
 
 func (app *App) Initialize(user, password, dbname, dbhost, dbport string) {
 	dbCreds := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", user, password, dbname, dbhost, dbport)
-	fmt.Printf("Connection established...")
 
 	var err error
 	app.DB, err = sql.Open("postgres", dbCreds)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to open database", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("connection established", "db_host", dbhost, "db_name", dbname)
+	app.Driver = migrations.Postgres
+	app.Store = workflow.NewPostgresStore(app.DB)
+
+	app.Router = mux.NewRouter()
+	app.initializeRoutes()
+}
+
+// InitializeSQLite sets the app up on the SQLite database at path, for running without Postgres
+func (app *App) InitializeSQLite(path string) {
+	var err error
+	app.DB, err = workflow.OpenSQLite(path)
+	if err != nil {
+		slog.Error("failed to open database", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("connection established", "db_path", path)
+	app.Driver = migrations.SQLite
+	app.Store = workflow.NewSQLiteStore(app.DB)
 
 	app.Router = mux.NewRouter()
 	app.initializeRoutes()
 }
 
-func (app *App) Run(addr string) {
-	fmt.Printf("Listening on %s", addr)
-	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
+// Run serves the API on addr with the background workers until SIGINT or SIGTERM, then
+// drains in-flight requests and stops the workers before returning
+func (app *App) Run(addr string) error {
+	if header, ok := os.LookupEnv("APP_TASK_IDEMPOTENCY_HEADER"); ok {
+		workflow.TaskIdempotencyHeader = header
+	}
+
+	egress, err := EgressPolicyFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid egress policy: %w", err)
+	}
+	workflow.Egress = egress
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The workers stop when ctx is done, and are waited for before Run returns
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+
+	if enabled, err := strconv.ParseBool(os.Getenv("APP_SCHEDULER_ENABLED")); err != nil || enabled {
+		pollInterval, _ := time.ParseDuration(os.Getenv("APP_SCHEDULER_POLL_INTERVAL"))
+		startWorker(workflow.NewScheduler(app.Store, pollInterval).Run)
+	}
+
+	pollerInterval, _ := time.ParseDuration(os.Getenv("APP_POLLER_INTERVAL"))
+	startWorker(workflow.NewPoller(app.Store, pollerInterval).Run)
+
+	var publisher workflow.Publisher = workflow.LogPublisher{}
+	if url := os.Getenv("APP_OUTBOX_WEBHOOK_URL"); url != "" {
+		publisher = workflow.WebhookPublisher{URL: url}
+	}
+	relayInterval, _ := time.ParseDuration(os.Getenv("APP_OUTBOX_INTERVAL"))
+	startWorker(workflow.NewOutboxRelay(app.Store, publisher, relayInterval).Run)
+
+	slog.Info("listening", "addr", addr)
+	headers := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "Idempotency-Key", RequestIDHeader})
 	methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"})
 	origins := handlers.AllowedOrigins([]string{"*"})
-	log.Fatal(http.ListenAndServe(addr, handlers.CORS(headers, methods, origins)(app.Router)))
+	if allowed := os.Getenv("APP_CORS_ALLOWED_ORIGINS"); allowed != "" {
+		origins = handlers.AllowedOrigins(strings.Split(allowed, ","))
+	}
+	exposed := handlers.ExposedHeaders([]string{RequestIDHeader})
+	server := &http.Server{Addr: addr, Handler: handlers.CORS(headers, methods, origins, exposed)(app.Router)}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
+		stop()
+		workers.Wait()
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		return fmt.Errorf("failed to stop background workers: %w", shutdownCtx.Err())
+	}
+	return nil
 }
 
 func (app *App) initializeRoutes() {
-	wfHandler := WorkflowHandler{DB: app.DB}
-	app.Router.HandleFunc("/workflow/node", wfHandler.CreateNode).Methods("POST")
-	app.Router.HandleFunc("/workflow/node/{id:[0-9a-fA-F-]+}", wfHandler.GetNode).Methods("GET")
-	app.Router.HandleFunc("/workflow/node/{id:[0-9a-fA-F-]+}/relationship", wfHandler.AddRelationship).Methods("POST")
-	app.Router.HandleFunc("/workflow/{id:[0-9a-fA-F-]+}/execute", wfHandler.ExecuteWorkflow).Methods("POST")
-	app.Router.HandleFunc("/workflow", wfHandler.CreateWorkflow).Methods("POST")
-	app.Router.HandleFunc("/workflow/task", wfHandler.CreateTask).Methods("POST")
-	app.Router.HandleFunc("/workflow/node/task", wfHandler.AddTaskToNode).Methods("POST")
-	app.Router.HandleFunc("/workflow/execution", wfHandler.CreateWorkflowExecution).Methods("POST")
-	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/execute", wfHandler.ExecuteWorkflowByExecutionID).Methods("POST")
+	authenticator, err := NewAuthenticator(app.Store, AuthConfigFromEnv())
+	if err != nil {
+		slog.Error("failed to set up authentication", "error", err)
+		os.Exit(1)
+	}
+	if !authenticator.Config.Enabled {
+		slog.Warn("authentication is disabled, every client is treated as an admin")
+	}
+	app.Router.Use(RequestIDMiddleware, authenticator.Middleware)
+
+	wfHandler := WorkflowHandler{Store: app.Store}
+	authz := &Authorizer{Store: app.Store}
+
+	// Every route names the permission it requires, and how to find the workflow it acts on
+	// for routes where roles granted on that workflow count
+	app.Router.HandleFunc("/workflow/node", authz.Require(PermissionDesign, nil, wfHandler.CreateNode)).Methods("POST")
+	app.Router.HandleFunc("/workflow/node/{id:[0-9a-fA-F-]+}", authz.Require(PermissionRead, nil, wfHandler.GetNode)).Methods("GET")
+	app.Router.HandleFunc("/workflow/node/{id:[0-9a-fA-F-]+}/relationship", authz.Require(PermissionDesign, nil, wfHandler.AddRelationship)).Methods("POST")
+	app.Router.HandleFunc("/workflow/{id:[0-9a-fA-F-]+}/execute", authz.Require(PermissionOperate, authz.workflowFromPath, wfHandler.ExecuteWorkflow)).Methods("POST")
+	app.Router.HandleFunc("/workflow/{id:[0-9a-fA-F-]+}/graph", authz.Require(PermissionRead, authz.workflowFromPath, wfHandler.GetWorkflowGraph)).Methods("GET")
+	app.Router.HandleFunc("/workflow", authz.Require(PermissionDesign, nil, wfHandler.CreateWorkflow)).Methods("POST")
+	app.Router.HandleFunc("/workflow", authz.Require(PermissionRead, nil, wfHandler.ListWorkflows)).Methods("GET")
+	app.Router.HandleFunc("/workflow/{id:[0-9a-fA-F-]+}", authz.Require(PermissionRead, authz.workflowFromPath, wfHandler.GetWorkflow)).Methods("GET")
+	app.Router.HandleFunc("/workflow/task", authz.Require(PermissionDesign, nil, wfHandler.CreateTask)).Methods("POST")
+	app.Router.HandleFunc("/workflow/task/{id:[0-9a-fA-F-]+}", authz.Require(PermissionRead, nil, wfHandler.GetTask)).Methods("GET")
+	app.Router.HandleFunc("/workflow/node/task", authz.Require(PermissionDesign, nil, wfHandler.AddTaskToNode)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution", authz.Require(PermissionOperate, authz.workflowFromBody, wfHandler.CreateWorkflowExecution)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution", authz.Require(PermissionRead, nil, wfHandler.ListWorkflowExecutions)).Methods("GET")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}", authz.Require(PermissionRead, authz.workflowFromExecution, wfHandler.GetWorkflowExecution)).Methods("GET")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/execute", authz.Require(PermissionOperate, authz.workflowFromExecution, wfHandler.ExecuteWorkflowByExecutionID)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/rollback", authz.Require(PermissionOperate, authz.workflowFromExecution, wfHandler.RollbackWorkflowExecution)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/cancel", authz.Require(PermissionOperate, authz.workflowFromExecution, wfHandler.CancelWorkflowExecution)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/resume", authz.Require(PermissionOperate, authz.workflowFromExecution, wfHandler.ResumeWorkflowExecution)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/signal/{name}", authz.Require(PermissionOperate, authz.workflowFromExecution, wfHandler.SignalWorkflowExecution)).Methods("POST")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/timeline", authz.Require(PermissionRead, authz.workflowFromExecution, wfHandler.GetExecutionTimeline)).Methods("GET")
+	app.Router.HandleFunc("/workflow/execution/{id:[0-9a-fA-F-]+}/logs", authz.Require(PermissionRead, authz.workflowFromExecution, wfHandler.GetExecutionLogs)).Methods("GET")
+	app.Router.HandleFunc("/workflow/timer", authz.Require(PermissionRead, nil, wfHandler.ListTimers)).Methods("GET")
+	app.Router.HandleFunc("/workflow/timer/{id:[0-9a-fA-F-]+}", authz.Require(PermissionRead, authz.workflowFromTimer, wfHandler.GetTimer)).Methods("GET")
+	app.Router.HandleFunc("/workflow/timer/{id:[0-9a-fA-F-]+}", authz.Require(PermissionOperate, authz.workflowFromTimer, wfHandler.CancelTimer)).Methods("DELETE")
+	app.Router.HandleFunc("/workflow/schedule", authz.Require(PermissionOperate, authz.workflowFromBody, wfHandler.CreateSchedule)).Methods("POST")
+	app.Router.HandleFunc("/workflow/schedule", authz.Require(PermissionRead, nil, wfHandler.ListSchedules)).Methods("GET")
+	app.Router.HandleFunc("/workflow/schedule/{id:[0-9a-fA-F-]+}", authz.Require(PermissionRead, authz.workflowFromSchedule, wfHandler.GetSchedule)).Methods("GET")
+	app.Router.HandleFunc("/workflow/schedule/{id:[0-9a-fA-F-]+}", authz.Require(PermissionOperate, authz.workflowFromSchedule, wfHandler.UpdateSchedule)).Methods("PUT")
+	app.Router.HandleFunc("/workflow/schedule/{id:[0-9a-fA-F-]+}", authz.Require(PermissionOperate, authz.workflowFromSchedule, wfHandler.DeleteSchedule)).Methods("DELETE")
+	app.Router.HandleFunc("/admin/breakers", authz.Require(PermissionDeployment, nil, wfHandler.ListBreakers)).Methods("GET")
+	app.Router.HandleFunc("/admin/target-policies", authz.Require(PermissionDeployment, nil, wfHandler.ListTargetPolicies)).Methods("GET")
+	app.Router.HandleFunc("/admin/target-policies", authz.Require(PermissionDeployment, nil, wfHandler.SaveTargetPolicy)).Methods("PUT")
+	app.Router.HandleFunc("/admin/target-policies/{id:[0-9a-fA-F-]+}", authz.Require(PermissionDeployment, nil, wfHandler.DeleteTargetPolicy)).Methods("DELETE")
+	app.Router.HandleFunc("/admin/tenants", authz.Require(PermissionDeployment, nil, wfHandler.ListTenantQuotas)).Methods("GET")
+	app.Router.HandleFunc("/admin/tenants/{tenant}/quota", authz.Require(PermissionDeployment, nil, wfHandler.GetTenantQuota)).Methods("GET")
+	app.Router.HandleFunc("/admin/tenants/{tenant}/quota", authz.Require(PermissionDeployment, nil, wfHandler.SaveTenantQuota)).Methods("PUT")
+	app.Router.HandleFunc("/audit", authz.Require(PermissionAdmin, nil, wfHandler.ListAuditEntries)).Methods("GET")
+	app.Router.HandleFunc("/auth/keys", authz.Require(PermissionAdmin, nil, wfHandler.CreateAPIKey)).Methods("POST")
+	app.Router.HandleFunc("/auth/keys", authz.Require(PermissionAdmin, nil, wfHandler.ListAPIKeys)).Methods("GET")
+	app.Router.HandleFunc("/auth/keys/{id:[0-9a-fA-F-]+}", authz.Require(PermissionAdmin, nil, wfHandler.RevokeAPIKey)).Methods("DELETE")
+	app.Router.HandleFunc("/auth/grants", authz.Require(PermissionAdmin, nil, wfHandler.CreateWorkflowGrant)).Methods("POST")
+	app.Router.HandleFunc("/auth/grants", authz.Require(PermissionAdmin, nil, wfHandler.ListWorkflowGrants)).Methods("GET")
+	app.Router.HandleFunc("/auth/grants/{id:[0-9a-fA-F-]+}", authz.Require(PermissionAdmin, nil, wfHandler.DeleteWorkflowGrant)).Methods("DELETE")
+
+	// Public, see publicPaths
+	app.Router.HandleFunc("/openapi.json", wfHandler.GetOpenAPI).Methods("GET")
+	app.Router.HandleFunc("/docs", wfHandler.GetDocs).Methods("GET")
 }
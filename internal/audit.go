@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// auditRecord is what a handler tells about the resource its request changed
+type auditRecord struct {
+	ResourceType string
+	ResourceID   string
+	Before       interface{}
+	After        interface{}
+}
+
+type auditKey struct{}
+
+// auditResource records the resource a request acted on, with its state before and after, for
+// the audit entry written once the handler returns. Either state is nil when the resource did
+// not exist at that point.
+func auditResource(req *http.Request, resourceType string, id interface{}, before, after interface{}) {
+	record, ok := req.Context().Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+
+	record.ResourceType, record.ResourceID = resourceType, fmt.Sprint(id)
+	if id == uuid.Nil {
+		record.ResourceID = ""
+	}
+	record.Before, record.After = before, after
+}
+
+// auditState returns what get returns when the request is audited, for the before or after
+// state of auditResource. Lookups are skipped for requests that are not audited, and failed
+// lookups give nil.
+func auditState(req *http.Request, get func() (interface{}, error)) interface{} {
+	if _, ok := req.Context().Value(auditKey{}).(*auditRecord); !ok {
+		return nil
+	}
+	state, err := get()
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// auditedMethods change something and are recorded whatever their outcome
+var auditedMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// statusRecorder keeps the status and, for errors, the body of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.status >= http.StatusBadRequest && r.body.Len() < 4096 {
+		r.body.Write(data)
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// audit runs handler and appends an audit entry for requests that change something
+func (a *Authorizer) audit(handler http.HandlerFunc) http.HandlerFunc {
+	return func(resw http.ResponseWriter, req *http.Request) {
+		if !auditedMethods[req.Method] {
+			handler(resw, req)
+			return
+		}
+
+		record := &auditRecord{}
+		recorder := &statusRecorder{ResponseWriter: resw}
+		handler(recorder, req.WithContext(context.WithValue(req.Context(), auditKey{}, record)))
+
+		identity, _ := IdentityFrom(req.Context())
+		entry := workflow.AuditEntry{
+			TenantID:     identity.Tenant,
+			Actor:        identity.Subject,
+			Action:       routeAction(req),
+			ResourceType: record.ResourceType,
+			ResourceID:   record.ResourceID,
+			Outcome:      workflow.AuditOutcomeSucceeded,
+			RequestID:    RequestIDFrom(req.Context()),
+			Before:       workflow.AuditState(record.Before),
+			After:        workflow.AuditState(record.After),
+		}
+		if recorder.status >= http.StatusBadRequest {
+			entry.Outcome, entry.Reason = workflow.AuditOutcomeFailed, responseReason(recorder.status, recorder.body.Bytes())
+		}
+
+		if err := a.Store.InsertAuditEntry(entry); err != nil {
+			workflow.Logger(req.Context()).Error("failed to write audit entry", "error", err)
+		}
+	}
+}
+
+// responseReason is the error message of an error response, or its status
+func responseReason(status int, body []byte) string {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != "" {
+		return fmt.Sprintf("%d: %s", status, payload.Error)
+	}
+	return fmt.Sprintf("%d: %s", status, http.StatusText(status))
+}
+
+// ListAuditEntries returns the audit entries of the tenant of the client, newest first, filtered
+// by the actor, action, resource_type, resource_id, outcome, request_id, since, until, limit
+// and offset query parameters
+func (wh *WorkflowHandler) ListAuditEntries(resw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := workflow.AuditFilter{
+		Actor:        query.Get("actor"),
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		ResourceID:   query.Get("resource_id"),
+		Outcome:      query.Get("outcome"),
+		RequestID:    query.Get("request_id"),
+	}
+
+	for name, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				responseError(resw, http.StatusBadRequest, fmt.Sprintf("Invalid %s, expected an RFC 3339 time", name))
+				return
+			}
+			*target = &t
+		}
+	}
+	if !parsePage(resw, req, &filter.Limit, &filter.Offset) {
+		return
+	}
+
+	entries, err := wh.store(req).ListAuditEntries(filter)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, entries)
+}
+
+// maxListLimit caps the rows returned by one request to a list route
+const maxListLimit = 1000
+
+// parsePage reads the limit and offset query parameters of a list route, capping the limit
+// at maxListLimit. It answers 400 and returns false when either is not a non-negative number.
+func parsePage(resw http.ResponseWriter, req *http.Request, limit, offset *int) bool {
+	for name, target := range map[string]*int{"limit": limit, "offset": offset} {
+		if value := req.URL.Query().Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				responseError(resw, http.StatusBadRequest, fmt.Sprintf("Invalid %s, expected a non-negative number", name))
+				return false
+			}
+			*target = n
+		}
+	}
+	if *limit > maxListLimit {
+		*limit = maxListLimit
+	}
+	return true
+}
+
+// RequestIDHeader carries the ID of a request. IDs sent by clients are kept, so a request can be
+// followed across services, and every response carries the ID its request got.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDFrom returns the ID of the request of ctx, empty outside requests
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware gives every request an ID, echoed in the response and added to its logs
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resw http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		resw.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(req.Context(), requestIDKey{}, id)
+		ctx = workflow.WithLogger(ctx, workflow.Logger(ctx).With("request_id", id))
+		next.ServeHTTP(resw, req.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts short printable IDs, so clients cannot forge log or audit content
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
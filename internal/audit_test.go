@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit_Routes(t *testing.T) {
+	t.Setenv("APP_AUTH_ENABLED", "true")
+	store := workflow.NewMemoryStore()
+	app := App{Router: mux.NewRouter(), Store: store}
+	app.initializeRoutes()
+
+	workflowID := createWorkflow(t, store, "checkout")
+	designer := createKey(t, store, "designer", workflow.RoleDesigner, workflow.RoleOperator)
+	admin := createKey(t, store, "admin", workflow.RoleAdmin)
+	acmeAdmin := createKey(t, store.ForTenant("acme"), "acme-admin", workflow.RoleAdmin)
+
+	req, _ := http.NewRequest("POST", "/workflow/node", strings.NewReader(`{"title":"Charge","type":"Task"}`))
+	req.Header.Set("Authorization", "Bearer "+designer)
+	req.Header.Set(RequestIDHeader, "req-42")
+	resw := httptest.NewRecorder()
+	app.Router.ServeHTTP(resw, req)
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	assert.Equal(t, "req-42", resw.Header().Get(RequestIDHeader))
+	var nodeID uuid.UUID
+	json.Unmarshal(resw.Body.Bytes(), &nodeID)
+
+	schedule := []byte(`{"workflow_id":"` + workflowID.String() + `","interval_seconds":60,"timezone":"UTC","misfire_policy":"skip"}`)
+	resw = serve(app.Router, "POST", "/workflow/schedule", designer, schedule)
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	assert.NotEmpty(t, resw.Header().Get(RequestIDHeader))
+	var scheduleID uuid.UUID
+	json.Unmarshal(resw.Body.Bytes(), &scheduleID)
+
+	assert.Equal(t, http.StatusOK, serve(app.Router, "PUT", "/workflow/schedule/"+scheduleID.String(), designer, []byte(`{"interval_seconds":300}`)).Code)
+	assert.Equal(t, http.StatusNotFound, serve(app.Router, "DELETE", "/workflow/schedule/"+uuid.NewString(), designer, nil).Code)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "GET", "/workflow/schedule", designer, nil).Code)
+
+	list := func(credential, query string) []workflow.AuditEntry {
+		resw := serve(app.Router, "GET", "/audit"+query, credential, nil)
+		assert.Equal(t, http.StatusOK, resw.Code)
+		var entries []workflow.AuditEntry
+		json.Unmarshal(resw.Body.Bytes(), &entries)
+		return entries
+	}
+
+	// Reads are not recorded, every change is, newest first
+	entries := list(admin, "?actor=designer")
+	if assert.Len(t, entries, 4) {
+		assert.Equal(t, workflow.AuditOutcomeFailed, entries[0].Outcome)
+		assert.Regexp(t, "^404: schedule [0-9a-f-]+ not found$", entries[0].Reason)
+
+		assert.Equal(t, "PUT /workflow/schedule/{id:[0-9a-fA-F-]+}", entries[1].Action)
+		assert.Equal(t, scheduleID.String(), entries[1].ResourceID)
+		var fields []string
+		for _, change := range entries[1].Changes {
+			fields = append(fields, change.Field)
+		}
+		assert.Contains(t, fields, "interval_seconds")
+
+		assert.Equal(t, "node", entries[3].ResourceType)
+		assert.Equal(t, nodeID.String(), entries[3].ResourceID)
+		assert.Equal(t, "req-42", entries[3].RequestID)
+		assert.JSONEq(t, `null`, string(entries[3].Before))
+		assert.Contains(t, string(entries[3].After), `"title":"Charge"`)
+	}
+
+	entries = list(admin, "?request_id=req-42")
+	assert.Len(t, entries, 1)
+	entries = list(admin, "?resource_type=schedule&outcome=succeeded&limit=1")
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "PUT /workflow/schedule/{id:[0-9a-fA-F-]+}", entries[0].Action)
+	}
+
+	// Other tenants see only their own entries, and only admins read the log
+	assert.Empty(t, list(acmeAdmin, ""))
+	assert.Equal(t, http.StatusForbidden, serve(app.Router, "GET", "/audit", designer, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(app.Router, "GET", "/audit?since=yesterday", admin, nil).Code)
+}
+
+func TestAudit_BeforeState(t *testing.T) {
+	t.Setenv("APP_AUTH_ENABLED", "true")
+	store := workflow.NewMemoryStore()
+	app := App{Router: mux.NewRouter(), Store: store}
+	app.initializeRoutes()
+
+	workflowID := createWorkflow(t, store, "checkout")
+	admin := createKey(t, store, "admin", workflow.RoleAdmin)
+	_, apiKey, _ := workflow.GenerateAPIKey("ci", []string{workflow.RoleOperator})
+	keyID, err := store.CreateAPIKey(apiKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := []byte(`{"scope":"host","target":"payments.example.com","failure_threshold":5}`)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "PUT", "/admin/target-policies", admin, policy).Code)
+	policy = []byte(`{"scope":"host","target":"payments.example.com","failure_threshold":3}`)
+	resw := serve(app.Router, "PUT", "/admin/target-policies", admin, policy)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	var saved workflow.TargetPolicy
+	json.Unmarshal(resw.Body.Bytes(), &saved)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "DELETE", "/admin/target-policies/"+saved.ID.String(), admin, nil).Code)
+
+	grant := []byte(`{"workflow_id":"` + workflowID.String() + `","subject":"ci","role":"operator"}`)
+	resw = serve(app.Router, "POST", "/auth/grants", admin, grant)
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	var created workflow.WorkflowGrant
+	json.Unmarshal(resw.Body.Bytes(), &created)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "DELETE", "/auth/grants/"+created.ID.String(), admin, nil).Code)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "DELETE", "/auth/keys/"+keyID.String(), admin, nil).Code)
+
+	// Replacing, revoking and deleting record what was there before
+	entries, err := store.ListAuditEntries(workflow.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, entries, 6) {
+		assert.Equal(t, "api_key", entries[0].ResourceType)
+		assert.Contains(t, string(entries[0].Before), `"revoked_at":null`)
+		assert.NotContains(t, string(entries[0].After), `"revoked_at":null`)
+
+		assert.Equal(t, "grant", entries[1].ResourceType)
+		assert.Contains(t, string(entries[1].Before), `"subject":"ci"`)
+		assert.Empty(t, entries[1].After)
+
+		assert.Equal(t, "target_policy", entries[3].ResourceType)
+		assert.Contains(t, string(entries[3].Before), `"failure_threshold":3`)
+		assert.Empty(t, entries[3].After)
+		assert.Contains(t, string(entries[4].Before), `"failure_threshold":5`)
+		assert.Empty(t, entries[5].Before)
+	}
+}
+
+func TestAudit_CLI(t *testing.T) {
+	store := workflow.NewMemoryStore()
+	app := App{Store: store}
+
+	var out strings.Builder
+	assert.NoError(t, app.APIKey([]string{"create", "--tenant", "acme", "ops", "admin"}, &out))
+
+	entries, _ := store.ListAuditEntries(workflow.AuditFilter{Action: "apikey create"})
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "acme", entries[0].TenantID)
+		assert.True(t, strings.HasPrefix(entries[0].Actor, "cli"))
+		assert.NotContains(t, string(entries[0].After), strings.TrimSpace(out.String()))
+	}
+}
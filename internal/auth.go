@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// AuthConfig controls how API requests are authenticated
+type AuthConfig struct {
+	Enabled          bool   // Reject requests without valid credentials
+	JWTSecret        string // HS256 signing secret, empty to refuse HS256 tokens
+	JWTPublicKeyFile string // PEM file with the RS256 public key, empty to refuse RS256 tokens
+	JWTIssuer        string // Required iss claim, if set
+	JWTAudience      string // Required aud claim, if set
+}
+
+func AuthConfigFromEnv() AuthConfig {
+	enabled, err := strconv.ParseBool(os.Getenv("APP_AUTH_ENABLED"))
+
+	return AuthConfig{
+		Enabled:          err != nil || enabled,
+		JWTSecret:        os.Getenv("APP_AUTH_JWT_SECRET"),
+		JWTPublicKeyFile: os.Getenv("APP_AUTH_JWT_PUBLIC_KEY_FILE"),
+		JWTIssuer:        os.Getenv("APP_AUTH_JWT_ISSUER"),
+		JWTAudience:      os.Getenv("APP_AUTH_JWT_AUDIENCE"),
+	}
+}
+
+// Identity is the authenticated client of a request
+type Identity struct {
+	Subject string   // API key name or JWT subject
+	Method  string   // api_key, jwt or none when authentication is disabled
+	Roles   []string // Roles on every workflow, see rolePermissions
+	Tenant  string   // Tenant whose resources the client works with
+}
+
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom returns the client authenticated for the request of ctx
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// tokenClaims are the JWT claims frosty reads besides the registered ones
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant"`
+}
+
+var errUnauthenticated = errors.New("missing credentials")
+
+// Authenticator identifies the client of every request by an API key or a JWT, sent as
+// Authorization: Bearer <credential>
+type Authenticator struct {
+	Store  workflow.APIKeyStore
+	Config AuthConfig
+
+	rsaKey  *rsa.PublicKey
+	methods []string
+}
+
+func NewAuthenticator(store workflow.APIKeyStore, cfg AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{Store: store, Config: cfg}
+
+	if cfg.JWTSecret != "" {
+		a.methods = append(a.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWTPublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.JWTPublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwt public key: %v", err)
+		}
+		a.rsaKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse jwt public key: %v", err)
+		}
+		a.methods = append(a.methods, jwt.SigningMethodRS256.Alg())
+	}
+	return a, nil
+}
+
+// Middleware rejects requests without valid credentials with 401 and passes the identity of
+// the others on in their context. The client is added to the request logger. Requests for
+// publicPaths need no credentials and carry no identity.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resw http.ResponseWriter, req *http.Request) {
+		if publicPaths[req.URL.Path] {
+			next.ServeHTTP(resw, req)
+			return
+		}
+
+		identity := Identity{Subject: "anonymous", Method: "none", Roles: []string{workflow.RoleAdmin}, Tenant: workflow.DefaultTenant}
+		if a.Config.Enabled {
+			var err error
+			identity, err = a.Authenticate(req)
+			if err != nil {
+				resw.Header().Set("WWW-Authenticate", `Bearer realm="frosty"`)
+				responseError(resw, http.StatusUnauthorized, "Unauthorized: "+err.Error())
+				return
+			}
+		}
+
+		ctx := withIdentity(req.Context(), identity)
+		ctx = workflow.WithLogger(ctx, workflow.Logger(ctx).With("client", identity.Subject, "tenant", identity.Tenant))
+		next.ServeHTTP(resw, req.WithContext(ctx))
+	})
+}
+
+// Authenticate returns the client identified by the credential of req
+func (a *Authenticator) Authenticate(req *http.Request) (Identity, error) {
+	credential, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || credential == "" {
+		return Identity{}, errUnauthenticated
+	}
+
+	if prefix, ok := workflow.ParseAPIKeyPrefix(credential); ok {
+		return a.authenticateAPIKey(prefix, credential)
+	}
+	return a.authenticateJWT(credential)
+}
+
+func (a *Authenticator) authenticateAPIKey(prefix, credential string) (Identity, error) {
+	key, err := a.Store.GetAPIKeyByPrefix(prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, errors.New("invalid api key")
+	}
+	if err != nil {
+		slog.Error("failed to look up api key", "error", err)
+		return Identity{}, errors.New("api key could not be checked")
+	}
+
+	if !key.Matches(credential) {
+		return Identity{}, errors.New("invalid api key")
+	}
+	return Identity{Subject: key.Name, Method: "api_key", Roles: key.Roles, Tenant: key.TenantID}, nil
+}
+
+func (a *Authenticator) authenticateJWT(credential string) (Identity, error) {
+	if len(a.methods) == 0 {
+		return Identity{}, errors.New("invalid api key")
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(a.methods), jwt.WithExpirationRequired()}
+	if a.Config.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.Config.JWTIssuer))
+	}
+	if a.Config.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(a.Config.JWTAudience))
+	}
+
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(credential, &claims, func(token *jwt.Token) (interface{}, error) {
+		// WithValidMethods only lets through the algorithms a key is configured for
+		if token.Method.Alg() == jwt.SigningMethodRS256.Alg() {
+			return a.rsaKey, nil
+		}
+		return []byte(a.Config.JWTSecret), nil
+	}, opts...)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token: %v", err)
+	}
+
+	if claims.Subject == "" {
+		return Identity{}, errors.New("invalid token: sub claim is required")
+	}
+	if claims.Tenant == "" {
+		claims.Tenant = workflow.DefaultTenant
+	}
+	return Identity{Subject: claims.Subject, Method: "jwt", Roles: claims.Roles, Tenant: claims.Tenant}, nil
+}
+
+// tenantStore returns store confined to the tenant of the client of req. Requests that did
+// not pass the Authenticator are not confined.
+func tenantStore(store workflow.Store, req *http.Request) workflow.Store {
+	identity, ok := IdentityFrom(req.Context())
+	if !ok {
+		return store
+	}
+	return store.ForTenant(identity.Tenant)
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// createdAPIKey is the response to CreateAPIKey, the only time the key itself is returned
+type createdAPIKey struct {
+	workflow.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey issues a new API key for the tenant of the client. Admins of the default tenant
+// can issue keys for other tenants with tenant_id. The key is only shown in this response.
+func (wh *WorkflowHandler) CreateAPIKey(resw http.ResponseWriter, req *http.Request) {
+	var body createAPIKeyRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+
+	store := wh.store(req)
+	if identity, _ := IdentityFrom(req.Context()); body.Tenant != "" && body.Tenant != identity.Tenant {
+		if !allowed(identity, PermissionDeployment) {
+			responseError(resw, http.StatusForbidden, "Forbidden: "+identity.Subject+" cannot issue keys for tenant "+body.Tenant)
+			return
+		}
+		store = wh.Store.ForTenant(body.Tenant)
+	}
+
+	key, apiKey, err := workflow.GenerateAPIKey(body.Name, body.Roles)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	if _, err := store.CreateAPIKey(apiKey); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+	apiKey, err = store.GetAPIKeyByPrefix(apiKey.Prefix)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "api_key", apiKey.ID, nil, apiKey)
+	responseJson(resw, http.StatusCreated, createdAPIKey{APIKey: apiKey, Key: key})
+}
+
+func (wh *WorkflowHandler) ListAPIKeys(resw http.ResponseWriter, req *http.Request) {
+	keys, err := wh.store(req).ListAPIKeys()
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, keys)
+}
+
+func (wh *WorkflowHandler) RevokeAPIKey(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Key Id")
+		return
+	}
+
+	before := wh.apiKeyState(req, id)
+	err = wh.store(req).RevokeAPIKey(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "api_key", id, before, wh.apiKeyState(req, id))
+
+	responseJson(resw, http.StatusOK, nil)
+}
+
+// CreateWorkflowGrant gives a client a role on one workflow
+func (wh *WorkflowHandler) CreateWorkflowGrant(resw http.ResponseWriter, req *http.Request) {
+	var body workflowGrantRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+
+	grant := workflow.WorkflowGrant{WorkflowID: body.WorkflowID, Subject: body.Subject, Role: body.Role}
+
+	_, err := wh.store(req).GetWorkflow(grant.WorkflowID)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	grant.ID, err = wh.store(req).CreateWorkflowGrant(grant)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "grant", grant.ID, nil, grant)
+	responseJson(resw, http.StatusCreated, grant)
+}
+
+// ListWorkflowGrants returns the grants on the workflow of the workflow_id query parameter,
+// or every grant without it
+func (wh *WorkflowHandler) ListWorkflowGrants(resw http.ResponseWriter, req *http.Request) {
+	workflowID := uuid.Nil
+	if value := req.URL.Query().Get("workflow_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			responseError(resw, http.StatusBadRequest, "Invalid Workflow Id")
+			return
+		}
+		workflowID = id
+	}
+
+	grants, err := wh.store(req).ListWorkflowGrants(workflowID)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, grants)
+}
+
+func (wh *WorkflowHandler) DeleteWorkflowGrant(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Grant Id")
+		return
+	}
+
+	before := wh.grantState(req, id)
+	err = wh.store(req).DeleteWorkflowGrant(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "grant", id, before, nil)
+
+	responseJson(resw, http.StatusOK, nil)
+}
+
+// apiKeyState is the API key for the audit entry of req, see auditState
+func (wh *WorkflowHandler) apiKeyState(req *http.Request, id uuid.UUID) interface{} {
+	return auditState(req, func() (interface{}, error) {
+		keys, err := wh.store(req).ListAPIKeys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if key.ID == id {
+				return key, nil
+			}
+		}
+		return nil, nil
+	})
+}
+
+// grantState is the grant for the audit entry of req, see auditState
+func (wh *WorkflowHandler) grantState(req *http.Request, id uuid.UUID) interface{} {
+	return auditState(req, func() (interface{}, error) {
+		grants, err := wh.store(req).ListWorkflowGrants(uuid.Nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			if grant.ID == id {
+				return grant, nil
+			}
+		}
+		return nil, nil
+	})
+}
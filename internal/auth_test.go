@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// newAuthRouter serves the API key routes and a /whoami route echoing the identity
+func newAuthRouter(t *testing.T, store workflow.Store, cfg AuthConfig) *mux.Router {
+	authenticator, err := NewAuthenticator(store, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wfHandler := WorkflowHandler{Store: store}
+	authz := &Authorizer{Store: store}
+	router := mux.NewRouter()
+	router.Use(authenticator.Middleware)
+	router.HandleFunc("/whoami", func(resw http.ResponseWriter, req *http.Request) {
+		identity, _ := IdentityFrom(req.Context())
+		responseJson(resw, http.StatusOK, identity)
+	})
+	router.HandleFunc("/auth/keys", authz.Require(PermissionAdmin, nil, wfHandler.CreateAPIKey)).Methods("POST")
+	router.HandleFunc("/auth/keys/{id}", authz.Require(PermissionAdmin, nil, wfHandler.RevokeAPIKey)).Methods("DELETE")
+	return router
+}
+
+func serve(router http.Handler, method, path, credential string, body []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+	if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+	resw := httptest.NewRecorder()
+	router.ServeHTTP(resw, req)
+	return resw
+}
+
+func TestAuthenticator_APIKey(t *testing.T) {
+	store := workflow.NewMemoryStore()
+	router := newAuthRouter(t, store, AuthConfig{Enabled: true})
+
+	adminKey, apiKey, _ := workflow.GenerateAPIKey("ops", []string{workflow.RoleAdmin})
+	store.CreateAPIKey(apiKey)
+
+	resw := serve(router, "GET", "/whoami", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, resw.Code)
+	assert.Contains(t, resw.Header().Get("WWW-Authenticate"), "Bearer")
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/whoami", adminKey+"x", nil).Code)
+
+	resw = serve(router, "GET", "/whoami", adminKey, nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.JSONEq(t, `{"Subject":"ops","Method":"api_key","Roles":["admin"],"Tenant":"default"}`, resw.Body.String())
+
+	// Admins issue keys, which work right away but cannot issue keys themselves
+	resw = serve(router, "POST", "/auth/keys", adminKey, []byte(`{"name":"billing"}`))
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	var created createdAPIKey
+	json.Unmarshal(resw.Body.Bytes(), &created)
+	assert.Equal(t, "billing", created.Name)
+	assert.Equal(t, []string{workflow.RoleViewer}, created.Roles)
+	assert.NotNil(t, created.CreatedAt)
+	assert.NotContains(t, resw.Body.String(), "hash")
+
+	assert.Equal(t, http.StatusOK, serve(router, "GET", "/whoami", created.Key, nil).Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, "POST", "/auth/keys", created.Key, []byte(`{"name":"other"}`)).Code)
+
+	// Revoked keys are rejected
+	assert.Equal(t, http.StatusOK, serve(router, "DELETE", "/auth/keys/"+created.ID.String(), adminKey, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/whoami", created.Key, nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, "DELETE", "/auth/keys/"+created.ID.String(), adminKey, nil).Code)
+}
+
+func TestAuthenticator_HS256(t *testing.T) {
+	router := newAuthRouter(t, workflow.NewMemoryStore(), AuthConfig{Enabled: true, JWTSecret: "s3cret", JWTIssuer: "sso"})
+
+	sign := func(claims jwt.MapClaims, secret string) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		return token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	resw := serve(router, "GET", "/whoami", sign(jwt.MapClaims{"sub": "deployer", "iss": "sso", "exp": exp, "roles": []string{"operator"}, "tenant": "acme"}, "s3cret"), nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.JSONEq(t, `{"Subject":"deployer","Method":"jwt","Roles":["operator"],"Tenant":"acme"}`, resw.Body.String())
+
+	for name, token := range map[string]string{
+		"wrong secret": sign(jwt.MapClaims{"sub": "deployer", "iss": "sso", "exp": exp}, "guess"),
+		"expired":      sign(jwt.MapClaims{"sub": "deployer", "iss": "sso", "exp": time.Now().Add(-time.Minute).Unix()}, "s3cret"),
+		"no expiry":    sign(jwt.MapClaims{"sub": "deployer", "iss": "sso"}, "s3cret"),
+		"wrong issuer": sign(jwt.MapClaims{"sub": "deployer", "iss": "other", "exp": exp}, "s3cret"),
+		"no subject":   sign(jwt.MapClaims{"iss": "sso", "exp": exp}, "s3cret"),
+	} {
+		assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/whoami", token, nil).Code, name)
+	}
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "deployer", "iss": "sso", "exp": exp}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/whoami", unsigned, nil).Code)
+}
+
+func TestAuthenticator_RS256(t *testing.T) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	keyFile := filepath.Join(t.TempDir(), "jwt.pem")
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+
+	router := newAuthRouter(t, workflow.NewMemoryStore(), AuthConfig{Enabled: true, JWTPublicKeyFile: keyFile})
+	claims := jwt.MapClaims{"sub": "deployer", "roles": []string{"admin"}, "exp": time.Now().Add(time.Hour).Unix()}
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(privateKey)
+	resw := serve(router, "GET", "/whoami", token, nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.JSONEq(t, `{"Subject":"deployer","Method":"jwt","Roles":["admin"],"Tenant":"default"}`, resw.Body.String())
+
+	// Without a secret HS256 tokens are refused, even when signed with the public key
+	pemBytes, _ := os.ReadFile(keyFile)
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(pemBytes)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, "GET", "/whoami", forged, nil).Code)
+
+	_, err := NewAuthenticator(workflow.NewMemoryStore(), AuthConfig{JWTPublicKeyFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestAuthenticator_Disabled(t *testing.T) {
+	router := newAuthRouter(t, workflow.NewMemoryStore(), AuthConfig{})
+
+	resw := serve(router, "GET", "/whoami", "", nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.JSONEq(t, `{"Subject":"anonymous","Method":"none","Roles":["admin"],"Tenant":"default"}`, resw.Body.String())
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// Permission is what a route requires of its client
+type Permission string
+
+const (
+	PermissionRead    Permission = "read"    // Read definitions, executions and logs
+	PermissionDesign  Permission = "design"  // Create and change workflow definitions
+	PermissionOperate Permission = "operate" // Start, signal, cancel and roll back executions
+	PermissionAdmin   Permission = "admin"   // Manage the API keys and grants of the tenant
+	// PermissionDeployment manages what the tenants share: tenant quotas, breakers and target
+	// policies. Only admins of the default tenant hold it.
+	PermissionDeployment Permission = "deployment"
+)
+
+// rolePermissions lists the permissions each role holds
+var rolePermissions = map[string][]Permission{
+	workflow.RoleViewer:   {PermissionRead},
+	workflow.RoleDesigner: {PermissionRead, PermissionDesign},
+	workflow.RoleOperator: {PermissionRead, PermissionOperate},
+	workflow.RoleAdmin:    {PermissionRead, PermissionDesign, PermissionOperate, PermissionAdmin, PermissionDeployment},
+}
+
+// allowed tells whether identity holds permission on every workflow of its tenant
+func allowed(identity Identity, permission Permission) bool {
+	if permission == PermissionDeployment && identity.Tenant != workflow.DefaultTenant {
+		return false
+	}
+	return hasPermission(identity.Roles, permission)
+}
+
+func hasPermission(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		for _, held := range rolePermissions[role] {
+			if held == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// workflowResolver returns the workflow a request acts on, uuid.Nil when it cannot tell
+type workflowResolver func(req *http.Request) (uuid.UUID, error)
+
+// Authorizer checks the permission of every route against the roles of the client and the
+// roles it was granted on the workflow the request acts on
+type Authorizer struct {
+	Store workflow.Store
+}
+
+// Require wraps a route that needs permission. When resolve is set, roles granted on the
+// workflow it returns count as well. Denied requests get 403, and they and allowed requests
+// that change something get an audit entry.
+func (a *Authorizer) Require(permission Permission, resolve workflowResolver, handler http.HandlerFunc) http.HandlerFunc {
+	handler = a.audit(handler)
+	return func(resw http.ResponseWriter, req *http.Request) {
+		identity, _ := IdentityFrom(req.Context())
+		if allowed(identity, permission) {
+			handler(resw, req)
+			return
+		}
+
+		var workflowID uuid.UUID
+		if resolve != nil {
+			var err error
+			workflowID, err = resolve(req)
+			if err != nil {
+				responseFailure(resw, err)
+				return
+			}
+		}
+		if workflowID != uuid.Nil && permission != PermissionDeployment {
+			granted, err := tenantStore(a.Store, req).GetGrantedRoles(workflowID, identity.Subject)
+			if err != nil {
+				responseFailure(resw, err)
+				return
+			}
+			if hasPermission(granted, permission) {
+				handler(resw, req)
+				return
+			}
+		}
+
+		a.deny(resw, req, identity, permission, workflowID)
+	}
+}
+
+func (a *Authorizer) deny(resw http.ResponseWriter, req *http.Request, identity Identity, permission Permission, workflowID uuid.UUID) {
+	reason := fmt.Sprintf("%s lacks the %s permission", identity.Subject, permission)
+	entry := workflow.AuditEntry{
+		TenantID:  identity.Tenant,
+		Actor:     identity.Subject,
+		Action:    routeAction(req),
+		Outcome:   workflow.AuditOutcomeDenied,
+		RequestID: RequestIDFrom(req.Context()),
+	}
+	if workflowID != uuid.Nil {
+		reason += " on workflow " + workflowID.String()
+		entry.ResourceType, entry.ResourceID = "workflow", workflowID.String()
+	}
+	reason += fmt.Sprintf(" (roles: %s)", strings.Join(identity.Roles, ", "))
+	entry.Reason = reason
+
+	if err := a.Store.InsertAuditEntry(entry); err != nil {
+		slog.Error("failed to write audit entry", "error", err)
+	}
+	responseError(resw, http.StatusForbidden, "Forbidden: "+reason)
+}
+
+// routeAction names the route of req like "POST /workflow/{id}/execute"
+func routeAction(req *http.Request) string {
+	if route := mux.CurrentRoute(req); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return req.Method + " " + template
+		}
+	}
+	return req.Method + " " + req.URL.Path
+}
+
+// workflowFromPath resolves the workflow whose ID is the id path variable
+func (a *Authorizer) workflowFromPath(req *http.Request) (uuid.UUID, error) {
+	id, _ := uuid.Parse(mux.Vars(req)["id"])
+	return id, nil
+}
+
+// workflowFromBody resolves the workflow of the workflow_id field of a JSON body of at most
+// maxRequestBody bytes. The body is put back for the handler.
+func (a *Authorizer) workflowFromBody(req *http.Request) (uuid.UUID, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, maxRequestBody))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var target struct {
+		WorkflowID uuid.UUID `json:"workflow_id"`
+	}
+	json.Unmarshal(body, &target)
+	return target.WorkflowID, nil
+}
+
+// workflowFromExecution resolves the workflow of the execution whose ID is the id path variable
+func (a *Authorizer) workflowFromExecution(req *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil {
+		return uuid.Nil, nil
+	}
+	return a.executionWorkflow(req, id)
+}
+
+// workflowFromTimer resolves the workflow of the execution of the timer whose ID is the id path variable
+func (a *Authorizer) workflowFromTimer(req *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil {
+		return uuid.Nil, nil
+	}
+	timer, err := tenantStore(a.Store, req).GetTimer(id)
+	if err != nil {
+		return uuid.Nil, ignoreNotFound(err)
+	}
+	return a.executionWorkflow(req, timer.ExecutionID)
+}
+
+// workflowFromSchedule resolves the workflow of the schedule whose ID is the id path variable
+func (a *Authorizer) workflowFromSchedule(req *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil {
+		return uuid.Nil, nil
+	}
+	schedule, err := tenantStore(a.Store, req).GetSchedule(id)
+	if err != nil {
+		return uuid.Nil, ignoreNotFound(err)
+	}
+	return schedule.WorkflowID, nil
+}
+
+func (a *Authorizer) executionWorkflow(req *http.Request, executionID uuid.UUID) (uuid.UUID, error) {
+	execution, err := tenantStore(a.Store, req).GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return uuid.Nil, ignoreNotFound(err)
+	}
+	return execution.WorkflowID, nil
+}
+
+// ignoreNotFound drops sql.ErrNoRows: missing resources resolve to no workflow, so the
+// request is denied rather than told whether the resource exists
+func ignoreNotFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// auditRecorder keeps the audit entries written through it
+type auditRecorder struct {
+	workflow.Store
+	entries []workflow.AuditEntry
+}
+
+func (r *auditRecorder) InsertAuditEntry(entry workflow.AuditEntry) error {
+	r.entries = append(r.entries, entry)
+	return r.Store.InsertAuditEntry(entry)
+}
+
+func createWorkflow(t *testing.T, store workflow.Store, name string) uuid.UUID {
+	startID, _ := store.CreateNode("Start", workflow.NodeTypeStart, "", nil)
+	endID, _ := store.CreateNode("End", workflow.NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, endID, ""))
+
+	workflowID, err := store.CreateWorkflow(name, "", startID, false)
+	assert.NoError(t, err)
+	return workflowID
+}
+
+func createKey(t *testing.T, store workflow.Store, name string, roles ...string) string {
+	key, apiKey, _ := workflow.GenerateAPIKey(name, roles)
+	_, err := store.CreateAPIKey(apiKey)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestAuthorizer_Routes(t *testing.T) {
+	t.Setenv("APP_AUTH_ENABLED", "true")
+	store := &auditRecorder{Store: workflow.NewMemoryStore()}
+	app := App{Router: mux.NewRouter(), Store: store}
+	app.initializeRoutes()
+
+	checkoutID := createWorkflow(t, store, "checkout")
+	refundID := createWorkflow(t, store, "refund")
+
+	viewer := createKey(t, store, "viewer", workflow.RoleViewer)
+	designer := createKey(t, store, "designer", workflow.RoleDesigner)
+	operator := createKey(t, store, "operator", workflow.RoleOperator)
+	admin := createKey(t, store, "admin", workflow.RoleAdmin)
+
+	execute := func(workflowID uuid.UUID) []byte {
+		body, _ := json.Marshal(map[string]interface{}{"workflow_id": workflowID, "reference_number": uuid.NewString()})
+		return body
+	}
+	node := []byte(`{"title":"Charge","type":"Task"}`)
+
+	assert.Equal(t, http.StatusOK, serve(app.Router, "GET", "/workflow/"+checkoutID.String()+"/graph", viewer, nil).Code)
+	assert.Equal(t, http.StatusCreated, serve(app.Router, "POST", "/workflow/node", designer, node).Code)
+	assert.Equal(t, http.StatusCreated, serve(app.Router, "POST", "/workflow/execution", operator, execute(checkoutID)).Code)
+
+	resw := serve(app.Router, "POST", "/workflow/node", viewer, node)
+	assert.Equal(t, http.StatusForbidden, resw.Code)
+	assert.Contains(t, resw.Body.String(), "viewer lacks the design permission")
+	assert.Equal(t, http.StatusForbidden, serve(app.Router, "POST", "/workflow/execution", designer, execute(checkoutID)).Code)
+	assert.Equal(t, http.StatusForbidden, serve(app.Router, "GET", "/auth/keys", operator, nil).Code)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "GET", "/auth/keys", admin, nil).Code)
+
+	// A grant lets the viewer run checkout, and only checkout
+	grant, _ := json.Marshal(workflowGrantRequest{WorkflowID: checkoutID, Subject: "viewer", Role: workflow.RoleOperator})
+	assert.Equal(t, http.StatusCreated, serve(app.Router, "POST", "/auth/grants", admin, grant).Code)
+
+	resw = serve(app.Router, "POST", "/workflow/execution", viewer, execute(checkoutID))
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	var execution workflow.WorkflowExecution
+	json.Unmarshal(resw.Body.Bytes(), &execution)
+	executionID := execution.ID
+	assert.Equal(t, http.StatusOK, serve(app.Router, "POST", "/workflow/execution/"+executionID.String()+"/execute", viewer, nil).Code)
+
+	resw = serve(app.Router, "POST", "/workflow/execution", viewer, execute(refundID))
+	assert.Equal(t, http.StatusForbidden, resw.Code)
+	assert.Contains(t, resw.Body.String(), "on workflow "+refundID.String())
+
+	// The workflow is looked up in bodies of up to maxRequestBody bytes only
+	resw = serve(app.Router, "POST", "/workflow/execution", viewer, []byte(strings.Repeat(" ", maxRequestBody+1)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resw.Code)
+
+	// Every denial is audited
+	var denied []workflow.AuditEntry
+	for _, entry := range store.entries {
+		if entry.Outcome == workflow.AuditOutcomeDenied {
+			denied = append(denied, entry)
+		}
+	}
+	if assert.Len(t, denied, 4) {
+		entry := denied[3]
+		assert.Equal(t, "viewer", entry.Actor)
+		assert.Equal(t, "POST /workflow/execution", entry.Action)
+		assert.Equal(t, workflow.AuditOutcomeDenied, entry.Outcome)
+		assert.Equal(t, refundID.String(), entry.ResourceID)
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kadzany/frosty/workflow"
+)
+
+// EgressPolicyFromEnv builds the policy of task calls. Unless configured otherwise tasks call
+// http and https URLs on any host and port, except loopback, link-local, metadata and multicast
+// addresses. APP_EGRESS_DENY_PRIVATE also keeps them out of internal networks.
+func EgressPolicyFromEnv() (workflow.EgressPolicy, error) {
+	policy := workflow.EgressPolicy{
+		AllowedSchemes: []string{"http", "https"},
+		AllowedHosts:   envList("APP_EGRESS_ALLOWED_HOSTS"),
+		DeniedHosts:    envList("APP_EGRESS_DENIED_HOSTS"),
+		DeniedCIDRs:    append([]netip.Prefix(nil), workflow.DefaultDeniedCIDRs...),
+	}
+	if schemes := envList("APP_EGRESS_ALLOWED_SCHEMES"); len(schemes) > 0 {
+		policy.AllowedSchemes = schemes
+	}
+
+	for _, value := range envList("APP_EGRESS_ALLOWED_PORTS") {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return workflow.EgressPolicy{}, fmt.Errorf("invalid port %q in APP_EGRESS_ALLOWED_PORTS", value)
+		}
+		policy.AllowedPorts = append(policy.AllowedPorts, port)
+	}
+
+	if denyPrivate, _ := strconv.ParseBool(os.Getenv("APP_EGRESS_DENY_PRIVATE")); denyPrivate {
+		policy.DeniedCIDRs = append(policy.DeniedCIDRs, workflow.PrivateCIDRs...)
+	}
+	denied, err := workflow.ParsePrefixes(envList("APP_EGRESS_DENIED_CIDRS"))
+	if err != nil {
+		return workflow.EgressPolicy{}, fmt.Errorf("APP_EGRESS_DENIED_CIDRS: %v", err)
+	}
+	policy.DeniedCIDRs = append(policy.DeniedCIDRs, denied...)
+
+	policy.AllowedCIDRs, err = workflow.ParsePrefixes(envList("APP_EGRESS_ALLOWED_CIDRS"))
+	if err != nil {
+		return workflow.EgressPolicy{}, fmt.Errorf("APP_EGRESS_ALLOWED_CIDRS: %v", err)
+	}
+	return policy, nil
+}
+
+// envList splits a comma separated variable, dropping empty items
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
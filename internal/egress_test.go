@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressPolicyFromEnv(t *testing.T) {
+	policy, err := EgressPolicyFromEnv()
+	assert.NoError(t, err)
+	assert.ErrorIs(t, policy.CheckURL("http://169.254.169.254/"), workflow.ErrEgressDenied)
+	assert.ErrorIs(t, policy.CheckURL("file:///etc/passwd"), workflow.ErrEgressDenied)
+	assert.NoError(t, policy.CheckURL("http://10.0.0.5:8080/"))
+
+	t.Setenv("APP_EGRESS_DENY_PRIVATE", "true")
+	t.Setenv("APP_EGRESS_ALLOWED_CIDRS", "10.0.0.5")
+	t.Setenv("APP_EGRESS_DENIED_CIDRS", "203.0.113.0/24")
+	t.Setenv("APP_EGRESS_ALLOWED_PORTS", "443, 8443")
+	t.Setenv("APP_EGRESS_DENIED_HOSTS", "*.corp.example.com")
+	policy, err = EgressPolicyFromEnv()
+	assert.NoError(t, err)
+	assert.NoError(t, policy.CheckURL("https://10.0.0.5/"))
+	assert.ErrorIs(t, policy.CheckURL("https://10.0.0.6/"), workflow.ErrEgressDenied)
+	assert.ErrorIs(t, policy.CheckURL("https://203.0.113.7/"), workflow.ErrEgressDenied)
+	assert.ErrorIs(t, policy.CheckURL("http://10.0.0.5/"), workflow.ErrEgressDenied)
+	assert.ErrorIs(t, policy.CheckURL("https://hr.corp.example.com/"), workflow.ErrEgressDenied)
+
+	t.Setenv("APP_EGRESS_DENIED_CIDRS", "10.0.0.0/33")
+	_, err = EgressPolicyFromEnv()
+	assert.Error(t, err)
+}
+
+func TestWorkflowHandler_CreateTask_EgressDenied(t *testing.T) {
+	defer func(policy workflow.EgressPolicy) { workflow.Egress = policy }(workflow.Egress)
+	workflow.Egress = workflow.EgressPolicy{DeniedCIDRs: workflow.DefaultDeniedCIDRs}
+
+	handler := WorkflowHandler{Store: workflow.NewMemoryStore()}
+	req, _ := http.NewRequest("POST", "/workflow/task", bytes.NewBufferString(`{"title":"Metadata","type":"API","http_method":"GET","action":"http://169.254.169.254/latest/meta-data"}`))
+	resw := httptest.NewRecorder()
+
+	handler.CreateTask(resw, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resw.Code)
+	assert.Contains(t, resw.Body.String(), "denied range 169.254.0.0/16")
+}
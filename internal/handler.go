@@ -1,8 +1,10 @@
 package internal
 
 import (
-	"database/sql"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -12,25 +14,38 @@ import (
 )
 
 type WorkflowHandler struct {
-	DB *sql.DB
+	Store workflow.Store
 }
 
-func (wh *WorkflowHandler) CreateNode(resw http.ResponseWriter, req *http.Request) {
-	node := workflow.Node{}
-	decoder := json.NewDecoder(req.Body)
+// store returns the Store confined to the tenant of the client of req
+func (wh *WorkflowHandler) store(req *http.Request) workflow.Store {
+	return tenantStore(wh.Store, req)
+}
+
+// executionState is the execution for the audit entry of req, see auditState
+func (wh *WorkflowHandler) executionState(req *http.Request, id uuid.UUID) interface{} {
+	return auditState(req, func() (interface{}, error) { return wh.store(req).GetWorkflowExecutionByID(id) })
+}
 
-	if err := decoder.Decode(&node); err != nil {
-		responseError(resw, http.StatusBadRequest, "Invalid request payload")
+func (wh *WorkflowHandler) CreateNode(resw http.ResponseWriter, req *http.Request) {
+	var body createNodeRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+	if !checkQuota(resw, wh.store(req), workflow.QuotaNodes) {
+		return
 	}
-	defer req.Body.Close()
 
-	id, err := workflow.CreateNode(wh.DB, node.Title, node.Type, node.Description)
+	node := body.node()
+	id, err := wh.store(req).CreateNode(node.Title, node.Type, node.Description, node.Config)
 
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
+	node.ID = id
+	auditResource(req, "node", id, nil, node)
 	responseJson(resw, http.StatusCreated, id)
 }
 
@@ -40,11 +55,12 @@ func (wh *WorkflowHandler) GetNode(resw http.ResponseWriter, req *http.Request)
 
 	if err != nil {
 		responseError(resw, http.StatusBadRequest, "Invalid Node Id")
+		return
 	}
 
-	node, err := workflow.GetNode(wh.DB, id)
+	node, err := wh.store(req).GetNode(id)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
@@ -52,19 +68,19 @@ func (wh *WorkflowHandler) GetNode(resw http.ResponseWriter, req *http.Request)
 }
 
 func (wh *WorkflowHandler) AddRelationship(resw http.ResponseWriter, req *http.Request) {
-	var relationship workflow.NodeClosure
-	decoder := json.NewDecoder(req.Body)
-
-	if err := decoder.Decode(&relationship); err != nil {
-		responseError(resw, http.StatusBadRequest, "Invalid request payload")
+	var body addRelationshipRequest
+	if !decodeRequest(resw, req, &body) {
+		return
 	}
-	defer req.Body.Close()
 
-	err := workflow.AddRelationship(wh.DB, relationship.Ancestor, relationship.Descendant)
+	relationship := workflow.NodeClosure{Ancestor: body.Ancestor, Descendant: body.Descendant, Condition: body.Condition}
+	err := wh.store(req).AddRelationship(relationship.Ancestor, relationship.Descendant, relationship.Condition)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
+
+	auditResource(req, "node", relationship.Ancestor, nil, relationship)
 	responseJson(resw, http.StatusCreated, relationship)
 }
 
@@ -77,87 +93,160 @@ func (wh *WorkflowHandler) ExecuteWorkflow(resw http.ResponseWriter, req *http.R
 		return
 	}
 
-	err = workflow.ExecuteWorkflow(wh.DB, id)
+	err = workflow.ExecuteWorkflow(executionContext(req), wh.store(req), id)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
+	auditResource(req, "workflow", id, nil, nil)
+
 	responseJson(resw, http.StatusOK, nil)
 }
 
 func (wh *WorkflowHandler) CreateWorkflow(resw http.ResponseWriter, req *http.Request) {
-	wf := workflow.Workflow{}
-	decoder := json.NewDecoder(req.Body)
+	var wf createWorkflowRequest
+	if !decodeRequest(resw, req, &wf) {
+		return
+	}
 
-	if err := decoder.Decode(&wf); err != nil {
-		responseError(resw, http.StatusBadRequest, "Invalid request payload")
+	if !checkQuota(resw, wh.store(req), workflow.QuotaWorkflows) {
 		return
 	}
-	defer req.Body.Close()
 
-	id, err := workflow.CreateWorkflow(wh.DB, wf.Name, wf.Description, wf.StartingNodeID)
+	id, err := wh.store(req).CreateWorkflow(wf.Name, wf.Description, wf.StartingNodeID, wf.UniqueReference)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
+	auditResource(req, "workflow", id, nil, auditState(req, func() (interface{}, error) { return wh.store(req).GetWorkflow(id) }))
+
 	responseJson(resw, http.StatusCreated, id)
 }
 
-func (wh *WorkflowHandler) CreateTask(resw http.ResponseWriter, req *http.Request) {
-	task := workflow.Task{}
-	decoder := json.NewDecoder(req.Body)
+// ListWorkflows returns the workflows of the tenant of the client, newest first, filtered by
+// the name, limit and offset query parameters
+func (wh *WorkflowHandler) ListWorkflows(resw http.ResponseWriter, req *http.Request) {
+	filter := workflow.WorkflowFilter{Name: req.URL.Query().Get("name")}
+	if !parsePage(resw, req, &filter.Limit, &filter.Offset) {
+		return
+	}
 
-	if err := decoder.Decode(&task); err != nil {
-		responseError(resw, http.StatusBadRequest, "Invalid request payload")
+	workflows, err := wh.store(req).ListWorkflows(filter)
+	if err != nil {
+		responseFailure(resw, err)
+		return
 	}
-	defer req.Body.Close()
 
-	id, err := workflow.CreateTask(wh.DB, task.Title, task.Type, task.HttpMethod, task.Action, task.Params, task.MaxRetries)
+	responseJson(resw, http.StatusOK, workflows)
+}
+
+func (wh *WorkflowHandler) GetWorkflow(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Id")
+		return
+	}
+
+	wf, err := wh.store(req).GetWorkflow(id)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
+	responseJson(resw, http.StatusOK, wf)
+}
+
+func (wh *WorkflowHandler) CreateTask(resw http.ResponseWriter, req *http.Request) {
+	var task createTaskRequest
+	if !decodeRequest(resw, req, &task) {
+		return
+	}
+	if !checkQuota(resw, wh.store(req), workflow.QuotaTasks) {
+		return
+	}
+
+	id, err := wh.store(req).CreateTask(task.Title, task.Type, task.HttpMethod, task.Action, task.Params, task.MaxRetries)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "task", id, nil, auditState(req, func() (interface{}, error) { return wh.store(req).GetTask(id) }))
+
 	responseJson(resw, http.StatusCreated, id)
 }
 
-func (wh *WorkflowHandler) AddTaskToNode(resw http.ResponseWriter, req *http.Request) {
-	var nodeTask workflow.NodeTask
-	decoder := json.NewDecoder(req.Body)
+func (wh *WorkflowHandler) GetTask(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
 
-	if err := decoder.Decode(&nodeTask); err != nil {
-		responseError(resw, http.StatusBadRequest, "Invalid request payload")
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Task Id")
+		return
+	}
+
+	task, err := wh.store(req).GetTask(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, task)
+}
+
+func (wh *WorkflowHandler) AddTaskToNode(resw http.ResponseWriter, req *http.Request) {
+	var body addTaskToNodeRequest
+	if !decodeRequest(resw, req, &body) {
+		return
 	}
-	defer req.Body.Close()
 
-	err := workflow.AddTaskToNode(wh.DB, nodeTask.NodeID, nodeTask.TaskID, nodeTask.TaskOrder)
+	nodeTask := workflow.NodeTask{NodeID: body.NodeID, TaskID: body.TaskID, TaskOrder: body.TaskOrder}
+	err := wh.store(req).AddTaskToNode(nodeTask.NodeID, nodeTask.TaskID, nodeTask.TaskOrder)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
+	auditResource(req, "node", nodeTask.NodeID, nil, nodeTask)
 	responseJson(resw, http.StatusCreated, nodeTask)
 }
 
 func (wh *WorkflowHandler) CreateWorkflowExecution(resw http.ResponseWriter, req *http.Request) {
-	var wfExec workflow.WorkflowExecution
-	decoder := json.NewDecoder(req.Body)
+	var wfExec createExecutionRequest
+	if !decodeRequest(resw, req, &wfExec) {
+		return
+	}
 
-	if err := decoder.Decode(&wfExec); err != nil {
-		responseError(resw, http.StatusBadRequest, "Invalid request payload")
+	if !checkQuota(resw, wh.store(req), workflow.QuotaExecutions) {
 		return
 	}
-	defer req.Body.Close()
 
-	id, err := workflow.CreateWorkflowExecution(wh.DB, wfExec.WorkflowID, wfExec.ReferenceNumber)
+	// Retried requests carrying the same Idempotency-Key get the execution created by the first one
+	id, created, err := wh.store(req).CreateWorkflowExecution(wfExec.WorkflowID, wfExec.ReferenceNumber, wfExec.Data, req.Header.Get("Idempotency-Key"))
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
-	responseJson(resw, http.StatusCreated, id)
+	execution, err := wh.store(req).GetWorkflowExecutionByID(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	if !created {
+		auditResource(req, "execution", id, nil, nil)
+		resw.Header().Set("Idempotent-Replayed", "true")
+		responseJson(resw, http.StatusOK, execution)
+		return
+	}
+
+	auditResource(req, "execution", id, nil, execution)
+	responseJson(resw, http.StatusCreated, execution)
 }
 
 func (wh *WorkflowHandler) ExecuteWorkflowByExecutionID(resw http.ResponseWriter, req *http.Request) {
@@ -169,11 +258,267 @@ func (wh *WorkflowHandler) ExecuteWorkflowByExecutionID(resw http.ResponseWriter
 		return
 	}
 
-	err = workflow.ExecuteWorkflowByExecutionID(wh.DB, id)
+	before := wh.executionState(req, id)
+	err = workflow.ExecuteWorkflowByExecutionID(executionContext(req), wh.store(req), id)
 	if err != nil {
-		responseError(resw, http.StatusInternalServerError, err.Error())
+		responseFailure(resw, err)
 		return
 	}
 
+	auditResource(req, "execution", id, before, wh.executionState(req, id))
+
 	responseJson(resw, http.StatusOK, nil)
 }
+
+func (wh *WorkflowHandler) GetWorkflowExecution(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	tree, err := workflow.GetExecutionTree(wh.store(req), id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, tree)
+}
+
+// ListWorkflowExecutions returns the executions of the tenant of the client, newest first,
+// filtered by the workflow_id, status, reference_number, limit and offset query parameters
+func (wh *WorkflowHandler) ListWorkflowExecutions(resw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := workflow.ExecutionFilter{Status: query.Get("status"), ReferenceNumber: query.Get("reference_number")}
+	if value := query.Get("workflow_id"); value != "" {
+		var err error
+		filter.WorkflowID, err = uuid.Parse(value)
+		if err != nil {
+			responseError(resw, http.StatusBadRequest, "Invalid Workflow Id")
+			return
+		}
+	}
+	if !parsePage(resw, req, &filter.Limit, &filter.Offset) {
+		return
+	}
+
+	executions, err := wh.store(req).ListWorkflowExecutions(filter)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, executions)
+}
+
+func (wh *WorkflowHandler) RollbackWorkflowExecution(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	before := wh.executionState(req, id)
+	err = workflow.RollbackExecution(executionContext(req), wh.store(req), id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "execution", id, before, wh.executionState(req, id))
+
+	responseJson(resw, http.StatusOK, nil)
+}
+
+// CancelWorkflowExecution cancels a pending or waiting execution with everything it is parked on
+func (wh *WorkflowHandler) CancelWorkflowExecution(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	before := wh.executionState(req, id)
+	err = workflow.CancelWorkflowExecution(executionContext(req), wh.store(req), id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "execution", id, before, wh.executionState(req, id))
+
+	responseJson(resw, http.StatusOK, nil)
+}
+
+// ResumeWorkflowExecution fires the pending timers of an execution now and resumes it after them
+func (wh *WorkflowHandler) ResumeWorkflowExecution(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	before := wh.executionState(req, id)
+	err = workflow.FireExecutionTimers(executionContext(req), wh.store(req), id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "execution", id, before, wh.executionState(req, id))
+
+	responseJson(resw, http.StatusOK, nil)
+}
+
+func (wh *WorkflowHandler) SignalWorkflowExecution(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	// The payload is optional, but has to be a JSON object to be merged into the execution data
+	var payload map[string]json.RawMessage
+	req.Body = http.MaxBytesReader(resw, req.Body, maxRequestBody)
+	err = decodeStrict(req.Body, &payload)
+	defer req.Body.Close()
+	if err != nil && !errors.Is(err, io.EOF) {
+		responseUnreadable(resw, err)
+		return
+	}
+
+	var data json.RawMessage
+	if payload != nil {
+		data, _ = json.Marshal(payload)
+	}
+
+	before := wh.executionState(req, id)
+	err = workflow.SignalWorkflowExecution(executionContext(req), wh.store(req), id, vars["name"], data)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "execution", id, before, wh.executionState(req, id))
+	responseJson(resw, http.StatusOK, nil)
+}
+
+func (wh *WorkflowHandler) GetExecutionTimeline(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	timeline, err := workflow.GetExecutionTimeline(wh.store(req), id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	var body bytes.Buffer
+	switch req.URL.Query().Get("format") {
+	case "", "json":
+		responseJson(resw, http.StatusOK, timeline)
+	case "text":
+		if err := workflow.RenderTimelineText(&body, timeline); err != nil {
+			responseFailure(resw, err)
+			return
+		}
+		responseRaw(resw, http.StatusOK, "text/plain; charset=utf-8", body.Bytes())
+	case "html":
+		if err := workflow.RenderTimelineHTML(&body, timeline); err != nil {
+			responseFailure(resw, err)
+			return
+		}
+		responseRaw(resw, http.StatusOK, "text/html; charset=utf-8", body.Bytes())
+	default:
+		responseError(resw, http.StatusBadRequest, "Invalid format, expected json, text or html")
+	}
+}
+
+// GetExecutionLogs returns the log entries of an execution, oldest first
+func (wh *WorkflowHandler) GetExecutionLogs(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+		return
+	}
+
+	// Logs have no tenant of their own, they belong to the tenant of their execution
+	if _, err := wh.store(req).GetWorkflowExecutionByID(id); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	logs, err := wh.store(req).GetExecutionLogs(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+	if logs == nil {
+		logs = []workflow.WorkflowLog{}
+	}
+
+	responseJson(resw, http.StatusOK, logs)
+}
+
+func (wh *WorkflowHandler) GetWorkflowGraph(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Workflow Id")
+		return
+	}
+
+	executionID := uuid.Nil
+	if value := req.URL.Query().Get("execution_id"); value != "" {
+		executionID, err = uuid.Parse(value)
+		if err != nil {
+			responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+			return
+		}
+	}
+
+	graph, err := workflow.GetWorkflowGraph(wh.store(req), id, executionID)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	var body bytes.Buffer
+	switch req.URL.Query().Get("format") {
+	case "", "json":
+		responseJson(resw, http.StatusOK, graph)
+	case "dot":
+		if err := workflow.RenderDOT(&body, graph); err != nil {
+			responseFailure(resw, err)
+			return
+		}
+		responseRaw(resw, http.StatusOK, "text/vnd.graphviz; charset=utf-8", body.Bytes())
+	case "mermaid":
+		if err := workflow.RenderMermaid(&body, graph); err != nil {
+			responseFailure(resw, err)
+			return
+		}
+		responseRaw(resw, http.StatusOK, "text/plain; charset=utf-8", body.Bytes())
+	default:
+		responseError(resw, http.StatusBadRequest, "Invalid format, expected dot, mermaid or json")
+	}
+}
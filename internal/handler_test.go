@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -19,8 +20,8 @@ func TestWorkflowHandler_CreateNode(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
-	handler := WorkflowHandler{DB: db}
-	node := workflow.Node{
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	node := createNodeRequest{
 		Title:       "Test Node",
 		Type:        "Task",
 		Description: "Test Description",
@@ -28,7 +29,7 @@ func TestWorkflowHandler_CreateNode(t *testing.T) {
 	nodeJSON, _ := json.Marshal(node)
 
 	mock.ExpectQuery("INSERT INTO nodes").
-		WithArgs("Test Node", "Task", "Test Description").
+		WithArgs("Test Node", "Task", "Test Description", nil, workflow.DefaultTenant).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
 
 	req, _ := http.NewRequest("POST", "/workflow/node", bytes.NewBuffer(nodeJSON))
@@ -43,13 +44,13 @@ func TestWorkflowHandler_GetNode(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
-	handler := WorkflowHandler{DB: db}
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
 	nodeID := uuid.New()
 
-	mock.ExpectQuery("SELECT id::uuid, title, type, description, created_at, updated_at, deleted_at FROM nodes WHERE id = ?").
-		WithArgs(nodeID.String()).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "type", "description", "created_at", "updated_at", "deleted_at"}).
-			AddRow(nodeID.String(), "Test Node", "Task", "Test Description", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), nil))
+	mock.ExpectQuery("SELECT id::uuid, title, type, description, created_at, updated_at, deleted_at, config FROM nodes WHERE id = ?").
+		WithArgs(nodeID.String(), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "type", "description", "created_at", "updated_at", "deleted_at", "config"}).
+			AddRow(nodeID.String(), "Test Node", "Task", "Test Description", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), nil, nil))
 
 	req, _ := http.NewRequest("GET", "/workflow/node/"+nodeID.String(), nil)
 	resw := httptest.NewRecorder()
@@ -64,13 +65,16 @@ func TestWorkflowHandler_AddRelationship(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
-	handler := WorkflowHandler{DB: db}
-	relationship := workflow.NodeClosure{
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	relationship := addRelationshipRequest{
 		Ancestor:   uuid.New(),
 		Descendant: uuid.New(),
 	}
 	relationshipJSON, _ := json.Marshal(relationship)
 
+	mock.ExpectQuery("WITH RECURSIVE reachable").
+		WithArgs(relationship.Descendant, relationship.Ancestor).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 	mock.ExpectExec("INSERT INTO node_closure").WillReturnResult(sqlmock.NewResult(1, 1))
 
 	req, _ := http.NewRequest("POST", "/workflow/node/relationship", bytes.NewBuffer(relationshipJSON))
@@ -81,12 +85,37 @@ func TestWorkflowHandler_AddRelationship(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, resw.Code)
 }
 
+func TestWorkflowHandler_AddRelationship_Cycle(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	relationship := addRelationshipRequest{
+		Ancestor:   uuid.New(),
+		Descendant: uuid.New(),
+	}
+	relationshipJSON, _ := json.Marshal(relationship)
+
+	mock.ExpectQuery("WITH RECURSIVE reachable").
+		WithArgs(relationship.Descendant, relationship.Ancestor).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	req, _ := http.NewRequest("POST", "/workflow/node/relationship", bytes.NewBuffer(relationshipJSON))
+	resw := httptest.NewRecorder()
+
+	handler.AddRelationship(resw, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resw.Code)
+	assert.Contains(t, resw.Body.String(), `"code":"cycle"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestWorkflowHandler_CreateTask(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
-	handler := WorkflowHandler{DB: db}
-	task := workflow.Task{
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	task := createTaskRequest{
 		Title:      "Test Task",
 		Type:       "API",
 		HttpMethod: "POST",
@@ -97,7 +126,7 @@ func TestWorkflowHandler_CreateTask(t *testing.T) {
 	taskJSON, _ := json.Marshal(task)
 
 	mock.ExpectQuery("INSERT INTO tasks").
-		WithArgs("Test Task", "API", "POST", "http://example.com/api", "{}", 3).
+		WithArgs("Test Task", "API", "POST", "http://example.com/api", "{}", 3, workflow.DefaultTenant).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
 
 	req, _ := http.NewRequest("POST", "/workflow/task", bytes.NewBuffer(taskJSON))
@@ -112,11 +141,11 @@ func TestWorkflowHandler_AddTaskToNode(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
-	handler := WorkflowHandler{DB: db}
-	nodeTask := workflow.NodeTask{
-		NodeID:     uuid.New(),
-		TaskID:     uuid.New(),
-		TaskOrder:  1,
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	nodeTask := addTaskToNodeRequest{
+		NodeID:    uuid.New(),
+		TaskID:    uuid.New(),
+		TaskOrder: 1,
 	}
 	nodeTaskJSON, _ := json.Marshal(nodeTask)
 
@@ -129,3 +158,311 @@ func TestWorkflowHandler_AddTaskToNode(t *testing.T) {
 
 	assert.Equal(t, http.StatusCreated, resw.Code)
 }
+
+func TestWorkflowHandler_CreateSchedule(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	workflowID := uuid.New()
+	scheduleJSON := []byte(`{"workflow_id":"` + workflowID.String() + `","cron_expression":"0 1 * * *","timezone":"Europe/Amsterdam","payload_template":"{\"day\":\"{{.ScheduledAt.Format \"2006-01-02\"}}\"}"}`)
+
+	mock.ExpectQuery("INSERT INTO workflow_schedules").
+		WithArgs(workflowID, "0 1 * * *", 0, "Europe/Amsterdam", sqlmock.AnyArg(), "schedule-{{.ScheduleID}}-{{.ScheduledAt.Unix}}", "skip", true, sqlmock.AnyArg(), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New().String()))
+
+	req, _ := http.NewRequest("POST", "/workflow/schedule", bytes.NewBuffer(scheduleJSON))
+	resw := httptest.NewRecorder()
+
+	handler.CreateSchedule(resw, req)
+
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowHandler_CreateSchedule_InvalidCron(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	scheduleJSON := []byte(`{"workflow_id":"` + uuid.New().String() + `","cron_expression":"every day"}`)
+
+	req, _ := http.NewRequest("POST", "/workflow/schedule", bytes.NewBuffer(scheduleJSON))
+	resw := httptest.NewRecorder()
+
+	handler.CreateSchedule(resw, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resw.Code)
+}
+
+func TestWorkflowHandler_CreateNode_InvalidWaitConfig(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	node := createNodeRequest{
+		Title:  "Manager Approval",
+		Type:   workflow.NodeTypeWait,
+		Config: json.RawMessage(`{"timeout":"48h"}`),
+	}
+	nodeJSON, _ := json.Marshal(node)
+
+	req, _ := http.NewRequest("POST", "/workflow/node", bytes.NewBuffer(nodeJSON))
+	resw := httptest.NewRecorder()
+
+	handler.CreateNode(resw, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resw.Code)
+}
+
+func TestWorkflowHandler_SignalWorkflowExecution_NoPendingWait(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	executionID := uuid.New()
+
+	mock.ExpectQuery("SELECT (.+) FROM execution_waits").
+		WithArgs(executionID, "approved", workflow.WaitStatusWaiting, "").
+		WillReturnError(sql.ErrNoRows)
+
+	req, _ := http.NewRequest("POST", "/workflow/execution/"+executionID.String()+"/signal/approved", bytes.NewBufferString(`{"approver":"jane"}`))
+	resw := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": executionID.String(), "name": "approved"})
+
+	handler.SignalWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusNotFound, resw.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowHandler_SignalWorkflowExecution_InvalidPayload(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	executionID := uuid.New()
+
+	req, _ := http.NewRequest("POST", "/workflow/execution/"+executionID.String()+"/signal/approved", bytes.NewBufferString(`["not", "an", "object"]`))
+	resw := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": executionID.String(), "name": "approved"})
+
+	handler.SignalWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusBadRequest, resw.Code)
+}
+
+func TestWorkflowHandler_CancelTimer_AlreadyFired(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	timerID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM workflow_timers WHERE id = ?").
+		WithArgs(timerID, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "execution_id", "node_id", "fire_at", "status", "created_at", "resolved_at", "resumed_at"}).
+			AddRow(timerID, uuid.New(), uuid.New(), now, workflow.TimerStatusFired, now, now, now))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE workflow_timers").
+		WithArgs(workflow.TimerStatusCancelled, timerID, workflow.TimerStatusPending, "").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	req, _ := http.NewRequest("DELETE", "/workflow/timer/"+timerID.String(), nil)
+	resw := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": timerID.String()})
+
+	handler.CancelTimer(resw, req)
+
+	assert.Equal(t, http.StatusConflict, resw.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+var workflowExecutionColumns = []string{
+	"id", "workflow_id", "last_executed_node_id", "last_executed_task_id", "reference_number", "status", "message",
+	"last_node_executed_at", "last_node_completed_at", "last_task_executed_at", "last_task_completed_at", "created_at", "updated_at", "data",
+	"parent_execution_id", "parent_node_id", "idempotency_key", "version", "tenant_id", "lease_expires_at",
+}
+
+func TestWorkflowHandler_GetWorkflowExecution(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	workflowID, parentID, childID, nodeID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+	columns := workflowExecutionColumns
+
+	mock.ExpectQuery("SELECT (.+) FROM workflow_executions WHERE id = ?").
+		WithArgs(parentID, "").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(parentID, workflowID, nil, nil, "ORD-1", "waiting", "", now, nil, now, nil, now, now, nil, nil, nil, "", 2, workflow.DefaultTenant, nil))
+	mock.ExpectQuery("SELECT (.+) FROM workflow_executions WHERE parent_execution_id = ?").
+		WithArgs(parentID, "").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(childID, uuid.New(), nil, nil, "ORD-1/address-validation", "waiting", "", now, nil, now, nil, now, now, []byte(`{"city":"Jakarta"}`), parentID, nodeID, "", 1, workflow.DefaultTenant, nil))
+	mock.ExpectQuery("SELECT (.+) FROM workflow_executions WHERE parent_execution_id = ?").
+		WithArgs(childID, "").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	req, _ := http.NewRequest("GET", "/workflow/execution/"+parentID.String(), nil)
+	resw := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": parentID.String()})
+
+	handler.GetWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var tree workflow.ExecutionTree
+	assert.NoError(t, json.Unmarshal(resw.Body.Bytes(), &tree))
+	assert.Equal(t, parentID, tree.ID)
+	if assert.Len(t, tree.Children, 1) {
+		assert.Equal(t, childID, tree.Children[0].ID)
+		assert.Equal(t, &parentID, tree.Children[0].ParentExecutionID)
+		assert.Empty(t, tree.Children[0].Children)
+	}
+}
+
+func TestWorkflowHandler_GetWorkflowExecution_NotFound(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	executionID := uuid.New()
+
+	mock.ExpectQuery("SELECT (.+) FROM workflow_executions WHERE id = ?").
+		WithArgs(executionID, "").
+		WillReturnError(sql.ErrNoRows)
+
+	req, _ := http.NewRequest("GET", "/workflow/execution/"+executionID.String(), nil)
+	resw := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": executionID.String()})
+
+	handler.GetWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusNotFound, resw.Code)
+}
+
+func TestWorkflowHandler_CreateWorkflowExecution_IdempotencyKey(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	workflowID, executionID := uuid.New(), uuid.New()
+	now := time.Now()
+	body := `{"workflow_id":"` + workflowID.String() + `","reference_number":"ORD-1"}`
+
+	// First request creates the execution
+	mock.ExpectQuery("INSERT INTO workflow_executions").
+		WithArgs(workflowID, "ORD-1", nil, "key-1", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(executionID))
+	mock.ExpectQuery("SELECT (.+) FROM workflow_executions WHERE id = ?").
+		WithArgs(executionID, "").
+		WillReturnRows(sqlmock.NewRows(workflowExecutionColumns).
+			AddRow(executionID, workflowID, nil, nil, "ORD-1", "pending", "", now, nil, now, nil, now, now, nil, nil, nil, "key-1", 1, workflow.DefaultTenant, nil))
+
+	req, _ := http.NewRequest("POST", "/workflow/execution", bytes.NewBufferString(body))
+	req.Header.Set("Idempotency-Key", "key-1")
+	resw := httptest.NewRecorder()
+	handler.CreateWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	var created workflow.WorkflowExecution
+	assert.NoError(t, json.Unmarshal(resw.Body.Bytes(), &created))
+	assert.Equal(t, executionID, created.ID)
+	assert.Equal(t, "pending", created.Status)
+
+	// The retry hits the unique index and gets the existing execution back
+	mock.ExpectQuery("INSERT INTO workflow_executions").
+		WithArgs(workflowID, "ORD-1", nil, "key-1", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT id FROM workflow_executions").
+		WithArgs(workflowID, "key-1", "ORD-1", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(executionID))
+	mock.ExpectQuery("SELECT (.+) FROM workflow_executions WHERE id = ?").
+		WithArgs(executionID, "").
+		WillReturnRows(sqlmock.NewRows(workflowExecutionColumns).
+			AddRow(executionID, workflowID, nil, nil, "ORD-1", "executing", "", now, nil, now, nil, now, now, nil, nil, nil, "key-1", 1, workflow.DefaultTenant, nil))
+
+	req, _ = http.NewRequest("POST", "/workflow/execution", bytes.NewBufferString(body))
+	req.Header.Set("Idempotency-Key", "key-1")
+	resw = httptest.NewRecorder()
+	handler.CreateWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.Equal(t, "true", resw.Header().Get("Idempotent-Replayed"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	var execution workflow.WorkflowExecution
+	assert.NoError(t, json.Unmarshal(resw.Body.Bytes(), &execution))
+	assert.Equal(t, executionID, execution.ID)
+	assert.Equal(t, "executing", execution.Status)
+}
+
+func TestWorkflowHandler_CreateWorkflowExecution_UnknownWorkflow(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	workflowID := uuid.New()
+
+	mock.ExpectQuery("INSERT INTO workflow_executions").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT id FROM workflow_executions").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req, _ := http.NewRequest("POST", "/workflow/execution", bytes.NewBufferString(`{"workflow_id":"`+workflowID.String()+`","reference_number":"ORD-1"}`))
+	resw := httptest.NewRecorder()
+	handler.CreateWorkflowExecution(resw, req)
+
+	assert.Equal(t, http.StatusNotFound, resw.Code)
+}
+
+func TestWorkflowHandler_MemoryStore(t *testing.T) {
+	handler := WorkflowHandler{Store: workflow.NewMemoryStore()}
+
+	req, _ := http.NewRequest("POST", "/workflow/node", bytes.NewBufferString(`{"title":"Approval","type":"Wait","config":{"signal":"approved"}}`))
+	resw := httptest.NewRecorder()
+	handler.CreateNode(resw, req)
+	assert.Equal(t, http.StatusCreated, resw.Code)
+
+	var nodeID uuid.UUID
+	assert.NoError(t, json.Unmarshal(resw.Body.Bytes(), &nodeID))
+
+	req, _ = http.NewRequest("GET", "/workflow/node/"+nodeID.String(), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": nodeID.String()})
+	resw = httptest.NewRecorder()
+	handler.GetNode(resw, req)
+
+	var node workflow.Node
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.NoError(t, json.Unmarshal(resw.Body.Bytes(), &node))
+	assert.Equal(t, "Approval", node.Title)
+	assert.JSONEq(t, `{"signal":"approved"}`, string(node.Config))
+}
+
+func TestWorkflowHandler_CancelWorkflowExecution(t *testing.T) {
+	store := workflow.NewMemoryStore()
+	handler := WorkflowHandler{Store: store}
+
+	startID, _ := store.CreateNode("Start", workflow.NodeTypeStart, "", nil)
+	workflowID, _ := store.CreateWorkflow("checkout", "", startID, false)
+	executionID, _, _ := store.CreateWorkflowExecution(workflowID, "ORD-1", nil, "")
+
+	cancel := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/workflow/execution/"+executionID.String()+"/cancel", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": executionID.String()})
+		resw := httptest.NewRecorder()
+		handler.CancelWorkflowExecution(resw, req)
+		return resw
+	}
+
+	assert.Equal(t, http.StatusOK, cancel().Code)
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "cancelled", execution.Status)
+
+	resw := cancel()
+	assert.Equal(t, http.StatusConflict, resw.Code)
+	assert.JSONEq(t, `{"error":"execution has already finished","code":"invalid_state_transition"}`, resw.Body.String())
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LogConfig controls the process wide structured logger
+type LogConfig struct {
+	Level        string // Minimum level: debug, info, warn or error
+	Format       string // Output format: json or text
+	ResponseBody bool   // Log redacted response bodies at debug level
+}
+
+// Keys whose values are replaced when response bodies are logged
+var redactedKeys = []string{"password", "secret", "token", "authorization", "api_key", "apikey", "credential", "params", "response", "data"}
+
+const redactedValue = "[REDACTED]"
+
+var logResponseBody bool
+
+func LogConfigFromEnv() LogConfig {
+	responseBody, _ := strconv.ParseBool(os.Getenv("APP_LOG_RESPONSE_BODY"))
+
+	return LogConfig{
+		Level:        os.Getenv("APP_LOG_LEVEL"),
+		Format:       os.Getenv("APP_LOG_FORMAT"),
+		ResponseBody: responseBody,
+	}
+}
+
+func NewLogger(w io.Writer, cfg LogConfig) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(cfg.Format, "text") {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// SetupLogging installs the configured logger as the slog default
+func SetupLogging(cfg LogConfig) {
+	slog.SetDefault(NewLogger(os.Stdout, cfg))
+	logResponseBody = cfg.ResponseBody
+}
+
+// redactBody masks the values of sensitive keys anywhere in a JSON document
+func redactBody(body []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return redactedValue
+	}
+
+	redacted, _ := json.Marshal(redactValue(doc))
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if isRedactedKey(key) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redactValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isRedactedKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, redacted := range redactedKeys {
+		if strings.Contains(key, redacted) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactBody(t *testing.T) {
+	body := []byte(`{"title":"Create user","params":"{\"password\":\"p\"}","nested":{"Authorization":"Bearer x","id":1},"items":[{"api_key":"k"}]}`)
+
+	var redacted map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(redactBody(body)), &redacted))
+
+	assert.Equal(t, "Create user", redacted["title"])
+	assert.Equal(t, redactedValue, redacted["params"])
+	assert.Equal(t, redactedValue, redacted["nested"].(map[string]interface{})["Authorization"])
+	assert.Equal(t, float64(1), redacted["nested"].(map[string]interface{})["id"])
+	assert.Equal(t, redactedValue, redacted["items"].([]interface{})[0].(map[string]interface{})["api_key"])
+}
+
+func TestRedactBody_InvalidJSON(t *testing.T) {
+	assert.Equal(t, redactedValue, redactBody([]byte("not json")))
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LogConfig{Level: "warn", Format: "json"})
+
+	logger.Info("hidden")
+	logger.Warn("shown", "execution_id", "abc")
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "shown", line["msg"])
+	assert.Equal(t, "abc", line["execution_id"])
+}
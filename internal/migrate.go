@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kadzany/frosty/pqinit/migrations"
+)
+
+var errMigrateUsage = errors.New("usage: migrate up | down [steps] | status | baseline <version>")
+
+// Migrate runs the migrate subcommand against the database of the app
+func (app *App) Migrate(args []string, out io.Writer) error {
+	migrator, err := migrations.New(app.DB, app.Driver)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	switch args[0] {
+	case "up":
+		migrated, err := migrator.Up()
+		for _, migration := range migrated {
+			fmt.Fprintf(out, "applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(migrated) == 0 {
+			fmt.Fprintf(out, "schema is up to date at version %d\n", migrator.Latest())
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("steps must be a positive number")
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+
+	case "baseline":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version <= 0 {
+			return fmt.Errorf("version must be a positive number")
+		}
+		if err := migrator.Baseline(version); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "recorded migrations up to version %d as applied\n", version)
+		return nil
+	}
+
+	return errMigrateUsage
+}
+
+// CheckSchema fails unless the database schema matches the migrations of the binary.
+// With APP_DB_AUTO_MIGRATE pending migrations are applied first.
+func (app *App) CheckSchema() error {
+	migrator, err := migrations.New(app.DB, app.Driver)
+	if err != nil {
+		return err
+	}
+
+	if autoMigrate, _ := strconv.ParseBool(os.Getenv("APP_DB_AUTO_MIGRATE")); autoMigrate {
+		migrated, err := migrator.Up()
+		for _, migration := range migrated {
+			slog.Info("migration applied", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := migrator.Check(); err != nil {
+		return err
+	}
+	slog.Info("database schema checked", "version", migrator.Latest())
+	return nil
+}
@@ -0,0 +1,544 @@
+package internal
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// apiOperation describes a route in the OpenAPI document. Every route registered by
+// initializeRoutes has one, which TestOpenAPI_MatchesRoutes checks.
+type apiOperation struct {
+	Method      string
+	Path        string         // Route template, with its variables but not their patterns
+	ID          string         // operationId, the name of the handler
+	Tag         string         // Group of the operation in the docs
+	Summary     string         // One line description
+	Permission  Permission     // Permission the client needs, empty for public routes
+	Parameters  []apiParameter // Query and header parameters, path variables are added from Path
+	Request     interface{}    // Body, a pointer to the DTO decoded by decodeRequest, nil when there is none
+	Optional    bool           // The body may be left out
+	Status      int            // Status of a successful response
+	Response    interface{}    // Value of the type of a successful response body, nil when it is null
+	Alternative []string       // Other content types of a successful response, selected with format
+	Errors      []int          // Statuses of error responses besides 401, 403 and 500
+}
+
+type apiParameter struct {
+	In          string // query or header
+	Name        string
+	Description string
+	Schema      *schema
+}
+
+// Statuses of the usual error responses of routes with path variables, bodies and quotas
+var (
+	pathErrors   = []int{http.StatusBadRequest, http.StatusNotFound}
+	bodyErrors   = []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity}
+	createErrors = []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests}
+	stateErrors  = []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}
+)
+
+var (
+	stringSchema = &schema{Type: "string"}
+	uuidSchema   = &schema{Type: "string", Format: "uuid"}
+	timeSchema   = &schema{Type: "string", Format: "date-time"}
+	intSchema    = &schema{Type: "integer", Minimum: new(float64)}
+)
+
+var apiOperations = []apiOperation{
+	{Method: "POST", Path: "/workflow/node", ID: "CreateNode", Tag: "Definitions", Summary: "Create a node",
+		Permission: PermissionDesign, Request: &createNodeRequest{}, Status: http.StatusCreated, Response: uuid.UUID{}, Errors: createErrors},
+	{Method: "GET", Path: "/workflow/node/{id}", ID: "GetNode", Tag: "Definitions", Summary: "Get a node",
+		Permission: PermissionRead, Status: http.StatusOK, Response: workflow.Node{}, Errors: pathErrors},
+	{Method: "POST", Path: "/workflow/node/{id}/relationship", ID: "AddRelationship", Tag: "Definitions", Summary: "Make a node the child of another",
+		Permission: PermissionDesign, Request: &addRelationshipRequest{}, Status: http.StatusCreated, Response: workflow.NodeClosure{}, Errors: append(bodyErrors, http.StatusNotFound)},
+	{Method: "POST", Path: "/workflow/{id}/execute", ID: "ExecuteWorkflow", Tag: "Executions", Summary: "Run a workflow without an execution record",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: stateErrors},
+	{Method: "GET", Path: "/workflow/{id}/graph", ID: "GetWorkflowGraph", Tag: "Definitions", Summary: "Get the graph of a workflow, with the state of an execution",
+		Permission: PermissionRead, Parameters: []apiParameter{
+			{In: "query", Name: "execution_id", Description: "Execution whose node and task states are shown", Schema: uuidSchema},
+			{In: "query", Name: "format", Description: "Format of the graph", Schema: &schema{Type: "string", Enum: []string{"json", "dot", "mermaid"}}},
+		}, Status: http.StatusOK, Response: workflow.Graph{}, Alternative: []string{"text/vnd.graphviz", "text/plain"}, Errors: pathErrors},
+	{Method: "POST", Path: "/workflow", ID: "CreateWorkflow", Tag: "Definitions", Summary: "Create a workflow, or a new version of a workflow with the same name",
+		Permission: PermissionDesign, Request: &createWorkflowRequest{}, Status: http.StatusCreated, Response: uuid.UUID{}, Errors: append(createErrors, http.StatusNotFound)},
+	{Method: "GET", Path: "/workflow", ID: "ListWorkflows", Tag: "Definitions", Summary: "List workflows, newest first",
+		Permission: PermissionRead, Parameters: []apiParameter{
+			{In: "query", Name: "name", Description: "Only the versions of the workflow with this name", Schema: stringSchema},
+			{In: "query", Name: "limit", Description: "At most this many, 100 by default and at most 1000", Schema: intSchema},
+			{In: "query", Name: "offset", Description: "Skip this many of the newest matches", Schema: intSchema},
+		}, Status: http.StatusOK, Response: []workflow.Workflow{}, Errors: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/workflow/{id}", ID: "GetWorkflow", Tag: "Definitions", Summary: "Get a workflow",
+		Permission: PermissionRead, Status: http.StatusOK, Response: workflow.Workflow{}, Errors: pathErrors},
+	{Method: "POST", Path: "/workflow/task", ID: "CreateTask", Tag: "Definitions", Summary: "Create a task",
+		Permission: PermissionDesign, Request: &createTaskRequest{}, Status: http.StatusCreated, Response: uuid.UUID{}, Errors: createErrors},
+	{Method: "GET", Path: "/workflow/task/{id}", ID: "GetTask", Tag: "Definitions", Summary: "Get a task",
+		Permission: PermissionRead, Status: http.StatusOK, Response: workflow.Task{}, Errors: pathErrors},
+	{Method: "POST", Path: "/workflow/node/task", ID: "AddTaskToNode", Tag: "Definitions", Summary: "Add a task to a node",
+		Permission: PermissionDesign, Request: &addTaskToNodeRequest{}, Status: http.StatusCreated, Response: workflow.NodeTask{}, Errors: append(bodyErrors, http.StatusNotFound)},
+	{Method: "POST", Path: "/workflow/execution", ID: "CreateWorkflowExecution", Tag: "Executions", Summary: "Create an execution of a workflow",
+		Permission: PermissionOperate, Parameters: []apiParameter{
+			{In: "header", Name: "Idempotency-Key", Description: "Retries with the same key get the execution created by the first request, with status 200", Schema: stringSchema},
+		}, Request: &createExecutionRequest{}, Status: http.StatusCreated, Response: workflow.WorkflowExecution{}, Errors: append(createErrors, http.StatusNotFound, http.StatusConflict)},
+	{Method: "GET", Path: "/workflow/execution", ID: "ListWorkflowExecutions", Tag: "Executions", Summary: "List executions, newest first",
+		Permission: PermissionRead, Parameters: []apiParameter{
+			{In: "query", Name: "workflow_id", Description: "Only the executions of this workflow", Schema: uuidSchema},
+			{In: "query", Name: "status", Description: "Only executions with this status", Schema: stringSchema},
+			{In: "query", Name: "reference_number", Description: "Only executions with this reference number", Schema: stringSchema},
+			{In: "query", Name: "limit", Description: "At most this many, 100 by default and at most 1000", Schema: intSchema},
+			{In: "query", Name: "offset", Description: "Skip this many of the newest matches", Schema: intSchema},
+		}, Status: http.StatusOK, Response: []workflow.WorkflowExecution{}, Errors: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/workflow/execution/{id}", ID: "GetWorkflowExecution", Tag: "Executions", Summary: "Get an execution with the executions started by its SubWorkflow nodes",
+		Permission: PermissionRead, Status: http.StatusOK, Response: workflow.ExecutionTree{}, Errors: pathErrors},
+	{Method: "POST", Path: "/workflow/execution/{id}/execute", ID: "ExecuteWorkflowByExecutionID", Tag: "Executions", Summary: "Run a pending execution",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: stateErrors},
+	{Method: "POST", Path: "/workflow/execution/{id}/rollback", ID: "RollbackWorkflowExecution", Tag: "Executions", Summary: "Roll back an execution",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: stateErrors},
+	{Method: "POST", Path: "/workflow/execution/{id}/cancel", ID: "CancelWorkflowExecution", Tag: "Executions", Summary: "Cancel a pending or waiting execution with its waits, timers and child executions",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: stateErrors},
+	{Method: "POST", Path: "/workflow/execution/{id}/resume", ID: "ResumeWorkflowExecution", Tag: "Executions", Summary: "Fire the pending timers of an execution now and resume it after them",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: stateErrors},
+	{Method: "POST", Path: "/workflow/execution/{id}/signal/{name}", ID: "SignalWorkflowExecution", Tag: "Executions", Summary: "Send a signal to an execution waiting for it, merging the body into its data",
+		Permission: PermissionOperate, Request: map[string]interface{}{}, Optional: true, Status: http.StatusOK, Errors: stateErrors},
+	{Method: "GET", Path: "/workflow/execution/{id}/timeline", ID: "GetExecutionTimeline", Tag: "Executions", Summary: "Get the nodes, tasks and attempts of an execution over time",
+		Permission: PermissionRead, Parameters: []apiParameter{
+			{In: "query", Name: "format", Description: "Format of the timeline", Schema: &schema{Type: "string", Enum: []string{"json", "text", "html"}}},
+		}, Status: http.StatusOK, Response: workflow.Timeline{}, Alternative: []string{"text/plain", "text/html"}, Errors: pathErrors},
+	{Method: "GET", Path: "/workflow/execution/{id}/logs", ID: "GetExecutionLogs", Tag: "Executions", Summary: "Get the log entries of an execution, oldest first",
+		Permission: PermissionRead, Status: http.StatusOK, Response: []workflow.WorkflowLog{}, Errors: pathErrors},
+	{Method: "GET", Path: "/workflow/timer", ID: "ListTimers", Tag: "Timers", Summary: "List timers",
+		Permission: PermissionRead, Parameters: []apiParameter{
+			{In: "query", Name: "execution_id", Description: "Only the timers of this execution", Schema: uuidSchema},
+			{In: "query", Name: "status", Description: "Only timers with this status, pending by default", Schema: stringSchema},
+		}, Status: http.StatusOK, Response: []workflow.Timer{}, Errors: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/workflow/timer/{id}", ID: "GetTimer", Tag: "Timers", Summary: "Get a timer",
+		Permission: PermissionRead, Status: http.StatusOK, Response: workflow.Timer{}, Errors: pathErrors},
+	{Method: "DELETE", Path: "/workflow/timer/{id}", ID: "CancelTimer", Tag: "Timers", Summary: "Cancel a pending timer",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: append(pathErrors, http.StatusConflict)},
+	{Method: "POST", Path: "/workflow/schedule", ID: "CreateSchedule", Tag: "Schedules", Summary: "Schedule executions of a workflow",
+		Permission: PermissionOperate, Request: &scheduleRequest{}, Status: http.StatusCreated, Response: uuid.UUID{}, Errors: append(bodyErrors, http.StatusNotFound)},
+	{Method: "GET", Path: "/workflow/schedule", ID: "ListSchedules", Tag: "Schedules", Summary: "List schedules",
+		Permission: PermissionRead, Parameters: []apiParameter{
+			{In: "query", Name: "workflow_id", Description: "Only the schedules of this workflow", Schema: uuidSchema},
+		}, Status: http.StatusOK, Response: []workflow.Schedule{}, Errors: []int{http.StatusBadRequest}},
+	{Method: "GET", Path: "/workflow/schedule/{id}", ID: "GetSchedule", Tag: "Schedules", Summary: "Get a schedule",
+		Permission: PermissionRead, Status: http.StatusOK, Response: workflow.Schedule{}, Errors: pathErrors},
+	{Method: "PUT", Path: "/workflow/schedule/{id}", ID: "UpdateSchedule", Tag: "Schedules", Summary: "Update a schedule, fields missing from the body keep their value",
+		Permission: PermissionOperate, Request: &scheduleRequest{}, Status: http.StatusOK, Response: workflow.Schedule{}, Errors: append(bodyErrors, http.StatusNotFound)},
+	{Method: "DELETE", Path: "/workflow/schedule/{id}", ID: "DeleteSchedule", Tag: "Schedules", Summary: "Delete a schedule",
+		Permission: PermissionOperate, Status: http.StatusOK, Errors: pathErrors},
+	{Method: "GET", Path: "/admin/breakers", ID: "ListBreakers", Tag: "Administration", Summary: "Show the circuit breaker and limit state of every task target",
+		Permission: PermissionDeployment, Status: http.StatusOK, Response: []workflow.BreakerStatus{}},
+	{Method: "GET", Path: "/admin/target-policies", ID: "ListTargetPolicies", Tag: "Administration", Summary: "List target policies",
+		Permission: PermissionDeployment, Status: http.StatusOK, Response: []workflow.TargetPolicy{}},
+	{Method: "PUT", Path: "/admin/target-policies", ID: "SaveTargetPolicy", Tag: "Administration", Summary: "Create or replace the policy of a target",
+		Permission: PermissionDeployment, Request: &targetPolicyRequest{}, Status: http.StatusOK, Response: workflow.TargetPolicy{}, Errors: bodyErrors},
+	{Method: "DELETE", Path: "/admin/target-policies/{id}", ID: "DeleteTargetPolicy", Tag: "Administration", Summary: "Delete a target policy",
+		Permission: PermissionDeployment, Status: http.StatusOK, Errors: pathErrors},
+	{Method: "GET", Path: "/admin/tenants", ID: "ListTenantQuotas", Tag: "Administration", Summary: "List every quota that was set",
+		Permission: PermissionDeployment, Status: http.StatusOK, Response: []workflow.TenantQuota{}},
+	{Method: "GET", Path: "/admin/tenants/{tenant}/quota", ID: "GetTenantQuota", Tag: "Administration", Summary: "Get the quota and usage of a tenant",
+		Permission: PermissionDeployment, Status: http.StatusOK, Response: tenantQuota{}},
+	{Method: "PUT", Path: "/admin/tenants/{tenant}/quota", ID: "SaveTenantQuota", Tag: "Administration", Summary: "Set the quota of a tenant, 0 meaning unlimited",
+		Permission: PermissionDeployment, Request: &tenantQuotaRequest{}, Status: http.StatusOK, Response: workflow.TenantQuota{}, Errors: bodyErrors},
+	{Method: "GET", Path: "/audit", ID: "ListAuditEntries", Tag: "Administration", Summary: "List the audit entries of the tenant, newest first",
+		Permission: PermissionAdmin, Parameters: []apiParameter{
+			{In: "query", Name: "actor", Description: "Client that acted", Schema: stringSchema},
+			{In: "query", Name: "action", Description: "Method and route, e.g. POST /workflow", Schema: stringSchema},
+			{In: "query", Name: "resource_type", Description: "Kind of resource acted on, e.g. task", Schema: stringSchema},
+			{In: "query", Name: "resource_id", Description: "ID of the resource acted on", Schema: stringSchema},
+			{In: "query", Name: "outcome", Description: "Result of the action", Schema: &schema{Type: "string", Enum: []string{workflow.AuditOutcomeSucceeded, workflow.AuditOutcomeFailed, workflow.AuditOutcomeDenied}}},
+			{In: "query", Name: "request_id", Description: "ID of the request that acted", Schema: stringSchema},
+			{In: "query", Name: "since", Description: "Entries written at or after", Schema: timeSchema},
+			{In: "query", Name: "until", Description: "Entries written before", Schema: timeSchema},
+			{In: "query", Name: "limit", Description: "At most this many entries, 100 by default and at most 1000", Schema: intSchema},
+			{In: "query", Name: "offset", Description: "Skip this many of the newest matching entries", Schema: intSchema},
+		}, Status: http.StatusOK, Response: []workflow.AuditEntry{}, Errors: []int{http.StatusBadRequest}},
+	{Method: "POST", Path: "/auth/keys", ID: "CreateAPIKey", Tag: "Authorization", Summary: "Issue an API key, shown only in this response",
+		Permission: PermissionAdmin, Request: &createAPIKeyRequest{}, Status: http.StatusCreated, Response: createdAPIKey{}, Errors: bodyErrors},
+	{Method: "GET", Path: "/auth/keys", ID: "ListAPIKeys", Tag: "Authorization", Summary: "List the API keys of the tenant",
+		Permission: PermissionAdmin, Status: http.StatusOK, Response: []workflow.APIKey{}},
+	{Method: "DELETE", Path: "/auth/keys/{id}", ID: "RevokeAPIKey", Tag: "Authorization", Summary: "Revoke an API key",
+		Permission: PermissionAdmin, Status: http.StatusOK, Errors: pathErrors},
+	{Method: "POST", Path: "/auth/grants", ID: "CreateWorkflowGrant", Tag: "Authorization", Summary: "Grant a client a role on one workflow",
+		Permission: PermissionAdmin, Request: &workflowGrantRequest{}, Status: http.StatusCreated, Response: workflow.WorkflowGrant{}, Errors: append(bodyErrors, http.StatusNotFound)},
+	{Method: "GET", Path: "/auth/grants", ID: "ListWorkflowGrants", Tag: "Authorization", Summary: "List grants",
+		Permission: PermissionAdmin, Parameters: []apiParameter{
+			{In: "query", Name: "workflow_id", Description: "Only the grants on this workflow", Schema: uuidSchema},
+		}, Status: http.StatusOK, Response: []workflow.WorkflowGrant{}, Errors: []int{http.StatusBadRequest}},
+	{Method: "DELETE", Path: "/auth/grants/{id}", ID: "DeleteWorkflowGrant", Tag: "Authorization", Summary: "Remove a grant",
+		Permission: PermissionAdmin, Status: http.StatusOK, Errors: pathErrors},
+	{Method: "GET", Path: "/openapi.json", ID: "GetOpenAPI", Tag: "Documentation", Summary: "Get this document",
+		Status: http.StatusOK, Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/docs", ID: "GetDocs", Tag: "Documentation", Summary: "Browse this document",
+		Status: http.StatusOK, Alternative: []string{"text/html"}},
+}
+
+// requestEnums are the values fields of request bodies are restricted to, by schema and field
+var requestEnums = map[string][]string{
+	"CreateNodeRequest.type":          workflow.NodeTypes,
+	"CreateTaskRequest.http_method":   httpMethods,
+	"ScheduleRequest.misfire_policy":  {workflow.MisfireSkip, workflow.MisfireCatchUp},
+	"TargetPolicyRequest.scope":       {workflow.PolicyScopeHost, workflow.PolicyScopeTask},
+	"TargetPolicyRequest.open_policy": {workflow.OpenPolicyFailFast, workflow.OpenPolicyWait},
+	"WorkflowGrantRequest.role":       workflow.Roles,
+}
+
+// schemaNames name the schemas of types whose own name is taken by another schema
+var schemaNames = map[reflect.Type]string{
+	reflect.TypeOf(errorResponse{}): "Error",
+	reflect.TypeOf(tenantQuota{}):   "TenantQuotaUsage",
+}
+
+// openAPIDocument is an OpenAPI 3.0 document
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Security   []map[string][]string                   `json:"security"`
+	Tags       []openAPITag                            `json:"tags"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type openAPITag struct {
+	Name string `json:"name"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Tags        []string                    `json:"tags"`
+	Summary     string                      `json:"summary"`
+	Description string                      `json:"description,omitempty"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Parameters  []openAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema               `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description"`
+}
+
+// schema is an OpenAPI schema object, of the parts this document uses
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+var (
+	uuidType       = reflect.TypeOf(uuid.UUID{})
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaBuilder derives schemas from Go types, collecting struct types as components
+type schemaBuilder struct {
+	schemas map[string]*schema
+	types   map[reflect.Type]string
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *schema {
+	switch t {
+	case uuidType:
+		return &schema{Type: "string", Format: "uuid"}
+	case timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := b.schemaOf(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return &schema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+	// Interfaces hold any value
+	return &schema{}
+}
+
+// component returns the name of the schema of the struct type t, adding it on first use
+func (b *schemaBuilder) component(t reflect.Type) string {
+	if name, ok := b.types[t]; ok {
+		return name
+	}
+
+	name, ok := schemaNames[t]
+	if !ok {
+		name = strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	}
+	if _, taken := b.schemas[name]; taken {
+		panic("openapi: schema " + name + " is the name of two types, add one to schemaNames")
+	}
+
+	// Registered before its fields, so types containing themselves refer to their own schema
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	b.types[t], b.schemas[name] = name, s
+	b.addFields(s, t)
+	return name
+}
+
+// addFields adds the JSON fields of t to s, those of embedded structs included. Fields
+// without omitempty are always present, so they are required.
+func (b *schemaBuilder) addFields(s *schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.addFields(s, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = b.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// requestSchema returns the schema of a request body. Whether a field of a DTO is required
+// is up to validate, so required fields are those it reports missing from an empty body.
+func (b *schemaBuilder) requestSchema(body interface{}) *schema {
+	if _, ok := body.(request); !ok {
+		return b.schemaOf(reflect.TypeOf(body))
+	}
+	t := reflect.TypeOf(body).Elem()
+
+	name := b.component(t)
+	s := b.schemas[name]
+	s.Required = nil
+
+	var errs fieldErrors
+	reflect.New(t).Interface().(request).validate(&errs)
+	for _, e := range errs {
+		if e.Code == CodeRequired {
+			s.Required = append(s.Required, e.Field)
+		}
+	}
+
+	for field, property := range s.Properties {
+		if values, ok := requestEnums[name+"."+field]; ok {
+			property.Enum = values
+		}
+	}
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+// pathVariable matches the variables of a route template
+var pathVariable = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPISpec builds the OpenAPI document of apiOperations
+func openAPISpec() openAPIDocument {
+	b := &schemaBuilder{schemas: map[string]*schema{}, types: map[reflect.Type]string{}}
+	errorSchema := &schema{Ref: "#/components/schemas/" + b.component(reflect.TypeOf(errorResponse{}))}
+	bearer := []map[string][]string{{"bearer": {}}}
+
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "frosty",
+			Description: "Workflow engine storing workflows as a closure table of nodes. Errors answer an Error body whose code is stable, see the README for the list of codes.",
+			Version:     "1.0.0",
+		},
+		Security: bearer,
+		Paths:    map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"bearer": {Type: "http", Scheme: "bearer", Description: "API key (frosty_<prefix>_<secret>) or JWT"},
+			},
+		},
+	}
+
+	seenTags := map[string]bool{}
+	for _, op := range apiOperations {
+		if !seenTags[op.Tag] {
+			seenTags[op.Tag] = true
+			doc.Tags = append(doc.Tags, openAPITag{Name: op.Tag})
+		}
+
+		operation := &openAPIOperation{
+			OperationID: op.ID,
+			Tags:        []string{op.Tag},
+			Summary:     op.Summary,
+			Responses:   map[string]*openAPIResponse{},
+		}
+		if op.Permission == "" {
+			operation.Security = []map[string][]string{{}}
+		} else {
+			operation.Description = "Requires the " + string(op.Permission) + " permission."
+		}
+
+		for _, match := range pathVariable.FindAllStringSubmatch(op.Path, -1) {
+			parameter := openAPIParameter{Name: match[1], In: "path", Required: true, Schema: stringSchema}
+			if match[1] == "id" {
+				parameter.Schema = uuidSchema
+			}
+			operation.Parameters = append(operation.Parameters, parameter)
+		}
+		for _, p := range op.Parameters {
+			operation.Parameters = append(operation.Parameters, openAPIParameter{Name: p.Name, In: p.In, Description: p.Description, Schema: p.Schema})
+		}
+
+		if op.Request != nil {
+			operation.RequestBody = &openAPIRequestBody{
+				Required: !op.Optional,
+				Content:  map[string]openAPIMediaType{"application/json": {Schema: b.requestSchema(op.Request)}},
+			}
+		}
+
+		success := &openAPIResponse{Description: http.StatusText(op.Status), Headers: map[string]openAPIHeader{
+			RequestIDHeader: {Description: "ID of the request, the one sent by the client if any", Schema: stringSchema},
+		}}
+		if op.Response != nil {
+			success.Content = map[string]openAPIMediaType{"application/json": {Schema: b.schemaOf(reflect.TypeOf(op.Response))}}
+		}
+		for _, contentType := range op.Alternative {
+			if success.Content == nil {
+				success.Content = map[string]openAPIMediaType{}
+			}
+			success.Content[contentType] = openAPIMediaType{Schema: stringSchema}
+		}
+		operation.Responses[strconv.Itoa(op.Status)] = success
+
+		statuses := append([]int{}, op.Errors...)
+		if op.Permission != "" {
+			statuses = append(statuses, http.StatusUnauthorized, http.StatusForbidden)
+		}
+		for _, status := range append(statuses, http.StatusInternalServerError) {
+			operation.Responses[strconv.Itoa(status)] = &openAPIResponse{
+				Description: http.StatusText(status),
+				Content:     map[string]openAPIMediaType{"application/json": {Schema: errorSchema}},
+			}
+		}
+
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+	return doc
+}
+
+// The docs page and the stylesheet and script inlined into it. Nothing is loaded from other
+// origins, and the Content-Security-Policy only lets these exact blocks run.
+var (
+	//go:embed openapi.html
+	docsTemplate string
+	//go:embed openapi.css
+	docsStyle string
+	//go:embed openapi.js
+	docsScript string
+
+	docsPage   = []byte(strings.NewReplacer("{{style}}", docsStyle, "{{script}}", docsScript).Replace(docsTemplate))
+	docsPolicy = fmt.Sprintf("default-src 'none'; script-src '%s'; style-src '%s'; connect-src 'self'; form-action 'none'; base-uri 'none'; frame-ancestors 'none'",
+		cspHash(docsScript), cspHash(docsStyle))
+)
+
+// cspHash is the Content-Security-Policy source allowing an inline block with this content
+func cspHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// publicPaths are served without credentials
+var publicPaths = map[string]bool{"/openapi.json": true, "/docs": true}
+
+// GetOpenAPI serves the OpenAPI document of the API
+func (wh *WorkflowHandler) GetOpenAPI(resw http.ResponseWriter, req *http.Request) {
+	responseJson(resw, http.StatusOK, openAPISpec())
+}
+
+// GetDocs serves a page to browse and try the API, rendering /openapi.json
+func (wh *WorkflowHandler) GetDocs(resw http.ResponseWriter, req *http.Request) {
+	resw.Header().Set("Content-Security-Policy", docsPolicy)
+	responseRaw(resw, http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
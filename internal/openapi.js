@@ -0,0 +1,244 @@
+// Renders /openapi.json and sends "Try it" requests to this server. The page loads nothing
+// from elsewhere: everything it runs is embedded in the frosty binary.
+(function () {
+  "use strict";
+
+  var credentialKey = "frosty.credential";
+  var docs = document.getElementById("docs");
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (name) {
+      if (name === "text") {
+        node.textContent = attrs[name];
+      } else {
+        node.setAttribute(name, attrs[name]);
+      }
+    });
+    (children || []).forEach(function (child) { node.appendChild(child); });
+    return node;
+  }
+
+  function pretty(value) {
+    return JSON.stringify(value, null, 2);
+  }
+
+  // resolve follows a $ref into the schemas of the document
+  function resolve(spec, schema) {
+    if (schema && schema.$ref) {
+      return spec.components.schemas[schema.$ref.split("/").pop()] || {};
+    }
+    return schema || {};
+  }
+
+  // example builds a request body from a schema, for the "Try it" form
+  function example(spec, schema, depth) {
+    schema = resolve(spec, schema);
+    if (depth > 4) {
+      return null;
+    }
+    if (schema.enum) {
+      return schema.enum[0];
+    }
+    switch (schema.type) {
+      case "object":
+        var value = {};
+        Object.keys(schema.properties || {}).forEach(function (name) {
+          value[name] = example(spec, schema.properties[name], depth + 1);
+        });
+        return value;
+      case "array":
+        return [example(spec, schema.items, depth + 1)];
+      case "integer":
+      case "number":
+        return 0;
+      case "boolean":
+        return false;
+      case "string":
+        return schema.format === "uuid" ? "00000000-0000-0000-0000-000000000000" : "";
+    }
+    return {};
+  }
+
+  function schemaName(schema) {
+    if (!schema) {
+      return "";
+    }
+    if (schema.$ref) {
+      return schema.$ref.split("/").pop();
+    }
+    if (schema.type === "array") {
+      return schemaName(schema.items) + "[]";
+    }
+    return schema.type || "any";
+  }
+
+  function parameterTable(parameters, inputs) {
+    var rows = parameters.map(function (parameter) {
+      var input = el("input", { name: parameter.name, placeholder: schemaName(parameter.schema) });
+      inputs.push({ parameter: parameter, input: input });
+      return el("tr", {}, [
+        el("td", { text: parameter.name + (parameter.required ? " *" : "") }),
+        el("td", { text: parameter.in }),
+        el("td", {}, [input]),
+        el("td", { text: parameter.description || "" }),
+      ]);
+    });
+    return el("table", {}, [
+      el("tr", {}, [el("th", { text: "Name" }), el("th", { text: "In" }), el("th", { text: "Value" }), el("th", { text: "Description" })]),
+    ].concat(rows));
+  }
+
+  function responseTable(operation) {
+    var rows = Object.keys(operation.responses || {}).map(function (status) {
+      var response = operation.responses[status];
+      var content = response.content || {};
+      var type = Object.keys(content)[0];
+      return el("tr", {}, [
+        el("td", { text: status }),
+        el("td", { text: response.description || "" }),
+        el("td", { text: type ? schemaName(content[type].schema) : "" }),
+      ]);
+    });
+    return el("table", {}, [
+      el("tr", {}, [el("th", { text: "Status" }), el("th", { text: "Description" }), el("th", { text: "Body" })]),
+    ].concat(rows));
+  }
+
+  function send(method, path, inputs, body, output) {
+    var url = path;
+    var query = new URLSearchParams();
+    var headers = {};
+    for (var i = 0; i < inputs.length; i++) {
+      var parameter = inputs[i].parameter;
+      var value = inputs[i].input.value;
+      if (value === "") {
+        if (parameter.required) {
+          output.className = "error";
+          output.textContent = parameter.name + " is required";
+          return;
+        }
+        continue;
+      }
+      if (parameter.in === "path") {
+        url = url.replace("{" + parameter.name + "}", encodeURIComponent(value));
+      } else if (parameter.in === "query") {
+        query.append(parameter.name, value);
+      } else if (parameter.in === "header") {
+        headers[parameter.name] = value;
+      }
+    }
+    if (query.toString() !== "") {
+      url += "?" + query.toString();
+    }
+
+    var credential = sessionStorage.getItem(credentialKey);
+    if (credential) {
+      headers.Authorization = "Bearer " + credential;
+    }
+    var init = { method: method.toUpperCase(), headers: headers };
+    if (body && body.value.trim() !== "") {
+      headers["Content-Type"] = "application/json";
+      init.body = body.value;
+    }
+
+    output.className = "";
+    output.textContent = "…";
+    fetch(url, init).then(function (response) {
+      return response.text().then(function (text) {
+        try {
+          text = pretty(JSON.parse(text));
+        } catch (e) {
+          // Not JSON, shown as is
+        }
+        output.className = response.ok ? "" : "error";
+        output.textContent = init.method + " " + url + "\n" + response.status + " " + response.statusText + "\n\n" + text;
+      });
+    }, function (err) {
+      output.className = "error";
+      output.textContent = String(err);
+    });
+  }
+
+  function renderOperation(spec, method, path, operation) {
+    var inputs = [];
+    var parameters = (operation.parameters || []).filter(function (parameter) { return parameter.in !== "cookie"; });
+    var section = el("div", {}, [el("p", { text: operation.description || "" })]);
+    if (parameters.length > 0) {
+      section.appendChild(el("h4", { text: "Parameters" }));
+      section.appendChild(parameterTable(parameters, inputs));
+    }
+
+    var body = null;
+    var content = operation.requestBody && operation.requestBody.content["application/json"];
+    if (content) {
+      section.appendChild(el("h4", { text: "Body: " + schemaName(content.schema) + (operation.requestBody.required ? "" : " (optional)") }));
+      body = el("textarea", { spellcheck: "false" });
+      body.value = pretty(example(spec, content.schema, 0));
+      section.appendChild(body);
+    }
+
+    section.appendChild(el("h4", { text: "Responses" }));
+    section.appendChild(responseTable(operation));
+
+    var output = el("pre", {});
+    var button = el("button", { type: "button", text: "Try it" });
+    button.addEventListener("click", function () { send(method, path, inputs, body, output); });
+    section.appendChild(button);
+    section.appendChild(output);
+
+    return el("details", {}, [
+      el("summary", {}, [
+        el("span", { class: "method " + method, text: method.toUpperCase() }),
+        el("span", { class: "path", text: path }),
+        el("span", { class: "summary", text: operation.summary || "" }),
+      ]),
+      section,
+    ]);
+  }
+
+  function render(spec) {
+    document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+    document.getElementById("description").textContent = spec.info.description || "";
+
+    var byTag = {};
+    var tags = (spec.tags || []).map(function (tag) { return tag.name; });
+    Object.keys(spec.paths).forEach(function (path) {
+      Object.keys(spec.paths[path]).forEach(function (method) {
+        var operation = spec.paths[path][method];
+        var tag = (operation.tags || ["Other"])[0];
+        if (tags.indexOf(tag) < 0) {
+          tags.push(tag);
+        }
+        (byTag[tag] = byTag[tag] || []).push(renderOperation(spec, method, path, operation));
+      });
+    });
+    tags.forEach(function (tag) {
+      if (byTag[tag]) {
+        docs.appendChild(el("h2", { text: tag }));
+        byTag[tag].forEach(function (operation) { docs.appendChild(operation); });
+      }
+    });
+  }
+
+  var authorized = document.getElementById("authorized");
+  var credential = document.getElementById("credential");
+  function showAuthorized() {
+    authorized.textContent = sessionStorage.getItem(credentialKey) ? "authorized" : "";
+  }
+  document.getElementById("authorize").addEventListener("submit", function (event) {
+    event.preventDefault();
+    if (credential.value === "") {
+      sessionStorage.removeItem(credentialKey);
+    } else {
+      sessionStorage.setItem(credentialKey, credential.value);
+    }
+    credential.value = "";
+    showAuthorized();
+  });
+  showAuthorized();
+
+  fetch(docs.getAttribute("data-spec")).then(function (response) { return response.json(); }).then(render, function (err) {
+    docs.appendChild(el("p", { class: "error", text: "Failed to load " + docs.getAttribute("data-spec") + ": " + err }));
+  });
+})();
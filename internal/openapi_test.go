@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+// routePattern matches the pattern of a route variable, e.g. :[0-9a-fA-F-]+ in {id:[0-9a-fA-F-]+}
+var routePattern = regexp.MustCompile(`\{(\w+):[^}]+\}`)
+
+func TestOpenAPI_MatchesRoutes(t *testing.T) {
+	app := App{Router: mux.NewRouter(), Store: workflow.NewMemoryStore()}
+	app.initializeRoutes()
+
+	var routes []string
+	err := app.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			routes = append(routes, method+" "+routePattern.ReplaceAllString(path, "{$1}"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var documented []string
+	for path, operations := range openAPISpec().Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	// A route added without its operation, or an operation left after its route was removed,
+	// shows up in the diff
+	assert.ElementsMatch(t, routes, documented)
+	assert.Len(t, documented, len(apiOperations), "operations are documented once")
+}
+
+func TestOpenAPI_Document(t *testing.T) {
+	t.Setenv("APP_AUTH_ENABLED", "true")
+	app := App{Router: mux.NewRouter(), Store: workflow.NewMemoryStore()}
+	app.initializeRoutes()
+
+	// Served without credentials
+	resw := serve(app.Router, "GET", "/openapi.json", "", nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.Equal(t, "application/json", resw.Header().Get("Content-Type"))
+	var doc map[string]interface{}
+	if err := json.Unmarshal(resw.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "3.0.3", doc["openapi"])
+
+	// Every reference resolves
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`).FindAllStringSubmatch(resw.Body.String(), -1)
+	assert.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Contains(t, schemas, ref[1])
+	}
+
+	// Request bodies are the DTOs, with the fields validate requires
+	task := schemas["CreateTaskRequest"].(map[string]interface{})
+	assert.ElementsMatch(t, []interface{}{"title", "type", "http_method", "action"}, task["required"])
+	method := task["properties"].(map[string]interface{})["http_method"].(map[string]interface{})
+	assert.Len(t, method["enum"], len(httpMethods))
+	assert.Contains(t, schemas, "Error")
+	assert.Contains(t, schemas, "TenantQuotaUsage")
+
+	paths := doc["paths"].(map[string]interface{})
+	getNode := paths["/workflow/node/{id}"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Equal(t, "GetNode", getNode["operationId"])
+	assert.Contains(t, getNode["responses"], "404")
+	assert.Contains(t, getNode["responses"], "401")
+
+	resw = serve(app.Router, "GET", "/docs", "", nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	assert.Contains(t, resw.Body.String(), `data-spec="/openapi.json"`)
+	assert.NotContains(t, resw.Body.String(), "{{")
+
+	// Only the inlined script and stylesheet may run, nothing from other origins
+	policy := resw.Header().Get("Content-Security-Policy")
+	assert.Contains(t, policy, "script-src '"+cspHash(docsScript)+"'")
+	assert.Contains(t, policy, "connect-src 'self'")
+	assert.NotRegexp(t, `(src|href)="https?:`, resw.Body.String())
+
+	// Other routes still need credentials
+	assert.Equal(t, http.StatusUnauthorized, serve(app.Router, "GET", "/workflow/timer", "", nil).Code)
+}
@@ -0,0 +1,454 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/robfig/cron/v3"
+)
+
+// Codes of the field errors of an invalid request
+const (
+	CodeRequired     = "required"      // The field is missing or empty
+	CodeUnknownField = "unknown_field" // The field is not part of the request
+	CodeInvalidType  = "invalid_type"  // The field has the wrong JSON type
+	CodeInvalid      = "invalid"       // The value is not accepted
+	CodeTooLong      = "too_long"      // The value exceeds its maximum length
+	CodeOutOfRange   = "out_of_range"  // The number is outside its allowed range
+	CodeMalformed    = "malformed"     // The body is not a single JSON document
+)
+
+const (
+	maxTitleLength     = 255
+	maxTypeLength      = 50
+	maxTaskRetries     = 100
+	maxReferenceLength = 255
+)
+
+// maxRequestBody is the most bytes of a request body read
+const maxRequestBody = 1 << 20
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// fieldError tells what is wrong with one field of a request body. Field is the JSON name,
+// dotted for nested fields, and empty when the error concerns the body as a whole.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type fieldErrors []fieldError
+
+func (e *fieldErrors) add(field, code, format string, args ...interface{}) {
+	*e = append(*e, fieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// required adds an error when value is empty and returns whether it is set
+func (e *fieldErrors) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		e.add(field, CodeRequired, "%s is required", field)
+		return false
+	}
+	return true
+}
+
+func (e *fieldErrors) requiredID(field string, id uuid.UUID) {
+	if id == uuid.Nil {
+		e.add(field, CodeRequired, "%s is required", field)
+	}
+}
+
+func (e *fieldErrors) maxLength(field, value string, max int) {
+	if len(value) > max {
+		e.add(field, CodeTooLong, "%s must be at most %d characters", field, max)
+	}
+}
+
+func (e *fieldErrors) oneOf(field, value string, allowed []string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.add(field, CodeInvalid, "%s must be one of %s", field, strings.Join(allowed, ", "))
+}
+
+func (e *fieldErrors) between(field string, value, min, max int) {
+	if value < min || value > max {
+		e.add(field, CodeOutOfRange, "%s must be between %d and %d", field, min, max)
+	}
+}
+
+func (e *fieldErrors) nonNegative(field string, value float64) {
+	if value < 0 {
+		e.add(field, CodeOutOfRange, "%s cannot be negative", field)
+	}
+}
+
+// check adds the error, if any, of a model's own validation
+func (e *fieldErrors) check(field string, err error) {
+	if err != nil {
+		e.add(field, CodeInvalid, "%s", err.Error())
+	}
+}
+
+// request is the body of a request, decoded by decodeRequest. validate adds an error for
+// every invalid field and may normalise the values it accepts.
+type request interface {
+	validate(errs *fieldErrors)
+}
+
+// decodeRequest decodes the JSON body of req into dst and validates it. Unknown fields are
+// rejected. It answers the request and returns false when the body cannot be decoded (400)
+// or has invalid fields (422).
+func decodeRequest(resw http.ResponseWriter, req *http.Request, dst request) bool {
+	req.Body = http.MaxBytesReader(resw, req.Body, maxRequestBody)
+	defer req.Body.Close()
+
+	if err := decodeStrict(req.Body, dst); err != nil {
+		responseUnreadable(resw, err)
+		return false
+	}
+
+	var errs fieldErrors
+	dst.validate(&errs)
+	if len(errs) > 0 {
+		responseErrorCode(resw, http.StatusUnprocessableEntity, ErrorValidation, "Invalid request", errs)
+		return false
+	}
+	return true
+}
+
+// decodeStrict decodes exactly one JSON value without unknown fields
+func decodeStrict(body io.Reader, dst interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errTrailingData
+	}
+	return nil
+}
+
+var errTrailingData = errors.New("request body must contain a single JSON value")
+
+// decodeError describes why a body could not be decoded
+func decodeError(err error) fieldError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return fieldError{Code: CodeRequired, Message: "request body is required"}
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &syntaxErr), errors.Is(err, errTrailingData):
+		return fieldError{Code: CodeMalformed, Message: "request body is not valid JSON: " + strings.TrimPrefix(err.Error(), "json: ")}
+	case errors.As(err, &typeErr):
+		subject := typeErr.Field
+		if subject == "" {
+			subject = "request body"
+		}
+		return fieldError{Field: typeErr.Field, Code: CodeInvalidType, Message: fmt.Sprintf("%s cannot be a JSON %s", subject, typeErr.Value)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return fieldError{Field: field, Code: CodeUnknownField, Message: fmt.Sprintf("%s is not a known field", field)}
+	}
+	// Values rejected by their own UnmarshalJSON or UnmarshalText, such as malformed IDs
+	return fieldError{Code: CodeInvalid, Message: err.Error()}
+}
+
+// responseUnreadable answers a request whose body could not be decoded
+func responseUnreadable(resw http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		message := fmt.Sprintf("request body cannot be larger than %d bytes", tooLarge.Limit)
+		responseErrorCode(resw, http.StatusRequestEntityTooLarge, ErrorTooLarge, "Invalid request", fieldErrors{{Code: CodeTooLong, Message: message}})
+		return
+	}
+	responseErrorCode(resw, http.StatusBadRequest, ErrorInvalidRequest, "Invalid request", fieldErrors{decodeError(err)})
+}
+
+type createNodeRequest struct {
+	Title       string          `json:"title"`
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Config      json.RawMessage `json:"config"`
+}
+
+func (r *createNodeRequest) validate(errs *fieldErrors) {
+	errs.required("title", r.Title)
+	errs.maxLength("title", r.Title, maxTitleLength)
+	if errs.required("type", r.Type) {
+		errs.oneOf("type", r.Type, workflow.NodeTypes)
+	}
+	errs.check("config", workflow.ValidateNodeConfig(r.node()))
+}
+
+func (r *createNodeRequest) node() workflow.Node {
+	return workflow.Node{Title: r.Title, Type: r.Type, Description: r.Description, Config: omitNull(r.Config)}
+}
+
+type addRelationshipRequest struct {
+	Ancestor   uuid.UUID `json:"ancestor"`
+	Descendant uuid.UUID `json:"descendant"`
+	Condition  string    `json:"condition"`
+}
+
+func (r *addRelationshipRequest) validate(errs *fieldErrors) {
+	errs.requiredID("ancestor", r.Ancestor)
+	errs.requiredID("descendant", r.Descendant)
+	if r.Ancestor != uuid.Nil && r.Ancestor == r.Descendant {
+		errs.add("descendant", CodeInvalid, "a node cannot descend from itself")
+	}
+	errs.maxLength("condition", r.Condition, maxTitleLength)
+	if err := workflow.ValidateBranchCondition(r.Condition); err != nil {
+		errs.add("condition", CodeInvalid, err.Error())
+	}
+}
+
+type createWorkflowRequest struct {
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	StartingNodeID  uuid.UUID `json:"starting_node_id"`
+	UniqueReference bool      `json:"unique_reference"`
+}
+
+func (r *createWorkflowRequest) validate(errs *fieldErrors) {
+	errs.required("name", r.Name)
+	errs.maxLength("name", r.Name, maxTitleLength)
+	errs.requiredID("starting_node_id", r.StartingNodeID)
+}
+
+type createTaskRequest struct {
+	Title      string `json:"title"`
+	Type       string `json:"type"`
+	HttpMethod string `json:"http_method"`
+	Action     string `json:"action"`
+	Params     string `json:"params"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+func (r *createTaskRequest) validate(errs *fieldErrors) {
+	errs.required("title", r.Title)
+	errs.maxLength("title", r.Title, maxTitleLength)
+	errs.required("type", r.Type)
+	errs.maxLength("type", r.Type, maxTypeLength)
+
+	r.HttpMethod = strings.ToUpper(r.HttpMethod)
+	if errs.required("http_method", r.HttpMethod) {
+		errs.oneOf("http_method", r.HttpMethod, httpMethods)
+	}
+
+	if errs.required("action", r.Action) {
+		u, err := url.Parse(r.Action)
+		switch {
+		case err != nil:
+			errs.add("action", CodeInvalid, "action is not a valid URL")
+		case (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			errs.add("action", CodeInvalid, "action must be an absolute http or https URL")
+		default:
+			// Addresses the host name resolves to are checked on every call
+			errs.check("action", workflow.Egress.CheckURL(r.Action))
+		}
+	}
+
+	if r.Params != "" && !json.Valid([]byte(r.Params)) {
+		errs.add("params", CodeInvalid, "params must be valid JSON")
+	}
+	errs.between("max_retries", r.MaxRetries, 0, maxTaskRetries)
+}
+
+type addTaskToNodeRequest struct {
+	NodeID    uuid.UUID `json:"node_id"`
+	TaskID    uuid.UUID `json:"task_id"`
+	TaskOrder int       `json:"task_order"`
+}
+
+func (r *addTaskToNodeRequest) validate(errs *fieldErrors) {
+	errs.requiredID("node_id", r.NodeID)
+	errs.requiredID("task_id", r.TaskID)
+	errs.nonNegative("task_order", float64(r.TaskOrder))
+}
+
+type createExecutionRequest struct {
+	WorkflowID      uuid.UUID       `json:"workflow_id"`
+	ReferenceNumber string          `json:"reference_number"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func (r *createExecutionRequest) validate(errs *fieldErrors) {
+	errs.requiredID("workflow_id", r.WorkflowID)
+	errs.maxLength("reference_number", r.ReferenceNumber, maxReferenceLength)
+	r.Data = omitNull(r.Data)
+	if len(r.Data) > 0 && !isJSONObject(r.Data) {
+		errs.add("data", CodeInvalidType, "data must be a JSON object")
+	}
+}
+
+// scheduleRequest creates a schedule, or updates one where fields missing from the body keep
+// their current value
+type scheduleRequest struct {
+	WorkflowID        *uuid.UUID `json:"workflow_id"`
+	CronExpression    *string    `json:"cron_expression"`
+	IntervalSeconds   *int       `json:"interval_seconds"`
+	Timezone          *string    `json:"timezone"`
+	PayloadTemplate   *string    `json:"payload_template"`
+	ReferenceTemplate *string    `json:"reference_template"`
+	MisfirePolicy     *string    `json:"misfire_policy"`
+	Enabled           *bool      `json:"enabled"`
+}
+
+func (r *scheduleRequest) validate(errs *fieldErrors) {
+	if r.WorkflowID != nil {
+		errs.requiredID("workflow_id", *r.WorkflowID)
+	}
+	if r.CronExpression != nil && *r.CronExpression != "" {
+		if _, err := cron.ParseStandard(*r.CronExpression); err != nil {
+			errs.add("cron_expression", CodeInvalid, "invalid cron_expression: %v", err)
+		}
+	}
+	if r.IntervalSeconds != nil {
+		errs.nonNegative("interval_seconds", float64(*r.IntervalSeconds))
+	}
+	if r.Timezone != nil && *r.Timezone != "" {
+		if _, err := time.LoadLocation(*r.Timezone); err != nil {
+			errs.add("timezone", CodeInvalid, "invalid timezone: %v", err)
+		}
+	}
+	if r.MisfirePolicy != nil && *r.MisfirePolicy != "" {
+		errs.oneOf("misfire_policy", *r.MisfirePolicy, []string{workflow.MisfireSkip, workflow.MisfireCatchUp})
+	}
+}
+
+// apply copies the fields present in the body onto schedule
+func (r *scheduleRequest) apply(schedule *workflow.Schedule) {
+	if r.WorkflowID != nil {
+		schedule.WorkflowID = *r.WorkflowID
+	}
+	if r.CronExpression != nil {
+		schedule.CronExpression = *r.CronExpression
+	}
+	if r.IntervalSeconds != nil {
+		schedule.IntervalSeconds = *r.IntervalSeconds
+	}
+	if r.Timezone != nil {
+		schedule.Timezone = *r.Timezone
+	}
+	if r.PayloadTemplate != nil {
+		schedule.PayloadTemplate = *r.PayloadTemplate
+	}
+	if r.ReferenceTemplate != nil {
+		schedule.ReferenceTemplate = *r.ReferenceTemplate
+	}
+	if r.MisfirePolicy != nil {
+		schedule.MisfirePolicy = *r.MisfirePolicy
+	}
+	if r.Enabled != nil {
+		schedule.Enabled = *r.Enabled
+	}
+}
+
+type targetPolicyRequest struct {
+	Scope            string  `json:"scope"`
+	Target           string  `json:"target"`
+	FailureThreshold int     `json:"failure_threshold"`
+	OpenSeconds      int     `json:"open_seconds"`
+	OpenPolicy       string  `json:"open_policy"`
+	MaxWaitSeconds   int     `json:"max_wait_seconds"`
+	MaxConcurrency   int     `json:"max_concurrency"`
+	RatePerSecond    float64 `json:"rate_per_second"`
+	Burst            int     `json:"burst"`
+}
+
+func (r *targetPolicyRequest) validate(errs *fieldErrors) {
+	if errs.required("scope", r.Scope) {
+		errs.oneOf("scope", r.Scope, []string{workflow.PolicyScopeHost, workflow.PolicyScopeTask})
+	}
+	if errs.required("target", r.Target) && r.Scope == workflow.PolicyScopeTask {
+		if _, err := uuid.Parse(r.Target); err != nil {
+			errs.add("target", CodeInvalid, "target of a task policy must be a task ID")
+		}
+	}
+	if r.OpenPolicy != "" {
+		errs.oneOf("open_policy", r.OpenPolicy, []string{workflow.OpenPolicyFailFast, workflow.OpenPolicyWait})
+	}
+	errs.nonNegative("failure_threshold", float64(r.FailureThreshold))
+	errs.nonNegative("open_seconds", float64(r.OpenSeconds))
+	errs.nonNegative("max_wait_seconds", float64(r.MaxWaitSeconds))
+	errs.nonNegative("max_concurrency", float64(r.MaxConcurrency))
+	errs.nonNegative("rate_per_second", r.RatePerSecond)
+	errs.nonNegative("burst", float64(r.Burst))
+}
+
+func (r *targetPolicyRequest) policy() workflow.TargetPolicy {
+	return workflow.TargetPolicy{
+		Scope: r.Scope, Target: r.Target, FailureThreshold: r.FailureThreshold, OpenSeconds: r.OpenSeconds, OpenPolicy: r.OpenPolicy,
+		MaxWaitSeconds: r.MaxWaitSeconds, MaxConcurrency: r.MaxConcurrency, RatePerSecond: r.RatePerSecond, Burst: r.Burst,
+	}
+}
+
+type tenantQuotaRequest struct {
+	MaxConcurrentExecutions int `json:"max_concurrent_executions"`
+	MaxWorkflows            int `json:"max_workflows"`
+	MaxNodes                int `json:"max_nodes"`
+	MaxTasks                int `json:"max_tasks"`
+}
+
+func (r *tenantQuotaRequest) validate(errs *fieldErrors) {
+	errs.nonNegative("max_concurrent_executions", float64(r.MaxConcurrentExecutions))
+	errs.nonNegative("max_workflows", float64(r.MaxWorkflows))
+	errs.nonNegative("max_nodes", float64(r.MaxNodes))
+	errs.nonNegative("max_tasks", float64(r.MaxTasks))
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant_id"`
+}
+
+func (r *createAPIKeyRequest) validate(errs *fieldErrors) {
+	errs.required("name", r.Name)
+	errs.maxLength("name", r.Name, maxTitleLength)
+	if len(r.Roles) == 0 {
+		r.Roles = []string{workflow.RoleViewer}
+	}
+	errs.check("roles", workflow.ValidateRoles(r.Roles))
+}
+
+type workflowGrantRequest struct {
+	WorkflowID uuid.UUID `json:"workflow_id"`
+	Subject    string    `json:"subject"`
+	Role       string    `json:"role"`
+}
+
+func (r *workflowGrantRequest) validate(errs *fieldErrors) {
+	errs.requiredID("workflow_id", r.WorkflowID)
+	errs.required("subject", r.Subject)
+	if errs.required("role", r.Role) {
+		errs.check("role", workflow.ValidateRoles([]string{r.Role}))
+	}
+}
+
+// omitNull drops an explicit JSON null, which stores take as a value
+func omitNull(data json.RawMessage) json.RawMessage {
+	if string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+func isJSONObject(data json.RawMessage) bool {
+	var object map[string]json.RawMessage
+	return json.Unmarshal(data, &object) == nil && object != nil
+}
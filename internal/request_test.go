@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeRequest_InvalidBodies(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	tests := []struct {
+		name    string
+		handle  http.HandlerFunc
+		body    string
+		status  int
+		invalid []fieldError
+	}{
+		{"empty body", handler.CreateNode, ``, http.StatusBadRequest,
+			[]fieldError{{Code: CodeRequired, Message: "request body is required"}}},
+		{"malformed body", handler.CreateNode, `{"title":`, http.StatusBadRequest,
+			[]fieldError{{Code: CodeMalformed, Message: "request body is not valid JSON: unexpected EOF"}}},
+		{"trailing data", handler.CreateNode, `{"title":"Start","type":"Start"} {}`, http.StatusBadRequest,
+			[]fieldError{{Code: CodeMalformed, Message: "request body is not valid JSON: request body must contain a single JSON value"}}},
+		{"unknown field", handler.CreateNode, `{"id":"4a7f1a3e-6f0b-4a0e-8a43-3c3b1f0f2d55","title":"Start","type":"Start"}`, http.StatusBadRequest,
+			[]fieldError{{Field: "id", Code: CodeUnknownField, Message: "id is not a known field"}}},
+		{"wrong type", handler.CreateNode, `{"title":1,"type":"Start"}`, http.StatusBadRequest,
+			[]fieldError{{Field: "title", Code: CodeInvalidType, Message: "title cannot be a JSON number"}}},
+		{"invalid node", handler.CreateNode, `{"title":" ","type":"Loop"}`, http.StatusUnprocessableEntity,
+			[]fieldError{
+				{Field: "title", Code: CodeRequired, Message: "title is required"},
+				{Field: "type", Code: CodeInvalid, Message: "type must be one of Start, Task, Decision, Fork, Join, End, Wait, Timer, SubWorkflow"},
+			}},
+		{"invalid task", handler.CreateTask, `{"title":"Charge","type":"API","http_method":"FETCH","action":"billing/charge","params":"{","max_retries":-1}`, http.StatusUnprocessableEntity,
+			[]fieldError{
+				{Field: "http_method", Code: CodeInvalid, Message: "http_method must be one of GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS"},
+				{Field: "action", Code: CodeInvalid, Message: "action must be an absolute http or https URL"},
+				{Field: "params", Code: CodeInvalid, Message: "params must be valid JSON"},
+				{Field: "max_retries", Code: CodeOutOfRange, Message: "max_retries must be between 0 and 100"},
+			}},
+		{"malformed id", handler.AddTaskToNode, `{"node_id":"node-1","task_id":"task-1"}`, http.StatusBadRequest,
+			[]fieldError{{Code: CodeInvalid, Message: "invalid UUID length: 6"}}},
+		{"missing ids", handler.AddTaskToNode, `{"task_order":-1}`, http.StatusUnprocessableEntity,
+			[]fieldError{
+				{Field: "node_id", Code: CodeRequired, Message: "node_id is required"},
+				{Field: "task_id", Code: CodeRequired, Message: "task_id is required"},
+				{Field: "task_order", Code: CodeOutOfRange, Message: "task_order cannot be negative"},
+			}},
+		{"invalid condition", handler.AddRelationship, `{"ancestor":"4a7f1a3e-6f0b-4a0e-8a43-3c3b1f0f2d55","descendant":"5b8e2b4f-7a1c-4b1f-9b54-4d4c2a1e3e66","condition":"{{gt .amount"}`, http.StatusUnprocessableEntity,
+			[]fieldError{{Field: "condition", Code: CodeInvalid, Message: "invalid condition: template: condition:1: unclosed action"}}},
+		{"too large", handler.CreateNode, `{"title":"` + strings.Repeat("a", maxRequestBody) + `","type":"Start"}`, http.StatusRequestEntityTooLarge,
+			[]fieldError{{Code: CodeTooLong, Message: "request body cannot be larger than 1048576 bytes"}}},
+		{"execution data", handler.CreateWorkflowExecution, `{"workflow_id":"4a7f1a3e-6f0b-4a0e-8a43-3c3b1f0f2d55","data":[1]}`, http.StatusUnprocessableEntity,
+			[]fieldError{{Field: "data", Code: CodeInvalidType, Message: "data must be a JSON object"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(tt.body))
+			resw := httptest.NewRecorder()
+
+			tt.handle(resw, req)
+
+			assert.Equal(t, tt.status, resw.Code)
+			var body errorResponse
+			if err := json.Unmarshal(resw.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not a single JSON document: %v", err)
+			}
+			assert.Equal(t, "Invalid request", body.Error)
+			assert.Equal(t, statusCodes[tt.status], body.Code)
+			assert.Equal(t, tt.invalid, body.Fields)
+		})
+	}
+
+	// Nothing reaches the store once the body is rejected
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowHandler_GetNode_InvalidID(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := WorkflowHandler{Store: workflow.NewPostgresStore(db)}
+	req, _ := http.NewRequest("GET", "/workflow/node/start", nil)
+	resw := httptest.NewRecorder()
+	req = mux.SetURLVars(req, map[string]string{"id": "start"})
+
+	handler.GetNode(resw, req)
+
+	assert.Equal(t, http.StatusBadRequest, resw.Code)
+	assert.JSONEq(t, `{"error":"Invalid Node Id","code":"invalid_request"}`, resw.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,22 +1,109 @@
 package internal
 
 import (
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+
+	"github.com/kadzany/frosty/workflow"
+)
+
+// Codes of error responses. Clients should rely on them rather than on messages.
+const (
+	ErrorInvalidRequest    = "invalid_request"          // 400, the request cannot be read
+	ErrorUnauthorized      = "unauthorized"             // 401, credentials are missing or invalid
+	ErrorForbidden         = "forbidden"                // 403, the client lacks a permission
+	ErrorNotFound          = "not_found"                // 404, the resource does not exist
+	ErrorConflict          = "conflict"                 // 409, the resource changed concurrently
+	ErrorInvalidTransition = "invalid_state_transition" // 409, the resource is not in a state allowing the action
+	ErrorValidation        = "validation_failed"        // 422, the request is well formed but not accepted
+	ErrorCycle             = "cycle"                    // 422, a relationship would create a cycle
+	ErrorTooLarge          = "request_too_large"        // 413, the request body exceeds maxRequestBody
+	ErrorQuotaExceeded     = "quota_exceeded"           // 429, the tenant is at a quota limit
+	ErrorInternal          = "internal"                 // 500, something failed on the server
 )
 
+// statusCodes are the codes of errors answered with a status but no more specific code
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            ErrorInvalidRequest,
+	http.StatusUnauthorized:          ErrorUnauthorized,
+	http.StatusForbidden:             ErrorForbidden,
+	http.StatusNotFound:              ErrorNotFound,
+	http.StatusConflict:              ErrorConflict,
+	http.StatusRequestEntityTooLarge: ErrorTooLarge,
+	http.StatusUnprocessableEntity:   ErrorValidation,
+	http.StatusTooManyRequests:       ErrorQuotaExceeded,
+	http.StatusInternalServerError:   ErrorInternal,
+}
+
+// errorResponse is the body of every error response
+type errorResponse struct {
+	Error     string       `json:"error"`                // Human readable message
+	Code      string       `json:"code"`                 // Stable machine readable code
+	RequestID string       `json:"request_id,omitempty"` // ID of the request, also in the X-Request-ID header
+	Fields    []fieldError `json:"fields,omitempty"`     // Invalid fields of the request body
+}
+
 func responseError(resw http.ResponseWriter, respCode int, message string) {
-	fmt.Println("Response Error:", message)
-	responseJson(resw, respCode, map[string]string{"error": message})
+	responseErrorCode(resw, respCode, statusCodes[respCode], message, nil)
+}
+
+func responseErrorCode(resw http.ResponseWriter, respCode int, code, message string, fields []fieldError) {
+	requestID := resw.Header().Get(RequestIDHeader)
+	slog.Warn("response error", "status", respCode, "code", code, "error", message, "request_id", requestID)
+	responseJson(resw, respCode, errorResponse{Error: message, Code: code, RequestID: requestID, Fields: fields})
+}
+
+// responseFailure answers with the status and code of the kind of err. Messages of
+// unexpected errors are logged but not returned, they may reveal internals.
+func responseFailure(resw http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	message := err.Error()
+	if status == http.StatusInternalServerError {
+		slog.Error("request failed", "error", err, "request_id", resw.Header().Get(RequestIDHeader))
+		message = "Internal server error"
+	}
+	responseErrorCode(resw, status, code, message, nil)
+}
+
+// errorStatus maps the kinds of workflow errors to a status and code
+func errorStatus(err error) (int, string) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, ErrorTooLarge
+	case errors.Is(err, workflow.ErrNotFound), errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, ErrorNotFound
+	case errors.Is(err, workflow.ErrInvalidTransition):
+		return http.StatusConflict, ErrorInvalidTransition
+	case errors.Is(err, workflow.ErrConflict):
+		return http.StatusConflict, ErrorConflict
+	case errors.Is(err, workflow.ErrCycle):
+		return http.StatusUnprocessableEntity, ErrorCycle
+	case errors.Is(err, workflow.ErrValidation):
+		return http.StatusUnprocessableEntity, ErrorValidation
+	case errors.Is(err, workflow.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, ErrorQuotaExceeded
+	}
+	return http.StatusInternalServerError, ErrorInternal
 }
 
 func responseJson(resw http.ResponseWriter, respCode int, payload interface{}) {
 	resp, _ := json.Marshal(payload)
 
-	fmt.Println("Response Json:", string(resp))
+	if logResponseBody {
+		slog.Debug("response json", "status", respCode, "body", redactBody(resp))
+	}
 
 	resw.Header().Set("Content-Type", "application/json")
 	resw.WriteHeader(respCode)
 	resw.Write(resp)
 }
+
+func responseRaw(resw http.ResponseWriter, respCode int, contentType string, body []byte) {
+	resw.Header().Set("Content-Type", contentType)
+	resw.WriteHeader(respCode)
+	resw.Write(body)
+}
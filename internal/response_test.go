@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/pqinit/migrations"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponses_MemoryStore(t *testing.T) {
+	testErrorResponses(t, workflow.NewMemoryStore())
+}
+
+func TestErrorResponses_SQLiteStore(t *testing.T) {
+	db, err := workflow.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	testErrorResponses(t, workflow.NewSQLiteStore(db))
+}
+
+// testErrorResponses checks that the errors of a store are answered with the same status and
+// code whichever store serves the request
+func testErrorResponses(t *testing.T, store workflow.Store) {
+	handler := WorkflowHandler{Store: store}
+
+	startID, _ := store.CreateNode("Start", workflow.NodeTypeStart, "", nil)
+	endID, _ := store.CreateNode("End", workflow.NodeTypeEnd, "", nil)
+	if err := store.AddRelationship(startID, endID, ""); err != nil {
+		t.Fatal(err)
+	}
+	workflowID, _ := store.CreateWorkflow("checkout", "", startID, false)
+	executionID, _, _ := store.CreateWorkflowExecution(workflowID, "ORD-1", nil, "")
+	if err := workflow.CancelWorkflowExecution(context.Background(), store, executionID); err != nil {
+		t.Fatal(err)
+	}
+
+	withID := func(method, url string, id uuid.UUID) *http.Request {
+		req, _ := http.NewRequest(method, url, nil)
+		return mux.SetURLVars(req, map[string]string{"id": id.String()})
+	}
+	relationship, _ := json.Marshal(addRelationshipRequest{Ancestor: endID, Descendant: startID})
+	missing := uuid.New()
+
+	tests := []struct {
+		name   string
+		handle http.HandlerFunc
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"missing execution", handler.GetWorkflowExecution, withID("GET", "/workflow/execution/"+missing.String(), missing),
+			http.StatusNotFound, ErrorNotFound},
+		{"missing starting node", handler.ExecuteWorkflow, withID("POST", "/workflow/"+missing.String()+"/execute", missing),
+			http.StatusNotFound, ErrorNotFound},
+		{"finished execution", handler.CancelWorkflowExecution, withID("POST", "/workflow/execution/"+executionID.String()+"/cancel", executionID),
+			http.StatusConflict, ErrorInvalidTransition},
+		{"cycle", handler.AddRelationship, func() *http.Request {
+			req, _ := http.NewRequest("POST", "/workflow/node/relationship", bytes.NewBuffer(relationship))
+			return req
+		}(), http.StatusUnprocessableEntity, ErrorCycle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resw := httptest.NewRecorder()
+			tt.handle(resw, tt.req)
+
+			assert.Equal(t, tt.status, resw.Code)
+			var body errorResponse
+			if err := json.Unmarshal(resw.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response is not a single JSON document: %v", err)
+			}
+			assert.Equal(t, tt.code, body.Code)
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+)
+
+func (wh *WorkflowHandler) CreateSchedule(resw http.ResponseWriter, req *http.Request) {
+	var body scheduleRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+
+	schedule := workflow.Schedule{Enabled: true}
+	body.apply(&schedule)
+	if err := prepareSchedule(&schedule); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	id, err := wh.store(req).CreateSchedule(schedule)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "schedule", id, nil, auditState(req, func() (interface{}, error) { return wh.store(req).GetSchedule(id) }))
+
+	responseJson(resw, http.StatusCreated, id)
+}
+
+func (wh *WorkflowHandler) ListSchedules(resw http.ResponseWriter, req *http.Request) {
+	workflowID := uuid.Nil
+	if value := req.URL.Query().Get("workflow_id"); value != "" {
+		var err error
+		workflowID, err = uuid.Parse(value)
+		if err != nil {
+			responseError(resw, http.StatusBadRequest, "Invalid Workflow Id")
+			return
+		}
+	}
+
+	schedules, err := wh.store(req).ListSchedules(workflowID)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, schedules)
+}
+
+func (wh *WorkflowHandler) GetSchedule(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Schedule Id")
+		return
+	}
+
+	schedule, err := wh.store(req).GetSchedule(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, schedule)
+}
+
+func (wh *WorkflowHandler) UpdateSchedule(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Schedule Id")
+		return
+	}
+
+	var body scheduleRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+
+	schedule, err := wh.store(req).GetSchedule(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	// Fields missing from the payload keep their current value
+	before := schedule
+	body.apply(&schedule)
+	if err := prepareSchedule(&schedule); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	if err := wh.store(req).UpdateSchedule(schedule); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "schedule", id, before, schedule)
+
+	responseJson(resw, http.StatusOK, schedule)
+}
+
+func (wh *WorkflowHandler) DeleteSchedule(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Schedule Id")
+		return
+	}
+
+	before := auditState(req, func() (interface{}, error) { return wh.store(req).GetSchedule(id) })
+	if err := wh.store(req).DeleteSchedule(id); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "schedule", id, before, nil)
+
+	responseJson(resw, http.StatusOK, nil)
+}
+
+// prepareSchedule validates the schedule and computes its first tick from now
+func prepareSchedule(schedule *workflow.Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		next, err := schedule.Next(time.Now())
+		if err != nil {
+			return err
+		}
+		next = next.Truncate(time.Second)
+		schedule.NextRunAt = &next
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+)
+
+// tenantQuota is the quota of a tenant together with what it currently uses
+type tenantQuota struct {
+	workflow.TenantQuota
+	Usage workflow.TenantUsage `json:"usage"`
+}
+
+// ListTenantQuotas returns every quota that was set
+func (wh *WorkflowHandler) ListTenantQuotas(resw http.ResponseWriter, req *http.Request) {
+	quotas, err := wh.Store.ListTenantQuotas()
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, quotas)
+}
+
+func (wh *WorkflowHandler) GetTenantQuota(resw http.ResponseWriter, req *http.Request) {
+	tenant := mux.Vars(req)["tenant"]
+
+	quota, err := wh.Store.GetTenantQuota(tenant)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+	usage, err := wh.Store.GetTenantUsage(tenant)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, tenantQuota{TenantQuota: quota, Usage: usage})
+}
+
+// SaveTenantQuota sets the quota of a tenant, replacing the existing one
+func (wh *WorkflowHandler) SaveTenantQuota(resw http.ResponseWriter, req *http.Request) {
+	var body tenantQuotaRequest
+	if !decodeRequest(resw, req, &body) {
+		return
+	}
+
+	quota := workflow.TenantQuota{
+		TenantID: mux.Vars(req)["tenant"], MaxConcurrentExecutions: body.MaxConcurrentExecutions,
+		MaxWorkflows: body.MaxWorkflows, MaxNodes: body.MaxNodes, MaxTasks: body.MaxTasks,
+	}
+	if err := quota.Validate(); err != nil {
+		responseError(resw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before := auditState(req, func() (interface{}, error) { return wh.Store.GetTenantQuota(quota.TenantID) })
+	if err := wh.Store.SaveTenantQuota(quota); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+	quota, err := wh.Store.GetTenantQuota(quota.TenantID)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "tenant_quota", quota.TenantID, before, quota)
+	responseJson(resw, http.StatusOK, quota)
+}
+
+// checkQuota answers the request and returns false when the tenant of store cannot create
+// another resource
+func checkQuota(resw http.ResponseWriter, store workflow.Store, resource workflow.QuotaResource) bool {
+	if err := workflow.CheckQuota(store, resource); err != nil {
+		responseFailure(resw, err)
+		return false
+	}
+	return true
+}
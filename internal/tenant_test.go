@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenants_Routes(t *testing.T) {
+	t.Setenv("APP_AUTH_ENABLED", "true")
+	store := workflow.NewMemoryStore()
+	app := App{Router: mux.NewRouter(), Store: store}
+	app.initializeRoutes()
+
+	acme, globex := store.ForTenant("acme"), store.ForTenant("globex")
+	checkoutID := createWorkflow(t, acme, "checkout")
+	acmeOperator := createKey(t, acme, "acme-operator", workflow.RoleOperator)
+	acmeAdmin := createKey(t, acme, "acme-admin", workflow.RoleAdmin)
+	globexOperator := createKey(t, globex, "globex-operator", workflow.RoleOperator)
+	admin := createKey(t, store, "admin", workflow.RoleAdmin)
+
+	execute, _ := json.Marshal(map[string]interface{}{"workflow_id": checkoutID, "reference_number": "ORD-1"})
+	resw := serve(app.Router, "POST", "/workflow/execution", acmeOperator, execute)
+	assert.Equal(t, http.StatusCreated, resw.Code)
+	var execution workflow.WorkflowExecution
+	json.Unmarshal(resw.Body.Bytes(), &execution)
+	executionID := execution.ID
+
+	// Other tenants cannot tell the workflow exists
+	assert.Equal(t, http.StatusOK, serve(app.Router, "GET", "/workflow/execution/"+executionID.String(), acmeOperator, nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(app.Router, "GET", "/workflow/execution/"+executionID.String(), globexOperator, nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(app.Router, "GET", "/workflow/"+checkoutID.String()+"/graph", globexOperator, nil).Code)
+	assert.Equal(t, http.StatusNotFound, serve(app.Router, "POST", "/workflow/execution", globexOperator, execute).Code)
+
+	// Only admins of the default tenant manage quotas
+	quota := []byte(`{"max_concurrent_executions":1}`)
+	assert.Equal(t, http.StatusForbidden, serve(app.Router, "PUT", "/admin/tenants/acme/quota", acmeAdmin, quota).Code)
+	assert.Equal(t, http.StatusOK, serve(app.Router, "PUT", "/admin/tenants/acme/quota", admin, quota).Code)
+
+	resw = serve(app.Router, "GET", "/admin/tenants/acme/quota", admin, nil)
+	assert.Equal(t, http.StatusOK, resw.Code)
+	var saved tenantQuota
+	json.Unmarshal(resw.Body.Bytes(), &saved)
+	assert.Equal(t, 1, saved.MaxConcurrentExecutions)
+	assert.Equal(t, 1, saved.Usage.ActiveExecutions)
+
+	// acme is at its limit while globex is not
+	execute, _ = json.Marshal(map[string]interface{}{"workflow_id": checkoutID, "reference_number": "ORD-2"})
+	resw = serve(app.Router, "POST", "/workflow/execution", acmeOperator, execute)
+	assert.Equal(t, http.StatusTooManyRequests, resw.Code)
+	assert.Contains(t, resw.Body.String(), "limit of 1 concurrent executions")
+
+	refundID := createWorkflow(t, globex, "refund")
+	execute, _ = json.Marshal(map[string]interface{}{"workflow_id": refundID, "reference_number": "ORD-2"})
+	assert.Equal(t, http.StatusCreated, serve(app.Router, "POST", "/workflow/execution", globexOperator, execute).Code)
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/kadzany/frosty/workflow"
+)
+
+func (wh *WorkflowHandler) ListTimers(resw http.ResponseWriter, req *http.Request) {
+	executionID := uuid.Nil
+	if value := req.URL.Query().Get("execution_id"); value != "" {
+		var err error
+		executionID, err = uuid.Parse(value)
+		if err != nil {
+			responseError(resw, http.StatusBadRequest, "Invalid Workflow Execution Id")
+			return
+		}
+	}
+
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = workflow.TimerStatusPending
+	}
+
+	timers, err := wh.store(req).ListTimers(executionID, status)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, timers)
+}
+
+func (wh *WorkflowHandler) GetTimer(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Timer Id")
+		return
+	}
+
+	timer, err := wh.store(req).GetTimer(id)
+	if err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	responseJson(resw, http.StatusOK, timer)
+}
+
+func (wh *WorkflowHandler) CancelTimer(resw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id, err := uuid.Parse(vars["id"])
+
+	if err != nil {
+		responseError(resw, http.StatusBadRequest, "Invalid Timer Id")
+		return
+	}
+
+	get := func() (interface{}, error) { return wh.store(req).GetTimer(id) }
+	before := auditState(req, get)
+	if err := workflow.CancelTimer(executionContext(req), wh.store(req), id); err != nil {
+		responseFailure(resw, err)
+		return
+	}
+
+	auditResource(req, "timer", id, before, auditState(req, get))
+
+	responseJson(resw, http.StatusOK, nil)
+}
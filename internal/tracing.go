@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TraceConfig controls the OpenTelemetry trace exporter
+type TraceConfig struct {
+	Exporter    string // none (default), stdout or file
+	File        string // Output path used by the file exporter
+	ServiceName string // Reported as the service.name resource attribute
+}
+
+func TraceConfigFromEnv() TraceConfig {
+	cfg := TraceConfig{
+		Exporter:    os.Getenv("OTEL_TRACES_EXPORTER"),
+		File:        os.Getenv("APP_TRACE_FILE"),
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "frosty"
+	}
+	return cfg
+}
+
+// SetupTracing installs the global tracer provider and W3C trace context propagator.
+// The returned function flushes and closes the exporter.
+func SetupTracing(cfg TraceConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var opts []stdouttrace.Option
+	closeOutput := func() error { return nil }
+
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		opts = append(opts, stdouttrace.WithPrettyPrint())
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("APP_TRACE_FILE is required for the file trace exporter")
+		}
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %v", err)
+		}
+		opts = append(opts, stdouttrace.WithWriter(f))
+		closeOutput = f.Close
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter: %s", cfg.Exporter)
+	}
+
+	exporter, err := stdouttrace.New(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		// Spans are written as they end so nothing is lost when the process exits
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		if err := provider.Shutdown(ctx); err != nil {
+			return err
+		}
+		return closeOutput()
+	}, nil
+}
+
+// executionContext returns the context an execution runs in. It continues any trace
+// started by the caller's traceparent header, but is not cancelled when the client
+// disconnects so in-flight task calls are not aborted halfway.
+func executionContext(req *http.Request) context.Context {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	return context.WithoutCancel(ctx)
+}
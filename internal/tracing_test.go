@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestExecutionContext_RespectsTraceparent(t *testing.T) {
+	_, err := SetupTracing(TraceConfig{Exporter: "none"})
+	assert.NoError(t, err)
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(reqCtx, "POST", "/workflow/execution/x/execute", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := executionContext(req)
+	cancel()
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+	assert.True(t, spanContext.IsRemote())
+	assert.NoError(t, ctx.Err())
+}
+
+func TestSetupTracing_UnsupportedExporter(t *testing.T) {
+	_, err := SetupTracing(TraceConfig{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
@@ -1,20 +1,87 @@
 package main
 
 import (
+	"context"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/kadzany/frosty/internal"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run starts frosty and returns the exit code, so deferred cleanup such as flushing
+// traces happens before the process exits
+func run() int {
+	internal.SetupLogging(internal.LogConfigFromEnv())
+
+	shutdownTracing, err := internal.SetupTracing(internal.TraceConfigFromEnv())
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("failed to shut down tracing", "error", err)
+		}
+	}()
+
 	app := internal.App{}
 
-	app.Initialize(
-		os.Getenv("APP_DB_USERNAME"),
-		os.Getenv("APP_DB_PASSWORD"),
-		os.Getenv("APP_DB_NAME"),
-		os.Getenv("APP_DB_HOST"),
-		os.Getenv("APP_DB_PORT"))
+	switch driver := os.Getenv("APP_DB_DRIVER"); driver {
+	case "", "postgres":
+		app.Initialize(
+			os.Getenv("APP_DB_USERNAME"),
+			os.Getenv("APP_DB_PASSWORD"),
+			os.Getenv("APP_DB_NAME"),
+			os.Getenv("APP_DB_HOST"),
+			os.Getenv("APP_DB_PORT"))
+	case "sqlite":
+		app.InitializeSQLite(dbPath())
+	default:
+		slog.Error("unknown database driver", "driver", driver)
+		return 1
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.Migrate(os.Args[2:], os.Stdout); err != nil {
+			slog.Error("migrate failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := app.APIKey(os.Args[2:], os.Stdout); err != nil {
+			slog.Error("apikey failed", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	// Refuse to serve against a schema the code was not written for
+	if err := app.CheckSchema(); err != nil {
+		slog.Error("database schema check failed", "error", err)
+		return 1
+	}
+
+	if err := app.Run(":8080"); err != nil {
+		slog.Error("server stopped", "error", err)
+		return 1
+	}
+	slog.Info("server stopped")
+	return 0
+}
 
-	app.Run(":8080")
+// dbPath is the SQLite database file, frosty.db in the working directory unless APP_DB_PATH is set
+func dbPath() string {
+	if path := os.Getenv("APP_DB_PATH"); path != "" {
+		return path
+	}
+	return "frosty.db"
 }
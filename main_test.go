@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"log/slog"
 	"os"
 	"testing"
 
@@ -11,12 +12,20 @@ var app internal.App
 
 func TestMain(m *testing.M) {
 	app = internal.App{}
-	app.Initialize(
-		os.Getenv("APP_DB_USERNAME"),
-		os.Getenv("APP_DB_PASSWORD"),
-		os.Getenv("APP_TEST_DB_NAME"),
-		os.Getenv("APP_DB_HOST"),
-		os.Getenv("APP_DB_PORT"))
+	switch driver := os.Getenv("APP_DB_DRIVER"); driver {
+	case "", "postgres":
+		app.Initialize(
+			os.Getenv("APP_DB_USERNAME"),
+			os.Getenv("APP_DB_PASSWORD"),
+			os.Getenv("APP_TEST_DB_NAME"),
+			os.Getenv("APP_DB_HOST"),
+			os.Getenv("APP_DB_PORT"))
+	case "sqlite":
+		app.InitializeSQLite(":memory:")
+	default:
+		slog.Error("unknown database driver", "driver", driver)
+		os.Exit(1)
+	}
 
 	code := m.Run()
 	os.Exit(code)
@@ -0,0 +1 @@
+DROP TABLE node_closure;
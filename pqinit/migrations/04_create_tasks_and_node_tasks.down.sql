@@ -0,0 +1,2 @@
+DROP TABLE node_tasks;
+DROP TABLE tasks;
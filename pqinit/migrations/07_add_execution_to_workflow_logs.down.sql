@@ -0,0 +1,5 @@
+DROP INDEX idx_workflow_logs_execution_id;
+
+ALTER TABLE workflow_logs
+    DROP COLUMN attempt,
+    DROP COLUMN execution_id;
@@ -0,0 +1,5 @@
+ALTER TABLE workflow_logs
+    ADD COLUMN execution_id UUID REFERENCES workflow_executions(id),
+    ADD COLUMN attempt INT;
+
+CREATE INDEX idx_workflow_logs_execution_id ON workflow_logs (execution_id, executed_at);
@@ -0,0 +1,2 @@
+ALTER TABLE node_closure
+    DROP COLUMN condition;
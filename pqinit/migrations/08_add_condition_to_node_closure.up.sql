@@ -0,0 +1,2 @@
+ALTER TABLE node_closure
+    ADD COLUMN condition VARCHAR(255);
@@ -0,0 +1,2 @@
+ALTER TABLE workflow_executions
+    ADD COLUMN data JSONB;
@@ -0,0 +1 @@
+DROP TABLE workflow_schedules;
@@ -0,0 +1,20 @@
+CREATE TABLE workflow_schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    workflow_id UUID NOT NULL,
+    cron_expression VARCHAR(255),
+    interval_seconds INT,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    payload_template TEXT,
+    reference_template TEXT,
+    misfire_policy VARCHAR(20) NOT NULL DEFAULT 'skip',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    FOREIGN KEY (workflow_id) REFERENCES workflows(id),
+    CHECK (cron_expression IS NOT NULL OR interval_seconds IS NOT NULL)
+);
+
+CREATE INDEX idx_workflow_schedules_next_run_at ON workflow_schedules (next_run_at) WHERE enabled AND deleted_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE nodes
+    ADD COLUMN config JSONB;
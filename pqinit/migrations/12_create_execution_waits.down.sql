@@ -0,0 +1 @@
+DROP TABLE execution_waits;
@@ -0,0 +1,16 @@
+CREATE TABLE execution_waits (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    execution_id UUID NOT NULL,
+    node_id UUID NOT NULL,
+    signal_name VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'waiting',
+    timeout_at TIMESTAMPTZ,
+    payload JSONB,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    FOREIGN KEY (execution_id) REFERENCES workflow_executions(id),
+    FOREIGN KEY (node_id) REFERENCES nodes(id)
+);
+
+CREATE INDEX idx_execution_waits_signal ON execution_waits (execution_id, signal_name) WHERE status = 'waiting';
+CREATE INDEX idx_execution_waits_timeout_at ON execution_waits (timeout_at) WHERE status = 'waiting';
@@ -0,0 +1,14 @@
+CREATE TABLE workflow_timers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    execution_id UUID NOT NULL,
+    node_id UUID NOT NULL,
+    fire_at TIMESTAMPTZ NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    FOREIGN KEY (execution_id) REFERENCES workflow_executions(id),
+    FOREIGN KEY (node_id) REFERENCES nodes(id)
+);
+
+CREATE INDEX idx_workflow_timers_fire_at ON workflow_timers (fire_at) WHERE status = 'pending';
+CREATE INDEX idx_workflow_timers_execution_id ON workflow_timers (execution_id);
@@ -0,0 +1,10 @@
+DROP INDEX idx_workflow_executions_parent_execution_id;
+
+ALTER TABLE workflow_executions
+    DROP COLUMN parent_node_id,
+    DROP COLUMN parent_execution_id;
+
+DROP INDEX idx_workflows_name_version;
+
+ALTER TABLE workflows
+    DROP COLUMN version;
@@ -0,0 +1,19 @@
+ALTER TABLE workflows
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- Workflows created before versioning may share a name, number them in creation order
+UPDATE workflows w
+SET version = numbered.version
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY name ORDER BY created_at, id) AS version
+    FROM workflows
+) numbered
+WHERE w.id = numbered.id;
+
+CREATE UNIQUE INDEX idx_workflows_name_version ON workflows (name, version) WHERE deleted_at IS NULL;
+
+ALTER TABLE workflow_executions
+    ADD COLUMN parent_execution_id UUID REFERENCES workflow_executions(id),
+    ADD COLUMN parent_node_id UUID REFERENCES nodes(id);
+
+CREATE INDEX idx_workflow_executions_parent_execution_id ON workflow_executions (parent_execution_id);
@@ -0,0 +1,9 @@
+DROP INDEX idx_workflow_executions_unique_reference;
+DROP INDEX idx_workflow_executions_idempotency_key;
+
+ALTER TABLE workflow_executions
+    DROP COLUMN unique_reference,
+    DROP COLUMN idempotency_key;
+
+ALTER TABLE workflows
+    DROP COLUMN unique_reference;
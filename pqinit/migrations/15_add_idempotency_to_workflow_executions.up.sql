@@ -0,0 +1,12 @@
+ALTER TABLE workflows
+    ADD COLUMN unique_reference BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE workflow_executions
+    ADD COLUMN idempotency_key VARCHAR(255),
+    ADD COLUMN unique_reference BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX idx_workflow_executions_idempotency_key
+    ON workflow_executions (workflow_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+CREATE UNIQUE INDEX idx_workflow_executions_unique_reference
+    ON workflow_executions (workflow_id, reference_number) WHERE unique_reference;
@@ -0,0 +1,15 @@
+CREATE TABLE task_target_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    scope VARCHAR(50) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    failure_threshold INT NOT NULL DEFAULT 0,
+    open_seconds INT NOT NULL DEFAULT 30,
+    open_policy VARCHAR(50) NOT NULL DEFAULT 'fail_fast',
+    max_wait_seconds INT NOT NULL DEFAULT 0,
+    max_concurrency INT NOT NULL DEFAULT 0,
+    rate_per_second DOUBLE PRECISION NOT NULL DEFAULT 0,
+    burst INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ,
+    UNIQUE (scope, target)
+);
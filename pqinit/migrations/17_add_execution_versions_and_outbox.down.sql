@@ -0,0 +1,4 @@
+DROP TABLE outbox_events;
+
+ALTER TABLE workflow_executions
+    DROP COLUMN version;
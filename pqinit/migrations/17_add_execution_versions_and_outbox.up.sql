@@ -0,0 +1,16 @@
+ALTER TABLE workflow_executions
+    ADD COLUMN version INT NOT NULL DEFAULT 0;
+
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_type VARCHAR(100) NOT NULL,
+    execution_id UUID,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    FOREIGN KEY (execution_id) REFERENCES workflow_executions(id)
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (created_at) WHERE published_at IS NULL;
@@ -0,0 +1,10 @@
+DROP TABLE audit_log;
+DROP TABLE workflow_grants;
+
+ALTER TABLE api_keys
+    ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE api_keys SET admin = TRUE WHERE ',' || roles || ',' LIKE '%,admin,%';
+
+ALTER TABLE api_keys
+    DROP COLUMN roles;
@@ -0,0 +1,23 @@
+ALTER TABLE nodes ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE tasks ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE workflows ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE workflow_executions ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE workflow_schedules ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+
+-- Every tenant numbers the versions of its workflows on its own
+DROP INDEX idx_workflows_name_version;
+CREATE UNIQUE INDEX idx_workflows_name_version ON workflows (tenant_id, name, version) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_nodes_tenant_id ON nodes (tenant_id);
+CREATE INDEX idx_tasks_tenant_id ON tasks (tenant_id);
+CREATE INDEX idx_workflow_executions_tenant_id_status ON workflow_executions (tenant_id, status);
+
+CREATE TABLE tenant_quotas (
+    tenant_id VARCHAR(255) PRIMARY KEY,
+    max_concurrent_executions INTEGER NOT NULL DEFAULT 0,
+    max_workflows INTEGER NOT NULL DEFAULT 0,
+    max_nodes INTEGER NOT NULL DEFAULT 0,
+    max_tasks INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+DROP FUNCTION IF EXISTS audit_log_append_only();
+
+DROP INDEX IF EXISTS idx_audit_log_resource;
+DROP INDEX IF EXISTS idx_audit_log_tenant_id_created_at;
+
+ALTER TABLE audit_log
+    DROP COLUMN after_state,
+    DROP COLUMN before_state,
+    DROP COLUMN request_id,
+    DROP COLUMN tenant_id;
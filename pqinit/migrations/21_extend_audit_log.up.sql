@@ -0,0 +1,19 @@
+ALTER TABLE audit_log
+    ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default',
+    ADD COLUMN request_id VARCHAR(255),
+    ADD COLUMN before_state JSONB,
+    ADD COLUMN after_state JSONB;
+
+CREATE INDEX idx_audit_log_tenant_id_created_at ON audit_log (tenant_id, created_at);
+CREATE INDEX idx_audit_log_resource ON audit_log (resource_type, resource_id);
+
+-- Entries are never changed or removed once written
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
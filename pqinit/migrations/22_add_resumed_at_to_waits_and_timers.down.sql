@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_workflow_timers_unresumed;
+DROP INDEX IF EXISTS idx_execution_waits_unresumed;
+
+ALTER TABLE workflow_timers DROP COLUMN resumed_at;
+ALTER TABLE execution_waits DROP COLUMN resumed_at;
@@ -0,0 +1,10 @@
+-- A resolved wait or fired timer is only done once the execution continued from it, so a
+-- resume lost between the two is picked up again
+ALTER TABLE execution_waits ADD COLUMN resumed_at TIMESTAMPTZ;
+ALTER TABLE workflow_timers ADD COLUMN resumed_at TIMESTAMPTZ;
+
+UPDATE execution_waits SET resumed_at = resolved_at WHERE status <> 'waiting';
+UPDATE workflow_timers SET resumed_at = resolved_at WHERE status <> 'pending';
+
+CREATE INDEX idx_execution_waits_unresumed ON execution_waits (resolved_at) WHERE resumed_at IS NULL AND status <> 'waiting';
+CREATE INDEX idx_workflow_timers_unresumed ON workflow_timers (resolved_at) WHERE resumed_at IS NULL AND status = 'fired';
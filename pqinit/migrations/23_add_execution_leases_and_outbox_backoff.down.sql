@@ -0,0 +1,5 @@
+ALTER TABLE outbox_events
+    DROP COLUMN claimed_until,
+    DROP COLUMN next_attempt_at;
+
+ALTER TABLE workflow_executions DROP COLUMN lease_expires_at;
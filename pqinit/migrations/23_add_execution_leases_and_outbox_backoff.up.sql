@@ -0,0 +1,9 @@
+-- The worker running an execution renews its lease; once it lapsed the worker is gone and a
+-- resume may take the execution over
+ALTER TABLE workflow_executions ADD COLUMN lease_expires_at TIMESTAMPTZ;
+
+-- Failed events are retried with a backoff, and claimed events are published outside the
+-- transaction claiming them
+ALTER TABLE outbox_events
+    ADD COLUMN next_attempt_at TIMESTAMPTZ,
+    ADD COLUMN claimed_until TIMESTAMPTZ;
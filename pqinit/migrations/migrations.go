@@ -0,0 +1,329 @@
+// Package migrations holds the versioned database schema and applies it. Every migration
+// is a pair of files, NN_name.up.sql and NN_name.down.sql, embedded in the binary. The
+// Postgres migrations live in this directory and the SQLite ones in sqlite/, under the same
+// versions.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
+
+// Dialects the migrations are written for
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// ErrSchemaMismatch is returned by Check when the database is not at the version the binary expects
+var ErrSchemaMismatch = errors.New("database schema does not match the binary")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration with the time it was applied, nil when pending
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the embedded migrations of dialect ordered by version
+func Load(dialect string) ([]Migration, error) {
+	switch dialect {
+	case Postgres:
+		return load(files)
+	case SQLite:
+		fsys, err := fs.Sub(files, "sqlite")
+		if err != nil {
+			return nil, err
+		}
+		return load(fsys)
+	}
+	return nil, fmt.Errorf("unknown database dialect %q", dialect)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, path := range paths {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(path, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s is not named NN_name.up.sql or NN_name.down.sql", path)
+		}
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s does not start with a version number", path)
+		}
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, name)
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s requires both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies migrations to a database and records them in schema_migrations
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	Migrations []Migration
+}
+
+// New returns a Migrator for the embedded migrations of dialect
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Dialect: dialect, Migrations: migrations}, nil
+}
+
+// Latest returns the version of the newest migration, 0 when there are none
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable() error {
+	// SQLite reads TIMESTAMP columns back as times, but not TIMESTAMPTZ ones
+	timestampType := "TIMESTAMPTZ"
+	if m.Dialect == SQLite {
+		timestampType = "TIMESTAMP"
+	}
+
+	_, err := m.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at ` + timestampType + ` NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	return nil
+}
+
+// applied returns when each applied version was applied
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	rows, err := m.DB.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning migration row: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Status returns every migration known to the binary with when it was applied
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies the pending migrations in order and returns them. Each migration runs in its
+// own transaction together with its schema_migrations row.
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var migrated []Migration
+	for _, migration := range m.Migrations {
+		ran, err := m.run(migration, true)
+		if err != nil {
+			return migrated, fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		if ran {
+			migrated = append(migrated, migration)
+		}
+	}
+	return migrated, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns them
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		ran, err := m.run(migration, false)
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		if ran {
+			reverted = append(reverted, migration)
+		}
+	}
+	return reverted, nil
+}
+
+// run applies or reverts one migration. It returns false when another instance got there first.
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Instances starting together migrate one after another. SQLite has a single writer,
+	// so its transactions do already.
+	if m.Dialect != SQLite {
+		if _, err := tx.Exec(`LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+			return false, err
+		}
+	}
+
+	var applied bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, migration.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.Exec(migration.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, CURRENT_TIMESTAMP)`, migration.Version, migration.Name)
+	} else {
+		if _, err := tx.Exec(migration.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Baseline records the migrations up to version as applied without running them, for
+// databases whose schema was created before migrations were tracked
+func (m *Migrator) Baseline(version int) error {
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	for _, migration := range m.Migrations {
+		if migration.Version > version {
+			break
+		}
+		_, err := m.DB.Exec(`
+			INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, CURRENT_TIMESTAMP)
+			ON CONFLICT (version) DO NOTHING
+		`, migration.Version, migration.Name)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Check returns ErrSchemaMismatch unless exactly the migrations of the binary are applied
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return fmt.Errorf("%w: %v, run migrate up", ErrSchemaMismatch, err)
+	}
+
+	known := map[int]bool{}
+	var pending []string
+	for _, migration := range m.Migrations {
+		known[migration.Version] = true
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%d_%s", migration.Version, migration.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: pending migrations %s, run migrate up", ErrSchemaMismatch, strings.Join(pending, ", "))
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: database has migration %d, which this binary does not know; it is older than the schema", ErrSchemaMismatch, version)
+		}
+	}
+	return nil
+}
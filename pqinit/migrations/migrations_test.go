@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(Postgres)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version, "versions must be contiguous")
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+
+	// Both dialects end at the same schema version
+	sqliteMigrations, err := Load(SQLite)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, sqliteMigrations) {
+		assert.Equal(t, migrations[len(migrations)-1].Version, sqliteMigrations[len(sqliteMigrations)-1].Version)
+	}
+
+	_, err = Load("mysql")
+	assert.ErrorContains(t, err, "unknown database dialect")
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, err := load(fstest.MapFS{"01_create_nodes.up.sql": {Data: []byte("CREATE TABLE nodes ();")}})
+	assert.ErrorContains(t, err, "requires both an up and a down file")
+
+	_, err = load(fstest.MapFS{"create_nodes.up.sql": {Data: []byte("CREATE TABLE nodes ();")}})
+	assert.ErrorContains(t, err, "does not start with a version number")
+}
+
+func TestMigratorUp(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	migrator := &Migrator{DB: db, Migrations: []Migration{
+		{Version: 1, Name: "create_nodes", Up: "CREATE TABLE nodes", Down: "DROP TABLE nodes"},
+		{Version: 2, Name: "create_tasks", Up: "CREATE TABLE tasks", Down: "DROP TABLE tasks"},
+	}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// The first migration is already applied
+	mock.ExpectBegin()
+	mock.ExpectExec("LOCK TABLE schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("LOCK TABLE schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("CREATE TABLE tasks").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(2, "create_tasks").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migrated, err := migrator.Up()
+	assert.NoError(t, err)
+	if assert.Len(t, migrated, 1) {
+		assert.Equal(t, 2, migrated[0].Version)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorCheck(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	migrator := &Migrator{DB: db, Migrations: []Migration{
+		{Version: 1, Name: "create_nodes"},
+		{Version: 2, Name: "create_tasks"},
+	}}
+	now := time.Now()
+
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, now))
+	err := migrator.Check()
+	assert.ErrorIs(t, err, ErrSchemaMismatch)
+	assert.ErrorContains(t, err, "2_create_tasks")
+
+	// A newer binary already migrated the database
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, now).AddRow(2, now).AddRow(3, now))
+	assert.ErrorIs(t, migrator.Check(), ErrSchemaMismatch)
+
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, now).AddRow(2, now))
+	assert.NoError(t, migrator.Check())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
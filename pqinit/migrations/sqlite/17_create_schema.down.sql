@@ -0,0 +1,12 @@
+DROP TABLE outbox_events;
+DROP TABLE task_target_policies;
+DROP TABLE workflow_timers;
+DROP TABLE execution_waits;
+DROP TABLE workflow_schedules;
+DROP TABLE workflow_logs;
+DROP TABLE workflow_executions;
+DROP TABLE node_tasks;
+DROP TABLE tasks;
+DROP TABLE workflows;
+DROP TABLE node_closure;
+DROP TABLE nodes;
@@ -0,0 +1,209 @@
+-- The schema of Postgres migrations 1 to 17. SQLite is dynamically typed: UUIDs and JSON are
+-- stored as text and times as UTC text, which the TIMESTAMP type reads back as times.
+
+CREATE TABLE nodes (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    title VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    description TEXT,
+    config TEXT,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE TABLE node_closure (
+    ancestor TEXT NOT NULL,
+    descendant TEXT NOT NULL,
+    depth INT NOT NULL,
+    condition VARCHAR(255),
+    PRIMARY KEY (ancestor, descendant),
+    FOREIGN KEY (ancestor) REFERENCES nodes(id),
+    FOREIGN KEY (descendant) REFERENCES nodes(id)
+);
+
+CREATE TABLE workflows (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    starting_node_id TEXT,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    status VARCHAR(50) DEFAULT 'draft',
+    version INT NOT NULL DEFAULT 1,
+    unique_reference BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_workflows_name_version ON workflows (name, version) WHERE deleted_at IS NULL;
+
+CREATE TABLE tasks (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    title VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    http_method VARCHAR(10) NOT NULL,
+    action TEXT NOT NULL,
+    params TEXT,
+    max_retries INT DEFAULT 3,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE TABLE node_tasks (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    node_id TEXT NOT NULL,
+    task_id TEXT NOT NULL,
+    task_order INT NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    retry_count INT DEFAULT 0,
+    http_code INT,
+    response TEXT,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    FOREIGN KEY (node_id) REFERENCES nodes(id),
+    FOREIGN KEY (task_id) REFERENCES tasks(id)
+);
+
+CREATE TABLE workflow_executions (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    workflow_id TEXT NOT NULL,
+    node_id TEXT,
+    last_executed_node_id TEXT,
+    last_executed_task_id TEXT,
+    reference_number VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    message TEXT,
+    data TEXT,
+    parent_execution_id TEXT REFERENCES workflow_executions(id),
+    parent_node_id TEXT REFERENCES nodes(id),
+    idempotency_key VARCHAR(255),
+    unique_reference BOOLEAN NOT NULL DEFAULT FALSE,
+    version INT NOT NULL DEFAULT 0,
+    last_node_executed_at TIMESTAMP DEFAULT (NOW()),
+    last_node_completed_at TIMESTAMP,
+    last_task_executed_at TIMESTAMP DEFAULT (NOW()),
+    last_task_completed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP DEFAULT (NOW()),
+    FOREIGN KEY (workflow_id) REFERENCES workflows(id),
+    FOREIGN KEY (node_id) REFERENCES nodes(id)
+);
+
+CREATE INDEX idx_workflow_executions_parent_execution_id ON workflow_executions (parent_execution_id);
+
+CREATE UNIQUE INDEX idx_workflow_executions_idempotency_key
+    ON workflow_executions (workflow_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+CREATE UNIQUE INDEX idx_workflow_executions_unique_reference
+    ON workflow_executions (workflow_id, reference_number) WHERE unique_reference;
+
+CREATE TABLE workflow_logs (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    workflow_id TEXT,
+    execution_id TEXT REFERENCES workflow_executions(id),
+    node_id TEXT,
+    task_id TEXT,
+    attempt INT,
+    status VARCHAR(50) NOT NULL,
+    message TEXT,
+    executed_at TIMESTAMP DEFAULT (NOW()),
+    completed_at TIMESTAMP,
+    error_message TEXT,
+    action_type VARCHAR(50),
+    metadata TEXT,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP DEFAULT (NOW()),
+    http_code INT,
+    response TEXT,
+    error TEXT,
+    FOREIGN KEY (workflow_id) REFERENCES workflows(id),
+    FOREIGN KEY (node_id) REFERENCES nodes(id)
+);
+
+CREATE INDEX idx_workflow_logs_execution_id ON workflow_logs (execution_id, executed_at);
+
+CREATE TABLE workflow_schedules (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    workflow_id TEXT NOT NULL,
+    cron_expression VARCHAR(255),
+    interval_seconds INT,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    payload_template TEXT,
+    reference_template TEXT,
+    misfire_policy VARCHAR(20) NOT NULL DEFAULT 'skip',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    next_run_at TIMESTAMP,
+    last_run_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP,
+    deleted_at TIMESTAMP,
+    FOREIGN KEY (workflow_id) REFERENCES workflows(id),
+    CHECK (cron_expression IS NOT NULL OR interval_seconds IS NOT NULL)
+);
+
+CREATE INDEX idx_workflow_schedules_next_run_at ON workflow_schedules (next_run_at) WHERE enabled AND deleted_at IS NULL;
+
+CREATE TABLE execution_waits (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    execution_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    signal_name VARCHAR(255) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'waiting',
+    timeout_at TIMESTAMP,
+    payload TEXT,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    resolved_at TIMESTAMP,
+    FOREIGN KEY (execution_id) REFERENCES workflow_executions(id),
+    FOREIGN KEY (node_id) REFERENCES nodes(id)
+);
+
+CREATE INDEX idx_execution_waits_signal ON execution_waits (execution_id, signal_name) WHERE status = 'waiting';
+CREATE INDEX idx_execution_waits_timeout_at ON execution_waits (timeout_at) WHERE status = 'waiting';
+
+CREATE TABLE workflow_timers (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    execution_id TEXT NOT NULL,
+    node_id TEXT NOT NULL,
+    fire_at TIMESTAMP NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT (NOW()),
+    resolved_at TIMESTAMP,
+    FOREIGN KEY (execution_id) REFERENCES workflow_executions(id),
+    FOREIGN KEY (node_id) REFERENCES nodes(id)
+);
+
+CREATE INDEX idx_workflow_timers_fire_at ON workflow_timers (fire_at) WHERE status = 'pending';
+CREATE INDEX idx_workflow_timers_execution_id ON workflow_timers (execution_id);
+
+CREATE TABLE task_target_policies (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    scope VARCHAR(50) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    failure_threshold INT NOT NULL DEFAULT 0,
+    open_seconds INT NOT NULL DEFAULT 30,
+    open_policy VARCHAR(50) NOT NULL DEFAULT 'fail_fast',
+    max_wait_seconds INT NOT NULL DEFAULT 0,
+    max_concurrency INT NOT NULL DEFAULT 0,
+    rate_per_second DOUBLE PRECISION NOT NULL DEFAULT 0,
+    burst INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    updated_at TIMESTAMP,
+    UNIQUE (scope, target)
+);
+
+CREATE TABLE outbox_events (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    event_type VARCHAR(100) NOT NULL,
+    execution_id TEXT,
+    payload TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    published_at TIMESTAMP,
+    FOREIGN KEY (execution_id) REFERENCES workflow_executions(id)
+);
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (created_at) WHERE published_at IS NULL;
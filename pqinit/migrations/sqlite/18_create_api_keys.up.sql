@@ -0,0 +1,9 @@
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    hash VARCHAR(128) NOT NULL,
+    admin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    revoked_at TIMESTAMP
+);
@@ -0,0 +1,30 @@
+ALTER TABLE api_keys
+    ADD COLUMN roles VARCHAR(255) NOT NULL DEFAULT 'viewer';
+
+UPDATE api_keys SET roles = 'admin' WHERE admin;
+
+ALTER TABLE api_keys
+    DROP COLUMN admin;
+
+CREATE TABLE workflow_grants (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    workflow_id TEXT NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT (NOW()),
+    FOREIGN KEY (workflow_id) REFERENCES workflows(id),
+    UNIQUE (workflow_id, subject, role)
+);
+
+CREATE TABLE audit_log (
+    id TEXT PRIMARY KEY DEFAULT (uuid_generate_v4()),
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(255) NOT NULL,
+    resource_type VARCHAR(50),
+    resource_id VARCHAR(255),
+    outcome VARCHAR(20) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT (NOW())
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,15 @@
+DROP TABLE tenant_quotas;
+
+DROP INDEX idx_workflow_executions_tenant_id_status;
+DROP INDEX idx_tasks_tenant_id;
+DROP INDEX idx_nodes_tenant_id;
+
+DROP INDEX idx_workflows_name_version;
+CREATE UNIQUE INDEX idx_workflows_name_version ON workflows (name, version) WHERE deleted_at IS NULL;
+
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+ALTER TABLE workflow_schedules DROP COLUMN tenant_id;
+ALTER TABLE workflow_executions DROP COLUMN tenant_id;
+ALTER TABLE workflows DROP COLUMN tenant_id;
+ALTER TABLE tasks DROP COLUMN tenant_id;
+ALTER TABLE nodes DROP COLUMN tenant_id;
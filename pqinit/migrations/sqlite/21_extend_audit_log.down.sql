@@ -0,0 +1,10 @@
+DROP TRIGGER audit_log_no_delete;
+DROP TRIGGER audit_log_no_update;
+
+DROP INDEX idx_audit_log_resource;
+DROP INDEX idx_audit_log_tenant_id_created_at;
+
+ALTER TABLE audit_log DROP COLUMN after_state;
+ALTER TABLE audit_log DROP COLUMN before_state;
+ALTER TABLE audit_log DROP COLUMN request_id;
+ALTER TABLE audit_log DROP COLUMN tenant_id;
@@ -0,0 +1,18 @@
+ALTER TABLE audit_log ADD COLUMN tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE audit_log ADD COLUMN request_id VARCHAR(255);
+ALTER TABLE audit_log ADD COLUMN before_state TEXT;
+ALTER TABLE audit_log ADD COLUMN after_state TEXT;
+
+CREATE INDEX idx_audit_log_tenant_id_created_at ON audit_log (tenant_id, created_at);
+CREATE INDEX idx_audit_log_resource ON audit_log (resource_type, resource_id);
+
+-- Entries are never changed or removed once written
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
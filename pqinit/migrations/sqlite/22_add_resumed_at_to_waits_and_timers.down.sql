@@ -0,0 +1,5 @@
+DROP INDEX idx_workflow_timers_unresumed;
+DROP INDEX idx_execution_waits_unresumed;
+
+ALTER TABLE workflow_timers DROP COLUMN resumed_at;
+ALTER TABLE execution_waits DROP COLUMN resumed_at;
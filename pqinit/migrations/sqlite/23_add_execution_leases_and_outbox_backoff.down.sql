@@ -0,0 +1,4 @@
+ALTER TABLE outbox_events DROP COLUMN claimed_until;
+ALTER TABLE outbox_events DROP COLUMN next_attempt_at;
+
+ALTER TABLE workflow_executions DROP COLUMN lease_expires_at;
@@ -0,0 +1,132 @@
+package workflow
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyPrefix starts every API key, telling keys apart from JWTs in the Authorization header
+const APIKeyPrefix = "frosty_"
+
+// APIKey is an issued API key. Only the SHA-256 hash of the secret is stored, the key itself is
+// shown once when it is created.
+type APIKey struct {
+	ID        uuid.UUID  `db:"id" json:"id"`                 // Unique identifier for the key
+	Name      string     `db:"name" json:"name"`             // Client the key was issued to
+	Prefix    string     `db:"prefix" json:"prefix"`         // Public part of the key, used to look it up
+	Hash      string     `db:"hash" json:"-"`                // Hex SHA-256 of the whole key
+	Roles     []string   `db:"roles" json:"roles"`           // Roles of the client on every workflow
+	TenantID  string     `db:"tenant_id" json:"tenant_id"`   // Tenant the client acts in
+	CreatedAt *time.Time `db:"created_at" json:"created_at"` // Creation timestamp
+	RevokedAt *time.Time `db:"revoked_at" json:"revoked_at"` // When the key was revoked, nil while it is valid
+}
+
+// GenerateAPIKey returns a new key for name and the APIKey row to store for it.
+// Keys look like frosty_<prefix>_<secret>.
+func GenerateAPIKey(name string, roles []string) (string, APIKey, error) {
+	random := make([]byte, 28)
+	if _, err := rand.Read(random); err != nil {
+		return "", APIKey{}, fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix := hex.EncodeToString(random[:4])
+	key := APIKeyPrefix + prefix + "_" + hex.EncodeToString(random[4:])
+	return key, APIKey{Name: name, Prefix: prefix, Hash: hashAPIKey(key), Roles: roles}, nil
+}
+
+// ParseAPIKeyPrefix returns the prefix of key, false when key is not shaped like an API key
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// Matches tells whether key is this API key and it was not revoked
+func (k APIKey) Matches(key string) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(k.Hash)) == 1
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+const apiKeyColumns = `id, name, prefix, hash, roles, tenant_id, created_at, revoked_at`
+
+// scanAPIKey reads a row of apiKeyColumns. Roles are stored comma separated.
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (APIKey, error) {
+	var k APIKey
+	var roles string
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &roles, &k.TenantID, &k.CreatedAt, &k.RevokedAt); err != nil {
+		return k, err
+	}
+	k.Roles = strings.Split(roles, ",")
+	return k, nil
+}
+
+// CreateAPIKey stores a key for a client of the tenant of the store
+func (s *PostgresStore) CreateAPIKey(key APIKey) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO api_keys (name, prefix, hash, roles, tenant_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id
+	`, key.Name, key.Prefix, key.Hash, strings.Join(key.Roles, ","), s.owner()).Scan(&id)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+// GetAPIKeyByPrefix looks up a key of any tenant, it is how clients are authenticated
+func (s *PostgresStore) GetAPIKeyByPrefix(prefix string) (APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix))
+	return key, noRows(err, "api key", prefix)
+}
+
+func (s *PostgresStore) ListAPIKeys() ([]APIKey, error) {
+	rows, err := s.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = $1 OR $1 = '' ORDER BY created_at ASC`, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key row: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes a key for good. It returns an ErrNotFound error when the key does not
+// exist or was already revoked.
+func (s *PostgresStore) RevokeAPIKey(keyID uuid.UUID) error {
+	result, err := s.db.Exec(`UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND (tenant_id = $2 OR $2 = '') AND revoked_at IS NULL`, keyID, s.tenant)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "api key", keyID)
+}
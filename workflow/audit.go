@@ -0,0 +1,216 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes recorded on audit entries
+const (
+	AuditOutcomeDenied    = "denied"    // The client lacked the permission for the action
+	AuditOutcomeSucceeded = "succeeded" // The action was carried out
+	AuditOutcomeFailed    = "failed"    // The action was allowed but was rejected or failed
+)
+
+// DefaultAuditLimit is the number of entries ListAuditEntries returns when the filter has no limit
+const DefaultAuditLimit = 100
+
+// AuditActorSystem is the actor of the entries of actions the engine takes on its own, such as
+// firing schedules, timing out waits, resuming executions and publishing events
+const AuditActorSystem = "system"
+
+// AuditEntry records who did, or tried to do, what to which resource. Entries are append-only.
+type AuditEntry struct {
+	ID           uuid.UUID       `db:"id" json:"id"`                       // Unique identifier for the entry
+	TenantID     string          `db:"tenant_id" json:"tenant_id"`         // Tenant of the client that acted
+	Actor        string          `db:"actor" json:"actor"`                 // Client that acted (API key name or JWT subject)
+	Action       string          `db:"action" json:"action"`               // What was done, e.g. POST /workflow/{id}/execute
+	ResourceType string          `db:"resource_type" json:"resource_type"` // Kind of resource acted on, e.g. workflow
+	ResourceID   string          `db:"resource_id" json:"resource_id"`     // ID of the resource acted on, if any
+	Outcome      string          `db:"outcome" json:"outcome"`             // Result of the action
+	Reason       string          `db:"reason" json:"reason"`               // Why the action had that outcome
+	RequestID    string          `db:"request_id" json:"request_id"`       // ID of the API request that acted, if any
+	Before       json.RawMessage `db:"before_state" json:"before"`         // Resource before the action, if it existed
+	After        json.RawMessage `db:"after_state" json:"after"`           // Resource after the action, if it still exists
+	Changes      []AuditChange   `db:"-" json:"changes"`                   // Top level fields that differ between Before and After
+	CreatedAt    *time.Time      `db:"created_at" json:"created_at"`       // When the action happened
+}
+
+// AuditChange is a field of a resource changed by an audited action
+type AuditChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditFilter selects audit entries. Empty fields match everything.
+type AuditFilter struct {
+	Actor        string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Outcome      string
+	RequestID    string
+	Since        *time.Time // Entries written at or after
+	Until        *time.Time // Entries written before
+	Limit        int        // At most this many entries, DefaultAuditLimit when 0
+	Offset       int        // Skip this many of the newest matching entries
+}
+
+func (f AuditFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultAuditLimit
+	}
+	return f.Limit
+}
+
+func (f AuditFilter) matches(e AuditEntry) bool {
+	for _, field := range [][2]string{
+		{f.Actor, e.Actor}, {f.Action, e.Action}, {f.ResourceType, e.ResourceType},
+		{f.ResourceID, e.ResourceID}, {f.Outcome, e.Outcome}, {f.RequestID, e.RequestID},
+	} {
+		if field[0] != "" && field[0] != field[1] {
+			return false
+		}
+	}
+	if f.Since != nil && e.CreatedAt.Before(*f.Since) {
+		return false
+	}
+	return f.Until == nil || e.CreatedAt.Before(*f.Until)
+}
+
+// AuditState encodes a resource for the Before or After of an entry, nil for nil
+func AuditState(resource interface{}) json.RawMessage {
+	if resource == nil {
+		return nil
+	}
+	data, err := json.Marshal(resource)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// diffAuditStates lists the top level fields of two JSON objects that differ. States that
+// are not objects are compared as a whole.
+func diffAuditStates(before, after json.RawMessage) []AuditChange {
+	if len(before) == 0 && len(after) == 0 {
+		return nil
+	}
+
+	var beforeFields, afterFields map[string]json.RawMessage
+	if json.Unmarshal(orNull(before), &beforeFields) != nil || json.Unmarshal(orNull(after), &afterFields) != nil {
+		if bytes.Equal(before, after) {
+			return nil
+		}
+		return []AuditChange{{Before: before, After: after}}
+	}
+
+	fields := map[string]bool{}
+	for field := range beforeFields {
+		fields[field] = true
+	}
+	for field := range afterFields {
+		fields[field] = true
+	}
+
+	changes := []AuditChange{}
+	for field := range fields {
+		if !jsonEqual(beforeFields[field], afterFields[field]) {
+			changes = append(changes, AuditChange{Field: field, Before: beforeFields[field], After: afterFields[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func orNull(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return json.RawMessage("null")
+	}
+	return data
+}
+
+// jsonEqual compares JSON documents regardless of formatting and key order
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(orNull(a), &x) != nil || json.Unmarshal(orNull(b), &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	normalizedX, _ := json.Marshal(x)
+	normalizedY, _ := json.Marshal(y)
+	return bytes.Equal(normalizedX, normalizedY)
+}
+
+// auditSystem appends the entry of an action the engine took on its own. Unless the entry
+// names a tenant, it is written for the tenant of the execution acted in, if any.
+func auditSystem(store Store, executionID uuid.UUID, entry AuditEntry) error {
+	if entry.TenantID == "" && executionID != uuid.Nil {
+		execution, err := store.GetWorkflowExecutionByID(executionID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch workflow execution: %w", err)
+		}
+		entry.TenantID = execution.TenantID
+	}
+
+	entry.Actor = AuditActorSystem
+	if entry.Outcome == "" {
+		entry.Outcome = AuditOutcomeSucceeded
+	}
+	if err := store.InsertAuditEntry(entry); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) InsertAuditEntry(entry AuditEntry) error {
+	tenant := entry.TenantID
+	if tenant == "" {
+		tenant = s.owner()
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log (tenant_id, actor, action, resource_type, resource_id, outcome, reason, request_id, before_state, after_state, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, NOW())
+	`, tenant, entry.Actor, entry.Action, entry.ResourceType, entry.ResourceID, entry.Outcome, entry.Reason, entry.RequestID,
+		nullableJSON(entry.Before), nullableJSON(entry.After))
+	return err
+}
+
+// ListAuditEntries returns the entries matching filter, newest first
+func (s *PostgresStore) ListAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	rows, err := s.db.Query(`
+		SELECT id::uuid, tenant_id, actor, action, COALESCE(resource_type, ''), COALESCE(resource_id, ''), outcome,
+			COALESCE(reason, ''), COALESCE(request_id, ''), before_state, after_state, created_at
+		FROM audit_log
+		WHERE (tenant_id = $1 OR $1 = '') AND ($2 = '' OR actor = $2) AND ($3 = '' OR action = $3)
+			AND ($4 = '' OR resource_type = $4) AND ($5 = '' OR resource_id = $5) AND ($6 = '' OR outcome = $6)
+			AND ($7 = '' OR request_id = $7) AND (created_at >= $8 OR $8 IS NULL) AND (created_at < $9 OR $9 IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $10 OFFSET $11
+	`, s.tenant, filter.Actor, filter.Action, filter.ResourceType, filter.ResourceID, filter.Outcome, filter.RequestID,
+		filter.Since, filter.Until, filter.limit(), filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.TenantID, &e.Actor, &e.Action, &e.ResourceType, &e.ResourceID, &e.Outcome,
+			&e.Reason, &e.RequestID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning audit entry row: %w", err)
+		}
+		e.Before, e.After = before, after
+		e.Changes = diffAuditStates(e.Before, e.After)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,154 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreAudit(t *testing.T) {
+	testStoreAudit(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreAudit(t *testing.T) {
+	store := newSQLiteStore(t)
+	testStoreAudit(t, store)
+
+	// The table refuses changes to written entries
+	_, err := store.conn.Exec(`UPDATE audit_log SET actor = 'someone else'`)
+	assert.ErrorContains(t, err, "append-only")
+	_, err = store.conn.Exec(`DELETE FROM audit_log`)
+	assert.ErrorContains(t, err, "append-only")
+}
+
+func TestMemoryStoreSystemAudit(t *testing.T) {
+	testStoreSystemAudit(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreSystemAudit(t *testing.T) {
+	testStoreSystemAudit(t, newSQLiteStore(t))
+}
+
+func testStoreAudit(t *testing.T, store Store) {
+	acme := store.ForTenant("acme")
+	start := time.Now().Add(-time.Second)
+
+	before := AuditState(Task{Title: "Charge", Action: "http://billing/charge"})
+	after := AuditState(Task{Title: "Charge", Action: "http://billing/v2/charge"})
+	assert.NoError(t, acme.InsertAuditEntry(AuditEntry{Actor: "ops", Action: "PUT /workflow/task", ResourceType: "task", ResourceID: "1", Outcome: AuditOutcomeSucceeded, RequestID: "req-1", Before: before, After: after}))
+	assert.NoError(t, acme.InsertAuditEntry(AuditEntry{Actor: "ci", Action: "POST /workflow/node", Outcome: AuditOutcomeDenied}))
+	assert.NoError(t, store.InsertAuditEntry(AuditEntry{TenantID: "globex", Actor: "ops", Action: "POST /workflow", Outcome: AuditOutcomeSucceeded}))
+
+	entries, err := acme.ListAuditEntries(AuditFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "ci", entries[0].Actor, "newest first")
+		assert.Equal(t, "acme", entries[1].TenantID)
+		assert.Equal(t, "req-1", entries[1].RequestID)
+		assert.Equal(t, []AuditChange{{Field: "action", Before: json.RawMessage(`"http://billing/charge"`), After: json.RawMessage(`"http://billing/v2/charge"`)}}, entries[1].Changes)
+		assert.Empty(t, entries[0].Changes)
+	}
+
+	entries, _ = store.ListAuditEntries(AuditFilter{Actor: "ops"})
+	assert.Len(t, entries, 2)
+	entries, _ = store.ListAuditEntries(AuditFilter{ResourceType: "task", ResourceID: "1", Outcome: AuditOutcomeSucceeded})
+	assert.Len(t, entries, 1)
+	entries, _ = store.ListAuditEntries(AuditFilter{RequestID: "req-2"})
+	assert.Empty(t, entries)
+	entries, _ = store.ListAuditEntries(AuditFilter{Since: timeRef(start), Until: timeRef(time.Now().Add(time.Second))})
+	assert.Len(t, entries, 3)
+	entries, _ = store.ListAuditEntries(AuditFilter{Until: timeRef(start)})
+	assert.Empty(t, entries)
+	entries, _ = store.ListAuditEntries(AuditFilter{Limit: 1, Offset: 1})
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "ci", entries[0].Actor)
+	}
+}
+
+func TestDiffAuditStates(t *testing.T) {
+	created := diffAuditStates(nil, json.RawMessage(`{"title":"Charge","retries":3}`))
+	assert.Equal(t, []AuditChange{
+		{Field: "retries", After: json.RawMessage(`3`)},
+		{Field: "title", After: json.RawMessage(`"Charge"`)},
+	}, created)
+
+	// Formatting and key order are not changes
+	assert.Empty(t, diffAuditStates(json.RawMessage(`{"a": {"x": 1, "y": 2}}`), json.RawMessage(`{"a":{"y":2,"x":1}}`)))
+	assert.Nil(t, diffAuditStates(nil, nil))
+
+	assert.Equal(t, []AuditChange{{Before: json.RawMessage(`"on"`), After: json.RawMessage(`"off"`)}},
+		diffAuditStates(json.RawMessage(`"on"`), json.RawMessage(`"off"`)))
+}
+
+// testStoreSystemAudit runs an execution fired by a schedule through a timer and a timed out
+// wait, and checks every step the engine took on its own is audited for the tenant
+func testStoreSystemAudit(t *testing.T, store Store) {
+	ctx := context.Background()
+	acme := store.ForTenant("acme")
+
+	startID, _ := acme.CreateNode("Start", NodeTypeStart, "", nil)
+	delayID, _ := acme.CreateNode("Delay", NodeTypeTimer, "", json.RawMessage(`{"duration":"1h"}`))
+	approvalID, _ := acme.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved","timeout":"1h"}`))
+	endID, _ := acme.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, acme.AddRelationship(startID, delayID, ""))
+	assert.NoError(t, acme.AddRelationship(delayID, approvalID, ""))
+	assert.NoError(t, acme.AddRelationship(approvalID, endID, ConditionTimeout))
+	workflowID, _ := acme.CreateWorkflow("approval", "", startID, false)
+
+	nextRunAt := time.Now().Add(-time.Second).Truncate(time.Second)
+	schedule := Schedule{WorkflowID: workflowID, IntervalSeconds: 3600, MisfirePolicy: MisfireCatchUp, Enabled: true, NextRunAt: &nextRunAt}
+	if err := schedule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acme.CreateSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewScheduler(store, time.Minute)
+	assert.NoError(t, scheduler.Tick(ctx, time.Now()))
+	scheduler.running.Wait()
+
+	poller := NewPoller(store, time.Second)
+	for _, at := range []time.Time{time.Now().Add(2 * time.Hour), time.Now().Add(4 * time.Hour)} {
+		assert.NoError(t, poller.Poll(ctx, at))
+		poller.running.Wait()
+	}
+
+	published, err := NewOutboxRelay(store, &recordingPublisher{}, 0).relay(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.NotZero(t, published)
+
+	executions, _ := acme.ListWorkflowExecutions(ExecutionFilter{WorkflowID: workflowID})
+	if !assert.Len(t, executions, 1) {
+		return
+	}
+	assert.Equal(t, "completed", executions[0].Status)
+
+	statusChange := func(before, after string) AuditChange {
+		return AuditChange{Field: "status", Before: AuditState(before), After: AuditState(after)}
+	}
+	entries, err := acme.ListAuditEntries(AuditFilter{Actor: AuditActorSystem})
+	assert.NoError(t, err)
+	actions := map[string]int{}
+	for _, entry := range entries {
+		actions[entry.Action]++
+		assert.Equal(t, AuditOutcomeSucceeded, entry.Outcome)
+
+		switch entry.Action {
+		case "schedule fire", "execution resume":
+			assert.Equal(t, executions[0].ID.String(), entry.ResourceID)
+		case "timer fire":
+			assert.Contains(t, entry.Changes, statusChange(TimerStatusPending, TimerStatusFired))
+		case "wait timeout":
+			assert.Contains(t, entry.Changes, statusChange(WaitStatusWaiting, WaitStatusTimedOut))
+		}
+	}
+	assert.Equal(t, map[string]int{"schedule fire": 1, "timer fire": 1, "wait timeout": 1, "execution resume": 2, "event publish": published}, actions)
+
+	// Nothing is audited for other tenants
+	entries, _ = store.ForTenant("globex").ListAuditEntries(AuditFilter{Actor: AuditActorSystem})
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,474 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+)
+
+// Scopes of a target policy
+const (
+	PolicyScopeHost = "host" // Target is the host (and port) of the task action URL
+	PolicyScopeTask = "task" // Target is the ID of a task
+)
+
+// Policies applied to calls made while a circuit breaker is open
+const (
+	OpenPolicyFailFast = "fail_fast" // The call fails immediately
+	OpenPolicyWait     = "wait"      // The call waits, up to max_wait_seconds, for the breaker to half-open
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned for task calls rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// policyRefreshInterval is how long target policies are cached before being reloaded
+const policyRefreshInterval = 30 * time.Second
+
+type TargetPolicy struct {
+	ID               uuid.UUID  `db:"id" json:"id"`                               // Unique identifier for the policy
+	Scope            string     `db:"scope" json:"scope"`                         // host or task
+	Target           string     `db:"target" json:"target"`                       // Host (and port) or task ID the policy applies to
+	FailureThreshold int        `db:"failure_threshold" json:"failure_threshold"` // Consecutive failures opening the breaker, 0 disables the breaker
+	OpenSeconds      int        `db:"open_seconds" json:"open_seconds"`           // How long the breaker stays open before letting a probe through
+	OpenPolicy       string     `db:"open_policy" json:"open_policy"`             // fail_fast or wait
+	MaxWaitSeconds   int        `db:"max_wait_seconds" json:"max_wait_seconds"`   // Longest a call waits on an open breaker or a full concurrency limit
+	MaxConcurrency   int        `db:"max_concurrency" json:"max_concurrency"`     // Most calls in flight at once, 0 for unlimited
+	RatePerSecond    float64    `db:"rate_per_second" json:"rate_per_second"`     // Sustained calls per second, 0 for unlimited
+	Burst            int        `db:"burst" json:"burst"`                         // Calls allowed above the rate in a burst
+	CreatedAt        *time.Time `db:"created_at" json:"created_at"`               // Creation timestamp
+	UpdatedAt        *time.Time `db:"updated_at" json:"updated_at"`               // Update timestamp
+}
+
+// BreakerStatus is the state of the breaker and limits of one target, as seen by this instance
+type BreakerStatus struct {
+	Scope               string     `json:"scope"`                // host or task
+	Target              string     `json:"target"`               // Host or task ID
+	State               string     `json:"state"`                // closed, open or half_open
+	ConsecutiveFailures int        `json:"consecutive_failures"` // Failures since the last success
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`  // When the breaker last opened
+	RetryAt             *time.Time `json:"retry_at,omitempty"`   // When an open breaker lets a probe through
+	InFlight            int        `json:"in_flight"`            // Calls currently holding a concurrency slot
+	MaxConcurrency      int        `json:"max_concurrency"`      // Concurrency limit, 0 for unlimited
+	RatePerSecond       float64    `json:"rate_per_second"`      // Rate limit, 0 for unlimited
+}
+
+// Validate checks the policy and fills in defaults
+func (p *TargetPolicy) Validate() error {
+	if p.Scope != PolicyScopeHost && p.Scope != PolicyScopeTask {
+		return invalidf("scope must be %s or %s", PolicyScopeHost, PolicyScopeTask)
+	}
+	if p.Target == "" {
+		return invalidf("target is required")
+	}
+	if p.Scope == PolicyScopeTask {
+		if _, err := uuid.Parse(p.Target); err != nil {
+			return invalidf("target of a task policy must be a task ID")
+		}
+	}
+	if p.OpenPolicy == "" {
+		p.OpenPolicy = OpenPolicyFailFast
+	}
+	if p.OpenPolicy != OpenPolicyFailFast && p.OpenPolicy != OpenPolicyWait {
+		return invalidf("open_policy must be %s or %s", OpenPolicyFailFast, OpenPolicyWait)
+	}
+	if p.FailureThreshold < 0 || p.OpenSeconds < 0 || p.MaxWaitSeconds < 0 || p.MaxConcurrency < 0 || p.RatePerSecond < 0 || p.Burst < 0 {
+		return invalidf("thresholds and limits must not be negative")
+	}
+	if p.FailureThreshold > 0 && p.OpenSeconds == 0 {
+		p.OpenSeconds = 30
+	}
+	if p.RatePerSecond > 0 && p.Burst == 0 {
+		p.Burst = 1
+	}
+	return nil
+}
+
+// targetGuard holds the breakers and limiters of every task target seen by this instance
+type targetGuard struct {
+	mu         sync.Mutex
+	policies   map[string]TargetPolicy
+	loadedAt   time.Time
+	breakers   map[string]*breaker
+	semaphores map[string]chan struct{}
+	limiters   map[string]*rate.Limiter
+	now        func() time.Time
+}
+
+type breaker struct {
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool
+}
+
+// Targets guards the task calls of this instance
+var Targets = newTargetGuard()
+
+func newTargetGuard() *targetGuard {
+	return &targetGuard{
+		policies:   make(map[string]TargetPolicy),
+		breakers:   make(map[string]*breaker),
+		semaphores: make(map[string]chan struct{}),
+		limiters:   make(map[string]*rate.Limiter),
+		now:        time.Now,
+	}
+}
+
+func policyKey(scope, target string) string {
+	return scope + ":" + target
+}
+
+// taskTargets returns the policy keys applying to a task, host first
+func taskTargets(task Task) []string {
+	keys := []string{}
+	if u, err := url.Parse(task.Action); err == nil && u.Host != "" {
+		keys = append(keys, policyKey(PolicyScopeHost, u.Host))
+	}
+	return append(keys, policyKey(PolicyScopeTask, task.ID.String()))
+}
+
+// refresh reloads the policies once the cache expired. A failed reload keeps the previous policies.
+func (g *targetGuard) refresh(store Store) error {
+	g.mu.Lock()
+	fresh := g.now().Sub(g.loadedAt) < policyRefreshInterval
+	g.mu.Unlock()
+	if fresh || store == nil {
+		return nil
+	}
+
+	policies, err := store.ListTargetPolicies()
+	if err != nil {
+		// Retry on the next refresh interval instead of on every call
+		g.mu.Lock()
+		g.loadedAt = g.now()
+		g.mu.Unlock()
+		return err
+	}
+	g.setPolicies(policies)
+	return nil
+}
+
+func (g *targetGuard) setPolicies(policies []TargetPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.policies = make(map[string]TargetPolicy, len(policies))
+	for _, policy := range policies {
+		key := policyKey(policy.Scope, policy.Target)
+		g.policies[key] = policy
+
+		// Limiters and semaphores follow policy changes; breaker state is kept
+		if policy.RatePerSecond > 0 {
+			limiter, ok := g.limiters[key]
+			if !ok {
+				g.limiters[key] = rate.NewLimiter(rate.Limit(policy.RatePerSecond), policy.Burst)
+			} else {
+				limiter.SetLimit(rate.Limit(policy.RatePerSecond))
+				limiter.SetBurst(policy.Burst)
+			}
+		} else {
+			delete(g.limiters, key)
+		}
+		if semaphore, ok := g.semaphores[key]; policy.MaxConcurrency > 0 && (!ok || cap(semaphore) != policy.MaxConcurrency) {
+			g.semaphores[key] = make(chan struct{}, policy.MaxConcurrency)
+		} else if policy.MaxConcurrency == 0 {
+			delete(g.semaphores, key)
+		}
+	}
+	g.loadedAt = g.now()
+}
+
+// acquire lets a task call through the breakers and limits of its targets. The returned
+// release func must be called with the outcome of the call.
+func (g *targetGuard) acquire(ctx context.Context, store Store, task Task) (func(failed bool), error) {
+	if err := g.refresh(store); err != nil {
+		Logger(ctx).Warn("failed to load task target policies", "error", err)
+	}
+
+	var releases []func()
+	var entered []string
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	keys := taskTargets(task)
+	for _, key := range keys {
+		g.mu.Lock()
+		policy, ok := g.policies[key]
+		g.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		maxWait := time.Duration(policy.MaxWaitSeconds) * time.Second
+		waitCtx, cancel := context.WithTimeout(ctx, maxWait)
+		if maxWait == 0 {
+			waitCtx, cancel = context.WithCancel(ctx)
+		}
+
+		err := g.enter(waitCtx, key, policy)
+		if err == nil {
+			entered = append(entered, key)
+
+			var release func()
+			release, err = g.takeSlot(waitCtx, key, policy)
+			if err == nil {
+				releases = append(releases, release)
+			}
+		}
+		cancel()
+
+		if err != nil {
+			// The call never happens, so probes taken on the way are handed back
+			releaseAll()
+			g.abandon(entered)
+			return nil, err
+		}
+	}
+
+	return func(failed bool) {
+		releaseAll()
+		for _, key := range keys {
+			g.record(key, failed)
+		}
+	}, nil
+}
+
+// enter checks the breaker of a target, waiting for it to half-open when the policy says so
+func (g *targetGuard) enter(ctx context.Context, key string, policy TargetPolicy) error {
+	if policy.FailureThreshold == 0 {
+		return nil
+	}
+
+	for {
+		g.mu.Lock()
+		b := g.breaker(key)
+		retryAt := b.openedAt.Add(time.Duration(policy.OpenSeconds) * time.Second)
+
+		switch {
+		case b.state == BreakerClosed:
+			g.mu.Unlock()
+			return nil
+		case b.state == BreakerOpen && !g.now().Before(retryAt):
+			b.state = BreakerHalfOpen
+			fallthrough
+		case b.state == BreakerHalfOpen && !b.probing:
+			// A single probe call decides whether the breaker closes again
+			b.probing = true
+			g.mu.Unlock()
+			return nil
+		}
+		g.mu.Unlock()
+
+		if policy.OpenPolicy != OpenPolicyWait {
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, key)
+		}
+
+		wait := retryAt.Sub(g.now())
+		if wait < 100*time.Millisecond {
+			wait = 100 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w for %s", ErrCircuitOpen, key)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// takeSlot waits for the rate limit and a concurrency slot of a target
+func (g *targetGuard) takeSlot(ctx context.Context, key string, policy TargetPolicy) (func(), error) {
+	g.mu.Lock()
+	limiter := g.limiters[key]
+	semaphore := g.semaphores[key]
+	g.mu.Unlock()
+
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limit of %s exceeded: %w", key, err)
+		}
+	}
+
+	if semaphore == nil {
+		return func() {}, nil
+	}
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("concurrency limit of %s reached", key)
+	}
+}
+
+// record feeds the outcome of a call into the breaker of a target
+func (g *targetGuard) record(key string, failed bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	policy, ok := g.policies[key]
+	if !ok || policy.FailureThreshold == 0 {
+		return
+	}
+
+	b := g.breaker(key)
+	wasProbe := b.state == BreakerHalfOpen && b.probing
+	b.probing = false
+
+	if !failed {
+		b.state = BreakerClosed
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.consecutiveFailures++
+	if wasProbe || b.consecutiveFailures >= policy.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = g.now()
+	}
+}
+
+// abandon hands back the half-open probes of targets whose call did not happen
+func (g *targetGuard) abandon(keys []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		if b, ok := g.breakers[key]; ok {
+			b.probing = false
+		}
+	}
+}
+
+// breaker returns the breaker of a target; g.mu must be held
+func (g *targetGuard) breaker(key string) *breaker {
+	b, ok := g.breakers[key]
+	if !ok {
+		b = &breaker{state: BreakerClosed}
+		g.breakers[key] = b
+	}
+	return b
+}
+
+// Reload makes the next task call reload the policies, so changes apply on this instance right away
+func (g *targetGuard) Reload() {
+	g.mu.Lock()
+	g.loadedAt = time.Time{}
+	g.mu.Unlock()
+}
+
+// Status returns the breaker and limit state of every target with a policy
+func (g *targetGuard) Status(store Store) ([]BreakerStatus, error) {
+	if err := g.refresh(store); err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	statuses := []BreakerStatus{}
+	for key, policy := range g.policies {
+		status := BreakerStatus{
+			Scope: policy.Scope, Target: policy.Target, State: BreakerClosed,
+			MaxConcurrency: policy.MaxConcurrency, RatePerSecond: policy.RatePerSecond,
+		}
+		if b, ok := g.breakers[key]; ok && policy.FailureThreshold > 0 {
+			status.State = b.state
+			status.ConsecutiveFailures = b.consecutiveFailures
+			if b.state != BreakerClosed {
+				openedAt := b.openedAt
+				retryAt := openedAt.Add(time.Duration(policy.OpenSeconds) * time.Second)
+				status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+			}
+		}
+		if semaphore, ok := g.semaphores[key]; ok {
+			status.InFlight = len(semaphore)
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return policyKey(statuses[i].Scope, statuses[i].Target) < policyKey(statuses[j].Scope, statuses[j].Target)
+	})
+	return statuses, nil
+}
+
+// isTargetFailure tells whether a task call outcome counts against the breaker of its target.
+// Client errors other than 429 are the caller's fault and do not.
+func isTargetFailure(httpCode int, err error) bool {
+	if err == nil {
+		return false
+	}
+	return httpCode >= http.StatusInternalServerError || httpCode == http.StatusTooManyRequests
+}
+
+const targetPolicyColumns = `
+	id, scope, target, failure_threshold, open_seconds, open_policy, max_wait_seconds, max_concurrency, rate_per_second, burst,
+	created_at, updated_at`
+
+func (s *PostgresStore) ListTargetPolicies() ([]TargetPolicy, error) {
+	rows, err := s.db.Query(`SELECT ` + targetPolicyColumns + ` FROM task_target_policies ORDER BY scope, target`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching task target policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []TargetPolicy{}
+	for rows.Next() {
+		var p TargetPolicy
+		err := rows.Scan(
+			&p.ID, &p.Scope, &p.Target, &p.FailureThreshold, &p.OpenSeconds, &p.OpenPolicy, &p.MaxWaitSeconds, &p.MaxConcurrency,
+			&p.RatePerSecond, &p.Burst, &p.CreatedAt, &p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning task target policy row: %w", err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// SaveTargetPolicy creates the policy of a target or replaces the existing one
+func (s *PostgresStore) SaveTargetPolicy(p TargetPolicy) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO task_target_policies (scope, target, failure_threshold, open_seconds, open_policy, max_wait_seconds, max_concurrency, rate_per_second, burst, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		ON CONFLICT (scope, target) DO UPDATE
+		SET failure_threshold = EXCLUDED.failure_threshold, open_seconds = EXCLUDED.open_seconds, open_policy = EXCLUDED.open_policy,
+			max_wait_seconds = EXCLUDED.max_wait_seconds, max_concurrency = EXCLUDED.max_concurrency,
+			rate_per_second = EXCLUDED.rate_per_second, burst = EXCLUDED.burst, updated_at = NOW()
+		RETURNING id
+	`, p.Scope, p.Target, p.FailureThreshold, p.OpenSeconds, p.OpenPolicy, p.MaxWaitSeconds, p.MaxConcurrency, p.RatePerSecond, p.Burst).Scan(&id)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) DeleteTargetPolicy(policyID uuid.UUID) error {
+	result, err := s.db.Exec(`DELETE FROM task_target_policies WHERE id = $1`, policyID)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, "target policy", policyID)
+}
@@ -0,0 +1,115 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGuard(now *time.Time, policies ...TargetPolicy) *targetGuard {
+	guard := newTargetGuard()
+	guard.now = func() time.Time { return *now }
+	guard.setPolicies(policies)
+	return guard
+}
+
+func TestTargetGuardBreaker(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	task := Task{ID: uuid.New(), Action: "http://payments.local:8080/charge"}
+	guard := newTestGuard(&now, TargetPolicy{Scope: PolicyScopeHost, Target: "payments.local:8080", FailureThreshold: 2, OpenSeconds: 30, OpenPolicy: OpenPolicyFailFast})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		release, err := guard.acquire(ctx, nil, task)
+		assert.NoError(t, err)
+		release(true)
+	}
+
+	_, err := guard.acquire(ctx, nil, task)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	statuses, err := guard.Status(nil)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, BreakerOpen, statuses[0].State)
+	assert.Equal(t, 2, statuses[0].ConsecutiveFailures)
+	assert.Equal(t, now.Add(30*time.Second), *statuses[0].RetryAt)
+
+	// Once half-open, a single probe goes through and a failed probe opens the breaker again
+	now = now.Add(31 * time.Second)
+	release, err := guard.acquire(ctx, nil, task)
+	assert.NoError(t, err)
+	_, err = guard.acquire(ctx, nil, task)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	release(true)
+
+	_, err = guard.acquire(ctx, nil, task)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+	// A successful probe closes it
+	now = now.Add(31 * time.Second)
+	release, err = guard.acquire(ctx, nil, task)
+	assert.NoError(t, err)
+	release(false)
+
+	release, err = guard.acquire(ctx, nil, task)
+	assert.NoError(t, err)
+	release(false)
+
+	statuses, _ = guard.Status(nil)
+	assert.Equal(t, BreakerClosed, statuses[0].State)
+	assert.Equal(t, 0, statuses[0].ConsecutiveFailures)
+}
+
+func TestTargetGuardConcurrencyLimit(t *testing.T) {
+	now := time.Now()
+	task := Task{ID: uuid.New(), Action: "http://reports.local/build"}
+	guard := newTestGuard(&now, TargetPolicy{Scope: PolicyScopeTask, Target: task.ID.String(), MaxConcurrency: 1})
+
+	release, err := guard.acquire(context.Background(), nil, task)
+	assert.NoError(t, err)
+
+	statuses, _ := guard.Status(nil)
+	assert.Equal(t, 1, statuses[0].InFlight)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = guard.acquire(ctx, nil, task)
+	assert.Error(t, err)
+
+	release(false)
+	release, err = guard.acquire(context.Background(), nil, task)
+	assert.NoError(t, err)
+	release(false)
+
+	// Tasks without a policy are not limited
+	release, err = guard.acquire(context.Background(), nil, Task{ID: uuid.New(), Action: "http://other.local/"})
+	assert.NoError(t, err)
+	release(true)
+}
+
+func TestTargetPolicyValidate(t *testing.T) {
+	policy := TargetPolicy{Scope: PolicyScopeHost, Target: "api.local", FailureThreshold: 5, RatePerSecond: 2}
+	assert.NoError(t, policy.Validate())
+	assert.Equal(t, OpenPolicyFailFast, policy.OpenPolicy)
+	assert.Equal(t, 30, policy.OpenSeconds)
+	assert.Equal(t, 1, policy.Burst)
+
+	assert.Error(t, (&TargetPolicy{Scope: "region", Target: "eu"}).Validate())
+	assert.Error(t, (&TargetPolicy{Scope: PolicyScopeTask, Target: "not-a-task"}).Validate())
+	assert.Error(t, (&TargetPolicy{Scope: PolicyScopeHost, Target: "api.local", OpenPolicy: "retry"}).Validate())
+	assert.Error(t, (&TargetPolicy{Scope: PolicyScopeHost, Target: "api.local", MaxConcurrency: -1}).Validate())
+}
+
+func TestIsTargetFailure(t *testing.T) {
+	failed := errors.New("failed")
+	assert.True(t, isTargetFailure(http.StatusBadGateway, failed))
+	assert.True(t, isTargetFailure(http.StatusTooManyRequests, failed))
+	assert.False(t, isTargetFailure(http.StatusBadRequest, failed))
+	assert.False(t, isTargetFailure(http.StatusOK, nil))
+}
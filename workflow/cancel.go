@@ -0,0 +1,53 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var ErrExecutionFinished = newError("execution has already finished", ErrInvalidTransition)
+
+// CancelWorkflowExecution cancels an execution that is pending or waiting, together with
+// every wait, timer and child execution it is parked on. Cancelling a child execution its
+// parent is waiting for fails the parent.
+func CancelWorkflowExecution(ctx context.Context, store Store, executionID uuid.UUID) error {
+	ctx, logger := withLogFields(ctx, "execution_id", executionID)
+
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return err
+	}
+	switch execution.Status {
+	case "executing":
+		return ErrExecutionRunning
+	case "pending", WaitStatusWaiting:
+	default:
+		return ErrExecutionFinished
+	}
+
+	// The execution must not have moved on since it was read
+	err = store.WithTx(func(tx Store) error {
+		if err := transitionExecution(tx, &execution, "cancelled", nil, nil); err != nil {
+			return err
+		}
+		return CancelParkedNodes(tx, executionID)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("workflow execution cancelled")
+
+	if execution.ParentExecutionID != nil {
+		parent, err := store.GetWorkflowExecutionByID(*execution.ParentExecutionID)
+		if err != nil {
+			return err
+		}
+		if parent.Status == WaitStatusWaiting {
+			return finishChildExecution(ctx, store, executionID, fmt.Errorf("execution was cancelled"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreCancel(t *testing.T) {
+	testStoreCancel(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreCancel(t *testing.T) {
+	testStoreCancel(t, newSQLiteStore(t))
+}
+
+// testStoreCancel cancels parked, pending and finished executions, and a child execution
+// its parent is waiting for
+func testStoreCancel(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	approvalID, _ := store.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved"}`))
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, approvalID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, endID, ""))
+	workflowID, _ := store.CreateWorkflow("approval", "", startID, false)
+
+	// A parked execution is cancelled with its wait
+	parkedID, _, _ := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, parkedID))
+	assert.NoError(t, CancelWorkflowExecution(ctx, store, parkedID))
+	execution, _ := store.GetWorkflowExecutionByID(parkedID)
+	assert.Equal(t, "cancelled", execution.Status)
+	assert.ErrorIs(t, SignalWorkflowExecution(ctx, store, parkedID, "approved", nil), ErrNoPendingWait)
+
+	// Finished executions stay as they are
+	assert.ErrorIs(t, CancelWorkflowExecution(ctx, store, parkedID), ErrExecutionFinished)
+	assert.ErrorIs(t, CancelWorkflowExecution(ctx, store, parkedID), ErrInvalidTransition)
+
+	pendingID, _, _ := store.CreateWorkflowExecution(workflowID, "order-2", nil, "")
+	assert.NoError(t, CancelWorkflowExecution(ctx, store, pendingID))
+	execution, _ = store.GetWorkflowExecutionByID(pendingID)
+	assert.Equal(t, "cancelled", execution.Status)
+
+	// Cancelled executions are never run, nor resumed
+	assert.ErrorIs(t, ExecuteWorkflowByExecutionID(ctx, store, pendingID), ErrInvalidTransition)
+	assert.ErrorIs(t, ResumeWorkflowExecution(ctx, store, parkedID, approvalID, false), ErrInvalidTransition)
+	execution, _ = store.GetWorkflowExecutionByID(pendingID)
+	assert.Equal(t, "cancelled", execution.Status)
+	logs, _ := store.GetExecutionLogs(pendingID)
+	assert.Empty(t, logs)
+
+	assert.ErrorIs(t, CancelWorkflowExecution(ctx, store, uuid.New()), ErrNotFound)
+
+	// Cancelling the child a parent waits for fails the parent
+	parentStartID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	childNodeID, _ := store.CreateNode("Approve", NodeTypeSubWorkflow, "", json.RawMessage(`{"workflow_id":"`+workflowID.String()+`"}`))
+	assert.NoError(t, store.AddRelationship(parentStartID, childNodeID, ""))
+	parentWorkflowID, _ := store.CreateWorkflow("order", "", parentStartID, false)
+
+	parentID, _, _ := store.CreateWorkflowExecution(parentWorkflowID, "order-3", nil, "")
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, parentID))
+	children, err := store.ListChildExecutions(parentID)
+	assert.NoError(t, err)
+	if !assert.Len(t, children, 1) {
+		return
+	}
+	assert.Equal(t, WaitStatusWaiting, children[0].Status)
+
+	assert.NoError(t, CancelWorkflowExecution(ctx, store, children[0].ID))
+	parent, _ := store.GetWorkflowExecutionByID(parentID)
+	assert.Equal(t, "error", parent.Status)
+}
@@ -0,0 +1,69 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+)
+
+// ValidateBranchCondition checks the condition of a relationship: none, timeout for the branch
+// a timed out Wait node follows, or a text/template over the execution data, which Decision
+// nodes evaluate to pick their branch. Other conditions are refused rather than ignored.
+func ValidateBranchCondition(condition string) error {
+	if condition == "" || condition == ConditionTimeout {
+		return nil
+	}
+	if !isTemplateCondition(condition) {
+		return invalidf("invalid condition %q: conditions are %s or a template such as {{gt .amount 100.0}}", condition, ConditionTimeout)
+	}
+	if _, err := template.New("condition").Option("missingkey=error").Parse(condition); err != nil {
+		return invalid(fmt.Errorf("invalid condition: %w", err))
+	}
+	return nil
+}
+
+func isTemplateCondition(condition string) bool {
+	return strings.Contains(condition, "{{")
+}
+
+// selectDecisionBranch returns the one descendant a Decision node continues with: the branch
+// whose condition renders "true" over the execution data, else the first branch without a
+// condition, as for any other node. No match, or more than one, fails the node rather than
+// following several branches.
+func selectDecisionBranch(nodeID uuid.UUID, children []NodeClosure, data json.RawMessage) (uuid.UUID, error) {
+	var values map[string]interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return uuid.Nil, fmt.Errorf("execution data is not a JSON object: %w", err)
+		}
+	}
+
+	var matched, defaults []uuid.UUID
+	for _, child := range children {
+		switch {
+		case child.Condition == "":
+			defaults = append(defaults, child.Descendant)
+		case isTemplateCondition(child.Condition):
+			rendered, err := renderTemplate("condition", child.Condition, values)
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("decision node %s: %w", nodeID, err)
+			}
+			if strings.TrimSpace(rendered) == "true" {
+				matched = append(matched, child.Descendant)
+			}
+		}
+	}
+
+	switch {
+	case len(matched) == 1:
+		return matched[0], nil
+	case len(matched) > 1:
+		return uuid.Nil, fmt.Errorf("decision node %s matched %d branches, conditions must exclude each other", nodeID, len(matched))
+	case len(defaults) > 0:
+		return defaults[0], nil
+	}
+	return uuid.Nil, fmt.Errorf("decision node %s matched no branch and has none without a condition", nodeID)
+}
@@ -0,0 +1,113 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreDecision(t *testing.T) {
+	testStoreDecision(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreDecision(t *testing.T) {
+	testStoreDecision(t, newSQLiteStore(t))
+}
+
+// testStoreDecision checks that a Decision node runs the one branch whose condition holds
+func testStoreDecision(t *testing.T, store Store) {
+	var mu sync.Mutex
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	decisionID, _ := store.CreateNode("Amount", NodeTypeDecision, "", nil)
+	reviewID, _ := store.CreateNode("Review", NodeTypeTask, "", nil)
+	approveID, _ := store.CreateNode("Approve", NodeTypeTask, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, decisionID, ""))
+	assert.NoError(t, store.AddRelationship(decisionID, reviewID, "{{gt .amount 100.0}}"))
+	assert.NoError(t, store.AddRelationship(decisionID, approveID, "{{le .amount 100.0}}"))
+
+	reviewTask, _ := store.CreateTask("Request review", "http", http.MethodPost, server.URL+"/review", `{}`, 0)
+	approveTask, _ := store.CreateTask("Approve", "http", http.MethodPost, server.URL+"/approve", `{}`, 0)
+	assert.NoError(t, store.AddTaskToNode(reviewID, reviewTask, 1))
+	assert.NoError(t, store.AddTaskToNode(approveID, approveTask, 1))
+
+	workflowID, _ := store.CreateWorkflow("refund", "", startID, false)
+	run := func(data string) (WorkflowExecution, []string, error) {
+		calls = nil
+		executionID, _, err := store.CreateWorkflowExecution(workflowID, "", json.RawMessage(data), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ExecuteWorkflowByExecutionID(context.Background(), store, executionID)
+		execution, _ := store.GetWorkflowExecutionByID(executionID)
+		return execution, calls, err
+	}
+
+	execution, called, err := run(`{"amount":250}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", execution.Status)
+	assert.Equal(t, []string{"/review"}, called)
+
+	execution, called, err = run(`{"amount":40}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", execution.Status)
+	assert.Equal(t, []string{"/approve"}, called)
+
+	// A condition that cannot be evaluated fails the execution instead of following every branch
+	execution, called, err = run(`{}`)
+	assert.ErrorContains(t, err, "decision node")
+	assert.Equal(t, "error", execution.Status)
+	assert.Empty(t, called)
+}
+
+func TestSelectDecisionBranch(t *testing.T) {
+	nodeID := uuid.New()
+	high, low, other := uuid.New(), uuid.New(), uuid.New()
+	children := []NodeClosure{
+		{Descendant: high, Condition: `{{gt .amount 100.0}}`},
+		{Descendant: low, Condition: `{{le .amount 100.0}}`},
+		{Descendant: other, Condition: ConditionTimeout},
+	}
+
+	next, err := selectDecisionBranch(nodeID, children, json.RawMessage(`{"amount":250}`))
+	assert.NoError(t, err)
+	assert.Equal(t, high, next)
+
+	// Branches without a condition are taken when no condition holds
+	fallback := uuid.New()
+	next, err = selectDecisionBranch(nodeID, []NodeClosure{children[0], {Descendant: fallback}}, json.RawMessage(`{"amount":5}`))
+	assert.NoError(t, err)
+	assert.Equal(t, fallback, next)
+
+	_, err = selectDecisionBranch(nodeID, children[:1], json.RawMessage(`{"amount":5}`))
+	assert.ErrorContains(t, err, "matched no branch")
+
+	overlapping := []NodeClosure{children[0], {Descendant: low, Condition: `{{gt .amount 10.0}}`}}
+	_, err = selectDecisionBranch(nodeID, overlapping, json.RawMessage(`{"amount":250}`))
+	assert.ErrorContains(t, err, "matched 2 branches")
+
+	// Like any other node, a Decision node without conditions continues with its first child
+	next, err = selectDecisionBranch(nodeID, []NodeClosure{{Descendant: fallback}, {Descendant: other}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fallback, next)
+
+	assert.NoError(t, ValidateBranchCondition(""))
+	assert.NoError(t, ValidateBranchCondition(ConditionTimeout))
+	assert.ErrorIs(t, ValidateBranchCondition("amount > 10"), ErrValidation, "conditions that are not templates would never hold")
+	assert.NoError(t, ValidateBranchCondition(`{{eq .status "approved"}}`))
+	assert.ErrorIs(t, ValidateBranchCondition(`{{eq .status`), ErrValidation)
+}
@@ -0,0 +1,234 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrEgressDenied is returned when the egress policy refuses the target of a task call
+var ErrEgressDenied = errors.New("egress denied")
+
+// DefaultDeniedCIDRs are never called unless an allowed range lifts them: loopback, link-local
+// (including cloud metadata endpoints), unspecified, broadcast and multicast addresses
+var DefaultDeniedCIDRs = mustParsePrefixes(
+	"127.0.0.0/8", "::1/128",
+	"169.254.0.0/16", "fe80::/10", "fd00:ec2::254/128",
+	"0.0.0.0/8", "::/128",
+	"255.255.255.255/32", "224.0.0.0/4", "ff00::/8",
+)
+
+// PrivateCIDRs are the internal network ranges: RFC 1918, carrier-grade NAT and unique local IPv6
+var PrivateCIDRs = mustParsePrefixes("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+// EgressPolicy decides which URLs tasks may call. Empty lists place no restriction, so the zero
+// policy allows everything.
+type EgressPolicy struct {
+	AllowedSchemes []string       // Schemes task URLs may use, e.g. https
+	AllowedPorts   []int          // Ports task URLs may use, including the default port of the scheme
+	AllowedHosts   []string       // Host names tasks may call; *.example.com matches subdomains
+	DeniedHosts    []string       // Host names tasks may not call, same patterns as AllowedHosts
+	AllowedCIDRs   []netip.Prefix // Addresses callable even when inside a denied range
+	DeniedCIDRs    []netip.Prefix // Addresses tasks may not connect to
+}
+
+// Egress is the policy every task call is subject to. It is set once on startup.
+var Egress EgressPolicy
+
+// CheckURL checks the scheme, host and port of a task URL, and its address when the host is an
+// IP or localhost. Addresses of other host names are checked when connecting.
+func (p EgressPolicy) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: invalid url: %v", ErrEgressDenied, err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%w: url %q has no host", ErrEgressDenied, rawURL)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if len(p.AllowedSchemes) > 0 && !containsFold(p.AllowedSchemes, scheme) {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrEgressDenied, u.Scheme)
+	}
+
+	port, err := urlPort(u)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEgressDenied, err)
+	}
+	if err := p.checkPort(port); err != nil {
+		return err
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if err := p.checkHost(host); err != nil {
+		return err
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		host = "127.0.0.1"
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(ip)
+	}
+	return nil
+}
+
+func (p EgressPolicy) checkPort(port int) error {
+	if len(p.AllowedPorts) == 0 {
+		return nil
+	}
+	for _, allowed := range p.AllowedPorts {
+		if port == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: port %d is not allowed", ErrEgressDenied, port)
+}
+
+func (p EgressPolicy) checkHost(host string) error {
+	for _, pattern := range p.DeniedHosts {
+		if matchHost(pattern, host) {
+			return fmt.Errorf("%w: host %s is denied", ErrEgressDenied, host)
+		}
+	}
+	if len(p.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowedHosts {
+		if matchHost(pattern, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %s is not allowed", ErrEgressDenied, host)
+}
+
+// checkAddr refuses addresses in a denied range, unless an allowed range contains them
+func (p EgressPolicy) checkAddr(ip netip.Addr) error {
+	ip = ip.Unmap().WithZone("")
+	for _, prefix := range p.AllowedCIDRs {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	for _, prefix := range p.DeniedCIDRs {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: address %s is in denied range %s", ErrEgressDenied, ip, prefix)
+		}
+	}
+	return nil
+}
+
+// checkDial checks the address a task call is about to connect to, after DNS resolution
+func (p EgressPolicy) checkDial(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: cannot check address %s: %v", ErrEgressDenied, address, err)
+	}
+	return p.checkAddr(addrPort.Addr())
+}
+
+// taskClient makes the HTTP calls of tasks. Every connection and every redirect is checked
+// against Egress, so host names resolving to, or redirecting to, denied addresses are refused.
+// Proxies configured in the environment are bypassed, tasks always connect to their host.
+var taskClient = &http.Client{
+	Transport: egressTransport(),
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return Egress.CheckURL(req.URL.String())
+	},
+}
+
+func egressTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Control runs for every address the host name resolved to, right before connecting
+		Control: func(_, address string, _ syscall.RawConn) error {
+			return Egress.checkDial(address)
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy only the address of the proxy would be checked, never the target's
+	transport.Proxy = nil
+	return transport
+}
+
+// matchHost matches a host against a name or a *.domain pattern, which matches subdomains only
+func matchHost(pattern, host string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// urlPort returns the port of a URL, the default port of its scheme when it has none
+func urlPort(u *url.URL) (int, error) {
+	if value := u.Port(); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return 0, fmt.Errorf("invalid port %q", value)
+		}
+		return port, nil
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return 80, nil
+	case "https":
+		return 443, nil
+	}
+	return 0, fmt.Errorf("scheme %q has no default port", u.Scheme)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixes parses CIDR ranges; single addresses are taken as ranges of one address
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", value, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func mustParsePrefixes(values ...string) []netip.Prefix {
+	prefixes, err := ParsePrefixes(values)
+	if err != nil {
+		panic(err)
+	}
+	return prefixes
+}
@@ -0,0 +1,133 @@
+package workflow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressPolicyCheckURL(t *testing.T) {
+	policy := EgressPolicy{
+		AllowedSchemes: []string{"http", "https"},
+		AllowedPorts:   []int{80, 443, 8080},
+		DeniedHosts:    []string{"admin.example.com", "*.internal"},
+		AllowedCIDRs:   mustParsePrefixes("10.1.2.0/24"),
+		DeniedCIDRs:    append(DefaultDeniedCIDRs, PrivateCIDRs...),
+	}
+
+	for rawURL, allowed := range map[string]bool{
+		"https://billing.example.com/charge":      true,
+		"http://billing.example.com:8080/charge":  true,
+		"http://10.1.2.3/charge":                  true,
+		"ftp://billing.example.com/file":          false,
+		"http://billing.example.com:22/":          false,
+		"http://ADMIN.example.com/":               false,
+		"http://vault.internal/":                  false,
+		"http://169.254.169.254/latest/meta-data": false,
+		"http://[fd00:ec2::254]/latest/meta-data": false,
+		"http://127.0.0.1:8080/":                  false,
+		"http://[::ffff:127.0.0.1]/":              false,
+		"http://localhost/":                       false,
+		"http://api.localhost./":                  false,
+		"http://10.0.0.1/":                        false,
+		"http://[fe80::1%25eth0]/":                false,
+		"/relative/path":                          false,
+		"http://billing.example.com:99999/":       false,
+	} {
+		err := policy.CheckURL(rawURL)
+		if allowed {
+			assert.NoError(t, err, rawURL)
+		} else {
+			assert.ErrorIs(t, err, ErrEgressDenied, rawURL)
+		}
+	}
+
+	// Allowed hosts restrict calls to those hosts
+	policy = EgressPolicy{AllowedHosts: []string{"*.example.com"}}
+	assert.NoError(t, policy.CheckURL("https://billing.example.com/"))
+	assert.ErrorIs(t, policy.CheckURL("https://example.com/"), ErrEgressDenied)
+	assert.ErrorIs(t, policy.CheckURL("https://billing.example.com.evil.io/"), ErrEgressDenied)
+
+	assert.NoError(t, EgressPolicy{}.CheckURL("http://127.0.0.1/"), "the zero policy allows everything")
+}
+
+func TestEgressPolicyCheckDial(t *testing.T) {
+	policy := EgressPolicy{DeniedCIDRs: DefaultDeniedCIDRs}
+
+	assert.ErrorIs(t, policy.checkDial("127.0.0.1:443"), ErrEgressDenied)
+	assert.ErrorIs(t, policy.checkDial("[::1]:80"), ErrEgressDenied)
+	assert.ErrorIs(t, policy.checkDial("[fe80::1%eth0]:80"), ErrEgressDenied)
+	assert.NoError(t, policy.checkDial("93.184.216.34:443"))
+}
+
+func TestPerformTaskEgress(t *testing.T) {
+	redirectTo := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if redirectTo != "" {
+			http.Redirect(w, r, redirectTo, http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	defer func(policy EgressPolicy) { Egress = policy }(Egress)
+	task := Task{Title: "Charge", HttpMethod: http.MethodPost, Action: server.URL}
+
+	// Loopback is denied before the request is made, and when connecting
+	Egress = EgressPolicy{DeniedCIDRs: DefaultDeniedCIDRs}
+	_, code, err := performTask(context.Background(), task, "key-1")
+	assert.ErrorIs(t, err, ErrEgressDenied)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	_, err = taskClient.Get(server.URL)
+	assert.ErrorIs(t, err, ErrEgressDenied)
+
+	// Allowed ranges lift denied ones
+	Egress.AllowedCIDRs = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	_, code, err = performTask(context.Background(), task, "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Redirects are held to the same policy
+	u, _ := url.Parse(server.URL)
+	Egress.AllowedPorts = []int{portOf(t, u)}
+	redirectTo = "http://127.0.0.1:1/admin"
+	_, code, err = performTask(context.Background(), task, "key-1")
+	assert.ErrorIs(t, err, ErrEgressDenied)
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestPerformTaskEgress_IgnoresProxy(t *testing.T) {
+	proxied := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+
+	defer func(policy EgressPolicy) { Egress = policy }(Egress)
+	Egress = EgressPolicy{DeniedCIDRs: DefaultDeniedCIDRs}
+
+	// Tasks connect to the target themselves, so the policy sees the addresses it resolves to
+	assert.Nil(t, taskClient.Transport.(*http.Transport).Proxy)
+	task := Task{Title: "Charge", HttpMethod: http.MethodPost, Action: "http://billing.invalid/charge"}
+	_, _, err := performTask(context.Background(), task, "key-1")
+	assert.Error(t, err)
+	assert.Equal(t, 0, proxied)
+}
+
+func portOf(t *testing.T, u *url.URL) int {
+	port, err := urlPort(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
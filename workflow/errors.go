@@ -0,0 +1,72 @@
+package workflow
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of errors. Errors returned by the engine and the stores wrap the kind they are of, so
+// callers tell them apart with errors.Is.
+var (
+	ErrNotFound          = errors.New("not found")                // A resource does not exist, or belongs to another tenant
+	ErrConflict          = errors.New("conflict")                 // A resource was changed concurrently, or already exists
+	ErrValidation        = errors.New("validation failed")        // A definition or value is not accepted
+	ErrCycle             = errors.New("cycle")                    // A relationship would make a node its own descendant
+	ErrInvalidTransition = errors.New("invalid state transition") // An execution or timer is not in a state allowing the action
+)
+
+// kindError is an error of one or more kinds, with a message of its own
+type kindError struct {
+	message string
+	kinds   []error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() []error {
+	return e.kinds
+}
+
+func newError(message string, kinds ...error) error {
+	return &kindError{message: message, kinds: kinds}
+}
+
+// invalidf returns an ErrValidation error with the formatted message
+func invalidf(format string, args ...interface{}) error {
+	return newError(fmt.Sprintf(format, args...), ErrValidation)
+}
+
+// invalid marks err as an ErrValidation error, keeping its message and what it wraps
+func invalid(err error) error {
+	if err == nil || errors.Is(err, ErrValidation) {
+		return err
+	}
+	return newError(err.Error(), ErrValidation, err)
+}
+
+// notFound tells the resource with the given ID does not exist. The error matches both
+// ErrNotFound and sql.ErrNoRows, which stores have always returned for missing rows.
+func notFound(resource string, id interface{}) error {
+	return newError(fmt.Sprintf("%s %v not found", resource, id), ErrNotFound, sql.ErrNoRows)
+}
+
+// noRows turns sql.ErrNoRows into the notFound error of the resource, leaving other errors as is
+func noRows(err error, resource string, id interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(resource, id)
+	}
+	return err
+}
+
+// cycleError tells a relationship from ancestor to descendant would close a cycle
+func cycleError(ancestor, descendant uuid.UUID) error {
+	if ancestor == descendant {
+		return newError(fmt.Sprintf("node %s cannot descend from itself", ancestor), ErrCycle)
+	}
+	return newError(fmt.Sprintf("node %s already descends from node %s, the relationship would create a cycle", ancestor, descendant), ErrCycle)
+}
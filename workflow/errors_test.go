@@ -0,0 +1,77 @@
+package workflow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreErrors(t *testing.T) {
+	testStoreErrors(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreErrors(t *testing.T) {
+	testStoreErrors(t, newSQLiteStore(t))
+}
+
+func TestErrorKinds(t *testing.T) {
+	id := uuid.New()
+	err := fmt.Errorf("failed to start: %w", notFound("workflow", id))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.False(t, errors.Is(err, ErrValidation))
+	assert.Equal(t, "failed to start: workflow "+id.String()+" not found", err.Error())
+
+	assert.True(t, errors.Is(ErrWorkflowNotFound, ErrNotFound))
+	assert.True(t, errors.Is(ErrExecutionRunning, ErrInvalidTransition))
+	assert.True(t, errors.Is(ErrExecutionConflict, ErrConflict))
+	assert.True(t, errors.Is(ErrTimerNotPending, ErrInvalidTransition))
+
+	cause := errors.New("unexpected token")
+	err = invalid(cause)
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, "unexpected token", err.Error())
+	assert.Nil(t, invalid(nil))
+
+	assert.Equal(t, sql.ErrConnDone, noRows(sql.ErrConnDone, "node", id))
+}
+
+// testStoreErrors checks the kinds of errors a store returns for missing rows and cycles
+func testStoreErrors(t *testing.T, store Store) {
+	missing := uuid.New()
+
+	_, err := store.GetNode(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	_, err = store.GetTask(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = store.GetWorkflow(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = store.GetWorkflowExecutionByID(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = store.GetStartingNode(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(ExecuteWorkflow(context.Background(), store, missing), ErrNotFound))
+	_, err = store.GetSchedule(missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(store.DeleteSchedule(missing), ErrNotFound))
+	assert.True(t, errors.Is(store.RevokeAPIKey(missing), ErrNotFound))
+
+	a, _ := store.CreateNode("A", NodeTypeStart, "", nil)
+	b, _ := store.CreateNode("B", NodeTypeTask, "", nil)
+	c, _ := store.CreateNode("C", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(a, b, ""))
+	assert.NoError(t, store.AddRelationship(b, c, ""))
+	assert.True(t, errors.Is(store.ForTenant("acme").AddRelationship(b, missing, ""), ErrNotFound))
+
+	err = store.AddRelationship(c, a, "")
+	assert.True(t, errors.Is(err, ErrCycle))
+	assert.EqualError(t, err, fmt.Sprintf("node %s already descends from node %s, the relationship would create a cycle", c, a))
+	assert.True(t, errors.Is(store.AddRelationship(a, a, ""), ErrCycle))
+}
@@ -2,32 +2,59 @@ package workflow
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func ExecuteWorkflow(db *sql.DB, workflowID uuid.UUID) error {
+func ExecuteWorkflow(ctx context.Context, store Store, workflowID uuid.UUID) (err error) {
+	ctx, span := tracer.Start(ctx, "workflow.execution", trace.WithAttributes(
+		attribute.String("workflow.id", workflowID.String()),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ctx, logger := withLogFields(withTraceFields(ctx), "workflow_id", workflowID)
+
 	// Fetch starting node
-	startNode, err := GetStartingNode(db, workflowID)
+	startNode, err := store.GetStartingNode(workflowID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch starting node: %v", err)
+		return fmt.Errorf("failed to fetch starting node: %w", err)
 	}
 
 	// Update workflow status
-	err = UpdateWorkflowStatus(db, workflowID, "executing")
-	if err != nil {
-		return fmt.Errorf("failed to update workflow status: %v", err)
-	}
+	startedAt := time.Now()
+	err = store.WithTx(func(tx Store) error {
+		if err := tx.UpdateWorkflowStatus(workflowID, "executing"); err != nil {
+			return fmt.Errorf("failed to update workflow status: %w", err)
+		}
 
-	// Log workflow execution
-	err = LogWorkflowExecution(db, workflowID, startNode.ID, nil, "executing", "Starting workflow execution", nil, nil, err)
+		// Log workflow execution
+		err := tx.InsertWorkflowLog(WorkflowLog{
+			WorkflowID: workflowID, NodeID: &startNode.ID, Status: "executing", Message: "Starting workflow execution",
+			ActionType: ActionTypeExecution, ExecutedAt: startedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to log workflow execution: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to log workflow execution: %v", err)
+		return err
 	}
 
+	logger.Info("workflow execution started", "node_id", startNode.ID)
+
 	// Initialize a queue for BFS traversal
 	nodeQueue := []uuid.UUID{startNode.ID}
 	visited := make(map[uuid.UUID]bool)
@@ -43,150 +70,277 @@ func ExecuteWorkflow(db *sql.DB, workflowID uuid.UUID) error {
 
 		visited[currentNodeID] = true
 
-		err = ExecuteNode(db, currentNodeID, workflowID, &nodeQueue, visited)
+		err = ExecuteNode(ctx, store, currentNodeID, workflowID, uuid.Nil, &nodeQueue, visited)
 		if err != nil {
-			UpdateWorkflowStatus(db, workflowID, "error")
-			return fmt.Errorf("workflow execution failed: %v", err)
+			logger.Error("workflow execution failed", "error", err)
+			finishWorkflow(store, workflowID, startNode.ID, startedAt, err)
+			return fmt.Errorf("workflow execution failed: %w", err)
 		}
 	}
 
 	// Update workflow status
-	err = UpdateWorkflowStatus(db, workflowID, "completed")
+	err = finishWorkflow(store, workflowID, startNode.ID, startedAt, nil)
 	if err != nil {
-		return fmt.Errorf("failed to update workflow status: %v", err)
+		return err
 	}
 
-	// Log workflow execution
-	err = LogWorkflowExecution(db, workflowID, startNode.ID, nil, "completed", "Starting workflow execution", nil, nil, err)
-	if err != nil {
-		return fmt.Errorf("failed to log workflow execution: %v", err)
-	}
+	logger.Info("workflow execution completed")
 
 	return nil
 }
 
-func ExecuteNode(db *sql.DB, nodeID uuid.UUID, workflowID uuid.UUID, queue *[]uuid.UUID, visited map[uuid.UUID]bool) error {
-	fmt.Printf("Executing node %s\n", nodeID)
+// finishWorkflow sets the workflow status to completed, or error when execErr is set,
+// together with the closing log row
+func finishWorkflow(store Store, workflowID, startNodeID uuid.UUID, startedAt time.Time, execErr error) error {
+	status := "completed"
+	if execErr != nil {
+		status = "error"
+	}
 
-	// Retrieve nodeTask associated with the node
-	nodeTasks, err := GetNodeTasks(db, nodeID)
+	return store.WithTx(func(tx Store) error {
+		if err := tx.UpdateWorkflowStatus(workflowID, status); err != nil {
+			return fmt.Errorf("failed to update workflow status: %w", err)
+		}
+		if err := logExecutionFinished(tx, workflowID, uuid.Nil, startNodeID, startedAt, execErr); err != nil {
+			return fmt.Errorf("failed to log workflow execution: %w", err)
+		}
+		return nil
+	})
+}
+
+func ExecuteNode(ctx context.Context, store Store, nodeID uuid.UUID, workflowID uuid.UUID, executionID uuid.UUID, queue *[]uuid.UUID, visited map[uuid.UUID]bool) (err error) {
+	ctx, span := tracer.Start(ctx, "workflow.node", trace.WithAttributes(
+		attribute.String("workflow.id", workflowID.String()),
+		attribute.String("node.id", nodeID.String()),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ctx, logger := withLogFields(ctx, "node_id", nodeID)
+	logger.Info("executing node")
+	startedAt := time.Now()
 
+	node, err := store.GetNode(nodeID)
 	if err != nil {
-		return fmt.Errorf("error retrieving tasks for node %s: %v", nodeID, err)
+		return fmt.Errorf("error retrieving node %s: %w", nodeID, err)
 	}
 
-	fmt.Printf("Node %s has %d tasks\n", nodeID, len(nodeTasks))
-	fmt.Printf("Executing tasks in node %s\n", nodeID)
-	fmt.Printf("Tasks: %v\n", nodeTasks)
+	// Wait, Timer and SubWorkflow nodes park the execution until a signal, timer or child execution resumes it
+	switch node.Type {
+	case NodeTypeWait:
+		return parkNode(ctx, store, node, workflowID, executionID)
+	case NodeTypeTimer:
+		return parkTimer(ctx, store, node, workflowID, executionID)
+	case NodeTypeSubWorkflow:
+		return parkSubWorkflow(ctx, store, node, workflowID, executionID)
+	}
 
-	// Execute each task in sequence
-	for _, nodeTask := range nodeTasks {
-		err := ExecuteTask(db, workflowID, nodeID, nodeTask.Task, nodeTask.RetryCount)
+	// A Join node runs once every branch into it completed. Branches arriving earlier leave
+	// it for the last one to run.
+	if node.Type == NodeTypeJoin {
+		ready, err := joinReady(store, workflowID, executionID, nodeID, visited)
 		if err != nil {
-			return fmt.Errorf("task %s execution failed in node %s: %v", nodeTask.ID, nodeID, err)
+			return err
+		}
+		if !ready {
+			logger.Debug("join waiting for its other branches")
+			delete(visited, nodeID)
+			return nil
 		}
+	}
 
-		// Log workflow execution
-		err = LogWorkflowExecution(db, workflowID, nodeID, &nodeTask.TaskID, "completed", fmt.Sprintf("Task %s execution completed", nodeTask.TaskID), nil, nil, err)
+	// Retrieve nodeTask associated with the node
+	nodeTasks, err := store.GetNodeTasks(nodeID)
+
+	if err != nil {
+		return fmt.Errorf("error retrieving tasks for node %s: %w", nodeID, err)
+	}
+
+	logger.Debug("executing node tasks", "task_count", len(nodeTasks))
+
+	// Execute each task in sequence
+	for _, nodeTask := range nodeTasks {
+		err := ExecuteTask(ctx, store, workflowID, executionID, nodeID, nodeTask.Task, nodeTask.RetryCount)
 		if err != nil {
-			return fmt.Errorf("failed to log task execution: %v", err)
+			logNodeFinished(store, workflowID, executionID, nodeID, startedAt, err)
+			return fmt.Errorf("task %s execution failed in node %s: %w", nodeTask.ID, nodeID, err)
 		}
 	}
 
-	fmt.Printf("All tasks in node %s completed successfully\n", nodeID)
+	logger.Info("node completed")
 
 	// Log workflow node execution
-	err = LogWorkflowExecution(db, workflowID, nodeID, nil, "completed", "Node execution completed", nil, nil, err)
+	err = logNodeFinished(store, workflowID, executionID, nodeID, startedAt, nil)
 	if err != nil {
-		return fmt.Errorf("failed to log workflow node execution: %v", err)
+		return fmt.Errorf("failed to log workflow node execution: %w", err)
 	}
 
 	// Get the next node(s) to execute
-	descendants, err := GetDescendants(db, nodeID)
+	children, err := store.GetChildren(nodeID)
 	if err != nil {
-		return fmt.Errorf("error retrieving next nodes for node %s: %v", nodeID, err)
+		return fmt.Errorf("error retrieving next nodes for node %s: %w", nodeID, err)
 	}
 
 	// Evaluate condition for next node execution
-	nextNodeID, err := evaluateCondition(db, nodeID, descendants)
+	nextNodeIDs, err := evaluateCondition(store, node, executionID, children)
 	if err != nil {
-		return fmt.Errorf("error evaluating condition for next node execution: %v", err)
+		return fmt.Errorf("error evaluating condition for next node execution: %w", err)
 	}
 
-	// Add the next node to the queue if not visited
-	if nextNodeID != uuid.Nil && !visited[nextNodeID] {
-		*queue = append(*queue, nextNodeID)
+	// Add the next nodes to the queue if not visited
+	for _, nextNodeID := range nextNodeIDs {
+		if !visited[nextNodeID] {
+			*queue = append(*queue, nextNodeID)
+		}
 	}
 
 	return nil
 }
 
-func ExecuteTask(db *sql.DB, workflowID uuid.UUID, nodeID uuid.UUID, task Task, retryCount int) error {
-	fmt.Printf("Executing task %s\n", task.Title)
+// joinReady tells whether every branch into the Join node nodeID completed. Runs without an
+// execution never park, so the nodes they visited completed.
+func joinReady(store Store, workflowID, executionID, nodeID uuid.UUID, visited map[uuid.UUID]bool) (bool, error) {
+	if executionID != uuid.Nil {
+		return store.AllParentsCompleted(executionID, nodeID)
+	}
+
+	edges, err := store.GetWorkflowEdges(workflowID)
+	if err != nil {
+		return false, fmt.Errorf("error retrieving edges of workflow %s: %w", workflowID, err)
+	}
+	for _, edge := range edges {
+		if edge.Descendant == nodeID && !visited[edge.Ancestor] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func ExecuteTask(ctx context.Context, store Store, workflowID uuid.UUID, executionID uuid.UUID, nodeID uuid.UUID, task Task, retryCount int) error {
+	_, logger := withLogFields(ctx, "task_id", task.ID)
+	logger.Info("executing task", "task_title", task.Title)
+
+	// Every retry sends the same key, so downstream services can de-duplicate the call
+	idempotencyKey, err := taskIdempotencyKey(store, executionID, nodeID, task.ID)
+	if err != nil {
+		return err
+	}
+	logger = logger.With("idempotency_key", idempotencyKey)
 
 	// Retry logic
 	retryLimit := task.MaxRetries
 	for retry := 0; retry <= retryLimit; retry++ {
+		attemptLogger := logger.With("attempt", retry+1)
+		attemptCtx, span := tracer.Start(ctx, "workflow.task.attempt", trace.WithAttributes(
+			attribute.String("task.id", task.ID.String()),
+			attribute.String("task.title", task.Title),
+			attribute.Int("task.attempt", retry+1),
+			attribute.String("task.idempotency_key", idempotencyKey),
+		))
+
 		// Simulate task execution
-		response, httpCode, err := performTask(task)
+		attemptStartedAt := time.Now()
+		var response string
+		var httpCode int
+		release, err := Targets.acquire(attemptCtx, store, task)
+		if err == nil {
+			response, httpCode, err = performTask(attemptCtx, task, idempotencyKey)
+			release(isTargetFailure(httpCode, err))
+		} else {
+			httpCode = http.StatusServiceUnavailable
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", httpCode))
+		endSpan(span, err)
+
+		attemptLog := WorkflowLog{
+			WorkflowID:  workflowID,
+			ExecutionID: nullableID(executionID),
+			NodeID:      &nodeID,
+			TaskID:      &task.ID,
+			ActionType:  ActionTypeTask,
+			Attempt:     intPtr(retry + 1),
+			ExecutedAt:  attemptStartedAt,
+			CompletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			HttpCode:    &httpCode,
+			Response:    &response,
+		}
 
 		// Handle success
 		if err == nil {
-			fmt.Printf("Task %s executed successfully on attempt %d\n", task.ID, retry+1)
+			attemptLogger.Info("task executed successfully", "http_code", httpCode)
 
 			// Update task status and response
-			err := UpdateTaskStatus(db, task.ID, "completed", retryCount)
-			if err != nil {
-				return fmt.Errorf("failed to update task %s status: %v", task.ID, err)
-			}
-
-			err = LogWorkflowExecution(db, workflowID, nodeID, &task.ID, "completed", fmt.Sprintf("Task \"%s\" performed successfully: [%d] %s", task.Title, httpCode, response), &httpCode, &response, err)
-			if err != nil {
-				return fmt.Errorf("failed to log workflow node execution: %v", err)
-			}
-
-			return nil
+			attemptLog.Status = "completed"
+			attemptLog.Message = fmt.Sprintf("Task \"%s\" performed successfully: [%d] %s", task.Title, httpCode, response)
+			return recordTaskAttempt(store, task.ID, retryCount, attemptLog)
 		}
 
 		// Handle retry
-		fmt.Printf("Task %s failed on attempt %d: %v\n", task.ID, retry+1, err)
+		attemptLogger.Warn("task attempt failed", "http_code", httpCode, "error", err)
 
-		// Update task retry count and error
-		err = UpdateTaskStatus(db, task.ID, "failed", retryCount)
-		if err != nil {
-			return fmt.Errorf("failed to update task %s status on failure: %v", task.ID, err)
-		}
+		attemptLog.Status = "failed"
+		attemptLog.Message = fmt.Sprintf("Task \"%s\" (retry no: %d) performed failed: [%d] %s", task.Title, retry, httpCode, response)
+		attemptLog.Error = stringPtr(err.Error())
 
-		err = LogWorkflowExecution(db, workflowID, nodeID, &task.ID, "failed", fmt.Sprintf("Task \"%s\" (retry no: %d) performed failed: [%d] %s", task.Title, retry, httpCode, response), &httpCode, &response, err)
+		// Update task retry count and error
+		err = recordTaskAttempt(store, task.ID, retryCount, attemptLog)
 		if err != nil {
-			return fmt.Errorf("failed to log workflow node execution: %v", err)
+			return err
 		}
 
 		if retry < retryLimit {
-			fmt.Printf("Retrying task %s (%d/%d)\n", task.ID, retry+2, retryLimit+1)
+			attemptLogger.Info("retrying task", "max_attempts", retryLimit+1)
 		} else {
 			break
 		}
 	}
 
 	// Task failed after retries
-	fmt.Printf("Task %s failed after %d attempts\n", task.ID, retryLimit+1)
+	logger.Error("task failed after maximum retries", "attempts", retryLimit+1)
 	return fmt.Errorf("task %s execution failed after maximum retries", task.ID)
 }
 
-func performTask(task Task) (string, int, error) {
+// recordTaskAttempt sets the task status to the status of the attempt together with its log row
+func recordTaskAttempt(store Store, taskID uuid.UUID, retryCount int, attemptLog WorkflowLog) error {
+	return store.WithTx(func(tx Store) error {
+		err := tx.UpdateTaskStatus(taskID, attemptLog.Status, retryCount)
+		if err != nil {
+			return fmt.Errorf("failed to update task %s status: %w", taskID, err)
+		}
+
+		err = tx.InsertWorkflowLog(attemptLog)
+		if err != nil {
+			return fmt.Errorf("failed to log workflow node execution: %w", err)
+		}
+		return nil
+	})
+}
+
+func performTask(ctx context.Context, task Task, idempotencyKey string) (string, int, error) {
+	// The policy may have changed since the task was created
+	if err := Egress.CheckURL(task.Action); err != nil {
+		return "", http.StatusForbidden, err
+	}
+
 	// Create the HTTP request
-	req, err := http.NewRequest(task.HttpMethod, task.Action, bytes.NewBuffer([]byte(task.Params)))
+	req, err := http.NewRequestWithContext(ctx, task.HttpMethod, task.Action, bytes.NewBuffer([]byte(task.Params)))
 	if err != nil {
 		return "", http.StatusInternalServerError, err
 	}
 
 	// Set headers if needed
 	req.Header.Set("Content-Type", "application/json")
+	if TaskIdempotencyHeader != "" {
+		req.Header.Set(TaskIdempotencyHeader, idempotencyKey)
+	}
+
+	// Propagate the trace context (traceparent) to the downstream service
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	// Perform the HTTP request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := taskClient.Do(req)
+	if errors.Is(err, ErrEgressDenied) {
+		return "", http.StatusForbidden, err
+	}
 	if err != nil {
 		return "", http.StatusInternalServerError, err
 	}
@@ -208,11 +362,13 @@ func performTask(task Task) (string, int, error) {
 	return "", resp.StatusCode, fmt.Errorf("Task %s failed with status code: %d", task.Title, resp.StatusCode)
 }
 
-func evaluateCondition(db *sql.DB, currentNodeID uuid.UUID, descendants []Node) (uuid.UUID, error) {
+func evaluateCondition(store Store, node Node, executionID uuid.UUID, children []NodeClosure) ([]uuid.UUID, error) {
+	currentNodeID := node.ID
+
 	// Check the status of the current node tasks
-	nodeTasks, err := GetNodeTasks(db, currentNodeID)
+	nodeTasks, err := store.GetNodeTasks(currentNodeID)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("error retrieving tasks for node %s: %v", currentNodeID, err)
+		return nil, fmt.Errorf("error retrieving tasks for node %s: %w", currentNodeID, err)
 	}
 
 	// If all tasks are completed successfully, execute the next node
@@ -224,43 +380,254 @@ func evaluateCondition(db *sql.DB, currentNodeID uuid.UUID, descendants []Node)
 		}
 	}
 
-	// Return the next node if all tasks are completed for the current node
-	if allTasksCompleted && len(descendants) > 0 {
-		return descendants[0].ID, nil
+	if !allTasksCompleted {
+		return nil, nil
+	}
+
+	// Decision nodes continue with the one branch whose condition holds for the execution data
+	if node.Type == NodeTypeDecision && len(children) > 0 {
+		var data json.RawMessage
+		if executionID != uuid.Nil {
+			execution, err := store.GetWorkflowExecutionByID(executionID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch workflow execution: %w", err)
+			}
+			data = execution.Data
+		}
+		next, err := selectDecisionBranch(currentNodeID, children, data)
+		if err != nil {
+			return nil, err
+		}
+		return []uuid.UUID{next}, nil
 	}
 
-	// If no condition matches, return nil
-	return uuid.Nil, nil
+	// Fork nodes continue with all their branches, other nodes with one
+	return selectBranch(node.Type, children, false), nil
 }
 
-func ExecuteWorkflowByExecutionID(db *sql.DB, executionID uuid.UUID) error {
+func ExecuteWorkflowByExecutionID(ctx context.Context, store Store, executionID uuid.UUID) (err error) {
+	ctx, span := tracer.Start(ctx, "workflow.execution", trace.WithAttributes(
+		attribute.String("execution.id", executionID.String()),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ctx, _ = withLogFields(withTraceFields(ctx), "execution_id", executionID)
+
 	// Fetch the workflow execution details
-	execution, err := GetWorkflowExecutionByID(db, executionID)
+	execution, err := store.GetWorkflowExecutionByID(executionID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch workflow execution: %v", err)
+		return fmt.Errorf("failed to fetch workflow execution: %w", err)
 	}
 
-	// Update workflow execution status
-	err = UpdateWorkflowExecutionStatus(db, executionID, "executing")
+	span.SetAttributes(
+		attribute.String("workflow.id", execution.WorkflowID.String()),
+		attribute.String("execution.reference_number", execution.ReferenceNumber),
+	)
+	ctx, _ = withLogFields(ctx, "workflow_id", execution.WorkflowID)
+
+	// Fetch starting node
+	startNode, err := store.GetStartingNode(execution.WorkflowID)
 	if err != nil {
-		return fmt.Errorf("failed to update workflow execution status: %v", err)
+		return fmt.Errorf("failed to fetch starting node: %w", err)
 	}
 
-	// Fetch starting node
-	startNode, err := GetStartingNode(db, execution.WorkflowID)
+	return runExecution(ctx, store, execution, "pending", startNode.ID, []uuid.UUID{startNode.ID}, "Starting workflow execution", nil)
+}
+
+// resumeConflictTimeout bounds how long a resume waits for another worker to settle the execution
+const resumeConflictTimeout = 30 * time.Second
+
+// executionLease is how long a worker holds an executing execution without renewing it.
+// Workers renew it while they run, so a lapsed lease means the worker is gone.
+const executionLease = time.Minute
+
+// leaseExpired tells whether the worker holding an executing execution stopped renewing its lease
+func leaseExpired(execution WorkflowExecution, now time.Time) bool {
+	return execution.Status == "executing" && execution.LeaseExpiresAt != nil && execution.LeaseExpiresAt.Before(now)
+}
+
+// keepExecutionLease renews the lease of a running execution until the returned func is called
+func keepExecutionLease(ctx context.Context, store Store, executionID uuid.UUID) func() {
+	done := make(chan struct{})
+	var stopped sync.WaitGroup
+	stopped.Add(1)
+	go func() {
+		defer stopped.Done()
+		ticker := time.NewTicker(executionLease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := store.RenewExecutionLease(executionID, time.Now().Add(executionLease)); err != nil {
+					Logger(ctx).Error("failed to renew execution lease", "error", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		stopped.Wait()
+	}
+}
+
+// resumeClaim marks the wait or timer an execution resumes from, in the transaction moving
+// the execution to executing. It returns false when the execution already continued from it.
+type resumeClaim func(tx Store) (bool, error)
+
+// errAlreadyResumed is returned by runExecution when another resume took its claim
+var errAlreadyResumed = errors.New("parked node already resumed")
+
+// ResumeWorkflowExecution continues a parked execution with the nodes following the wait
+// node nodeID. A timed out wait follows the timeout branch and fails the execution when
+// there is none. Resumes of the same execution run one after another.
+func ResumeWorkflowExecution(ctx context.Context, store Store, executionID uuid.UUID, nodeID uuid.UUID, timedOut bool) error {
+	return resumeExecution(ctx, store, executionID, nodeID, timedOut, nil)
+}
+
+// resumeExecution is ResumeWorkflowExecution taking claim together with the execution. A
+// resume whose claim was taken already returns nil without running anything.
+func resumeExecution(ctx context.Context, store Store, executionID uuid.UUID, nodeID uuid.UUID, timedOut bool, claim resumeClaim) (err error) {
+	ctx, span := tracer.Start(ctx, "workflow.execution.resume", trace.WithAttributes(
+		attribute.String("execution.id", executionID.String()),
+		attribute.String("node.id", nodeID.String()),
+		attribute.Bool("wait.timed_out", timedOut),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ctx, _ = withLogFields(withTraceFields(ctx), "execution_id", executionID)
+
+	node, err := store.GetNode(nodeID)
+	if err != nil {
+		return fmt.Errorf("error retrieving node %s: %w", nodeID, err)
+	}
+	children, err := store.GetChildren(nodeID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch starting node: %v", err)
+		return fmt.Errorf("error retrieving next nodes for node %s: %w", nodeID, err)
 	}
+	next := selectBranch(node.Type, children, timedOut)
+
+	// While another worker advances the execution, wait for it to settle or for its lease to
+	// lapse. A resume given up on stays unclaimed, so the poller retries it.
+	backoff := 50 * time.Millisecond
+	deadline := time.Now().Add(resumeConflictTimeout)
+	for {
+		execution, err := store.GetWorkflowExecutionByID(executionID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch workflow execution: %w", err)
+		}
 
-	// Log workflow execution
-	err = LogWorkflowExecution(db, execution.WorkflowID, startNode.ID, nil, "executing", "Starting workflow execution", nil, nil, err)
+		// Cancelled and finished executions stay as they are
+		if execution.Status != "executing" && execution.Status != WaitStatusWaiting {
+			return executionNotRunnable(execution, WaitStatusWaiting)
+		}
+
+		if execution.Status != "executing" || leaseExpired(execution, time.Now()) {
+			span.SetAttributes(attribute.String("workflow.id", execution.WorkflowID.String()))
+			ctx, _ := withLogFields(ctx, "workflow_id", execution.WorkflowID)
+
+			if timedOut && len(next) == 0 {
+				err = fmt.Errorf("wait node %s timed out without a %s branch", nodeID, ConditionTimeout)
+				if failErr := failExecution(ctx, store, execution, nodeID, time.Now(), err); !errors.Is(failErr, ErrExecutionConflict) {
+					return err
+				}
+			} else {
+				err = runExecution(ctx, store, execution, WaitStatusWaiting, nodeID, next, "Resuming workflow execution", claim)
+				if errors.Is(err, errAlreadyResumed) {
+					return nil
+				}
+				if !errors.Is(err, ErrExecutionConflict) {
+					return err
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return ErrExecutionConflict
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Second)
+	}
+}
+
+// runExecution runs the nodes of an execution breadth first starting from queue. When a
+// node parks the execution the other branches still run, then the execution is left waiting.
+// Child executions of SubWorkflow nodes start once the execution is left waiting, and a
+// finished child execution resumes or fails its parent. A claim, when given, is taken in
+// the transaction moving the execution to executing.
+func runExecution(ctx context.Context, store Store, execution WorkflowExecution, from string, fromNodeID uuid.UUID, queue []uuid.UUID, message string, claim resumeClaim) error {
+	logger := Logger(ctx)
+	executionID := execution.ID
+
+	var childExecutions []uuid.UUID
+	ctx = context.WithValue(ctx, childExecutionsKey{}, &childExecutions)
+
+	// The status is checked in the transaction moving the execution to executing, so an
+	// execution cancelled or finished since it was read never runs
+	startedAt := time.Now()
+	err := store.WithTx(func(tx Store) error {
+		current, err := tx.GetWorkflowExecutionByID(executionID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch workflow execution: %w", err)
+		}
+		switch current.Status {
+		case "executing":
+			// Another worker advancing the execution holds it in executing, until its lease
+			// lapsed and a resume takes the execution over
+			if from != WaitStatusWaiting || !leaseExpired(current, time.Now()) {
+				return ErrExecutionConflict
+			}
+			logger.Warn("taking over execution whose lease expired", "lease_expires_at", current.LeaseExpiresAt)
+		case from:
+		default:
+			return executionNotRunnable(current, from)
+		}
+
+		if claim != nil {
+			claimed, err := claim(tx)
+			if err != nil {
+				return fmt.Errorf("failed to claim resume: %w", err)
+			}
+			if !claimed {
+				return errAlreadyResumed
+			}
+		}
+
+		execution = current
+		err = transitionExecution(tx, &execution, "executing", &WorkflowLog{
+			WorkflowID: execution.WorkflowID, ExecutionID: &executionID, NodeID: &fromNodeID, Status: "executing",
+			Message: message, ActionType: ActionTypeExecution, ExecutedAt: startedAt,
+		}, nil)
+		if err != nil {
+			return err
+		}
+		return tx.RenewExecutionLease(executionID, startedAt.Add(executionLease))
+	})
 	if err != nil {
-		return fmt.Errorf("failed to log workflow execution: %v", err)
+		return err
 	}
 
-	// Initialize a queue for BFS traversal
-	nodeQueue := []uuid.UUID{startNode.ID}
-	visited := make(map[uuid.UUID]bool)
+	stopLease := keepExecutionLease(ctx, store, executionID)
+	defer stopLease()
+
+	logger.Info("workflow execution started", "node_id", fromNodeID, "reference_number", execution.ReferenceNumber)
+
+	// Initialize a queue for BFS traversal. Nodes the execution completed before it was parked
+	// are not run again, e.g. those reached both from the parked branch and from another one.
+	nodeQueue := queue
+	visited, err := completedNodes(store, executionID)
+	if err != nil {
+		failExecution(ctx, store, execution, fromNodeID, startedAt, err)
+		return fmt.Errorf("workflow execution failed: %w", err)
+	}
+	parked := false
 
 	// Execute nodes using BFS
 	for len(nodeQueue) > 0 {
@@ -273,24 +640,125 @@ func ExecuteWorkflowByExecutionID(db *sql.DB, executionID uuid.UUID) error {
 
 		visited[currentNodeID] = true
 
-		err = ExecuteNode(db, currentNodeID, execution.WorkflowID, &nodeQueue, visited)
+		err = ExecuteNode(ctx, store, currentNodeID, execution.WorkflowID, executionID, &nodeQueue, visited)
+		if errors.Is(err, ErrExecutionParked) {
+			parked = true
+			continue
+		}
+		if err != nil {
+			failExecution(ctx, store, execution, fromNodeID, startedAt, err)
+			return fmt.Errorf("workflow execution failed: %w", err)
+		}
+	}
+
+	// Branches parked earlier keep the execution waiting
+	if !parked {
+		pending, err := store.CountParkedNodes(executionID)
+		if err != nil {
+			return fmt.Errorf("failed to count parked nodes: %w", err)
+		}
+		parked = pending > 0
+	}
+
+	if parked {
+		err = transitionExecution(store, &execution, WaitStatusWaiting, &WorkflowLog{
+			WorkflowID: execution.WorkflowID, ExecutionID: &executionID, NodeID: &fromNodeID, Status: WaitStatusWaiting,
+			Message: "Workflow execution waiting for a signal or timer", ActionType: ActionTypeExecution, ExecutedAt: startedAt,
+		}, nil)
 		if err != nil {
-			UpdateWorkflowExecutionStatus(db, executionID, "error")
-			return fmt.Errorf("workflow execution failed: %v", err)
+			return fmt.Errorf("failed to park workflow execution: %w", err)
 		}
+
+		logger.Info("workflow execution waiting")
+		return startChildExecutions(ctx, store, childExecutions)
 	}
 
 	// Update workflow execution status
-	err = UpdateWorkflowExecutionStatus(db, executionID, "completed")
+	finished := executionFinishedLog(execution.WorkflowID, executionID, fromNodeID, startedAt, nil)
+	err = transitionExecution(store, &execution, "completed", &finished, nil)
+	if err != nil {
+		return fmt.Errorf("failed to complete workflow execution: %w", err)
+	}
+
+	logger.Info("workflow execution completed")
+
+	if execution.ParentExecutionID != nil {
+		return finishChildExecution(ctx, store, executionID, nil)
+	}
+
+	return nil
+}
+
+// completedNodes returns the nodes an execution completed so far
+func completedNodes(store Store, executionID uuid.UUID) (map[uuid.UUID]bool, error) {
+	logs, err := store.GetExecutionLogs(executionID)
 	if err != nil {
-		return fmt.Errorf("failed to update workflow execution status: %v", err)
+		return nil, fmt.Errorf("failed to fetch execution logs: %w", err)
+	}
+
+	completed := make(map[uuid.UUID]bool)
+	for _, entry := range logs {
+		if entry.NodeID != nil && entry.ActionType == ActionTypeNode && entry.Status == "completed" {
+			completed[*entry.NodeID] = true
+		}
+	}
+	return completed, nil
+}
+
+// failExecution marks an execution as failed, cancels whatever it is parked on and fails
+// its parent execution, if any
+func failExecution(ctx context.Context, store Store, execution WorkflowExecution, fromNodeID uuid.UUID, startedAt time.Time, execErr error) error {
+	Logger(ctx).Error("workflow execution failed", "execution_id", execution.ID, "error", execErr)
+	err := store.WithTx(func(tx Store) error {
+		finished := executionFinishedLog(execution.WorkflowID, execution.ID, fromNodeID, startedAt, execErr)
+		if err := transitionExecution(tx, &execution, "error", &finished, execErr); err != nil {
+			return err
+		}
+		return CancelParkedNodes(tx, execution.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if execution.ParentExecutionID != nil {
+		return finishChildExecution(ctx, store, execution.ID, execErr)
 	}
+	return nil
+}
 
-	// Log workflow execution
-	err = LogWorkflowExecution(db, execution.WorkflowID, startNode.ID, nil, "completed", "Starting workflow execution", nil, nil, err)
+// executionNotRunnable is the error for running an execution that is not in the from status
+func executionNotRunnable(execution WorkflowExecution, from string) error {
+	return newError(fmt.Sprintf("execution %s is %s, only %s executions can run", execution.ID, execution.Status, from), ErrInvalidTransition)
+}
+
+// transitionExecution moves an execution to status together with its log row and outbox
+// event. The execution must still be at the version it was read at, otherwise
+// ErrExecutionConflict is returned. On success the copy gets the new status and version.
+func transitionExecution(store Store, execution *WorkflowExecution, status string, entry *WorkflowLog, execErr error) error {
+	next := *execution
+	next.Status = status
+	next.Version++
+
+	err := store.WithTx(func(tx Store) error {
+		err := tx.UpdateWorkflowExecutionStatus(execution.ID, execution.Version, status)
+		if errors.Is(err, ErrExecutionConflict) {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update workflow execution status: %w", err)
+		}
+
+		if entry != nil {
+			if err := tx.InsertWorkflowLog(*entry); err != nil {
+				return fmt.Errorf("failed to log workflow execution: %w", err)
+			}
+		}
+		return emitExecutionEvent(tx, next, status, execErr)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to log workflow execution: %v", err)
+		return err
 	}
 
+	*execution = next
 	return nil
 }
@@ -0,0 +1,268 @@
+package workflow
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Graph struct {
+	WorkflowID  uuid.UUID   `json:"workflow_id"`            // ID of the workflow
+	Name        string      `json:"name"`                   // Name of the workflow
+	ExecutionID *uuid.UUID  `json:"execution_id,omitempty"` // Execution used to colour the nodes, if any
+	Nodes       []GraphNode `json:"nodes"`                  // Nodes reachable from the starting node
+	Edges       []GraphEdge `json:"edges"`                  // Direct relationships between the nodes
+}
+
+type GraphNode struct {
+	ID      uuid.UUID   `json:"id"`                // ID of the node
+	Title   string      `json:"title"`             // Title of the node
+	Type    string      `json:"type"`              // Type of the node
+	Tasks   []GraphTask `json:"tasks"`             // Tasks of the node in execution order
+	Outcome string      `json:"outcome,omitempty"` // Outcome of the node in the given execution (completed, failed, running, waiting or not_reached)
+}
+
+type GraphTask struct {
+	ID         uuid.UUID `json:"id"`          // ID of the task
+	Title      string    `json:"title"`       // Title of the task
+	HttpMethod string    `json:"http_method"` // HTTP method used by the task
+	Action     string    `json:"action"`      // URL called by the task
+}
+
+type GraphEdge struct {
+	From      uuid.UUID `json:"from"`                // Ancestor node
+	To        uuid.UUID `json:"to"`                  // Descendant node
+	Condition string    `json:"condition,omitempty"` // Condition label of the relationship
+}
+
+const OutcomeNotReached = "not_reached"
+
+// GetWorkflowGraph loads the structure of a workflow. When executionID is not Nil every
+// node is annotated with its outcome in that execution.
+func GetWorkflowGraph(store Store, workflowID uuid.UUID, executionID uuid.UUID) (Graph, error) {
+	wf, err := store.GetWorkflow(workflowID)
+	if err != nil {
+		return Graph{}, fmt.Errorf("error retrieving workflow %s: %w", workflowID, err)
+	}
+
+	edges, err := store.GetWorkflowEdges(workflowID)
+	if err != nil {
+		return Graph{}, err
+	}
+
+	graph := Graph{WorkflowID: wf.ID, Name: wf.Name, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+
+	// Nodes are listed in breadth first order starting from the starting node
+	nodeIDs := []uuid.UUID{wf.StartingNodeID}
+	seen := map[uuid.UUID]bool{wf.StartingNodeID: true}
+	for i := 0; i < len(nodeIDs); i++ {
+		for _, edge := range edges {
+			if edge.Ancestor == nodeIDs[i] && !seen[edge.Descendant] {
+				seen[edge.Descendant] = true
+				nodeIDs = append(nodeIDs, edge.Descendant)
+			}
+		}
+	}
+
+	for _, nodeID := range nodeIDs {
+		node, err := store.GetNode(nodeID)
+		if err != nil {
+			return Graph{}, fmt.Errorf("error retrieving node %s: %w", nodeID, err)
+		}
+
+		nodeTasks, err := store.GetNodeTasks(nodeID)
+		if err != nil {
+			return Graph{}, err
+		}
+
+		graphNode := GraphNode{ID: node.ID, Title: node.Title, Type: node.Type, Tasks: []GraphTask{}}
+		for _, nodeTask := range nodeTasks {
+			graphNode.Tasks = append(graphNode.Tasks, GraphTask{
+				ID: nodeTask.Task.ID, Title: nodeTask.Task.Title, HttpMethod: nodeTask.Task.HttpMethod, Action: nodeTask.Task.Action,
+			})
+		}
+		graph.Nodes = append(graph.Nodes, graphNode)
+	}
+
+	for _, edge := range edges {
+		graph.Edges = append(graph.Edges, GraphEdge{From: edge.Ancestor, To: edge.Descendant, Condition: edge.Condition})
+	}
+
+	if executionID != uuid.Nil {
+		// Only an execution of this workflow can annotate its graph
+		execution, err := store.GetWorkflowExecutionByID(executionID)
+		if err != nil {
+			return Graph{}, fmt.Errorf("error retrieving workflow execution %s: %w", executionID, err)
+		}
+		if execution.WorkflowID != workflowID {
+			return Graph{}, notFound("workflow execution", executionID)
+		}
+
+		logs, err := store.GetExecutionLogs(executionID)
+		if err != nil {
+			return Graph{}, err
+		}
+		graph.ExecutionID = &executionID
+		applyOutcomes(&graph, logs)
+	}
+
+	return graph, nil
+}
+
+// applyOutcomes sets the outcome of every node from the node level log rows of an execution
+func applyOutcomes(graph *Graph, logs []WorkflowLog) {
+	outcomes := make(map[uuid.UUID]string)
+	for _, entry := range logs {
+		if entry.NodeID == nil {
+			continue
+		}
+		switch entry.ActionType {
+		case ActionTypeNode:
+			outcomes[*entry.NodeID] = entry.Status
+		case ActionTypeTask:
+			if _, ok := outcomes[*entry.NodeID]; !ok {
+				outcomes[*entry.NodeID] = "running"
+			}
+		}
+	}
+
+	for i := range graph.Nodes {
+		outcome, ok := outcomes[graph.Nodes[i].ID]
+		if !ok {
+			outcome = OutcomeNotReached
+		}
+		graph.Nodes[i].Outcome = outcome
+	}
+}
+
+var outcomeColors = map[string]string{
+	"completed":       "#c8e6c9",
+	"failed":          "#ffcdd2",
+	"running":         "#fff9c4",
+	WaitStatusWaiting: "#bbdefb",
+	OutcomeNotReached: "#eeeeee",
+}
+
+// RenderDOT writes the graph in Graphviz DOT format
+func RenderDOT(w io.Writer, graph Graph) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(graph.Name))
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\", fontname=\"Helvetica\"];\n")
+
+	for _, node := range graph.Nodes {
+		label := fmt.Sprintf("%s\n(%s)", node.Title, node.Type)
+		for _, task := range node.Tasks {
+			label += fmt.Sprintf("\n%s %s", task.HttpMethod, task.Title)
+		}
+
+		attrs := []string{"label=" + dotQuote(label), "shape=" + dotShape(node.Type)}
+		if color, ok := outcomeColors[node.Outcome]; ok {
+			attrs = append(attrs, "fillcolor="+dotQuote(color))
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.ID.String()), strings.Join(attrs, ", "))
+	}
+
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(edge.From.String()), dotQuote(edge.To.String()))
+		if edge.Condition != "" {
+			fmt.Fprintf(&b, " [label=%s]", dotQuote(edge.Condition))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// RenderMermaid writes the graph as a Mermaid flowchart
+func RenderMermaid(w io.Writer, graph Graph) error {
+	var b strings.Builder
+
+	ids := make(map[uuid.UUID]string)
+	b.WriteString("flowchart TD\n")
+
+	for i, node := range graph.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.ID] = id
+
+		label := fmt.Sprintf("%s<br/><i>%s</i>", mermaidEscape(node.Title), node.Type)
+		for _, task := range node.Tasks {
+			label += fmt.Sprintf("<br/>%s %s", task.HttpMethod, mermaidEscape(task.Title))
+		}
+
+		open, close := mermaidShape(node.Type)
+		fmt.Fprintf(&b, "  %s%s\"%s\"%s\n", id, open, label, close)
+	}
+
+	for _, edge := range graph.Edges {
+		from, to := ids[edge.From], ids[edge.To]
+		if from == "" || to == "" {
+			continue
+		}
+		if edge.Condition != "" {
+			fmt.Fprintf(&b, "  %s -->|%s| %s\n", from, mermaidEscape(edge.Condition), to)
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", from, to)
+		}
+	}
+
+	if graph.ExecutionID != nil {
+		for _, outcome := range []string{"completed", "failed", "running", WaitStatusWaiting, OutcomeNotReached} {
+			fmt.Fprintf(&b, "  classDef %s fill:%s\n", outcome, outcomeColors[outcome])
+		}
+		for _, node := range graph.Nodes {
+			if node.Outcome != "" {
+				fmt.Fprintf(&b, "  class %s %s\n", ids[node.ID], node.Outcome)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotShape(nodeType string) string {
+	switch nodeType {
+	case NodeTypeStart, NodeTypeEnd:
+		return "ellipse"
+	case NodeTypeDecision:
+		return "diamond"
+	case NodeTypeFork, NodeTypeJoin:
+		return "hexagon"
+	case NodeTypeSubWorkflow:
+		return "box3d"
+	default:
+		return "box"
+	}
+}
+
+func mermaidShape(nodeType string) (string, string) {
+	switch nodeType {
+	case NodeTypeStart, NodeTypeEnd:
+		return "([", "])"
+	case NodeTypeDecision:
+		return "{", "}"
+	case NodeTypeFork, NodeTypeJoin:
+		return "{{", "}}"
+	case NodeTypeSubWorkflow:
+		return "[[", "]]"
+	default:
+		return "[", "]"
+	}
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
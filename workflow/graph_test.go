@@ -0,0 +1,84 @@
+package workflow
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGraph() Graph {
+	start, check, escalate := uuid.New(), uuid.New(), uuid.New()
+	return Graph{
+		WorkflowID: uuid.New(),
+		Name:       `provision "gold"`,
+		Nodes: []GraphNode{
+			{ID: start, Title: "start", Type: NodeTypeStart, Tasks: []GraphTask{}},
+			{ID: check, Title: "check", Type: NodeTypeDecision, Tasks: []GraphTask{{Title: "lookup", HttpMethod: "GET"}}},
+			{ID: escalate, Title: "escalate", Type: NodeTypeTask, Tasks: []GraphTask{}},
+		},
+		Edges: []GraphEdge{
+			{From: start, To: check},
+			{From: check, To: escalate, Condition: "timeout"},
+		},
+	}
+}
+
+func TestRenderDOT(t *testing.T) {
+	graph := testGraph()
+
+	var out bytes.Buffer
+	assert.NoError(t, RenderDOT(&out, graph))
+
+	assert.Contains(t, out.String(), `digraph "provision \"gold\"" {`)
+	assert.Contains(t, out.String(), `label="check\n(Decision)\nGET lookup", shape=diamond`)
+	assert.Contains(t, out.String(), `"`+graph.Nodes[1].ID.String()+`" -> "`+graph.Nodes[2].ID.String()+`" [label="timeout"];`)
+}
+
+func TestRenderMermaid_WithOutcomes(t *testing.T) {
+	graph := testGraph()
+	executionID := uuid.New()
+	graph.ExecutionID = &executionID
+	applyOutcomes(&graph, []WorkflowLog{
+		{ActionType: ActionTypeNode, Status: "completed", NodeID: &graph.Nodes[0].ID},
+		{ActionType: ActionTypeNode, Status: "failed", NodeID: &graph.Nodes[1].ID},
+	})
+
+	var out bytes.Buffer
+	assert.NoError(t, RenderMermaid(&out, graph))
+
+	assert.Contains(t, out.String(), "flowchart TD\n")
+	assert.Contains(t, out.String(), `n1{"check<br/><i>Decision</i><br/>GET lookup"}`)
+	assert.Contains(t, out.String(), "n1 -->|timeout| n2")
+	assert.Contains(t, out.String(), "class n1 failed")
+	assert.Contains(t, out.String(), "class n2 not_reached")
+}
+
+func TestMemoryStoreWorkflowGraphExecution(t *testing.T) {
+	testStoreWorkflowGraphExecution(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreWorkflowGraphExecution(t *testing.T) {
+	testStoreWorkflowGraphExecution(t, newSQLiteStore(t))
+}
+
+func testStoreWorkflowGraphExecution(t *testing.T, store Store) {
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	workflowID, _ := store.CreateWorkflow("provision", "", startID, false)
+	otherID, _ := store.CreateWorkflow("deprovision", "", startID, false)
+	executionID, _, err := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := GetWorkflowGraph(store, workflowID, executionID)
+	assert.NoError(t, err)
+	assert.Equal(t, &executionID, graph.ExecutionID)
+
+	// An execution of another workflow, or no execution at all, is not found
+	_, err = GetWorkflowGraph(store, otherID, executionID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = GetWorkflowGraph(store, workflowID, uuid.New())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,46 @@
+package workflow
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// TaskIdempotencyHeader is the header carrying the idempotency key of outbound task requests.
+// An empty value disables the header.
+var TaskIdempotencyHeader = "Idempotency-Key"
+
+// taskIdempotencyNamespace namespaces the name based (v5) UUIDs used as task idempotency keys
+var taskIdempotencyNamespace = uuid.MustParse("b24e415f-c375-4010-b76f-b711a5b2a499")
+
+// TaskIdempotencyKey derives the idempotency key of a task call. The key is the same for
+// every retry and resume of the task; attemptGroup only changes once the node was rolled
+// back, so a new logical attempt is not de-duplicated against the reverted one.
+func TaskIdempotencyKey(executionID, nodeID, taskID uuid.UUID, attemptGroup int) string {
+	name := fmt.Sprintf("%s/%s/%s/%d", executionID, nodeID, taskID, attemptGroup)
+	return uuid.NewSHA1(taskIdempotencyNamespace, []byte(name)).String()
+}
+
+// taskIdempotencyKey returns the key for a task run. Runs outside of an execution are
+// not repeatable, so they get a random key shared by their retries only.
+func taskIdempotencyKey(store Store, executionID, nodeID, taskID uuid.UUID) (string, error) {
+	if executionID == uuid.Nil {
+		return uuid.NewString(), nil
+	}
+
+	attemptGroup, err := store.CountNodeRollbacks(executionID, nodeID)
+	if err != nil {
+		return "", fmt.Errorf("failed to count rollbacks of node %s: %w", nodeID, err)
+	}
+	return TaskIdempotencyKey(executionID, nodeID, taskID, attemptGroup), nil
+}
+
+// CountNodeRollbacks returns how many times a node was rolled back within an execution
+func (s *PostgresStore) CountNodeRollbacks(executionID, nodeID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM workflow_logs
+		WHERE execution_id = $1 AND node_id = $2 AND action_type = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+	`, executionID, nodeID, ActionTypeRollback, s.tenant).Scan(&count)
+	return count, err
+}
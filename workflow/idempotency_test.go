@@ -0,0 +1,46 @@
+package workflow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskIdempotencyKey(t *testing.T) {
+	executionID, nodeID, taskID := uuid.New(), uuid.New(), uuid.New()
+
+	key := TaskIdempotencyKey(executionID, nodeID, taskID, 0)
+	assert.Equal(t, key, TaskIdempotencyKey(executionID, nodeID, taskID, 0))
+	assert.NotEqual(t, key, TaskIdempotencyKey(executionID, nodeID, taskID, 1))
+	assert.NotEqual(t, key, TaskIdempotencyKey(uuid.New(), nodeID, taskID, 0))
+	assert.NotEqual(t, key, TaskIdempotencyKey(executionID, nodeID, uuid.New(), 0))
+
+	parsed, err := uuid.Parse(key)
+	assert.NoError(t, err)
+	assert.Equal(t, uuid.Version(5), parsed.Version())
+}
+
+func TestPerformTaskSendsIdempotencyKey(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Idempotency-Key")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	task := Task{Title: "Provision", HttpMethod: http.MethodPost, Action: server.URL}
+	_, code, err := performTask(context.Background(), task, "key-1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "key-1", received)
+
+	defer func(header string) { TaskIdempotencyHeader = header }(TaskIdempotencyHeader)
+	TaskIdempotencyHeader = ""
+	_, _, err = performTask(context.Background(), task, "key-2")
+	assert.NoError(t, err)
+	assert.Empty(t, received)
+}
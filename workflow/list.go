@@ -0,0 +1,101 @@
+package workflow
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DefaultListLimit is the number of workflows or executions returned when a filter has no limit
+const DefaultListLimit = 100
+
+// WorkflowFilter selects workflows. Empty fields match everything.
+type WorkflowFilter struct {
+	Name   string // Every version of the workflow with this name
+	Limit  int    // At most this many workflows, DefaultListLimit when 0
+	Offset int    // Skip this many of the newest matching workflows
+}
+
+func (f WorkflowFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultListLimit
+	}
+	return f.Limit
+}
+
+func (f WorkflowFilter) matches(wf Workflow) bool {
+	return wf.DeletedAt == nil && (f.Name == "" || f.Name == wf.Name)
+}
+
+// ExecutionFilter selects executions. Empty fields match everything.
+type ExecutionFilter struct {
+	WorkflowID      uuid.UUID // Executions of this workflow
+	Status          string    // Executions with this status
+	ReferenceNumber string    // Executions with this reference number
+	Limit           int       // At most this many executions, DefaultListLimit when 0
+	Offset          int       // Skip this many of the newest matching executions
+}
+
+func (f ExecutionFilter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultListLimit
+	}
+	return f.Limit
+}
+
+func (f ExecutionFilter) matches(e WorkflowExecution) bool {
+	return (f.WorkflowID == uuid.Nil || f.WorkflowID == e.WorkflowID) && (f.Status == "" || f.Status == e.Status) &&
+		(f.ReferenceNumber == "" || f.ReferenceNumber == e.ReferenceNumber)
+}
+
+// ListWorkflows returns the workflows matching filter, newest first
+func (s *PostgresStore) ListWorkflows(filter WorkflowFilter) ([]Workflow, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, starting_node_id, COALESCE(description, ''), version, unique_reference, tenant_id, created_at, updated_at, deleted_at
+		FROM workflows
+		WHERE deleted_at IS NULL AND (tenant_id = $1 OR $1 = '') AND ($2 = '' OR name = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`, s.tenant, filter.Name, filter.limit(), filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching workflows: %w", err)
+	}
+	defer rows.Close()
+
+	workflows := []Workflow{}
+	for rows.Next() {
+		var wf Workflow
+		if err := rows.Scan(&wf.ID, &wf.Name, &wf.StartingNodeID, &wf.Description, &wf.Version, &wf.UniqueReference, &wf.TenantID,
+			&wf.CreatedAt, &wf.UpdatedAt, &wf.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning workflow row: %w", err)
+		}
+		workflows = append(workflows, wf)
+	}
+	return workflows, rows.Err()
+}
+
+// ListWorkflowExecutions returns the executions matching filter, newest first
+func (s *PostgresStore) ListWorkflowExecutions(filter ExecutionFilter) ([]WorkflowExecution, error) {
+	rows, err := s.db.Query(`
+		SELECT `+executionColumns+`
+		FROM workflow_executions
+		WHERE (tenant_id = $1 OR $1 = '') AND ($2::uuid IS NULL OR workflow_id = $2::uuid) AND ($3 = '' OR status = $3)
+			AND ($4 = '' OR reference_number = $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5 OFFSET $6
+	`, s.tenant, nullableID(filter.WorkflowID), filter.Status, filter.ReferenceNumber, filter.limit(), filter.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching workflow executions: %w", err)
+	}
+	defer rows.Close()
+
+	executions := []WorkflowExecution{}
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning workflow execution row: %w", err)
+		}
+		executions = append(executions, execution)
+	}
+	return executions, rows.Err()
+}
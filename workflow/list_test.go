@@ -0,0 +1,73 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreLists(t *testing.T) {
+	testStoreLists(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreLists(t *testing.T) {
+	testStoreLists(t, newSQLiteStore(t))
+}
+
+// testStoreLists checks that workflows and executions are listed newest first, filtered and paged
+func testStoreLists(t *testing.T, store Store) {
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	checkout1, _ := store.CreateWorkflow("checkout", "", startID, false)
+	refund, _ := store.CreateWorkflow("refund", "", startID, false)
+	checkout2, _ := store.CreateWorkflow("checkout", "", startID, false)
+	acme := store.ForTenant("acme")
+	acmeStart, _ := acme.CreateNode("Start", NodeTypeStart, "", nil)
+	acme.CreateWorkflow("checkout", "", acmeStart, false)
+
+	ids := func(workflows []Workflow) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, wf := range workflows {
+			ids = append(ids, wf.ID)
+		}
+		return ids
+	}
+
+	workflows, err := store.ForTenant(DefaultTenant).ListWorkflows(WorkflowFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{checkout2, refund, checkout1}, ids(workflows))
+	workflows, _ = store.ForTenant(DefaultTenant).ListWorkflows(WorkflowFilter{Name: "checkout"})
+	assert.Equal(t, []uuid.UUID{checkout2, checkout1}, ids(workflows))
+	workflows, _ = store.ForTenant(DefaultTenant).ListWorkflows(WorkflowFilter{Limit: 1, Offset: 1})
+	assert.Equal(t, []uuid.UUID{refund}, ids(workflows))
+	workflows, _ = acme.ListWorkflows(WorkflowFilter{})
+	assert.Len(t, workflows, 1)
+	workflows, _ = store.ListWorkflows(WorkflowFilter{Offset: 10})
+	assert.NotNil(t, workflows)
+	assert.Empty(t, workflows)
+
+	first, _, err := store.CreateWorkflowExecution(checkout1, "ORD-1", nil, "")
+	assert.NoError(t, err)
+	second, _, _ := store.CreateWorkflowExecution(checkout1, "ORD-2", nil, "")
+	third, _, _ := store.CreateWorkflowExecution(refund, "ORD-1", nil, "")
+	execution, _ := store.GetWorkflowExecutionByID(second)
+	assert.NoError(t, store.UpdateWorkflowExecutionStatus(second, execution.Version, "completed"))
+
+	executionIDs := func(filter ExecutionFilter) []uuid.UUID {
+		executions, err := store.ListWorkflowExecutions(filter)
+		assert.NoError(t, err)
+		var ids []uuid.UUID
+		for _, e := range executions {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []uuid.UUID{third, second, first}, executionIDs(ExecutionFilter{}))
+	assert.Equal(t, []uuid.UUID{second, first}, executionIDs(ExecutionFilter{WorkflowID: checkout1}))
+	assert.Equal(t, []uuid.UUID{second}, executionIDs(ExecutionFilter{Status: "completed"}))
+	assert.Equal(t, []uuid.UUID{third, first}, executionIDs(ExecutionFilter{ReferenceNumber: "ORD-1"}))
+	assert.Equal(t, []uuid.UUID{second}, executionIDs(ExecutionFilter{Limit: 1, Offset: 1}))
+
+	executions, _ := acme.ListWorkflowExecutions(ExecutionFilter{})
+	assert.Empty(t, executions)
+}
@@ -1,28 +1,122 @@
 package workflow
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-func logWorkflowNode(db *sql.DB, workflowID uuid.UUID, nodeID uuid.UUID, status string, message string) error {
+// Action types recorded on workflow_logs rows
+const (
+	ActionTypeExecution = "execution" // Start or end of a whole execution
+	ActionTypeNode      = "node"      // A node finished (completed or failed)
+	ActionTypeTask      = "task"      // A single task attempt
+	ActionTypeRollback  = "rollback"  // A rollback step
+)
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying the given logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger carried by ctx, falling back to the slog default
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withLogFields attaches fields (execution_id, node_id, ...) to the logger carried by ctx
+func withLogFields(ctx context.Context, args ...any) (context.Context, *slog.Logger) {
+	logger := Logger(ctx).With(args...)
+	return WithLogger(ctx, logger), logger
+}
+
+func logWorkflowNode(store Store, workflowID uuid.UUID, nodeID uuid.UUID, status string, message string) error {
 	// Log workflow execution
-	err := LogWorkflowExecution(db, workflowID, nodeID, nil, status, message, nil, nil, nil)
+	err := store.LogWorkflowExecution(workflowID, nodeID, nil, status, message, nil, nil, nil)
 	if err != nil {
-		return fmt.Errorf("failed to log workflow execution: %v", err)
+		return fmt.Errorf("failed to log workflow execution: %w", err)
 	}
 
 	return nil
 }
 
-func logWorkflowNodeTask(db *sql.DB, workflowID uuid.UUID, nodeID uuid.UUID, taskID uuid.UUID, status string, message string) error {
+func logWorkflowNodeTask(store Store, workflowID uuid.UUID, nodeID uuid.UUID, taskID uuid.UUID, status string, message string) error {
 	// Log workflow execution
-	err := LogWorkflowExecution(db, workflowID, nodeID, &taskID, status, message, nil, nil, nil)
+	err := store.LogWorkflowExecution(workflowID, nodeID, &taskID, status, message, nil, nil, nil)
 	if err != nil {
-		return fmt.Errorf("failed to log workflow execution: %v", err)
+		return fmt.Errorf("failed to log workflow execution: %w", err)
 	}
 
 	return nil
 }
+
+// logExecutionFinished writes the closing log row of an execution, spanning from startedAt until now
+func logExecutionFinished(store Store, workflowID, executionID, startNodeID uuid.UUID, startedAt time.Time, execErr error) error {
+	return store.InsertWorkflowLog(executionFinishedLog(workflowID, executionID, startNodeID, startedAt, execErr))
+}
+
+// executionFinishedLog builds the log row of an execution, spanning from startedAt until now
+func executionFinishedLog(workflowID, executionID, startNodeID uuid.UUID, startedAt time.Time, execErr error) WorkflowLog {
+	entry := WorkflowLog{
+		WorkflowID:  workflowID,
+		ExecutionID: nullableID(executionID),
+		NodeID:      &startNodeID,
+		Status:      "completed",
+		Message:     "Workflow execution completed",
+		ActionType:  ActionTypeExecution,
+		ExecutedAt:  startedAt,
+		CompletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+	if execErr != nil {
+		entry.Status = "error"
+		entry.Message = "Workflow execution failed"
+		entry.Error = stringPtr(execErr.Error())
+	}
+
+	return entry
+}
+
+// logNodeFinished writes the log row of a node, spanning from startedAt until now
+func logNodeFinished(store Store, workflowID, executionID, nodeID uuid.UUID, startedAt time.Time, nodeErr error) error {
+	entry := WorkflowLog{
+		WorkflowID:  workflowID,
+		ExecutionID: nullableID(executionID),
+		NodeID:      &nodeID,
+		Status:      "completed",
+		Message:     "Node execution completed",
+		ActionType:  ActionTypeNode,
+		ExecutedAt:  startedAt,
+		CompletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}
+	if nodeErr != nil {
+		entry.Status = "failed"
+		entry.Message = "Node execution failed"
+		entry.Error = stringPtr(nodeErr.Error())
+	}
+
+	return store.InsertWorkflowLog(entry)
+}
+
+func nullableID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,1576 @@
+package workflow
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is a Store keeping everything in process. It mirrors the behaviour of
+// PostgresStore, including the compare-and-set claims, so the engine can be exercised
+// without a database. Rows are kept in insertion order.
+type MemoryStore struct {
+	*memoryData
+	inTx   bool   // set on the Store handed to WithTx, which already holds mu
+	tenant string // tenant the store is confined to, empty for every tenant
+}
+
+// memoryData is shared by a MemoryStore and its transactions. A transaction holds mu until
+// it ends, so it is serializable and can be undone by restoring a snapshot.
+type memoryData struct {
+	mu sync.Mutex
+
+	nodes      []Node
+	closure    []NodeClosure
+	tasks      []Task
+	nodeTasks  []NodeTask
+	workflows  []memoryWorkflow
+	executions []memoryExecution
+	logs       []WorkflowLog
+	waits      []ExecutionWait
+	timers     []Timer
+	schedules  []Schedule
+	policies   []TargetPolicy
+	outbox     []memoryOutboxEvent
+	apiKeys    []APIKey
+	grants     []WorkflowGrant
+	audit      []AuditEntry
+	quotas     []TenantQuota
+	owners     map[uuid.UUID]string // tenant of every node and task, which have no tenant field
+}
+
+type memoryOutboxEvent struct {
+	OutboxEvent
+	claimedUntil *time.Time
+}
+
+type memoryWorkflow struct {
+	Workflow
+	status string
+}
+
+type memoryExecution struct {
+	WorkflowExecution
+	uniqueReference bool
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memoryData: &memoryData{owners: map[uuid.UUID]string{}}}
+}
+
+// lock locks the store for one call and returns the unlock
+func (m *MemoryStore) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+func (m *MemoryStore) WithTx(fn func(tx Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.snapshot()
+	if err := fn(&MemoryStore{memoryData: m.memoryData, inTx: true, tenant: m.tenant}); err != nil {
+		m.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// ForTenant returns the store confined to tenant, see Store
+func (m *MemoryStore) ForTenant(tenant string) Store {
+	return &MemoryStore{memoryData: m.memoryData, inTx: m.inTx, tenant: tenant}
+}
+
+func (m *MemoryStore) Tenant() string {
+	return m.tenant
+}
+
+// owner is the tenant of the rows the store creates
+func (m *MemoryStore) owner() string {
+	if m.tenant == "" {
+		return DefaultTenant
+	}
+	return m.tenant
+}
+
+// visible tells whether a row of tenant can be seen through the store
+func (m *MemoryStore) visible(tenant string) bool {
+	return m.tenant == "" || tenant == m.tenant
+}
+
+// snapshot copies the rows; rows are only ever replaced, never changed through shared pointers
+func (m *MemoryStore) snapshot() *memoryData {
+	owners := make(map[uuid.UUID]string, len(m.owners))
+	for id, tenant := range m.owners {
+		owners[id] = tenant
+	}
+	return &memoryData{
+		nodes: append([]Node(nil), m.nodes...), closure: append([]NodeClosure(nil), m.closure...),
+		tasks: append([]Task(nil), m.tasks...), nodeTasks: append([]NodeTask(nil), m.nodeTasks...),
+		workflows: append([]memoryWorkflow(nil), m.workflows...), executions: append([]memoryExecution(nil), m.executions...),
+		logs: append([]WorkflowLog(nil), m.logs...), waits: append([]ExecutionWait(nil), m.waits...),
+		timers: append([]Timer(nil), m.timers...), schedules: append([]Schedule(nil), m.schedules...),
+		policies: append([]TargetPolicy(nil), m.policies...), outbox: append([]memoryOutboxEvent(nil), m.outbox...),
+		apiKeys: append([]APIKey(nil), m.apiKeys...), grants: append([]WorkflowGrant(nil), m.grants...),
+		audit: append([]AuditEntry(nil), m.audit...), quotas: append([]TenantQuota(nil), m.quotas...), owners: owners,
+	}
+}
+
+func (m *MemoryStore) restore(snapshot *memoryData) {
+	m.nodes, m.closure, m.tasks, m.nodeTasks = snapshot.nodes, snapshot.closure, snapshot.tasks, snapshot.nodeTasks
+	m.workflows, m.executions, m.logs, m.waits = snapshot.workflows, snapshot.executions, snapshot.logs, snapshot.waits
+	m.timers, m.schedules, m.policies, m.outbox = snapshot.timers, snapshot.schedules, snapshot.policies, snapshot.outbox
+	m.apiKeys, m.grants, m.audit = snapshot.apiKeys, snapshot.grants, snapshot.audit
+	m.quotas, m.owners = snapshot.quotas, snapshot.owners
+}
+
+func cloneJSON(data json.RawMessage) json.RawMessage {
+	if data == nil {
+		return nil
+	}
+	return append(json.RawMessage{}, data...)
+}
+
+func timeRef(t time.Time) *time.Time {
+	return &t
+}
+
+func (m *MemoryStore) CreateNode(title, nodeType string, description string, config json.RawMessage) (uuid.UUID, error) {
+	defer m.lock()()
+
+	node := Node{ID: uuid.New(), Title: title, Type: nodeType, Description: description, Config: cloneJSON(config), CreatedAt: timeRef(time.Now())}
+	m.nodes = append(m.nodes, node)
+	m.owners[node.ID] = m.owner()
+	return node.ID, nil
+}
+
+func (m *MemoryStore) GetNode(nodeID uuid.UUID) (Node, error) {
+	defer m.lock()()
+
+	node, ok := m.node(nodeID)
+	if !ok {
+		return Node{}, notFound("node", nodeID)
+	}
+	node.Config = cloneJSON(node.Config)
+	return node, nil
+}
+
+// node looks up a node of the tenant of the store; m.mu must be held
+func (m *MemoryStore) node(nodeID uuid.UUID) (Node, bool) {
+	for _, node := range m.nodes {
+		if node.ID == nodeID && m.visible(m.owners[nodeID]) {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
+
+func (m *MemoryStore) AddRelationship(ancestor, descendant uuid.UUID, condition string) error {
+	defer m.lock()()
+
+	if err := ValidateBranchCondition(condition); err != nil {
+		return err
+	}
+	if m.tenant != "" {
+		for _, nodeID := range []uuid.UUID{ancestor, descendant} {
+			if _, ok := m.node(nodeID); !ok {
+				return notFound("node", nodeID)
+			}
+		}
+	}
+	if m.reaches(descendant, ancestor) {
+		return cycleError(ancestor, descendant)
+	}
+
+	var rows []NodeClosure
+	for _, edge := range m.closure {
+		if edge.Descendant == ancestor {
+			rows = append(rows, NodeClosure{Ancestor: edge.Ancestor, Descendant: descendant, Depth: edge.Depth + 1})
+		}
+	}
+	rows = append(rows, NodeClosure{Ancestor: ancestor, Descendant: descendant, Depth: 0, Condition: condition})
+	for _, row := range rows {
+		m.addClosure(row)
+	}
+	return nil
+}
+
+// addClosure stores row unless a path at most as short already connects its nodes; m.mu must be held
+func (m *MemoryStore) addClosure(row NodeClosure) {
+	for i, edge := range m.closure {
+		if edge.Ancestor == row.Ancestor && edge.Descendant == row.Descendant {
+			if row.Depth < edge.Depth {
+				m.closure[i] = row
+			}
+			return
+		}
+	}
+	m.closure = append(m.closure, row)
+}
+
+// reaches tells whether to can be reached from from through direct relationships; m.mu must be held
+func (m *MemoryStore) reaches(from, to uuid.UUID) bool {
+	seen := map[uuid.UUID]bool{from: true}
+	queue := []uuid.UUID{from}
+	for len(queue) > 0 {
+		nodeID := queue[0]
+		queue = queue[1:]
+		if nodeID == to {
+			return true
+		}
+		for _, edge := range m.closure {
+			if edge.Ancestor == nodeID && edge.Depth == 0 && !seen[edge.Descendant] {
+				seen[edge.Descendant] = true
+				queue = append(queue, edge.Descendant)
+			}
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) GetDescendants(ancestor uuid.UUID) ([]Node, error) {
+	defer m.lock()()
+
+	var descendants []Node
+	for _, edge := range m.closure {
+		if edge.Ancestor != ancestor {
+			continue
+		}
+		if node, ok := m.node(edge.Descendant); ok {
+			node.Config = nil
+			descendants = append(descendants, node)
+		}
+	}
+	return descendants, nil
+}
+
+func (m *MemoryStore) GetChildren(nodeID uuid.UUID) ([]NodeClosure, error) {
+	defer m.lock()()
+
+	if _, ok := m.node(nodeID); !ok {
+		return nil, nil
+	}
+
+	var children []NodeClosure
+	for _, edge := range m.closure {
+		if edge.Ancestor == nodeID && edge.Depth == 0 {
+			children = append(children, edge)
+		}
+	}
+	return children, nil
+}
+
+func (m *MemoryStore) GetImmediateAncestor(nodeID uuid.UUID) (Node, error) {
+	defer m.lock()()
+
+	for _, edge := range m.closure {
+		if edge.Descendant != nodeID || edge.Depth != 1 {
+			continue
+		}
+		if node, ok := m.node(edge.Ancestor); ok {
+			node.Config = nil
+			return node, nil
+		}
+	}
+	return Node{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) AllParentsCompleted(executionID, nodeID uuid.UUID) (bool, error) {
+	defer m.lock()()
+
+	for _, edge := range m.closure {
+		if edge.Descendant != nodeID || edge.Depth != 0 {
+			continue
+		}
+		if _, ok := m.node(edge.Ancestor); !ok {
+			continue
+		}
+
+		completed := false
+		for _, entry := range m.logs {
+			if entry.ExecutionID != nil && *entry.ExecutionID == executionID && entry.NodeID != nil && *entry.NodeID == edge.Ancestor &&
+				entry.ActionType == ActionTypeNode && entry.Status == "completed" {
+				completed = true
+				break
+			}
+		}
+		if !completed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (m *MemoryStore) ValidateClosure(startNode uuid.UUID) error {
+	defer m.lock()()
+
+	if _, ok := m.node(startNode); !ok {
+		return nil
+	}
+
+	count := 0
+	for _, edge := range m.closure {
+		if edge.Ancestor == startNode && edge.Descendant == startNode {
+			count++
+		}
+	}
+	if count > 1 {
+		return fmt.Errorf("cyclic dependency detected")
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateTask(title, taskType, httpMethod, action, params string, maxRetries int) (uuid.UUID, error) {
+	defer m.lock()()
+
+	task := Task{
+		ID: uuid.New(), Title: title, Type: taskType, HttpMethod: httpMethod, Action: action, Params: params, MaxRetries: maxRetries,
+		CreatedAt: timeRef(time.Now()),
+	}
+	m.tasks = append(m.tasks, task)
+	m.owners[task.ID] = m.owner()
+	return task.ID, nil
+}
+
+func (m *MemoryStore) GetTask(taskID uuid.UUID) (Task, error) {
+	defer m.lock()()
+
+	task, ok := m.task(taskID)
+	if !ok {
+		return Task{}, notFound("task", taskID)
+	}
+	return task, nil
+}
+
+// task looks up a task of the tenant of the store; m.mu must be held
+func (m *MemoryStore) task(taskID uuid.UUID) (Task, bool) {
+	for _, task := range m.tasks {
+		if task.ID == taskID && m.visible(m.owners[taskID]) {
+			return task, true
+		}
+	}
+	return Task{}, false
+}
+
+func (m *MemoryStore) AddTaskToNode(nodeID, taskID uuid.UUID, taskOrder int) error {
+	defer m.lock()()
+
+	if _, ok := m.node(nodeID); !ok {
+		return fmt.Errorf("node %s does not exist", nodeID)
+	}
+	if _, ok := m.task(taskID); !ok {
+		return fmt.Errorf("task %s does not exist", taskID)
+	}
+
+	m.nodeTasks = append(m.nodeTasks, NodeTask{
+		ID: uuid.New(), NodeID: nodeID, TaskID: taskID, TaskOrder: taskOrder, Status: "pending", CreatedAt: timeRef(time.Now()),
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetNodeTasks(nodeID uuid.UUID) ([]NodeTask, error) {
+	defer m.lock()()
+
+	var nodeTasks []NodeTask
+	for _, nodeTask := range m.nodeTasks {
+		if nodeTask.NodeID != nodeID || nodeTask.DeletedAt != nil {
+			continue
+		}
+		task, ok := m.task(nodeTask.TaskID)
+		if !ok || task.Type == "Start" || task.Type == "End" {
+			continue
+		}
+		// Only the task fields PostgresStore loads
+		nodeTask.Task = Task{ID: task.ID, Title: task.Title, Type: task.Type, HttpMethod: task.HttpMethod, Action: task.Action, Params: task.Params}
+		nodeTasks = append(nodeTasks, nodeTask)
+	}
+
+	sort.SliceStable(nodeTasks, func(i, j int) bool {
+		return nodeTasks[i].TaskOrder < nodeTasks[j].TaskOrder
+	})
+	return nodeTasks, nil
+}
+
+func (m *MemoryStore) UpdateTaskStatus(taskID uuid.UUID, status string, retryCount int) error {
+	defer m.lock()()
+
+	if _, ok := m.task(taskID); !ok {
+		return nil
+	}
+
+	for i := range m.nodeTasks {
+		if m.nodeTasks[i].TaskID == taskID {
+			m.nodeTasks[i].Status = status
+			m.nodeTasks[i].RetryCount = retryCount
+			m.nodeTasks[i].UpdatedAt = timeRef(time.Now())
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateWorkflow(name, description string, startingNodeID uuid.UUID, uniqueReference bool) (uuid.UUID, error) {
+	defer m.lock()()
+
+	if _, ok := m.node(startingNodeID); m.tenant != "" && !ok {
+		return uuid.Nil, notFound("node", startingNodeID)
+	}
+
+	version := 1
+	for _, wf := range m.workflows {
+		if wf.Name == name && wf.TenantID == m.owner() && wf.Version >= version {
+			version = wf.Version + 1
+		}
+	}
+
+	wf := Workflow{
+		ID: uuid.New(), Name: name, Description: description, StartingNodeID: startingNodeID, Version: version,
+		UniqueReference: uniqueReference, TenantID: m.owner(), CreatedAt: timeRef(time.Now()),
+	}
+	m.workflows = append(m.workflows, memoryWorkflow{Workflow: wf})
+	return wf.ID, nil
+}
+
+func (m *MemoryStore) GetWorkflow(workflowID uuid.UUID) (Workflow, error) {
+	defer m.lock()()
+
+	if wf := m.workflow(workflowID); wf != nil {
+		return wf.Workflow, nil
+	}
+	return Workflow{}, notFound("workflow", workflowID)
+}
+
+func (m *MemoryStore) ListWorkflows(filter WorkflowFilter) ([]Workflow, error) {
+	defer m.lock()()
+
+	workflows, skipped := []Workflow{}, 0
+	for i := len(m.workflows) - 1; i >= 0 && len(workflows) < filter.limit(); i-- {
+		wf := m.workflows[i].Workflow
+		if !m.visible(wf.TenantID) || !filter.matches(wf) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		workflows = append(workflows, wf)
+	}
+	return workflows, nil
+}
+
+// workflow looks up a workflow of the tenant of the store; m.mu must be held
+func (m *MemoryStore) workflow(workflowID uuid.UUID) *memoryWorkflow {
+	for i := range m.workflows {
+		if m.workflows[i].ID == workflowID && m.visible(m.workflows[i].TenantID) {
+			return &m.workflows[i]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetWorkflowVersion(name string, version int) (Workflow, error) {
+	defer m.lock()()
+
+	var found *Workflow
+	for i := range m.workflows {
+		wf := &m.workflows[i].Workflow
+		if wf.Name != name || wf.TenantID != m.owner() || wf.DeletedAt != nil || (version != 0 && wf.Version != version) {
+			continue
+		}
+		if found == nil || wf.Version > found.Version {
+			found = wf
+		}
+	}
+	if found == nil {
+		return Workflow{}, notFound("workflow", name)
+	}
+	return *found, nil
+}
+
+func (m *MemoryStore) GetStartingNode(workflowID uuid.UUID) (Node, error) {
+	defer m.lock()()
+
+	wf := m.workflow(workflowID)
+	if wf == nil {
+		return Node{}, newError(fmt.Sprintf("no starting node found for workflow %s", workflowID), ErrNotFound)
+	}
+	node, ok := m.node(wf.StartingNodeID)
+	if !ok || node.DeletedAt != nil {
+		return Node{}, newError(fmt.Sprintf("no starting node found for workflow %s", workflowID), ErrNotFound)
+	}
+	node.Config = nil
+	return node, nil
+}
+
+func (m *MemoryStore) GetWorkflowNodes(workflowID uuid.UUID) ([]Node, error) {
+	defer m.lock()()
+
+	wf := m.workflow(workflowID)
+	if wf == nil {
+		return nil, nil
+	}
+
+	reachable := map[uuid.UUID]bool{wf.StartingNodeID: true}
+	for _, edge := range m.closure {
+		if edge.Ancestor == wf.StartingNodeID {
+			reachable[edge.Descendant] = true
+		}
+	}
+
+	var nodes []Node
+	for _, node := range m.nodes {
+		if reachable[node.ID] && node.DeletedAt == nil {
+			node.Config = nil
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (m *MemoryStore) GetWorkflowEdges(workflowID uuid.UUID) ([]NodeClosure, error) {
+	defer m.lock()()
+
+	wf := m.workflow(workflowID)
+	if wf == nil {
+		return nil, nil
+	}
+
+	reachable := map[uuid.UUID]bool{wf.StartingNodeID: true}
+	for _, edge := range m.closure {
+		if edge.Ancestor == wf.StartingNodeID {
+			reachable[edge.Descendant] = true
+		}
+	}
+
+	var edges []NodeClosure
+	for _, edge := range m.closure {
+		if edge.Depth == 0 && reachable[edge.Ancestor] {
+			edges = append(edges, edge)
+		}
+	}
+	return edges, nil
+}
+
+func (m *MemoryStore) UpdateWorkflowStatus(workflowID uuid.UUID, status string) error {
+	defer m.lock()()
+
+	if wf := m.workflow(workflowID); wf != nil {
+		wf.status = status
+		wf.UpdatedAt = timeRef(time.Now())
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateWorkflowExecution(workflowID uuid.UUID, referenceNumber string, data json.RawMessage, idempotencyKey string) (uuid.UUID, bool, error) {
+	defer m.lock()()
+
+	wf := m.workflow(workflowID)
+	if wf == nil {
+		return uuid.Nil, false, ErrWorkflowNotFound
+	}
+
+	for _, existing := range m.executions {
+		if existing.WorkflowID != workflowID {
+			continue
+		}
+		sameKey := idempotencyKey != "" && existing.IdempotencyKey == idempotencyKey
+		sameReference := wf.UniqueReference && existing.uniqueReference && existing.ReferenceNumber == referenceNumber
+		if sameKey || sameReference {
+			return existing.ID, false, nil
+		}
+	}
+
+	now := time.Now()
+	execution := WorkflowExecution{
+		ID: uuid.New(), WorkflowID: workflowID, ReferenceNumber: referenceNumber, Status: "pending", Data: cloneJSON(data),
+		IdempotencyKey: idempotencyKey, TenantID: wf.TenantID, CreatedAt: now, UpdatedAt: now,
+	}
+	m.executions = append(m.executions, memoryExecution{WorkflowExecution: execution, uniqueReference: wf.UniqueReference})
+	return execution.ID, true, nil
+}
+
+func (m *MemoryStore) CreateChildExecution(workflowID uuid.UUID, referenceNumber string, data json.RawMessage, parentExecutionID, parentNodeID uuid.UUID) (uuid.UUID, error) {
+	defer m.lock()()
+
+	wf := m.workflow(workflowID)
+	if wf == nil {
+		return uuid.Nil, fmt.Errorf("workflow %s does not exist", workflowID)
+	}
+
+	now := time.Now()
+	execution := WorkflowExecution{
+		ID: uuid.New(), WorkflowID: workflowID, ReferenceNumber: referenceNumber, Status: "pending", Data: cloneJSON(data),
+		ParentExecutionID: &parentExecutionID, ParentNodeID: &parentNodeID, TenantID: wf.TenantID, CreatedAt: now, UpdatedAt: now,
+	}
+	m.executions = append(m.executions, memoryExecution{WorkflowExecution: execution})
+	return execution.ID, nil
+}
+
+func (m *MemoryStore) GetWorkflowExecutionByID(executionID uuid.UUID) (WorkflowExecution, error) {
+	defer m.lock()()
+
+	execution := m.execution(executionID)
+	if execution == nil {
+		return WorkflowExecution{}, notFound("workflow execution", executionID)
+	}
+	return copyExecution(execution.WorkflowExecution), nil
+}
+
+func (m *MemoryStore) ListWorkflowExecutions(filter ExecutionFilter) ([]WorkflowExecution, error) {
+	defer m.lock()()
+
+	executions, skipped := []WorkflowExecution{}, 0
+	for i := len(m.executions) - 1; i >= 0 && len(executions) < filter.limit(); i-- {
+		execution := m.executions[i].WorkflowExecution
+		if !m.visible(execution.TenantID) || !filter.matches(execution) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		executions = append(executions, copyExecution(execution))
+	}
+	return executions, nil
+}
+
+// execution looks up an execution of the tenant of the store; m.mu must be held
+func (m *MemoryStore) execution(executionID uuid.UUID) *memoryExecution {
+	for i := range m.executions {
+		if m.executions[i].ID == executionID && m.visible(m.executions[i].TenantID) {
+			return &m.executions[i]
+		}
+	}
+	return nil
+}
+
+func copyExecution(execution WorkflowExecution) WorkflowExecution {
+	execution.Data = cloneJSON(execution.Data)
+	return execution
+}
+
+func (m *MemoryStore) ListChildExecutions(parentExecutionID uuid.UUID) ([]WorkflowExecution, error) {
+	defer m.lock()()
+
+	var executions []WorkflowExecution
+	for _, execution := range m.executions {
+		if execution.ParentExecutionID != nil && *execution.ParentExecutionID == parentExecutionID && m.visible(execution.TenantID) {
+			executions = append(executions, copyExecution(execution.WorkflowExecution))
+		}
+	}
+	return executions, nil
+}
+
+func (m *MemoryStore) CancelChildExecutions(parentExecutionID uuid.UUID) ([]uuid.UUID, error) {
+	defer m.lock()()
+
+	var children []uuid.UUID
+	for i := range m.executions {
+		execution := &m.executions[i]
+		if execution.ParentExecutionID == nil || *execution.ParentExecutionID != parentExecutionID || !m.visible(execution.TenantID) {
+			continue
+		}
+		if execution.Status == "pending" || execution.Status == WaitStatusWaiting {
+			execution.Status = "cancelled"
+			execution.Version++
+			execution.UpdatedAt = time.Now()
+			children = append(children, execution.ID)
+		}
+	}
+	return children, nil
+}
+
+func (m *MemoryStore) MergeWorkflowExecutionData(executionID uuid.UUID, data json.RawMessage) error {
+	defer m.lock()()
+
+	execution := m.execution(executionID)
+	if execution == nil {
+		return notFound("workflow execution", executionID)
+	}
+
+	merged := map[string]json.RawMessage{}
+	if len(execution.Data) > 0 {
+		if err := json.Unmarshal(execution.Data, &merged); err != nil {
+			return fmt.Errorf("execution data is not a JSON object: %w", err)
+		}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("merged data is not a JSON object: %w", err)
+	}
+	for field, value := range fields {
+		merged[field] = value
+	}
+
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	execution.Data = out
+	execution.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStore) UpdateWorkflowExecutionStatus(executionID uuid.UUID, version int, status string) error {
+	defer m.lock()()
+
+	execution := m.execution(executionID)
+	if execution == nil || execution.Version != version {
+		return ErrExecutionConflict
+	}
+	execution.Status = status
+	execution.Version++
+	execution.UpdatedAt = time.Now()
+	return nil
+}
+
+func (m *MemoryStore) RenewExecutionLease(executionID uuid.UUID, until time.Time) error {
+	defer m.lock()()
+
+	if execution := m.execution(executionID); execution != nil && execution.Status == "executing" {
+		execution.LeaseExpiresAt = timeRef(until)
+	}
+	return nil
+}
+
+func (m *MemoryStore) CountParkedNodes(executionID uuid.UUID) (int, error) {
+	defer m.lock()()
+
+	if m.execution(executionID) == nil {
+		return 0, nil
+	}
+
+	count := 0
+	for _, wait := range m.waits {
+		if wait.ExecutionID == executionID && wait.Status == WaitStatusWaiting {
+			count++
+		}
+	}
+	for _, timer := range m.timers {
+		if timer.ExecutionID == executionID && timer.Status == TimerStatusPending {
+			count++
+		}
+	}
+	for _, execution := range m.executions {
+		if execution.ParentExecutionID == nil || *execution.ParentExecutionID != executionID {
+			continue
+		}
+		switch execution.Status {
+		case "pending", "executing", WaitStatusWaiting:
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) LogWorkflowExecution(workflowID, nodeID uuid.UUID, taskID *uuid.UUID, status, message string, httpCode *int, response *string, errorMessage error) error {
+	errorMessageStr := ""
+	if errorMessage != nil {
+		errorMessageStr = errorMessage.Error()
+	}
+	return m.InsertWorkflowLog(WorkflowLog{
+		WorkflowID: workflowID, NodeID: &nodeID, TaskID: taskID, Status: status, Message: message, ExecutedAt: time.Now(),
+		HttpCode: httpCode, Response: response, Error: &errorMessageStr,
+	})
+}
+
+func (m *MemoryStore) InsertWorkflowLog(entry WorkflowLog) error {
+	defer m.lock()()
+
+	if m.tenant != "" && m.workflow(entry.WorkflowID) == nil {
+		return notFound("workflow", entry.WorkflowID)
+	}
+	if m.tenant != "" && entry.ExecutionID != nil && m.execution(*entry.ExecutionID) == nil {
+		return notFound("workflow_execution", *entry.ExecutionID)
+	}
+
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	m.logs = append(m.logs, entry)
+	return nil
+}
+
+func (m *MemoryStore) GetExecutionLogs(executionID uuid.UUID) ([]WorkflowLog, error) {
+	defer m.lock()()
+
+	if m.execution(executionID) == nil {
+		return nil, nil
+	}
+
+	var logs []WorkflowLog
+	for _, entry := range m.logs {
+		if entry.ExecutionID != nil && *entry.ExecutionID == executionID {
+			logs = append(logs, entry)
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		if !logs[i].ExecutedAt.Equal(logs[j].ExecutedAt) {
+			return logs[i].ExecutedAt.Before(logs[j].ExecutedAt)
+		}
+		return logs[i].CreatedAt.Before(logs[j].CreatedAt)
+	})
+	return logs, nil
+}
+
+func (m *MemoryStore) GetExecutedNodes(currentNode uuid.UUID) ([]Node, error) {
+	defer m.lock()()
+
+	var until *time.Time
+	for _, entry := range m.logs {
+		if entry.NodeID != nil && *entry.NodeID == currentNode {
+			until = timeRef(entry.ExecutedAt)
+			break
+		}
+	}
+	if until == nil {
+		return nil, nil
+	}
+
+	var logs []WorkflowLog
+	for _, entry := range m.logs {
+		if entry.Status == "success" && entry.NodeID != nil && !entry.ExecutedAt.After(*until) {
+			logs = append(logs, entry)
+		}
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].ExecutedAt.After(logs[j].ExecutedAt)
+	})
+
+	var nodes []Node
+	for _, entry := range logs {
+		if node, ok := m.node(*entry.NodeID); ok {
+			node.Config = nil
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (m *MemoryStore) CountNodeRollbacks(executionID, nodeID uuid.UUID) (int, error) {
+	defer m.lock()()
+
+	if m.execution(executionID) == nil {
+		return 0, nil
+	}
+
+	count := 0
+	for _, entry := range m.logs {
+		if entry.ExecutionID != nil && *entry.ExecutionID == executionID && entry.NodeID != nil && *entry.NodeID == nodeID &&
+			entry.ActionType == ActionTypeRollback {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) CreateExecutionWait(wait ExecutionWait) (uuid.UUID, error) {
+	defer m.lock()()
+
+	if m.tenant != "" && m.execution(wait.ExecutionID) == nil {
+		return uuid.Nil, notFound("workflow_execution", wait.ExecutionID)
+	}
+
+	wait.ID = uuid.New()
+	wait.Status = WaitStatusWaiting
+	wait.Payload = nil
+	wait.CreatedAt = time.Now()
+	wait.ResolvedAt = nil
+	wait.ResumedAt = nil
+	m.waits = append(m.waits, wait)
+	return wait.ID, nil
+}
+
+func (m *MemoryStore) GetPendingWait(executionID uuid.UUID, signalName string) (ExecutionWait, error) {
+	defer m.lock()()
+
+	for _, wait := range m.waits {
+		if wait.ExecutionID == executionID && wait.SignalName == signalName && wait.Status == WaitStatusWaiting && m.execution(executionID) != nil {
+			wait.Payload = cloneJSON(wait.Payload)
+			return wait, nil
+		}
+	}
+	return ExecutionWait{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) ResolveWait(waitID uuid.UUID, status string, payload json.RawMessage) (bool, error) {
+	defer m.lock()()
+
+	for i := range m.waits {
+		wait := &m.waits[i]
+		if wait.ID == waitID && wait.Status == WaitStatusWaiting && m.execution(wait.ExecutionID) != nil {
+			wait.Status = status
+			wait.Payload = cloneJSON(payload)
+			wait.ResolvedAt = timeRef(time.Now())
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CancelExecutionWaits(executionID uuid.UUID) error {
+	defer m.lock()()
+
+	for i := range m.waits {
+		wait := &m.waits[i]
+		if wait.ExecutionID == executionID && wait.Status == WaitStatusWaiting && m.execution(executionID) != nil {
+			wait.Status = WaitStatusCancelled
+			wait.ResolvedAt = timeRef(time.Now())
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ClaimExpiredWaits(now time.Time, limit int) ([]ExecutionWait, error) {
+	defer m.lock()()
+
+	var expired []*ExecutionWait
+	for i := range m.waits {
+		wait := &m.waits[i]
+		if wait.Status == WaitStatusWaiting && wait.TimeoutAt != nil && !wait.TimeoutAt.After(now) && m.execution(wait.ExecutionID) != nil {
+			expired = append(expired, wait)
+		}
+	}
+	sort.SliceStable(expired, func(i, j int) bool {
+		return expired[i].TimeoutAt.Before(*expired[j].TimeoutAt)
+	})
+
+	var waits []ExecutionWait
+	for _, wait := range expired {
+		if len(waits) == limit {
+			break
+		}
+		wait.Status = WaitStatusTimedOut
+		wait.ResolvedAt = timeRef(time.Now())
+		waits = append(waits, *wait)
+	}
+	return waits, nil
+}
+
+func (m *MemoryStore) ClaimWaitResume(waitID uuid.UUID) (bool, error) {
+	defer m.lock()()
+
+	for i := range m.waits {
+		wait := &m.waits[i]
+		if wait.ID == waitID && wait.Status != WaitStatusWaiting && wait.ResumedAt == nil && m.execution(wait.ExecutionID) != nil {
+			wait.ResumedAt = timeRef(time.Now())
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) ListUnresumedWaits(resolvedBefore time.Time, limit int) ([]ExecutionWait, error) {
+	defer m.lock()()
+
+	var waits []ExecutionWait
+	for _, wait := range m.waits {
+		if (wait.Status == WaitStatusSignaled || wait.Status == WaitStatusTimedOut) && wait.ResumedAt == nil && !wait.ResolvedAt.After(resolvedBefore) && m.parked(wait.ExecutionID) {
+			wait.Payload = cloneJSON(wait.Payload)
+			waits = append(waits, wait)
+		}
+	}
+	sort.SliceStable(waits, func(i, j int) bool {
+		return waits[i].ResolvedAt.Before(*waits[j].ResolvedAt)
+	})
+	if len(waits) > limit {
+		waits = waits[:limit]
+	}
+	return waits, nil
+}
+
+// parked tells whether an execution is still running or waiting
+func (m *MemoryStore) parked(executionID uuid.UUID) bool {
+	execution := m.execution(executionID)
+	return execution != nil && (execution.Status == "executing" || execution.Status == WaitStatusWaiting)
+}
+
+func (m *MemoryStore) CreateTimer(timer Timer) (uuid.UUID, error) {
+	defer m.lock()()
+
+	if m.tenant != "" && m.execution(timer.ExecutionID) == nil {
+		return uuid.Nil, notFound("workflow_execution", timer.ExecutionID)
+	}
+
+	timer.ID = uuid.New()
+	timer.Status = TimerStatusPending
+	timer.CreatedAt = time.Now()
+	timer.ResolvedAt = nil
+	timer.ResumedAt = nil
+	m.timers = append(m.timers, timer)
+	return timer.ID, nil
+}
+
+func (m *MemoryStore) GetTimer(timerID uuid.UUID) (Timer, error) {
+	defer m.lock()()
+
+	for _, timer := range m.timers {
+		if timer.ID == timerID && m.execution(timer.ExecutionID) != nil {
+			return timer, nil
+		}
+	}
+	return Timer{}, notFound("timer", timerID)
+}
+
+func (m *MemoryStore) ListTimers(executionID uuid.UUID, status string) ([]Timer, error) {
+	defer m.lock()()
+
+	timers := []Timer{}
+	for _, timer := range m.timers {
+		if timer.Status == status && (executionID == uuid.Nil || timer.ExecutionID == executionID) && m.execution(timer.ExecutionID) != nil {
+			timers = append(timers, timer)
+		}
+	}
+	sort.SliceStable(timers, func(i, j int) bool {
+		return timers[i].FireAt.Before(timers[j].FireAt)
+	})
+	return timers, nil
+}
+
+func (m *MemoryStore) ResolveTimer(timerID uuid.UUID, status string) (bool, error) {
+	defer m.lock()()
+
+	for i := range m.timers {
+		timer := &m.timers[i]
+		if timer.ID == timerID && timer.Status == TimerStatusPending && m.execution(timer.ExecutionID) != nil {
+			timer.Status = status
+			timer.ResolvedAt = timeRef(time.Now())
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) CancelExecutionTimers(executionID uuid.UUID) error {
+	defer m.lock()()
+
+	for i := range m.timers {
+		timer := &m.timers[i]
+		if timer.ExecutionID == executionID && timer.Status == TimerStatusPending && m.execution(executionID) != nil {
+			timer.Status = TimerStatusCancelled
+			timer.ResolvedAt = timeRef(time.Now())
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ClaimDueTimers(now time.Time, limit int) ([]Timer, error) {
+	defer m.lock()()
+
+	var due []*Timer
+	for i := range m.timers {
+		timer := &m.timers[i]
+		if timer.Status == TimerStatusPending && !timer.FireAt.After(now) && m.execution(timer.ExecutionID) != nil {
+			due = append(due, timer)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].FireAt.Before(due[j].FireAt)
+	})
+
+	var timers []Timer
+	for _, timer := range due {
+		if len(timers) == limit {
+			break
+		}
+		timer.Status = TimerStatusFired
+		timer.ResolvedAt = timeRef(time.Now())
+		timers = append(timers, *timer)
+	}
+	return timers, nil
+}
+
+func (m *MemoryStore) ClaimTimerResume(timerID uuid.UUID) (bool, error) {
+	defer m.lock()()
+
+	for i := range m.timers {
+		timer := &m.timers[i]
+		if timer.ID == timerID && timer.Status == TimerStatusFired && timer.ResumedAt == nil && m.execution(timer.ExecutionID) != nil {
+			timer.ResumedAt = timeRef(time.Now())
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) ListUnresumedTimers(resolvedBefore time.Time, limit int) ([]Timer, error) {
+	defer m.lock()()
+
+	var timers []Timer
+	for _, timer := range m.timers {
+		if timer.Status == TimerStatusFired && timer.ResumedAt == nil && !timer.ResolvedAt.After(resolvedBefore) && m.parked(timer.ExecutionID) {
+			timers = append(timers, timer)
+		}
+	}
+	sort.SliceStable(timers, func(i, j int) bool {
+		return timers[i].ResolvedAt.Before(*timers[j].ResolvedAt)
+	})
+	if len(timers) > limit {
+		timers = timers[:limit]
+	}
+	return timers, nil
+}
+
+func (m *MemoryStore) CreateSchedule(schedule Schedule) (uuid.UUID, error) {
+	defer m.lock()()
+
+	wf := m.workflow(schedule.WorkflowID)
+	if wf == nil {
+		return uuid.Nil, ErrWorkflowNotFound
+	}
+
+	schedule.ID = uuid.New()
+	schedule.TenantID = wf.TenantID
+	schedule.CreatedAt = timeRef(time.Now())
+	schedule.UpdatedAt, schedule.DeletedAt, schedule.LastRunAt = nil, nil, nil
+	m.schedules = append(m.schedules, schedule)
+	return schedule.ID, nil
+}
+
+func (m *MemoryStore) GetSchedule(scheduleID uuid.UUID) (Schedule, error) {
+	defer m.lock()()
+
+	if schedule := m.schedule(scheduleID); schedule != nil {
+		return *schedule, nil
+	}
+	return Schedule{}, notFound("schedule", scheduleID)
+}
+
+// schedule looks up a schedule of the tenant of the store that was not deleted; m.mu must be held
+func (m *MemoryStore) schedule(scheduleID uuid.UUID) *Schedule {
+	for i := range m.schedules {
+		if m.schedules[i].ID == scheduleID && m.schedules[i].DeletedAt == nil && m.visible(m.schedules[i].TenantID) {
+			return &m.schedules[i]
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ListSchedules(workflowID uuid.UUID) ([]Schedule, error) {
+	defer m.lock()()
+
+	schedules := []Schedule{}
+	for _, schedule := range m.schedules {
+		if schedule.DeletedAt == nil && (workflowID == uuid.Nil || schedule.WorkflowID == workflowID) && m.visible(schedule.TenantID) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules, nil
+}
+
+func (m *MemoryStore) UpdateSchedule(schedule Schedule) error {
+	defer m.lock()()
+
+	existing := m.schedule(schedule.ID)
+	if existing == nil {
+		return notFound("schedule", schedule.ID)
+	}
+
+	existing.CronExpression, existing.IntervalSeconds, existing.Timezone = schedule.CronExpression, schedule.IntervalSeconds, schedule.Timezone
+	existing.PayloadTemplate, existing.ReferenceTemplate = schedule.PayloadTemplate, schedule.ReferenceTemplate
+	existing.MisfirePolicy, existing.Enabled, existing.NextRunAt = schedule.MisfirePolicy, schedule.Enabled, schedule.NextRunAt
+	existing.UpdatedAt = timeRef(time.Now())
+	return nil
+}
+
+func (m *MemoryStore) DeleteSchedule(scheduleID uuid.UUID) error {
+	defer m.lock()()
+
+	existing := m.schedule(scheduleID)
+	if existing == nil {
+		return notFound("schedule", scheduleID)
+	}
+
+	existing.Enabled = false
+	existing.DeletedAt = timeRef(time.Now())
+	return nil
+}
+
+func (m *MemoryStore) GetDueSchedules(now time.Time) ([]Schedule, error) {
+	defer m.lock()()
+
+	var schedules []Schedule
+	for _, schedule := range m.schedules {
+		if schedule.Enabled && schedule.DeletedAt == nil && schedule.NextRunAt != nil && !schedule.NextRunAt.After(now) && m.visible(schedule.TenantID) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	sort.SliceStable(schedules, func(i, j int) bool {
+		return schedules[i].NextRunAt.Before(*schedules[j].NextRunAt)
+	})
+	return schedules, nil
+}
+
+func (m *MemoryStore) ClaimScheduleTick(scheduleID uuid.UUID, expectedNextRunAt, nextRunAt time.Time, lastRunAt *time.Time) (bool, error) {
+	defer m.lock()()
+
+	schedule := m.schedule(scheduleID)
+	if schedule == nil || !schedule.Enabled || schedule.NextRunAt == nil || !schedule.NextRunAt.Equal(expectedNextRunAt) {
+		return false, nil
+	}
+
+	schedule.NextRunAt = timeRef(nextRunAt)
+	if lastRunAt != nil {
+		schedule.LastRunAt = timeRef(*lastRunAt)
+	}
+	schedule.UpdatedAt = timeRef(time.Now())
+	return true, nil
+}
+
+func (m *MemoryStore) ListTargetPolicies() ([]TargetPolicy, error) {
+	defer m.lock()()
+
+	policies := append([]TargetPolicy{}, m.policies...)
+	sort.Slice(policies, func(i, j int) bool {
+		return policyKey(policies[i].Scope, policies[i].Target) < policyKey(policies[j].Scope, policies[j].Target)
+	})
+	return policies, nil
+}
+
+func (m *MemoryStore) SaveTargetPolicy(p TargetPolicy) (uuid.UUID, error) {
+	defer m.lock()()
+
+	for i := range m.policies {
+		existing := &m.policies[i]
+		if existing.Scope == p.Scope && existing.Target == p.Target {
+			p.ID, p.CreatedAt, p.UpdatedAt = existing.ID, existing.CreatedAt, timeRef(time.Now())
+			*existing = p
+			return p.ID, nil
+		}
+	}
+
+	p.ID = uuid.New()
+	p.CreatedAt, p.UpdatedAt = timeRef(time.Now()), nil
+	m.policies = append(m.policies, p)
+	return p.ID, nil
+}
+
+func (m *MemoryStore) DeleteTargetPolicy(policyID uuid.UUID) error {
+	defer m.lock()()
+
+	for i, policy := range m.policies {
+		if policy.ID == policyID {
+			m.policies = append(m.policies[:i], m.policies[i+1:]...)
+			return nil
+		}
+	}
+	return notFound("target policy", policyID)
+}
+
+func (m *MemoryStore) InsertOutboxEvent(event OutboxEvent) error {
+	defer m.lock()()
+
+	if m.tenant != "" && event.ExecutionID != nil && m.execution(*event.ExecutionID) == nil {
+		return notFound("workflow_execution", *event.ExecutionID)
+	}
+
+	event.ID = uuid.New()
+	event.Payload = cloneJSON(event.Payload)
+	event.CreatedAt = time.Now()
+	m.outbox = append(m.outbox, memoryOutboxEvent{OutboxEvent: event})
+	return nil
+}
+
+func (m *MemoryStore) ListPendingOutboxEvents(limit int) ([]OutboxEvent, error) {
+	defer m.lock()()
+
+	var events []OutboxEvent
+	for _, event := range m.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.PublishedAt == nil && m.visibleOutboxEvent(event) {
+			event.Payload = cloneJSON(event.Payload)
+			events = append(events, event.OutboxEvent)
+		}
+	}
+	return events, nil
+}
+
+// outboxEvent looks up an outbox event of the tenant of the store; m.mu must be held
+func (m *MemoryStore) outboxEvent(eventID uuid.UUID) *memoryOutboxEvent {
+	for i := range m.outbox {
+		if m.outbox[i].ID == eventID && m.visibleOutboxEvent(m.outbox[i]) {
+			return &m.outbox[i]
+		}
+	}
+	return nil
+}
+
+// visibleOutboxEvent tells whether the execution of an event can be seen through the store,
+// events without an execution only being seen by a store not confined to a tenant
+func (m *MemoryStore) visibleOutboxEvent(event memoryOutboxEvent) bool {
+	if event.ExecutionID == nil {
+		return m.tenant == ""
+	}
+	return m.execution(*event.ExecutionID) != nil
+}
+
+func (m *MemoryStore) ClaimOutboxEvents(now, claimedUntil time.Time, limit int) ([]OutboxEvent, error) {
+	defer m.lock()()
+
+	var events []OutboxEvent
+	blocked := map[uuid.UUID]bool{}
+	for i := range m.outbox {
+		event := &m.outbox[i]
+		if event.PublishedAt != nil || !m.visibleOutboxEvent(*event) {
+			continue
+		}
+		if event.ExecutionID != nil && blocked[*event.ExecutionID] {
+			continue
+		}
+		if event.ExecutionID != nil && event.Attempts > 0 {
+			blocked[*event.ExecutionID] = true
+		}
+
+		due := event.NextAttemptAt == nil || !event.NextAttemptAt.After(now)
+		claimed := event.claimedUntil != nil && event.claimedUntil.After(now)
+		if !due || claimed || len(events) == limit {
+			continue
+		}
+		event.claimedUntil = timeRef(claimedUntil)
+
+		claim := event.OutboxEvent
+		claim.Payload = cloneJSON(claim.Payload)
+		events = append(events, claim)
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) MarkOutboxEventPublished(eventID uuid.UUID) error {
+	defer m.lock()()
+
+	if event := m.outboxEvent(eventID); event != nil {
+		event.PublishedAt = timeRef(time.Now())
+		event.claimedUntil = nil
+	}
+	return nil
+}
+
+func (m *MemoryStore) MarkOutboxEventFailed(eventID uuid.UUID, publishErr error, nextAttemptAt time.Time) error {
+	defer m.lock()()
+
+	if event := m.outboxEvent(eventID); event != nil {
+		event.Attempts++
+		event.LastError = stringPtr(publishErr.Error())
+		event.NextAttemptAt = timeRef(nextAttemptAt)
+		event.claimedUntil = nil
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateAPIKey(key APIKey) (uuid.UUID, error) {
+	defer m.lock()()
+
+	for _, existing := range m.apiKeys {
+		if existing.Prefix == key.Prefix {
+			return uuid.Nil, fmt.Errorf("api key prefix %s already exists", key.Prefix)
+		}
+	}
+
+	key.ID, key.TenantID = uuid.New(), m.owner()
+	key.CreatedAt, key.RevokedAt = timeRef(time.Now()), nil
+	m.apiKeys = append(m.apiKeys, key)
+	return key.ID, nil
+}
+
+func (m *MemoryStore) GetAPIKeyByPrefix(prefix string) (APIKey, error) {
+	defer m.lock()()
+
+	for _, key := range m.apiKeys {
+		if key.Prefix == prefix {
+			return key, nil
+		}
+	}
+	return APIKey{}, notFound("api key", prefix)
+}
+
+func (m *MemoryStore) ListAPIKeys() ([]APIKey, error) {
+	defer m.lock()()
+
+	keys := []APIKey{}
+	for _, key := range m.apiKeys {
+		if m.visible(key.TenantID) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MemoryStore) RevokeAPIKey(keyID uuid.UUID) error {
+	defer m.lock()()
+
+	for i := range m.apiKeys {
+		if m.apiKeys[i].ID == keyID && m.apiKeys[i].RevokedAt == nil && m.visible(m.apiKeys[i].TenantID) {
+			m.apiKeys[i].RevokedAt = timeRef(time.Now())
+			return nil
+		}
+	}
+	return notFound("api key", keyID)
+}
+
+func (m *MemoryStore) CreateWorkflowGrant(grant WorkflowGrant) (uuid.UUID, error) {
+	defer m.lock()()
+
+	if m.tenant != "" && m.workflow(grant.WorkflowID) == nil {
+		return uuid.Nil, notFound("workflow", grant.WorkflowID)
+	}
+
+	for _, existing := range m.grants {
+		if existing.WorkflowID == grant.WorkflowID && existing.Subject == grant.Subject && existing.Role == grant.Role {
+			return existing.ID, nil
+		}
+	}
+
+	grant.ID = uuid.New()
+	grant.CreatedAt = timeRef(time.Now())
+	m.grants = append(m.grants, grant)
+	return grant.ID, nil
+}
+
+func (m *MemoryStore) ListWorkflowGrants(workflowID uuid.UUID) ([]WorkflowGrant, error) {
+	defer m.lock()()
+
+	grants := []WorkflowGrant{}
+	for _, grant := range m.grants {
+		if (workflowID == uuid.Nil || grant.WorkflowID == workflowID) && m.workflow(grant.WorkflowID) != nil {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+func (m *MemoryStore) GetGrantedRoles(workflowID uuid.UUID, subject string) ([]string, error) {
+	defer m.lock()()
+
+	var granted []string
+	for _, grant := range m.grants {
+		if grant.WorkflowID == workflowID && grant.Subject == subject && m.workflow(grant.WorkflowID) != nil {
+			granted = append(granted, grant.Role)
+		}
+	}
+	return granted, nil
+}
+
+func (m *MemoryStore) DeleteWorkflowGrant(grantID uuid.UUID) error {
+	defer m.lock()()
+
+	for i, grant := range m.grants {
+		if grant.ID == grantID && m.workflow(grant.WorkflowID) != nil {
+			m.grants = append(m.grants[:i], m.grants[i+1:]...)
+			return nil
+		}
+	}
+	return notFound("grant", grantID)
+}
+
+func (m *MemoryStore) InsertAuditEntry(entry AuditEntry) error {
+	defer m.lock()()
+
+	entry.ID = uuid.New()
+	if entry.TenantID == "" {
+		entry.TenantID = m.owner()
+	}
+	entry.CreatedAt = timeRef(time.Now())
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+func (m *MemoryStore) ListAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	defer m.lock()()
+
+	entries, skipped := []AuditEntry{}, 0
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < filter.limit(); i-- {
+		entry := m.audit[i]
+		if !m.visible(entry.TenantID) || !filter.matches(entry) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		entry.Changes = diffAuditStates(entry.Before, entry.After)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) GetTenantQuota(tenantID string) (TenantQuota, error) {
+	defer m.lock()()
+
+	for _, quota := range m.quotas {
+		if quota.TenantID == tenantID {
+			return quota, nil
+		}
+	}
+	return TenantQuota{TenantID: tenantID}, nil
+}
+
+func (m *MemoryStore) SaveTenantQuota(quota TenantQuota) error {
+	defer m.lock()()
+
+	quota.UpdatedAt = timeRef(time.Now())
+	for i := range m.quotas {
+		if m.quotas[i].TenantID == quota.TenantID {
+			m.quotas[i] = quota
+			return nil
+		}
+	}
+	m.quotas = append(m.quotas, quota)
+	return nil
+}
+
+func (m *MemoryStore) ListTenantQuotas() ([]TenantQuota, error) {
+	defer m.lock()()
+
+	quotas := append([]TenantQuota{}, m.quotas...)
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].TenantID < quotas[j].TenantID
+	})
+	return quotas, nil
+}
+
+func (m *MemoryStore) GetTenantUsage(tenantID string) (TenantUsage, error) {
+	defer m.lock()()
+
+	var usage TenantUsage
+	for _, execution := range m.executions {
+		if execution.TenantID != tenantID {
+			continue
+		}
+		for _, status := range activeExecutionStatuses {
+			if execution.Status == status {
+				usage.ActiveExecutions++
+			}
+		}
+	}
+	for _, wf := range m.workflows {
+		if wf.TenantID == tenantID && wf.DeletedAt == nil {
+			usage.Workflows++
+		}
+	}
+	for _, node := range m.nodes {
+		if m.owners[node.ID] == tenantID && node.DeletedAt == nil {
+			usage.Nodes++
+		}
+	}
+	for _, task := range m.tasks {
+		if m.owners[task.ID] == tenantID && task.DeletedAt == nil {
+			usage.Tasks++
+		}
+	}
+	return usage, nil
+}
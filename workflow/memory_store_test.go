@@ -0,0 +1,114 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreExecution(t *testing.T) {
+	testStoreExecution(t, NewMemoryStore())
+}
+
+func TestMemoryStoreClaims(t *testing.T) {
+	testStoreClaims(t, NewMemoryStore())
+}
+
+// testStoreExecution runs a workflow through a task, a wait and a rollback on store
+func testStoreExecution(t *testing.T, store Store) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	chargeID, _ := store.CreateNode("Charge", NodeTypeTask, "", nil)
+	approvalID, _ := store.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved"}`))
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, chargeID, ""))
+	assert.NoError(t, store.AddRelationship(chargeID, approvalID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, endID, ""))
+
+	taskID, _ := store.CreateTask("Charge card", "http", http.MethodPost, server.URL, `{}`, 0)
+	assert.NoError(t, store.AddTaskToNode(chargeID, taskID, 1))
+
+	workflowID, _ := store.CreateWorkflow("checkout", "", startID, false)
+	executionID, created, err := store.CreateWorkflowExecution(workflowID, "order-1", json.RawMessage(`{"order":1}`), "key-1")
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	replayID, created, err := store.CreateWorkflowExecution(workflowID, "order-1", nil, "key-1")
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, executionID, replayID)
+
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, executionID))
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, WaitStatusWaiting, execution.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	assert.ErrorIs(t, SignalWorkflowExecution(ctx, store, executionID, "rejected", nil), ErrNoPendingWait)
+	assert.NoError(t, SignalWorkflowExecution(ctx, store, executionID, "approved", json.RawMessage(`{"approved_by":"ops"}`)))
+
+	execution, _ = store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "completed", execution.Status)
+	assert.JSONEq(t, `{"order":1,"approved_by":"ops"}`, string(execution.Data))
+
+	assert.NoError(t, RollbackExecution(ctx, store, executionID))
+	execution, _ = store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "rolled_back", execution.Status)
+
+	rollbacks, _ := store.CountNodeRollbacks(executionID, chargeID)
+	assert.Equal(t, 1, rollbacks)
+
+	_, _, err = store.CreateWorkflowExecution(uuid.New(), "order-2", nil, "")
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+}
+
+// testStoreClaims checks that due timers and schedule ticks are claimed once on store
+func testStoreClaims(t *testing.T, store Store) {
+	now := time.Now()
+	workflowID := newLinearWorkflow(t, store)
+	executionID, _, _ := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	nodeID, _ := store.CreateNode("Delay", NodeTypeTimer, "", nil)
+
+	dueID, _ := store.CreateTimer(Timer{ExecutionID: executionID, NodeID: nodeID, FireAt: now.Add(-time.Minute)})
+	store.CreateTimer(Timer{ExecutionID: executionID, NodeID: nodeID, FireAt: now.Add(time.Hour)})
+
+	timers, err := store.ClaimDueTimers(now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, timers, 1)
+	assert.Equal(t, dueID, timers[0].ID)
+
+	timers, _ = store.ClaimDueTimers(now, 10)
+	assert.Empty(t, timers)
+
+	parked, _ := store.CountParkedNodes(executionID)
+	assert.Equal(t, 1, parked)
+
+	resolved, _ := store.ResolveTimer(dueID, TimerStatusCancelled)
+	assert.False(t, resolved)
+
+	nextRunAt := now.Add(-time.Second)
+	scheduleID, _ := store.CreateSchedule(Schedule{WorkflowID: workflowID, IntervalSeconds: 60, Enabled: true, NextRunAt: &nextRunAt})
+
+	claimed, _ := store.ClaimScheduleTick(scheduleID, nextRunAt, now.Add(time.Minute), &nextRunAt)
+	assert.True(t, claimed)
+	claimed, _ = store.ClaimScheduleTick(scheduleID, nextRunAt, now.Add(time.Minute), &nextRunAt)
+	assert.False(t, claimed)
+
+	assert.NoError(t, store.DeleteSchedule(scheduleID))
+	_, err = store.GetSchedule(scheduleID)
+	assert.Error(t, err)
+}
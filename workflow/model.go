@@ -2,26 +2,29 @@ package workflow
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Node struct {
-	ID            uuid.UUID  `db:"id" json:"id"`                                             // Unique identifier for the node
-	Title         string     `db:"title" json:"title"`                                       // Title of the node
-	Type          string     `db:"type" json:"type"`                                         // Type of the node
-	Description   string     `db:"description,omitempty" json:"description,omitempty"`       // Description of the node
-	RollbackScope string     `db:"rollback_scope,omitempty" json:"rollback_scope,omitempty"` // Rollback scope for the node: start, finish, or immediate_ancestor
-	CreatedAt     *time.Time `db:"created_at,omitempty" json:"created_at,omitempty"`         // Creation timestamp
-	UpdatedAt     *time.Time `db:"updated_at,omitempty" json:"updated_at,omitempty"`         // Update timestamp
-	DeletedAt     *time.Time `db:"deleted_at,omitempty" json:"deleted_at,omitempty"`         // Deletion timestamp
+	ID            uuid.UUID       `db:"id" json:"id"`                                             // Unique identifier for the node
+	Title         string          `db:"title" json:"title"`                                       // Title of the node
+	Type          string          `db:"type" json:"type"`                                         // Type of the node
+	Description   string          `db:"description,omitempty" json:"description,omitempty"`       // Description of the node
+	RollbackScope string          `db:"rollback_scope,omitempty" json:"rollback_scope,omitempty"` // Rollback scope for the node: start, finish, or immediate_ancestor
+	Config        json.RawMessage `db:"config,omitempty" json:"config,omitempty"`                 // Type specific settings, e.g. the signal a Wait node waits for
+	CreatedAt     *time.Time      `db:"created_at,omitempty" json:"created_at,omitempty"`         // Creation timestamp
+	UpdatedAt     *time.Time      `db:"updated_at,omitempty" json:"updated_at,omitempty"`         // Update timestamp
+	DeletedAt     *time.Time      `db:"deleted_at,omitempty" json:"deleted_at,omitempty"`         // Deletion timestamp
 }
 
 type NodeClosure struct {
-	Ancestor   uuid.UUID `db:"ancestor" json:"ancestor"`     // Unique identifier for the ancestor node
-	Descendant uuid.UUID `db:"descendant" json:"descendant"` // Unique identifier for the descendant node
-	Depth      int       `db:"depth" json:"depth"`           // Depth of the descendant node
+	Ancestor   uuid.UUID `db:"ancestor" json:"ancestor"`             // Unique identifier for the ancestor node
+	Descendant uuid.UUID `db:"descendant" json:"descendant"`         // Unique identifier for the descendant node
+	Depth      int       `db:"depth" json:"depth"`                   // Depth of the descendant node
+	Condition  string    `db:"condition" json:"condition,omitempty"` // Condition label of a direct relationship, shown on graph edges
 }
 
 type NodeTask struct {
@@ -52,19 +55,24 @@ type Task struct {
 }
 
 type Workflow struct {
-	ID             uuid.UUID  `db:"id" json:"id"`                             // Unique identifier for the workflow
-	Name           string     `db:"name" json:"name"`                         // Name of the workflow
-	StartingNodeID uuid.UUID  `db:"starting_node_id" json:"starting_node_id"` // ID of the related node
-	Description    string     `db:"description" json:"description"`           // Description of the workflow
-	CreatedAt      *time.Time `db:"created_at" json:"created_at"`             // Creation timestamp
-	UpdatedAt      *time.Time `db:"updated_at" json:"updated_at"`             // Update timestamp
-	DeletedAt      *time.Time `db:"deleted_at" json:"deleted_at"`             // Deletion timestamp
+	ID              uuid.UUID  `db:"id" json:"id"`                             // Unique identifier for the workflow
+	Name            string     `db:"name" json:"name"`                         // Name of the workflow
+	StartingNodeID  uuid.UUID  `db:"starting_node_id" json:"starting_node_id"` // ID of the related node
+	Description     string     `db:"description" json:"description"`           // Description of the workflow
+	Version         int        `db:"version" json:"version"`                   // Version of the workflow, incremented for every workflow created with the same name
+	UniqueReference bool       `db:"unique_reference" json:"unique_reference"` // Allow only one execution per reference number
+	TenantID        string     `db:"tenant_id" json:"tenant_id"`               // Tenant owning the workflow
+	CreatedAt       *time.Time `db:"created_at" json:"created_at"`             // Creation timestamp
+	UpdatedAt       *time.Time `db:"updated_at" json:"updated_at"`             // Update timestamp
+	DeletedAt       *time.Time `db:"deleted_at" json:"deleted_at"`             // Deletion timestamp
 }
 type WorkflowLog struct {
 	ID           uuid.UUID      `db:"id" json:"id"`                       // Unique identifier for the log entry, referenced by the caller (can be order, provisioning etc)
 	WorkflowID   uuid.UUID      `db:"workflow_id" json:"workflow_id"`     // ID of the workflow this log belongs to
+	ExecutionID  *uuid.UUID     `db:"execution_id" json:"execution_id"`   // ID of the workflow execution this log belongs to
 	NodeID       *uuid.UUID     `db:"node_id" json:"node_id"`             // ID of the node being logged
 	TaskID       *uuid.UUID     `db:"task_id" json:"task_id"`             // ID of the task being logged
+	Attempt      *int           `db:"attempt" json:"attempt"`             // Attempt number of the task being logged, starting at 1
 	Status       string         `db:"status" json:"status"`               // Status of the node execution (e.g., "success", "failed", "rollback")
 	Message      string         `db:"message" json:"message"`             // Message of the node execution
 	ExecutedAt   time.Time      `db:"executed_at" json:"executed_at"`     // Timestamp of when the node was executed
@@ -80,17 +88,24 @@ type WorkflowLog struct {
 }
 
 type WorkflowExecution struct {
-	ID                  uuid.UUID    `db:"id" json:"id"`                                         // Unique identifier for the workflow execution
-	WorkflowID          uuid.UUID    `db:"workflow_id" json:"workflow_id"`                       // ID of the workflow this log belongs to
-	LastExecutedNodeID  *uuid.UUID   `db:"last_executed_node_id" json:"last_executed_node_id"`   // ID of the node being logged
-	LastExecutedTaskID  *uuid.UUID   `db:"last_executed_task_id" json:"last_executed_task_id"`   // ID of the task being logged
-	ReferenceNumber     string       `db:"reference_number" json:"reference_number"`             // Reference number of the node execution, could be order id, provisioning id, etc
-	Status              string       `db:"status" json:"status"`                                 // Status of the node execution (e.g., "success", "failed", "rollback")
-	Message             string       `db:"message" json:"message"`                               // Message of the node execution
-	LastNodeExecutedAt  time.Time    `db:"last_node_executed_at" json:"last_node_executed_at"`   // Timestamp of when the node was executed
-	LastNodeCompletedAt sql.NullTime `db:"last_node_completed_at" json:"last_node_completed_at"` // Timestamp of when the node execution was completed
-	LastTaskExecutedAt  time.Time    `db:"last_task_executed_at" json:"last_task_executed_at"`   // Timestamp of when the task was executed
-	LastTaskCompletedAt sql.NullTime `db:"last_task_completed_at" json:"last_task_completed_at"` // Timestamp of when the task execution was completed
-	CreatedAt           time.Time    `db:"created_at" json:"created_at"`                         // Log creation timestamp
-	UpdatedAt           time.Time    `db:"updated_at" json:"updated_at"`                         // Log update timestamp
+	ID                  uuid.UUID       `db:"id" json:"id"`                                         // Unique identifier for the workflow execution
+	WorkflowID          uuid.UUID       `db:"workflow_id" json:"workflow_id"`                       // ID of the workflow this log belongs to
+	LastExecutedNodeID  *uuid.UUID      `db:"last_executed_node_id" json:"last_executed_node_id"`   // ID of the node being logged
+	LastExecutedTaskID  *uuid.UUID      `db:"last_executed_task_id" json:"last_executed_task_id"`   // ID of the task being logged
+	ReferenceNumber     string          `db:"reference_number" json:"reference_number"`             // Reference number of the node execution, could be order id, provisioning id, etc
+	Status              string          `db:"status" json:"status"`                                 // Status of the node execution (e.g., "success", "failed", "rollback")
+	Message             string          `db:"message" json:"message"`                               // Message of the node execution
+	LastNodeExecutedAt  time.Time       `db:"last_node_executed_at" json:"last_node_executed_at"`   // Timestamp of when the node was executed
+	LastNodeCompletedAt sql.NullTime    `db:"last_node_completed_at" json:"last_node_completed_at"` // Timestamp of when the node execution was completed
+	LastTaskExecutedAt  time.Time       `db:"last_task_executed_at" json:"last_task_executed_at"`   // Timestamp of when the task was executed
+	LastTaskCompletedAt sql.NullTime    `db:"last_task_completed_at" json:"last_task_completed_at"` // Timestamp of when the task execution was completed
+	Data                json.RawMessage `db:"data" json:"data,omitempty"`                           // Input data of the execution (JSON object)
+	ParentExecutionID   *uuid.UUID      `db:"parent_execution_id" json:"parent_execution_id"`       // Execution that started this one from a SubWorkflow node, if any
+	ParentNodeID        *uuid.UUID      `db:"parent_node_id" json:"parent_node_id"`                 // SubWorkflow node of the parent execution
+	IdempotencyKey      string          `db:"idempotency_key" json:"idempotency_key,omitempty"`     // Idempotency-Key of the request that created the execution
+	Version             int             `db:"version" json:"version"`                               // Bumped on every status change, guards against concurrent workers
+	TenantID            string          `db:"tenant_id" json:"tenant_id"`                           // Tenant owning the execution, the tenant of its workflow
+	LeaseExpiresAt      *time.Time      `db:"lease_expires_at" json:"lease_expires_at,omitempty"`   // Until when the worker running the execution holds it, renewed while it runs
+	CreatedAt           time.Time       `db:"created_at" json:"created_at"`                         // Log creation timestamp
+	UpdatedAt           time.Time       `db:"updated_at" json:"updated_at"`                         // Log update timestamp
 }
@@ -1,10 +1,19 @@
 package workflow
 
 const (
-	NodeTypeStart    = "Start"
-	NodeTypeTask     = "Task"
-	NodeTypeDecision = "Decision"
-	NodeTypeFork     = "Fork"
-	NodeTypeJoin     = "Join"
-	NodeTypeEnd      = "End"
+	NodeTypeStart       = "Start"
+	NodeTypeTask        = "Task"
+	NodeTypeDecision    = "Decision"
+	NodeTypeFork        = "Fork"
+	NodeTypeJoin        = "Join"
+	NodeTypeEnd         = "End"
+	NodeTypeWait        = "Wait"
+	NodeTypeTimer       = "Timer"
+	NodeTypeSubWorkflow = "SubWorkflow"
 )
+
+// NodeTypes lists every node type the engine knows how to run
+var NodeTypes = []string{
+	NodeTypeStart, NodeTypeTask, NodeTypeDecision, NodeTypeFork, NodeTypeJoin,
+	NodeTypeEnd, NodeTypeWait, NodeTypeTimer, NodeTypeSubWorkflow,
+}
@@ -0,0 +1,358 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the events written to the outbox
+const (
+	EventExecutionStarted    = "execution.started"
+	EventExecutionWaiting    = "execution.waiting"
+	EventExecutionCompleted  = "execution.completed"
+	EventExecutionFailed     = "execution.failed"
+	EventExecutionCancelled  = "execution.cancelled"
+	EventExecutionRolledBack = "execution.rolled_back"
+)
+
+// executionEvents maps execution statuses to the event emitted when entering them
+var executionEvents = map[string]string{
+	"executing":       EventExecutionStarted,
+	WaitStatusWaiting: EventExecutionWaiting,
+	"completed":       EventExecutionCompleted,
+	"error":           EventExecutionFailed,
+	"cancelled":       EventExecutionCancelled,
+	"rolled_back":     EventExecutionRolledBack,
+}
+
+type OutboxEvent struct {
+	ID            uuid.UUID       `db:"id" json:"id"`                           // Unique identifier for the event, stable across publish attempts
+	EventType     string          `db:"event_type" json:"event_type"`           // e.g. execution.completed
+	ExecutionID   *uuid.UUID      `db:"execution_id" json:"execution_id"`       // Execution the event is about
+	Payload       json.RawMessage `db:"payload" json:"payload"`                 // Event body (JSON object)
+	Attempts      int             `db:"attempts" json:"attempts"`               // Failed publish attempts so far
+	LastError     *string         `db:"last_error" json:"last_error"`           // Error of the last failed publish attempt
+	NextAttemptAt *time.Time      `db:"next_attempt_at" json:"next_attempt_at"` // When a failed event is published again
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`           // When the event was written
+	PublishedAt   *time.Time      `db:"published_at" json:"published_at"`       // When the event was published
+}
+
+// ExecutionEventPayload is the payload of execution events
+type ExecutionEventPayload struct {
+	ExecutionID       uuid.UUID  `json:"execution_id"`
+	WorkflowID        uuid.UUID  `json:"workflow_id"`
+	ReferenceNumber   string     `json:"reference_number"`
+	Status            string     `json:"status"`
+	Version           int        `json:"version"`
+	ParentExecutionID *uuid.UUID `json:"parent_execution_id,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	OccurredAt        time.Time  `json:"occurred_at"`
+}
+
+// Publisher delivers outbox events. Delivery is at least once, so consumers should
+// de-duplicate on the event ID.
+type Publisher interface {
+	Publish(ctx context.Context, event OutboxEvent) error
+}
+
+// LogPublisher publishes events to the log
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(ctx context.Context, event OutboxEvent) error {
+	Logger(ctx).Info("event published", "event_id", event.ID, "event_type", event.EventType, "payload", string(event.Payload))
+	return nil
+}
+
+// WebhookPublisher POSTs every event as JSON to a URL
+type WebhookPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p WebhookPublisher) Publish(ctx context.Context, event OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID.String())
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// emitExecutionEvent writes the event for an execution entering status to the outbox.
+// Call it with the Store of the transaction making the transition.
+func emitExecutionEvent(store Store, execution WorkflowExecution, status string, execErr error) error {
+	eventType, ok := executionEvents[status]
+	if !ok {
+		return nil
+	}
+
+	payload := ExecutionEventPayload{
+		ExecutionID: execution.ID, WorkflowID: execution.WorkflowID, ReferenceNumber: execution.ReferenceNumber, Status: status,
+		Version: execution.Version, ParentExecutionID: execution.ParentExecutionID, OccurredAt: time.Now(),
+	}
+	if execErr != nil {
+		payload.Error = execErr.Error()
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	executionID := execution.ID
+	err = store.InsertOutboxEvent(OutboxEvent{EventType: eventType, ExecutionID: &executionID, Payload: data})
+	if err != nil {
+		return fmt.Errorf("failed to write %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// OutboxRelay publishes the events written to the outbox, oldest first
+type OutboxRelay struct {
+	Store     Store
+	Publisher Publisher
+	Interval  time.Duration // How often pending events are checked
+	BatchSize int           // Most events published in one relay
+	ClaimFor  time.Duration // How long claimed events are left to this relay before another one publishes them
+}
+
+// Backoff of failed events, doubling from the first to the last
+const (
+	outboxFirstBackoff = time.Second
+	outboxMaxBackoff   = 5 * time.Minute
+)
+
+func NewOutboxRelay(store Store, publisher Publisher, interval time.Duration) *OutboxRelay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &OutboxRelay{Store: store, Publisher: publisher, Interval: interval, BatchSize: 100, ClaimFor: 5 * time.Minute}
+}
+
+// Run relays until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	logger := Logger(ctx)
+	logger.Info("outbox relay started", "interval", r.Interval.String())
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Relay(ctx); err != nil {
+			logger.Error("outbox relay failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay publishes a batch of pending events and returns how many were published
+func (r *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	return r.relay(ctx, time.Now())
+}
+
+// relay claims the events due at now and publishes them outside any transaction, so a slow
+// publisher holds no locks. A failed event is retried after a backoff without holding up the
+// events of other executions; the later events of its own execution wait for it, so every
+// execution's events keep their order.
+func (r *OutboxRelay) relay(ctx context.Context, now time.Time) (int, error) {
+	events, err := r.Store.ClaimOutboxEvents(now, now.Add(r.ClaimFor), r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	failed := map[uuid.UUID]bool{}
+	for _, event := range events {
+		if event.ExecutionID != nil && failed[*event.ExecutionID] {
+			continue
+		}
+
+		if publishErr := r.Publisher.Publish(ctx, event); publishErr != nil {
+			backoff := outboxBackoff(event.Attempts)
+			Logger(ctx).Warn("failed to publish event", "event_id", event.ID, "event_type", event.EventType, "attempts", event.Attempts+1, "retry_in", backoff.String(), "error", publishErr)
+			if event.ExecutionID != nil {
+				failed[*event.ExecutionID] = true
+			}
+			err := r.Store.WithTx(func(tx Store) error {
+				if err := tx.MarkOutboxEventFailed(event.ID, publishErr, now.Add(backoff)); err != nil {
+					return err
+				}
+				return auditPublish(tx, event, publishErr)
+			})
+			if err != nil {
+				return published, err
+			}
+			continue
+		}
+
+		err := r.Store.WithTx(func(tx Store) error {
+			if err := tx.MarkOutboxEventPublished(event.ID); err != nil {
+				return err
+			}
+			return auditPublish(tx, event, nil)
+		})
+		if err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// auditPublish records an attempt to publish event, which failed with publishErr unless nil
+func auditPublish(tx Store, event OutboxEvent, publishErr error) error {
+	entry := AuditEntry{Action: "event publish", ResourceType: "outbox_event", ResourceID: event.ID.String(), After: AuditState(event)}
+	if publishErr != nil {
+		entry.Outcome, entry.Reason = AuditOutcomeFailed, publishErr.Error()
+	}
+
+	executionID := uuid.Nil
+	if event.ExecutionID != nil {
+		executionID = *event.ExecutionID
+	}
+	return auditSystem(tx, executionID, entry)
+}
+
+// outboxBackoff is how long an event that failed attempts times before is left alone
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxFirstBackoff
+	for i := 0; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outboxMaxBackoff)
+}
+
+func (s *PostgresStore) InsertOutboxEvent(event OutboxEvent) error {
+	if event.ExecutionID != nil {
+		if err := s.checkTenant("workflow_executions", *event.ExecutionID); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO outbox_events (event_type, execution_id, payload, created_at)
+		VALUES ($1, $2, $3, NOW())
+	`, event.EventType, event.ExecutionID, string(event.Payload))
+	return err
+}
+
+const outboxColumns = `id, event_type, execution_id, payload, attempts, last_error, next_attempt_at, created_at, published_at`
+
+func scanOutboxEvents(rows *sql.Rows) ([]OutboxEvent, error) {
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		var payload []byte
+		err := rows.Scan(&event.ID, &event.EventType, &event.ExecutionID, &payload, &event.Attempts, &event.LastError, &event.NextAttemptAt, &event.CreatedAt, &event.PublishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning outbox event row: %w", err)
+		}
+		event.Payload = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (s *PostgresStore) ListPendingOutboxEvents(limit int) ([]OutboxEvent, error) {
+	rows, err := s.db.Query(`
+		SELECT `+outboxColumns+`
+		FROM outbox_events
+		WHERE published_at IS NULL AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $2) OR $2 = '')
+		ORDER BY created_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching outbox events: %w", err)
+	}
+	return scanOutboxEvents(rows)
+}
+
+// ClaimOutboxEvents claims up to limit unpublished events due at now until claimedUntil and
+// returns them oldest first. Events behind a failed event of their execution are skipped.
+func (s *PostgresStore) ClaimOutboxEvents(now, claimedUntil time.Time, limit int) ([]OutboxEvent, error) {
+	rows, err := s.db.Query(`
+		UPDATE outbox_events
+		SET claimed_until = $1
+		WHERE id IN (
+			SELECT pending.id FROM outbox_events pending
+			WHERE pending.published_at IS NULL
+				AND (pending.execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+				AND (pending.next_attempt_at IS NULL OR pending.next_attempt_at <= $2)
+				AND (pending.claimed_until IS NULL OR pending.claimed_until <= $2)
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox_events failed
+					WHERE failed.execution_id = pending.execution_id AND failed.published_at IS NULL
+						AND failed.attempts > 0 AND failed.created_at < pending.created_at
+				)
+			ORDER BY pending.created_at ASC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+outboxColumns+`
+	`, claimedUntil, now, limit, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming outbox events: %w", err)
+	}
+
+	events, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	return events, nil
+}
+
+func (s *PostgresStore) MarkOutboxEventPublished(eventID uuid.UUID) error {
+	_, err := s.db.Exec(`
+		UPDATE outbox_events
+		SET published_at = NOW(), claimed_until = NULL
+		WHERE id = $1 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $2) OR $2 = '')
+	`, eventID, s.tenant)
+	return err
+}
+
+func (s *PostgresStore) MarkOutboxEventFailed(eventID uuid.UUID, publishErr error, nextAttemptAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE outbox_events
+		SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2, claimed_until = NULL
+		WHERE id = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+	`, publishErr.Error(), nextAttemptAt, eventID, s.tenant)
+	return err
+}
@@ -0,0 +1,185 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	events []OutboxEvent
+	err    error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event OutboxEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func newLinearWorkflow(t *testing.T, store Store) uuid.UUID {
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, endID, ""))
+
+	workflowID, err := store.CreateWorkflow("linear", "", startID, false)
+	assert.NoError(t, err)
+	return workflowID
+}
+
+func TestExecutionVersionConflict(t *testing.T) {
+	store := NewMemoryStore()
+	executionID, _, _ := store.CreateWorkflowExecution(newLinearWorkflow(t, store), "order-1", nil, "")
+
+	assert.NoError(t, store.UpdateWorkflowExecutionStatus(executionID, 0, "executing"))
+	assert.ErrorIs(t, store.UpdateWorkflowExecutionStatus(executionID, 0, "completed"), ErrExecutionConflict)
+
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "executing", execution.Status)
+	assert.Equal(t, 1, execution.Version)
+
+	// Another worker holds the execution, so it is not run twice
+	err := ExecuteWorkflowByExecutionID(context.Background(), store, executionID)
+	assert.ErrorIs(t, err, ErrExecutionConflict)
+}
+
+func TestMemoryStoreWithTx(t *testing.T) {
+	store := NewMemoryStore()
+	executionID, _, _ := store.CreateWorkflowExecution(newLinearWorkflow(t, store), "order-1", nil, "")
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+
+	failed := errors.New("log failed")
+	err := store.WithTx(func(tx Store) error {
+		if err := transitionExecution(tx, &execution, "executing", nil, nil); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	// Neither the status nor the event survive the rollback
+	stored, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "pending", stored.Status)
+	assert.Equal(t, 0, stored.Version)
+	events, _ := store.ListPendingOutboxEvents(10)
+	assert.Empty(t, events)
+}
+
+func TestMemoryStoreOutboxRelay(t *testing.T) {
+	testStoreOutboxRelay(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreOutboxRelayRetries(t *testing.T) {
+	testStoreOutboxRelay(t, newSQLiteStore(t))
+}
+
+// failingPublisher fails the events of one execution and records the others
+type failingPublisher struct {
+	recordingPublisher
+	executionID uuid.UUID
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, event OutboxEvent) error {
+	if event.ExecutionID != nil && *event.ExecutionID == p.executionID {
+		return errors.New("broker unavailable")
+	}
+	return p.recordingPublisher.Publish(ctx, event)
+}
+
+// testStoreOutboxRelay checks that a failing event is retried after a backoff, holding up the
+// later events of its execution but not those of other executions
+func testStoreOutboxRelay(t *testing.T, store Store) {
+	ctx := context.Background()
+	workflowID := newLinearWorkflow(t, store)
+	executionID, _, _ := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, executionID))
+	otherID, _, _ := store.CreateWorkflowExecution(workflowID, "order-2", nil, "")
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, otherID))
+
+	now := time.Now()
+	failing := &failingPublisher{executionID: executionID}
+	relay := NewOutboxRelay(store, failing, 0)
+	published, err := relay.relay(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+	if assert.Len(t, failing.events, 2) {
+		assert.Equal(t, otherID, *failing.events[0].ExecutionID)
+		assert.Equal(t, otherID, *failing.events[1].ExecutionID)
+	}
+
+	events, _ := store.ListPendingOutboxEvents(10)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, 1, events[0].Attempts)
+		assert.Equal(t, "broker unavailable", *events[0].LastError)
+		if assert.NotNil(t, events[0].NextAttemptAt) {
+			assert.WithinDuration(t, now.Add(outboxFirstBackoff), *events[0].NextAttemptAt, time.Second)
+		}
+		assert.Equal(t, 0, events[1].Attempts)
+	}
+
+	entries, _ := store.ListAuditEntries(AuditFilter{Actor: AuditActorSystem, Action: "event publish", Outcome: AuditOutcomeFailed})
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, events[0].ID.String(), entries[0].ResourceID)
+		assert.Equal(t, "broker unavailable", entries[0].Reason)
+	}
+
+	// The failed event is left alone until its backoff passed
+	publisher := &recordingPublisher{}
+	relay = NewOutboxRelay(store, publisher, 0)
+	published, _ = relay.relay(ctx, now)
+	assert.Equal(t, 0, published)
+
+	// Then the events of the execution are published in order, the later one once the
+	// failed one went out
+	later := now.Add(relay.ClaimFor)
+	published, err = relay.relay(ctx, later)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+	published, _ = relay.relay(ctx, later)
+	assert.Equal(t, 1, published)
+
+	if assert.Len(t, publisher.events, 2) {
+		assert.Equal(t, EventExecutionStarted, publisher.events[0].EventType)
+		assert.Equal(t, EventExecutionCompleted, publisher.events[1].EventType)
+
+		var payload ExecutionEventPayload
+		assert.NoError(t, json.Unmarshal(publisher.events[1].Payload, &payload))
+		assert.Equal(t, executionID, payload.ExecutionID)
+		assert.Equal(t, "completed", payload.Status)
+		assert.Equal(t, 2, payload.Version)
+	}
+
+	// Published events are not published again
+	published, _ = relay.relay(ctx, later)
+	assert.Equal(t, 0, published)
+}
+
+func TestOutboxClaims(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	executionID, _, _ := store.CreateWorkflowExecution(newLinearWorkflow(t, store), "order-1", nil, "")
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, executionID))
+
+	// Claimed events are left to their relay until the claim lapses
+	now := time.Now()
+	events, err := store.ClaimOutboxEvents(now, now.Add(time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	events, _ = store.ClaimOutboxEvents(now, now.Add(time.Minute), 10)
+	assert.Empty(t, events)
+	events, _ = store.ClaimOutboxEvents(now.Add(time.Minute), now.Add(2*time.Minute), 10)
+	assert.Len(t, events, 2)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, outboxBackoff(0))
+	assert.Equal(t, 8*time.Second, outboxBackoff(3))
+	assert.Equal(t, outboxMaxBackoff, outboxBackoff(100))
+}
@@ -0,0 +1,230 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Poller resumes parked executions whose wait timed out or whose timer is due, and those
+// whose resume after a signal, timeout or timer was lost
+type Poller struct {
+	Store       Store
+	Interval    time.Duration // How often expired waits are checked
+	BatchSize   int           // Most waits and timers claimed in one poll
+	ResumeAfter time.Duration // How long a resolved wait or fired timer stays unresumed before it is resumed again
+
+	running  sync.WaitGroup
+	mu       sync.Mutex
+	resuming map[uuid.UUID]bool // Waits and timers whose resume is running
+}
+
+func NewPoller(store Store, interval time.Duration) *Poller {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Poller{Store: store, Interval: interval, BatchSize: 100, ResumeAfter: 2 * resumeConflictTimeout}
+}
+
+// Run polls until ctx is cancelled, then waits for the executions it resumed
+func (p *Poller) Run(ctx context.Context) {
+	logger := Logger(ctx)
+	logger.Info("poller started", "interval", p.Interval.String())
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx, time.Now()); err != nil {
+			logger.Error("poll failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			p.running.Wait()
+			logger.Info("poller stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll resumes every execution whose wait timed out or whose timer is due at now, and
+// those whose resume was lost after their wait or timer was claimed
+func (p *Poller) Poll(ctx context.Context, now time.Time) error {
+	if err := p.expireWaits(ctx, now); err != nil {
+		return err
+	}
+	if err := p.fireTimers(ctx, now); err != nil {
+		return err
+	}
+	return p.resumeLost(ctx, now)
+}
+
+// resume continues an execution after a wait or timer in the background, unless a resume of
+// it is already running. The claim marks the wait or timer resumed together with the
+// execution, so a resume that fails or never runs is retried by resumeLost.
+func (p *Poller) resume(ctx context.Context, parkedID, executionID, nodeID uuid.UUID, timedOut bool, claim resumeClaim, failure string) {
+	p.mu.Lock()
+	if p.resuming[parkedID] {
+		p.mu.Unlock()
+		return
+	}
+	if p.resuming == nil {
+		p.resuming = map[uuid.UUID]bool{}
+	}
+	p.resuming[parkedID] = true
+	p.mu.Unlock()
+
+	p.running.Add(1)
+	go func() {
+		defer p.running.Done()
+		defer func() {
+			p.mu.Lock()
+			delete(p.resuming, parkedID)
+			p.mu.Unlock()
+		}()
+
+		if err := resumeExecution(context.WithoutCancel(ctx), p.Store, executionID, nodeID, timedOut, claim); err != nil {
+			Logger(ctx).Error(failure, "error", err)
+		}
+	}()
+}
+
+// resumeLost resumes the executions parked on a wait or timer claimed before
+// now - ResumeAfter that they never continued from, e.g. because the replica resuming them
+// stopped
+func (p *Poller) resumeLost(ctx context.Context, now time.Time) error {
+	resolvedBefore := now.Add(-p.ResumeAfter)
+
+	waits, err := p.Store.ListUnresumedWaits(resolvedBefore, p.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, wait := range waits {
+		ctx, logger := withLogFields(ctx, "execution_id", wait.ExecutionID, "node_id", wait.NodeID)
+		logger.Warn("resuming execution wait again", "wait_id", wait.ID, "status", wait.Status, "resolved_at", wait.ResolvedAt)
+		timedOut := wait.Status == WaitStatusTimedOut
+		claim := auditResume(claimWait(wait.ID), wait.ExecutionID, fmt.Sprintf("resume after wait %s was lost", wait.ID))
+		p.resume(ctx, wait.ID, wait.ExecutionID, wait.NodeID, timedOut, claim, "resumed execution failed")
+	}
+
+	timers, err := p.Store.ListUnresumedTimers(resolvedBefore, p.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, timer := range timers {
+		ctx, logger := withLogFields(ctx, "execution_id", timer.ExecutionID, "node_id", timer.NodeID)
+		logger.Warn("resuming fired timer again", "timer_id", timer.ID, "resolved_at", timer.ResolvedAt)
+		claim := auditResume(claimTimer(timer.ID), timer.ExecutionID, fmt.Sprintf("resume after timer %s was lost", timer.ID))
+		p.resume(ctx, timer.ID, timer.ExecutionID, timer.NodeID, false, claim, "resumed execution failed")
+	}
+	return nil
+}
+
+func (p *Poller) expireWaits(ctx context.Context, now time.Time) error {
+	// A claimed wait is only resolved together with its log row and audit entry
+	var waits []ExecutionWait
+	err := p.Store.WithTx(func(tx Store) error {
+		var err error
+		waits, err = tx.ClaimExpiredWaits(now, p.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, wait := range waits {
+			err := logParkedNodeResolved(tx, wait.ExecutionID, wait.NodeID, wait.CreatedAt, WaitStatusTimedOut, "Timed out waiting for signal \""+wait.SignalName+"\"")
+			if err != nil {
+				return err
+			}
+
+			before := wait
+			before.Status, before.ResolvedAt = WaitStatusWaiting, nil
+			err = auditSystem(tx, wait.ExecutionID, AuditEntry{
+				Action: "wait timeout", ResourceType: "wait", ResourceID: wait.ID.String(),
+				Reason: fmt.Sprintf("signal %q not received by %s", wait.SignalName, wait.TimeoutAt.Format(time.RFC3339)),
+				Before: AuditState(before), After: AuditState(wait),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, wait := range waits {
+		ctx, logger := withLogFields(ctx, "execution_id", wait.ExecutionID, "node_id", wait.NodeID)
+		logger.Info("execution wait timed out", "signal", wait.SignalName)
+		claim := auditResume(claimWait(wait.ID), wait.ExecutionID, fmt.Sprintf("wait %s timed out", wait.ID))
+		p.resume(ctx, wait.ID, wait.ExecutionID, wait.NodeID, true, claim, "timed out execution failed")
+	}
+
+	return nil
+}
+
+func (p *Poller) fireTimers(ctx context.Context, now time.Time) error {
+	// A claimed timer is only fired together with its log row and audit entry
+	var timers []Timer
+	err := p.Store.WithTx(func(tx Store) error {
+		var err error
+		timers, err = tx.ClaimDueTimers(now, p.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, timer := range timers {
+			if err := logParkedNodeResolved(tx, timer.ExecutionID, timer.NodeID, timer.CreatedAt, "completed", "Timer fired"); err != nil {
+				return err
+			}
+
+			before := timer
+			before.Status, before.ResolvedAt = TimerStatusPending, nil
+			err := auditSystem(tx, timer.ExecutionID, AuditEntry{
+				Action: "timer fire", ResourceType: "timer", ResourceID: timer.ID.String(),
+				Reason: "due at " + timer.FireAt.Format(time.RFC3339), Before: AuditState(before), After: AuditState(timer),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, timer := range timers {
+		ctx, logger := withLogFields(ctx, "execution_id", timer.ExecutionID, "node_id", timer.NodeID)
+		logger.Info("timer fired", "timer_id", timer.ID, "fire_at", timer.FireAt)
+		claim := auditResume(claimTimer(timer.ID), timer.ExecutionID, fmt.Sprintf("timer %s fired", timer.ID))
+		p.resume(ctx, timer.ID, timer.ExecutionID, timer.NodeID, false, claim, "resumed execution failed")
+	}
+
+	return nil
+}
+
+func claimWait(waitID uuid.UUID) resumeClaim {
+	return func(tx Store) (bool, error) { return tx.ClaimWaitResume(waitID) }
+}
+
+func claimTimer(timerID uuid.UUID) resumeClaim {
+	return func(tx Store) (bool, error) { return tx.ClaimTimerResume(timerID) }
+}
+
+// auditResume records the resume of an execution by the poller with the claim of the resume
+func auditResume(claim resumeClaim, executionID uuid.UUID, reason string) resumeClaim {
+	return func(tx Store) (bool, error) {
+		claimed, err := claim(tx)
+		if err != nil || !claimed {
+			return claimed, err
+		}
+		entry := AuditEntry{Action: "execution resume", ResourceType: "execution", ResourceID: executionID.String(), Reason: reason}
+		return true, auditSystem(tx, executionID, entry)
+	}
+}
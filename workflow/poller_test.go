@@ -0,0 +1,142 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorePollerResumesLost(t *testing.T) {
+	testStorePollerResumesLost(t, NewMemoryStore())
+}
+
+func TestSQLiteStorePollerResumesLost(t *testing.T) {
+	testStorePollerResumesLost(t, newSQLiteStore(t))
+}
+
+// testStorePollerResumesLost claims a timer and a wait without resuming their executions, as
+// a replica stopping right after the claim would, and checks the poller resumes them later
+func testStorePollerResumesLost(t *testing.T, store Store) {
+	ctx := context.Background()
+	later := time.Now().Add(2 * time.Hour)
+
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	delayID, _ := store.CreateNode("Delay", NodeTypeTimer, "", json.RawMessage(`{"duration":"1h"}`))
+	approvalID, _ := store.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved","timeout":"1h"}`))
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	expiredID, _ := store.CreateNode("Expired", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, delayID, ""))
+	assert.NoError(t, store.AddRelationship(delayID, approvalID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, endID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, expiredID, ConditionTimeout))
+	workflowID, _ := store.CreateWorkflow("approval", "", startID, false)
+
+	executionID, _, err := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, executionID))
+
+	poller := NewPoller(store, time.Second)
+	poll := func() {
+		assert.NoError(t, poller.Poll(ctx, later))
+		poller.running.Wait()
+	}
+
+	// The timer is claimed, but its execution is never resumed
+	timers, err := store.ClaimDueTimers(later, 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, timers, 1) {
+		return
+	}
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, WaitStatusWaiting, execution.Status)
+
+	// Until ResumeAfter passed the resume may still be running elsewhere
+	assert.NoError(t, poller.Poll(ctx, time.Now()))
+	poller.running.Wait()
+	unresumed, _ := store.ListUnresumedTimers(time.Now(), 10)
+	assert.Len(t, unresumed, 1)
+
+	poll()
+	unresumed, _ = store.ListUnresumedTimers(later, 10)
+	assert.Empty(t, unresumed)
+	claimed, _ := store.ClaimTimerResume(timers[0].ID)
+	assert.False(t, claimed, "the resume was claimed with the execution")
+
+	// The execution continued to the wait node, whose timeout is claimed but lost the same way
+	waits, err := store.ClaimExpiredWaits(later, 10)
+	assert.NoError(t, err)
+	if !assert.Len(t, waits, 1) {
+		return
+	}
+
+	poll()
+	execution, _ = store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "completed", execution.Status)
+	unresumedWaits, _ := store.ListUnresumedWaits(later, 10)
+	assert.Empty(t, unresumedWaits)
+
+	logs, _ := store.GetExecutionLogs(executionID)
+	var ended []string
+	for _, entry := range logs {
+		if entry.NodeID != nil && (*entry.NodeID == endID || *entry.NodeID == expiredID) && entry.ActionType == ActionTypeNode {
+			ended = append(ended, entry.NodeID.String())
+		}
+	}
+	assert.Equal(t, []string{expiredID.String()}, ended, "only the timeout branch ran, once")
+}
+
+func TestMemoryStoreSignalDuringLease(t *testing.T) {
+	testStoreSignalDuringLease(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreSignalDuringLease(t *testing.T) {
+	testStoreSignalDuringLease(t, newSQLiteStore(t))
+}
+
+// testStoreSignalDuringLease signals an execution held by a worker that stopped, and checks
+// the signal is resumed once the worker's lease lapsed instead of being lost
+func testStoreSignalDuringLease(t *testing.T, store Store) {
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	approvalID, _ := store.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved"}`))
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, approvalID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, endID, ""))
+	workflowID, _ := store.CreateWorkflow("approval", "", startID, false)
+
+	executionID, _, err := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, ExecuteWorkflowByExecutionID(context.Background(), store, executionID))
+
+	// A worker holds the execution, e.g. running another branch
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.NoError(t, store.UpdateWorkflowExecutionStatus(executionID, execution.Version, "executing"))
+	assert.NoError(t, store.RenewExecutionLease(executionID, time.Now().Add(time.Hour)))
+
+	// The signal is recorded, but its resume gives up while the lease holds
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = SignalWorkflowExecution(ctx, store, executionID, "approved", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	later := time.Now().Add(time.Hour)
+	waits, _ := store.ListUnresumedWaits(later, 10)
+	assert.Len(t, waits, 1)
+
+	// The worker stopped, so once its lease lapsed the poller takes the execution over
+	assert.NoError(t, store.RenewExecutionLease(executionID, time.Now().Add(-time.Second)))
+	poller := NewPoller(store, time.Second)
+	assert.NoError(t, poller.Poll(context.Background(), later))
+	poller.running.Wait()
+
+	execution, _ = store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "completed", execution.Status)
+	waits, _ = store.ListUnresumedWaits(later, 10)
+	assert.Empty(t, waits)
+}
@@ -2,18 +2,25 @@ package workflow
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-func CreateNode(db *sql.DB, title, nodeType string, description string) (uuid.UUID, error) {
+// ErrWorkflowNotFound is returned when creating an execution of a workflow that does not exist
+var ErrWorkflowNotFound = newError("workflow not found", ErrNotFound)
+
+func (s *PostgresStore) CreateNode(title, nodeType string, description string, config json.RawMessage) (uuid.UUID, error) {
 	var id uuid.UUID
-	err := db.QueryRow(`
-		INSERT INTO nodes (title, type, description, created_at)
-		VALUES ($1, $2, $3, NOW())
+	err := s.db.QueryRow(`
+		INSERT INTO nodes (title, type, description, config, tenant_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
 		RETURNING id
-	`, title, nodeType, description).Scan(&id)
+	`, title, nodeType, description, nullableJSON(config), s.owner()).Scan(&id)
 
 	if err != nil {
 		return uuid.Nil, err
@@ -22,36 +29,66 @@ func CreateNode(db *sql.DB, title, nodeType string, description string) (uuid.UU
 	return id, nil
 }
 
-func GetNode(db *sql.DB, nodeID uuid.UUID) (Node, error) {
+func (s *PostgresStore) GetNode(nodeID uuid.UUID) (Node, error) {
 	node := Node{}
-	err := db.QueryRow(`
-		SELECT id::uuid, title, type, description, created_at, updated_at, deleted_at
+	var config []byte
+	err := s.db.QueryRow(`
+		SELECT id::uuid, title, type, description, created_at, updated_at, deleted_at, config
 		FROM nodes
-		WHERE id = $1
-	`, nodeID).Scan(&node.ID, &node.Title, &node.Type, &node.Description, &node.CreatedAt, &node.UpdatedAt, &node.DeletedAt)
-	return node, err
+		WHERE id = $1 AND (tenant_id = $2 OR $2 = '')
+	`, nodeID, s.tenant).Scan(&node.ID, &node.Title, &node.Type, &node.Description, &node.CreatedAt, &node.UpdatedAt, &node.DeletedAt, &config)
+	node.Config = config
+	return node, noRows(err, "node", nodeID)
 }
 
-func AddRelationship(db *sql.DB, ancestor, descendant uuid.UUID) error {
-	_, err := db.Exec(`
-		INSERT INTO node_closure (ancestor, descendant, depth)
-		SELECT ancestor, $1::uuid, depth + 1
+func (s *PostgresStore) AddRelationship(ancestor, descendant uuid.UUID, condition string) error {
+	if err := ValidateBranchCondition(condition); err != nil {
+		return err
+	}
+	if err := s.checkTenant("nodes", ancestor, descendant); err != nil {
+		return err
+	}
+
+	// The ancestor must not be reachable from the descendant through direct relationships
+	var cycle bool
+	err := s.db.QueryRow(`
+		WITH RECURSIVE reachable(node) AS (
+			SELECT $1::uuid
+			UNION
+			SELECT nc.descendant FROM node_closure nc JOIN reachable r ON nc.ancestor = r.node WHERE nc.depth = 0
+		)
+		SELECT EXISTS (SELECT 1 FROM reachable WHERE node = $2::uuid)
+	`, descendant, ancestor).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check relationship for cycles: %w", err)
+	}
+	if cycle {
+		return cycleError(ancestor, descendant)
+	}
+
+	// A node reached along several paths, such as a Join, keeps the shortest one; a direct
+	// relationship always wins over an indirect one
+	_, err = s.db.Exec(`
+		INSERT INTO node_closure (ancestor, descendant, depth, condition)
+		SELECT ancestor, $1::uuid, depth + 1, NULL
 		FROM node_closure
 		WHERE descendant = $2::uuid
 		UNION ALL
-		SELECT $3::uuid, $4::uuid, 0
-	`, descendant, ancestor, ancestor, descendant)
+		SELECT $3::uuid, $4::uuid, 0, NULLIF($5, '') WHERE true
+		ON CONFLICT (ancestor, descendant) DO UPDATE SET depth = excluded.depth, condition = excluded.condition
+		WHERE excluded.depth < node_closure.depth
+	`, descendant, ancestor, ancestor, descendant, condition)
 
 	return err
 }
 
-func GetDescendants(db *sql.DB, ancestor uuid.UUID) ([]Node, error) {
-	rows, err := db.Query(`
+func (s *PostgresStore) GetDescendants(ancestor uuid.UUID) ([]Node, error) {
+	rows, err := s.db.Query(`
 		SELECT n.id, n.title, n.type, n.description, n.created_at, n.updated_at, n.deleted_at
 		FROM nodes n
 		JOIN node_closure nc ON nc.descendant = n.id
-		WHERE nc.ancestor = $1
-	`, ancestor)
+		WHERE nc.ancestor = $1 AND (n.tenant_id = $2 OR $2 = '')
+	`, ancestor, s.tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -69,14 +106,37 @@ func GetDescendants(db *sql.DB, ancestor uuid.UUID) ([]Node, error) {
 	return descendants, nil
 }
 
-func GetImmediateAncestor(db *sql.DB, nodeID uuid.UUID) (Node, error) {
-	row := db.QueryRow(`
+// GetChildren returns the direct relationships (depth 0) leaving a node
+func (s *PostgresStore) GetChildren(nodeID uuid.UUID) ([]NodeClosure, error) {
+	rows, err := s.db.Query(`
+		SELECT ancestor, descendant, depth, COALESCE(condition, '')
+		FROM node_closure
+		WHERE ancestor = $1 AND depth = 0 AND (ancestor IN (SELECT id FROM nodes WHERE tenant_id = $2) OR $2 = '')
+	`, nodeID, s.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []NodeClosure
+	for rows.Next() {
+		var edge NodeClosure
+		if err := rows.Scan(&edge.Ancestor, &edge.Descendant, &edge.Depth, &edge.Condition); err != nil {
+			return nil, err
+		}
+		children = append(children, edge)
+	}
+	return children, rows.Err()
+}
+
+func (s *PostgresStore) GetImmediateAncestor(nodeID uuid.UUID) (Node, error) {
+	row := s.db.QueryRow(`
 		SELECT n.id, n.title, n.type, n.description, n.created_at, n.updated_at, n.deleted_at
 		FROM node_closure nc
 		JOIN nodes n ON nc.ancestor = n.id
-		WHERE nc.descendant = $1::uuid AND nc.depth = 1
+		WHERE nc.descendant = $1::uuid AND nc.depth = 1 AND (n.tenant_id = $2 OR $2 = '')
 		LIMIT 1
-	`, nodeID)
+	`, nodeID, s.tenant)
 
 	node := Node{}
 	err := row.Scan(&node.ID, &node.Title, &node.Type, &node.Description, &node.CreatedAt, &node.UpdatedAt, &node.DeletedAt)
@@ -86,23 +146,29 @@ func GetImmediateAncestor(db *sql.DB, nodeID uuid.UUID) (Node, error) {
 	return node, nil
 }
 
-func AllParentsCompleted(db *sql.DB, nodeID uuid.UUID) bool {
+func (s *PostgresStore) AllParentsCompleted(executionID, nodeID uuid.UUID) (bool, error) {
 	var count int
-	err := db.QueryRow(`
-        SELECT COUNT(*)
-        FROM node_closure nc
-        JOIN nodes n ON nc.ancestor = n.id
-        WHERE nc.descendant = $1::uuid AND n.type != 'End'
-    `, nodeID).Scan(&count)
-
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM node_closure nc
+		WHERE nc.descendant = $2::uuid AND nc.depth = 0
+			AND (nc.ancestor IN (SELECT id FROM nodes WHERE tenant_id = $4) OR $4 = '')
+			AND NOT EXISTS (
+				SELECT 1 FROM workflow_logs wl
+				WHERE wl.execution_id = $1 AND wl.node_id = nc.ancestor AND wl.action_type = $3 AND wl.status = 'completed'
+			)
+	`, executionID, nodeID, ActionTypeNode, s.tenant).Scan(&count)
 	if err != nil {
-		return false
+		return false, fmt.Errorf("error checking parents of node %s: %w", nodeID, err)
 	}
-	return count == 0
+	return count == 0, nil
 }
 
-func ValidateClosure(db *sql.DB, startNode uuid.UUID) error {
-	rows := db.QueryRow("SELECT COUNT(1) FROM node_closure WHERE ancestor = descendant AND ancestor = $1::uuid", startNode)
+func (s *PostgresStore) ValidateClosure(startNode uuid.UUID) error {
+	rows := s.db.QueryRow(`
+		SELECT COUNT(1) FROM node_closure
+		WHERE ancestor = descendant AND ancestor = $1::uuid AND (ancestor IN (SELECT id FROM nodes WHERE tenant_id = $2) OR $2 = '')
+	`, startNode, s.tenant)
 
 	var count int
 	err := rows.Scan(&count)
@@ -115,31 +181,70 @@ func ValidateClosure(db *sql.DB, startNode uuid.UUID) error {
 	return nil
 }
 
-func CreateWorkflow(db *sql.DB, name, description string, startingNodeID uuid.UUID) (uuid.UUID, error) {
-	var id uuid.UUID
-	err := db.QueryRow(`
-		INSERT INTO workflows (name, description, starting_node_id, created_at)
-		VALUES ($1, $2, $3, NOW())
-		RETURNING id
-	`, name, description, startingNodeID).Scan(&id)
-
-	if err != nil {
+func (s *PostgresStore) CreateWorkflow(name, description string, startingNodeID uuid.UUID, uniqueReference bool) (uuid.UUID, error) {
+	if err := s.checkTenant("nodes", startingNodeID); err != nil {
 		return uuid.Nil, err
 	}
 
-	return id, nil
+	// A creation racing another one of the same name takes the same version, conflicts on
+	// idx_workflows_name_version and inserts nothing; it is retried with the next version
+	var id uuid.UUID
+	for attempt := 0; attempt < createWorkflowAttempts; attempt++ {
+		err := s.db.QueryRow(`
+			INSERT INTO workflows (name, description, starting_node_id, version, unique_reference, tenant_id, created_at)
+			VALUES ($1, $2, $3, COALESCE((SELECT MAX(version) FROM workflows WHERE name = $1 AND tenant_id = $5), 0) + 1, $4, $5, NOW())
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, name, description, startingNodeID, uniqueReference, s.owner()).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, err
+		}
+	}
+
+	return uuid.Nil, newError(fmt.Sprintf("workflow %s is being created concurrently, retry", name), ErrConflict)
+}
+
+// createWorkflowAttempts bounds how often CreateWorkflow retries after losing a version to a
+// concurrent creation of the same name
+const createWorkflowAttempts = 5
+
+func (s *PostgresStore) GetWorkflow(workflowID uuid.UUID) (Workflow, error) {
+	wf := Workflow{}
+	err := s.db.QueryRow(`
+		SELECT id, name, starting_node_id, COALESCE(description, ''), version, unique_reference, tenant_id, created_at, updated_at, deleted_at
+		FROM workflows
+		WHERE id = $1 AND (tenant_id = $2 OR $2 = '')
+	`, workflowID, s.tenant).Scan(&wf.ID, &wf.Name, &wf.StartingNodeID, &wf.Description, &wf.Version, &wf.UniqueReference, &wf.TenantID, &wf.CreatedAt, &wf.UpdatedAt, &wf.DeletedAt)
+	return wf, noRows(err, "workflow", workflowID)
 }
 
-func GetExecutedNodes(db *sql.DB, currentNode uuid.UUID) ([]Node, error) {
-	rows, err := db.Query(`
+// GetWorkflowVersion returns a version of the workflow with the given name, or its latest version when version is 0.
+// Names are looked up in the tenant of the store, the default tenant when it is not confined to one.
+func (s *PostgresStore) GetWorkflowVersion(name string, version int) (Workflow, error) {
+	wf := Workflow{}
+	err := s.db.QueryRow(`
+		SELECT id, name, starting_node_id, COALESCE(description, ''), version, unique_reference, tenant_id, created_at, updated_at, deleted_at
+		FROM workflows
+		WHERE name = $1 AND ($2 = 0 OR version = $2) AND tenant_id = $3 AND deleted_at IS NULL
+		ORDER BY version DESC
+		LIMIT 1
+	`, name, version, s.owner()).Scan(&wf.ID, &wf.Name, &wf.StartingNodeID, &wf.Description, &wf.Version, &wf.UniqueReference, &wf.TenantID, &wf.CreatedAt, &wf.UpdatedAt, &wf.DeletedAt)
+	return wf, noRows(err, "workflow", name)
+}
+
+func (s *PostgresStore) GetExecutedNodes(currentNode uuid.UUID) ([]Node, error) {
+	rows, err := s.db.Query(`
 		SELECT n.id, n.title, n.type, n.description, n.created_at, n.updated_at, n.deleted_at
 		FROM workflow_logs wl
 		JOIN nodes n ON wl.node_id = n.id
 		WHERE wl.status = 'success' AND wl.executed_at <= (
 			SELECT executed_at FROM workflow_logs WHERE node_id = $1::uuid
-		)
+		) AND (n.tenant_id = $2 OR $2 = '')
 		ORDER BY wl.executed_at DESC
-	`, currentNode)
+	`, currentNode, s.tenant)
 	if err != nil {
 		return nil, err
 	}
@@ -157,25 +262,27 @@ func GetExecutedNodes(db *sql.DB, currentNode uuid.UUID) ([]Node, error) {
 	return nodes, nil
 }
 
-func GetWorkflowNodes(db *sql.DB, workflowID uuid.UUID) ([]Node, error) {
+// GetWorkflowNodes returns the starting node of a workflow and every node reachable from it
+func (s *PostgresStore) GetWorkflowNodes(workflowID uuid.UUID) ([]Node, error) {
 	// Query to fetch all nodes belonging to the specified workflow
 	query := `
-		SELECT
+		SELECT DISTINCT
 			n.id, n.title, n.type, n.description, n.created_at, n.updated_at, n.deleted_at
 		FROM
 			nodes n
 		INNER JOIN
-			workflow_starting_nodes wn ON n.id = wn.starting_node_id
+			workflows w ON w.id = $1 AND (w.tenant_id = $2 OR $2 = '')
 		WHERE
-			wn.workflow_id = $1 AND n.deleted_at IS NULL
+			(n.id = w.starting_node_id OR n.id IN (SELECT descendant FROM node_closure WHERE ancestor = w.starting_node_id))
+			AND n.deleted_at IS NULL
 		ORDER BY
-			wn.created_at ASC;
+			n.created_at ASC;
 	`
 
 	// Execute the query
-	rows, err := db.Query(query, workflowID)
+	rows, err := s.db.Query(query, workflowID, s.tenant)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching nodes for workflow %s: %v", workflowID, err)
+		return nil, fmt.Errorf("error fetching nodes for workflow %s: %w", workflowID, err)
 	}
 	defer rows.Close()
 
@@ -186,7 +293,7 @@ func GetWorkflowNodes(db *sql.DB, workflowID uuid.UUID) ([]Node, error) {
 		var node Node
 		err := rows.Scan(&node.ID, &node.Title, &node.Type, &node.Description, &node.CreatedAt, &node.UpdatedAt, &node.DeletedAt)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning node row: %v", err)
+			return nil, fmt.Errorf("error scanning node row: %w", err)
 		}
 		nodes = append(nodes, node)
 	}
@@ -194,19 +301,102 @@ func GetWorkflowNodes(db *sql.DB, workflowID uuid.UUID) ([]Node, error) {
 	return nodes, nil
 }
 
-func LogWorkflowExecution(db *sql.DB, workflowID, nodeID uuid.UUID, taskID *uuid.UUID, status, message string, httpCode *int, response *string, errorMessage error) error {
+func (s *PostgresStore) LogWorkflowExecution(workflowID, nodeID uuid.UUID, taskID *uuid.UUID, status, message string, httpCode *int, response *string, errorMessage error) error {
+	if err := s.checkTenant("workflows", workflowID); err != nil {
+		return err
+	}
+
 	errorMessageStr := ""
 	if errorMessage != nil {
 		errorMessageStr = errorMessage.Error()
 	}
-	_, err := db.Exec(`
+	_, err := s.db.Exec(`
 		INSERT INTO workflow_logs (workflow_id, node_id, status, message, executed_at, task_id, http_code, response, error)
 		VALUES ($1::uuid, $2::uuid, $3, $4, NOW(), $5, $6, $7, $8)
 	`, workflowID, nodeID, status, message, taskID, httpCode, response, errorMessageStr)
 	return err
 }
 
-func GetStartingNode(db *sql.DB, workflowID uuid.UUID) (Node, error) {
+func (s *PostgresStore) InsertWorkflowLog(entry WorkflowLog) error {
+	if err := s.checkTenant("workflows", entry.WorkflowID); err != nil {
+		return err
+	}
+	if entry.ExecutionID != nil {
+		if err := s.checkTenant("workflow_executions", *entry.ExecutionID); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.db.Exec(`
+		INSERT INTO workflow_logs (workflow_id, execution_id, node_id, task_id, status, message, action_type, attempt, executed_at, completed_at, http_code, response, error)
+		VALUES ($1::uuid, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, entry.WorkflowID, entry.ExecutionID, entry.NodeID, entry.TaskID, entry.Status, entry.Message, entry.ActionType, entry.Attempt,
+		entry.ExecutedAt, entry.CompletedAt, entry.HttpCode, entry.Response, entry.Error)
+	return err
+}
+
+func (s *PostgresStore) GetExecutionLogs(executionID uuid.UUID) ([]WorkflowLog, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			id, workflow_id, execution_id, node_id, task_id, attempt, status, COALESCE(message, ''), executed_at, completed_at,
+			COALESCE(action_type, ''), created_at, http_code, response, error
+		FROM
+			workflow_logs
+		WHERE
+			execution_id = $1 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $2) OR $2 = '')
+		ORDER BY
+			executed_at ASC, created_at ASC
+	`, executionID, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching logs for execution %s: %w", executionID, err)
+	}
+	defer rows.Close()
+
+	var logs []WorkflowLog
+	for rows.Next() {
+		var entry WorkflowLog
+		err := rows.Scan(
+			&entry.ID, &entry.WorkflowID, &entry.ExecutionID, &entry.NodeID, &entry.TaskID, &entry.Attempt, &entry.Status, &entry.Message,
+			&entry.ExecutedAt, &entry.CompletedAt, &entry.ActionType, &entry.CreatedAt, &entry.HttpCode, &entry.Response, &entry.Error,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning workflow log row: %w", err)
+		}
+		logs = append(logs, entry)
+	}
+
+	return logs, rows.Err()
+}
+
+// GetWorkflowEdges returns the direct (depth 0) relationships between the nodes reachable from the workflow's starting node
+func (s *PostgresStore) GetWorkflowEdges(workflowID uuid.UUID) ([]NodeClosure, error) {
+	rows, err := s.db.Query(`
+		SELECT nc.ancestor, nc.descendant, nc.depth, COALESCE(nc.condition, '')
+		FROM node_closure nc
+		JOIN workflows w ON w.id = $1 AND (w.tenant_id = $2 OR $2 = '')
+		WHERE nc.depth = 0 AND (
+			nc.ancestor = w.starting_node_id
+			OR nc.ancestor IN (SELECT descendant FROM node_closure WHERE ancestor = w.starting_node_id)
+		)
+	`, workflowID, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching edges for workflow %s: %w", workflowID, err)
+	}
+	defer rows.Close()
+
+	var edges []NodeClosure
+	for rows.Next() {
+		var edge NodeClosure
+		if err := rows.Scan(&edge.Ancestor, &edge.Descendant, &edge.Depth, &edge.Condition); err != nil {
+			return nil, fmt.Errorf("error scanning node closure row: %w", err)
+		}
+		edges = append(edges, edge)
+	}
+
+	return edges, rows.Err()
+}
+
+func (s *PostgresStore) GetStartingNode(workflowID uuid.UUID) (Node, error) {
 	// Query to fetch the starting node of the workflow
 	query := `
 		SELECT
@@ -216,12 +406,12 @@ func GetStartingNode(db *sql.DB, workflowID uuid.UUID) (Node, error) {
 		INNER JOIN
 			workflows wn ON n.id = wn.starting_node_id
 		WHERE
-			wn.id = $1 AND n.deleted_at IS NULL
+			wn.id = $1 AND (wn.tenant_id = $2 OR $2 = '') AND n.deleted_at IS NULL
 		LIMIT 1;
 	`
 
 	// Execute the query
-	row := db.QueryRow(query, workflowID)
+	row := s.db.QueryRow(query, workflowID, s.tenant)
 
 	var node Node
 
@@ -229,24 +419,24 @@ func GetStartingNode(db *sql.DB, workflowID uuid.UUID) (Node, error) {
 	err := row.Scan(&node.ID, &node.Title, &node.Type, &node.Description, &node.CreatedAt, &node.UpdatedAt, &node.DeletedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return Node{}, fmt.Errorf("no starting node found for workflow %s", workflowID)
+			return Node{}, newError(fmt.Sprintf("no starting node found for workflow %s", workflowID), ErrNotFound)
 		}
-		return Node{}, fmt.Errorf("error fetching starting node for workflow %s: %v", workflowID, err)
+		return Node{}, fmt.Errorf("error fetching starting node for workflow %s: %w", workflowID, err)
 	}
 
 	return node, nil
 }
 
-func UpdateWorkflowStatus(db *sql.DB, workflowID uuid.UUID, status string) error {
-	_, err := db.Exec(`
+func (s *PostgresStore) UpdateWorkflowStatus(workflowID uuid.UUID, status string) error {
+	_, err := s.db.Exec(`
 		UPDATE workflows
 		SET status = $1, updated_at = NOW()
-		WHERE id = $2
-	`, status, workflowID)
+		WHERE id = $2 AND (tenant_id = $3 OR $3 = '')
+	`, status, workflowID, s.tenant)
 	return err
 }
 
-func GetNodeTasks(db *sql.DB, nodeID uuid.UUID) ([]NodeTask, error) {
+func (s *PostgresStore) GetNodeTasks(nodeID uuid.UUID) ([]NodeTask, error) {
 	// Query to fetch tasks associated with the given node
 	query := `
 		SELECT
@@ -271,15 +461,15 @@ func GetNodeTasks(db *sql.DB, nodeID uuid.UUID) ([]NodeTask, error) {
 			tasks t ON nt.task_id = t.id
 		WHERE
 			nt.node_id = $1 AND nt.deleted_at IS NULL
-			AND t.type NOT IN ('Start', 'End')
+			AND t.type NOT IN ('Start', 'End') AND (t.tenant_id = $2 OR $2 = '')
 		ORDER BY
 			nt.task_order ASC;
 	`
 
 	// Execute the query
-	rows, err := db.Query(query, nodeID)
+	rows, err := s.db.Query(query, nodeID, s.tenant)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching tasks for node %s: %v", nodeID, err)
+		return nil, fmt.Errorf("error fetching tasks for node %s: %w", nodeID, err)
 	}
 	defer rows.Close()
 
@@ -297,7 +487,7 @@ func GetNodeTasks(db *sql.DB, nodeID uuid.UUID) ([]NodeTask, error) {
 			&nodeTask.Task.HttpMethod, &nodeTask.Task.Action, &nodeTask.Task.Params,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning node task row: %v", err)
+			return nil, fmt.Errorf("error scanning node task row: %w", err)
 		}
 
 		nodeTasks = append(nodeTasks, nodeTask)
@@ -306,22 +496,22 @@ func GetNodeTasks(db *sql.DB, nodeID uuid.UUID) ([]NodeTask, error) {
 	return nodeTasks, nil
 }
 
-func UpdateTaskStatus(db *sql.DB, taskID uuid.UUID, status string, retryCount int) error {
-	_, err := db.Exec(`
+func (s *PostgresStore) UpdateTaskStatus(taskID uuid.UUID, status string, retryCount int) error {
+	_, err := s.db.Exec(`
 		UPDATE node_tasks
 		SET status = $1, retry_count = $2, updated_at = NOW()
-		WHERE task_id = $3
-	`, status, retryCount, taskID)
+		WHERE task_id = $3 AND (task_id IN (SELECT id FROM tasks WHERE tenant_id = $4) OR $4 = '')
+	`, status, retryCount, taskID, s.tenant)
 	return err
 }
 
-func CreateTask(db *sql.DB, title, taskType, httpMethod, action, params string, maxRetries int) (uuid.UUID, error) {
+func (s *PostgresStore) CreateTask(title, taskType, httpMethod, action, params string, maxRetries int) (uuid.UUID, error) {
 	var id uuid.UUID
-	err := db.QueryRow(`
-		INSERT INTO tasks (title, type, http_method, action, params, max_retries, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	err := s.db.QueryRow(`
+		INSERT INTO tasks (title, type, http_method, action, params, max_retries, tenant_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
 		RETURNING id
-	`, title, taskType, httpMethod, action, params, maxRetries).Scan(&id)
+	`, title, taskType, httpMethod, action, params, maxRetries, s.owner()).Scan(&id)
 
 	if err != nil {
 		return uuid.Nil, err
@@ -330,21 +520,83 @@ func CreateTask(db *sql.DB, title, taskType, httpMethod, action, params string,
 	return id, nil
 }
 
-func AddTaskToNode(db *sql.DB, nodeID, taskID uuid.UUID, taskOrder int) error {
-	_, err := db.Exec(`
+func (s *PostgresStore) GetTask(taskID uuid.UUID) (Task, error) {
+	task := Task{}
+	err := s.db.QueryRow(`
+		SELECT id, title, type, http_method, action, COALESCE(params, ''), max_retries, created_at, updated_at, deleted_at
+		FROM tasks
+		WHERE id = $1 AND (tenant_id = $2 OR $2 = '')
+	`, taskID, s.tenant).Scan(&task.ID, &task.Title, &task.Type, &task.HttpMethod, &task.Action, &task.Params, &task.MaxRetries, &task.CreatedAt, &task.UpdatedAt, &task.DeletedAt)
+	return task, noRows(err, "task", taskID)
+}
+
+func (s *PostgresStore) AddTaskToNode(nodeID, taskID uuid.UUID, taskOrder int) error {
+	if err := s.checkTenant("nodes", nodeID); err != nil {
+		return err
+	}
+	if err := s.checkTenant("tasks", taskID); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec(`
 		INSERT INTO node_tasks (node_id, task_id, task_order, created_at)
 		VALUES ($1, $2, $3, NOW())
 	`, nodeID, taskID, taskOrder)
 	return err
 }
 
-func CreateWorkflowExecution(db *sql.DB, workflowID uuid.UUID, referenceNumber string) (uuid.UUID, error) {
+// CreateWorkflowExecution creates a pending execution unless one already exists for the same
+// idempotency key, or for the same reference number when the workflow has unique_reference set.
+// It returns the ID of the new or existing execution and whether it was created.
+// The execution belongs to the tenant of its workflow.
+func (s *PostgresStore) CreateWorkflowExecution(workflowID uuid.UUID, referenceNumber string, data json.RawMessage, idempotencyKey string) (uuid.UUID, bool, error) {
 	var id uuid.UUID
-	err := db.QueryRow(`
-		INSERT INTO workflow_executions (workflow_id, reference_number, status, created_at, updated_at)
-		VALUES ($1, $2, 'pending', NOW(), NOW())
+	err := s.db.QueryRow(`
+		INSERT INTO workflow_executions (workflow_id, reference_number, status, data, idempotency_key, unique_reference, tenant_id, created_at, updated_at)
+		SELECT id, $2, 'pending', $3, NULLIF($4, ''), unique_reference, tenant_id, NOW(), NOW()
+		FROM workflows
+		WHERE id = $1 AND (tenant_id = $5 OR $5 = '')
+		ON CONFLICT DO NOTHING
 		RETURNING id
-	`, workflowID, referenceNumber).Scan(&id)
+	`, workflowID, referenceNumber, nullableJSON(data), idempotencyKey, s.tenant).Scan(&id)
+
+	if err == nil {
+		return id, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return uuid.Nil, false, err
+	}
+
+	// Nothing was inserted: either the workflow does not exist or the execution already does
+	err = s.db.QueryRow(`
+		SELECT id
+		FROM workflow_executions
+		WHERE workflow_id = $1 AND ((idempotency_key = NULLIF($2, '')) OR (unique_reference AND reference_number = $3))
+			AND (tenant_id = $4 OR $4 = '')
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, workflowID, idempotencyKey, referenceNumber, s.tenant).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, false, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+
+	return id, false, nil
+}
+
+// CreateChildExecution creates an execution started by a SubWorkflow node of a parent execution.
+// The execution belongs to the tenant of its workflow.
+func (s *PostgresStore) CreateChildExecution(workflowID uuid.UUID, referenceNumber string, data json.RawMessage, parentExecutionID, parentNodeID uuid.UUID) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO workflow_executions (workflow_id, reference_number, status, data, parent_execution_id, parent_node_id, tenant_id, created_at, updated_at)
+		SELECT id, $2, 'pending', $3, $4, $5, tenant_id, NOW(), NOW()
+		FROM workflows
+		WHERE id = $1 AND (tenant_id = $6 OR $6 = '')
+		RETURNING id
+	`, workflowID, referenceNumber, nullableJSON(data), parentExecutionID, parentNodeID, s.tenant).Scan(&id)
 
 	if err != nil {
 		return uuid.Nil, err
@@ -353,37 +605,131 @@ func CreateWorkflowExecution(db *sql.DB, workflowID uuid.UUID, referenceNumber s
 	return id, nil
 }
 
-func GetWorkflowExecutionByID(db *sql.DB, executionID uuid.UUID) (WorkflowExecution, error) {
-	query := `
-		SELECT
-			id, workflow_id, last_executed_node_id, last_executed_task_id, reference_number, status, message,
-			last_node_executed_at, last_node_completed_at, last_task_executed_at, last_task_completed_at, created_at, updated_at
-		FROM
-			workflow_executions
-		WHERE
-			id = $1
-	`
-
-	row := db.QueryRow(query, executionID)
+const executionColumns = `
+	id, workflow_id, last_executed_node_id, last_executed_task_id, reference_number, status, COALESCE(message, ''),
+	last_node_executed_at, last_node_completed_at, last_task_executed_at, last_task_completed_at, created_at, updated_at, data,
+	parent_execution_id, parent_node_id, COALESCE(idempotency_key, ''), version, tenant_id, lease_expires_at`
 
+func scanExecution(row interface{ Scan(...interface{}) error }) (WorkflowExecution, error) {
 	var execution WorkflowExecution
+	var data []byte
 	err := row.Scan(
 		&execution.ID, &execution.WorkflowID, &execution.LastExecutedNodeID, &execution.LastExecutedTaskID, &execution.ReferenceNumber,
 		&execution.Status, &execution.Message, &execution.LastNodeExecutedAt, &execution.LastNodeCompletedAt,
-		&execution.LastTaskExecutedAt, &execution.LastTaskCompletedAt, &execution.CreatedAt, &execution.UpdatedAt,
+		&execution.LastTaskExecutedAt, &execution.LastTaskCompletedAt, &execution.CreatedAt, &execution.UpdatedAt, &data,
+		&execution.ParentExecutionID, &execution.ParentNodeID, &execution.IdempotencyKey, &execution.Version, &execution.TenantID,
+		&execution.LeaseExpiresAt,
 	)
+	execution.Data = data
+	return execution, err
+}
+
+func (s *PostgresStore) GetWorkflowExecutionByID(executionID uuid.UUID) (WorkflowExecution, error) {
+	row := s.db.QueryRow(`SELECT `+executionColumns+` FROM workflow_executions WHERE id = $1 AND (tenant_id = $2 OR $2 = '')`, executionID, s.tenant)
+
+	execution, err := scanExecution(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return WorkflowExecution{}, notFound("workflow execution", executionID)
+	}
 	if err != nil {
-		return WorkflowExecution{}, fmt.Errorf("failed to fetch workflow execution: %v", err)
+		return WorkflowExecution{}, fmt.Errorf("failed to fetch workflow execution: %w", err)
 	}
 
 	return execution, nil
 }
 
-func UpdateWorkflowExecutionStatus(db *sql.DB, executionID uuid.UUID, status string) error {
-	_, err := db.Exec(`
+// ListChildExecutions returns the executions started by SubWorkflow nodes of an execution
+func (s *PostgresStore) ListChildExecutions(parentExecutionID uuid.UUID) ([]WorkflowExecution, error) {
+	rows, err := s.db.Query(`
+		SELECT `+executionColumns+`
+		FROM workflow_executions
+		WHERE parent_execution_id = $1 AND (tenant_id = $2 OR $2 = '')
+		ORDER BY created_at ASC
+	`, parentExecutionID, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching child executions: %w", err)
+	}
+	defer rows.Close()
+
+	var executions []WorkflowExecution
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning workflow execution row: %w", err)
+		}
+		executions = append(executions, execution)
+	}
+	return executions, rows.Err()
+}
+
+// MergeWorkflowExecutionData shallow merges a JSON object into the execution data
+func (s *PostgresStore) MergeWorkflowExecutionData(executionID uuid.UUID, data json.RawMessage) error {
+	result, err := s.db.Exec(`
 		UPDATE workflow_executions
-		SET status = $1, updated_at = NOW()
-		WHERE id = $2
-	`, status, executionID)
+		SET data = COALESCE(data, '{}'::jsonb) || $1::jsonb, updated_at = NOW()
+		WHERE id = $2 AND (tenant_id = $3 OR $3 = '')
+	`, string(data), executionID, s.tenant)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, "workflow execution", executionID)
+}
+
+func (s *PostgresStore) UpdateWorkflowExecutionStatus(executionID uuid.UUID, version int, status string) error {
+	result, err := s.db.Exec(`
+		UPDATE workflow_executions
+		SET status = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND version = $3 AND (tenant_id = $4 OR $4 = '')
+	`, status, executionID, version, s.tenant)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrExecutionConflict
+	}
+	return nil
+}
+
+// RenewExecutionLease extends the lease of an executing execution until the given time
+func (s *PostgresStore) RenewExecutionLease(executionID uuid.UUID, until time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE workflow_executions
+		SET lease_expires_at = $1
+		WHERE id = $2 AND status = 'executing' AND (tenant_id = $3 OR $3 = '')
+	`, until, executionID, s.tenant)
 	return err
 }
+
+// checkTenant returns a notFound error unless the rows of table with the given IDs belong to
+// the tenant the store is confined to
+func (s *PostgresStore) checkTenant(table string, ids ...uuid.UUID) error {
+	if s.tenant == "" {
+		return nil
+	}
+
+	for _, id := range ids {
+		var tenant string
+		err := s.db.QueryRow(`SELECT tenant_id FROM `+table+` WHERE id = $1`, id).Scan(&tenant)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && tenant != s.tenant) {
+			return notFound(strings.TrimSuffix(table, "s"), id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check tenant of %s %s: %w", strings.TrimSuffix(table, "s"), id, err)
+		}
+	}
+	return nil
+}
+
+// nullableJSON converts an empty JSON document to NULL. Documents are sent as text so
+// they can be stored in JSONB columns.
+func nullableJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
@@ -0,0 +1,36 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresStoreCreateWorkflow_ConcurrentVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+	startID, workflowID := uuid.New(), uuid.New()
+
+	// Losing the version to a concurrent creation inserts nothing, the retry takes the next one
+	mock.ExpectQuery("INSERT INTO workflows (.+) ON CONFLICT DO NOTHING").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("INSERT INTO workflows").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(workflowID))
+
+	id, err := store.CreateWorkflow("checkout", "", startID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, workflowID, id)
+
+	// A name contended for longer is reported as a conflict
+	for i := 0; i < createWorkflowAttempts; i++ {
+		mock.ExpectQuery("INSERT INTO workflows").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+
+	_, err = store.CreateWorkflow("checkout", "", startID, false)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,151 +1,259 @@
 package workflow
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-func RollbackWorkflow(db *sql.DB, workflowID uuid.UUID, currentNodeID uuid.UUID, rollbackScope RollbackScope) error {
-	fmt.Printf("Starting rollback for workflow %s from node %s with scope %s\n", workflowID, currentNodeID, rollbackScope)
+// ErrExecutionRunning is returned when rolling back an execution that is still executing
+var ErrExecutionRunning = newError("execution is still running", ErrInvalidTransition)
+
+func RollbackWorkflow(ctx context.Context, store Store, workflowID uuid.UUID, currentNodeID uuid.UUID, rollbackScope RollbackScope) error {
+	ctx, logger := withLogFields(ctx, "workflow_id", workflowID, "rollback_scope", rollbackScope)
+	logger.Info("starting rollback", "node_id", currentNodeID)
 
 	switch rollbackScope {
 	case RollbackToStart:
-		return rollbackToStart(db, workflowID, currentNodeID)
+		return rollbackToStart(ctx, store, workflowID, currentNodeID)
 	case RollbackOne:
-		return rollbackOneAncestor(db, workflowID, currentNodeID)
+		return rollbackOneAncestor(ctx, store, workflowID, currentNodeID)
 	case RollbackFinish:
-		return rollbackFinish(db, workflowID, currentNodeID)
+		return rollbackFinish(ctx, store, workflowID, currentNodeID)
 	default:
 		return fmt.Errorf("unknown rollback scope: %s", rollbackScope)
 	}
 }
 
 // Rollback to the very start of the workflow
-func rollbackToStart(db *sql.DB, workflowID uuid.UUID, currentNodeID uuid.UUID) error {
-	fmt.Printf("Rolling back to the start of the workflow %s\n", workflowID)
+func rollbackToStart(ctx context.Context, store Store, workflowID uuid.UUID, currentNodeID uuid.UUID) error {
+	logger := Logger(ctx)
+	logger.Info("rolling back to the start of the workflow")
 
 	// Traverse back to the starting node
 	for {
-		node, err := GetNode(db, currentNodeID)
+		node, err := store.GetNode(currentNodeID)
 		if err != nil {
-			return fmt.Errorf("error retrieving node %s: %v", currentNodeID, err)
+			return fmt.Errorf("error retrieving node %s: %w", currentNodeID, err)
 		}
 
 		// Perform rollback logic for the current node
-		err = RollbackNode(db, node.ID)
+		err = RollbackNode(ctx, store, node.ID)
 		if err != nil {
-			return fmt.Errorf("rollback failed for node %s: %v", node.ID, err)
+			return fmt.Errorf("rollback failed for node %s: %w", node.ID, err)
 		}
 
 		if node.Type == "Start" {
 			// Reached the start node
-			fmt.Printf("Reached the starting node %s\n", node.ID)
+			logger.Info("reached the starting node", "node_id", node.ID)
 			break
 		}
 
 		// Get the ancestor node
-		ancestor, err := GetImmediateAncestor(db, node.ID)
+		ancestor, err := store.GetImmediateAncestor(node.ID)
 		if err != nil {
-			return fmt.Errorf("error retrieving ancestor for node %s: %v", node.ID, err)
+			return fmt.Errorf("error retrieving ancestor for node %s: %w", node.ID, err)
 		}
 		currentNodeID = ancestor.ID
 	}
 
-	fmt.Printf("Rollback to start completed for workflow %s\n", workflowID)
+	logger.Info("rollback to start completed")
 	return nil
 }
 
 // Rollback one ancestor node
-func rollbackOneAncestor(db *sql.DB, workflowID uuid.UUID, currentNodeID uuid.UUID) error {
-	fmt.Printf("Rolling back one ancestor for workflow %s from node %s\n", workflowID, currentNodeID)
+func rollbackOneAncestor(ctx context.Context, store Store, workflowID uuid.UUID, currentNodeID uuid.UUID) error {
+	logger := Logger(ctx)
+	logger.Info("rolling back one ancestor", "node_id", currentNodeID)
 
 	// Get the current node
-	node, err := GetNode(db, currentNodeID)
+	node, err := store.GetNode(currentNodeID)
 	if err != nil {
-		return fmt.Errorf("error retrieving node %s: %v", currentNodeID, err)
+		return fmt.Errorf("error retrieving node %s: %w", currentNodeID, err)
 	}
 
 	// Perform rollback logic for the current node
-	err = RollbackNode(db, node.ID)
+	err = RollbackNode(ctx, store, node.ID)
 	if err != nil {
-		return fmt.Errorf("rollback failed for node %s: %v", node.ID, err)
+		return fmt.Errorf("rollback failed for node %s: %w", node.ID, err)
 	}
 
 	// Get the ancestor node
-	ancestor, err := GetImmediateAncestor(db, node.ID)
+	ancestor, err := store.GetImmediateAncestor(node.ID)
 	if err != nil {
-		return fmt.Errorf("error retrieving ancestor for node %s: %v", node.ID, err)
+		return fmt.Errorf("error retrieving ancestor for node %s: %w", node.ID, err)
 	}
 
 	// Rollback the ancestor
-	err = RollbackNode(db, ancestor.ID)
+	err = RollbackNode(ctx, store, ancestor.ID)
 	if err != nil {
-		return fmt.Errorf("rollback failed for ancestor node %s: %v", ancestor.ID, err)
+		return fmt.Errorf("rollback failed for ancestor node %s: %w", ancestor.ID, err)
 	}
 
-	fmt.Printf("Rollback one ancestor completed for workflow %s\n", workflowID)
+	logger.Info("rollback one ancestor completed")
 	return nil
 }
 
 // Stop/finish the workflow upon rollback
-func rollbackFinish(db *sql.DB, workflowID uuid.UUID, currentNodeID uuid.UUID) error {
-	fmt.Printf("Finishing workflow %s from node %s\n", workflowID, currentNodeID)
+func rollbackFinish(ctx context.Context, store Store, workflowID uuid.UUID, currentNodeID uuid.UUID) error {
+	logger := Logger(ctx)
+	logger.Info("finishing workflow", "node_id", currentNodeID)
 
 	// Perform rollback logic for the current node
-	node, err := GetNode(db, currentNodeID)
+	node, err := store.GetNode(currentNodeID)
 	if err != nil {
-		return fmt.Errorf("error retrieving node %s: %v", currentNodeID, err)
+		return fmt.Errorf("error retrieving node %s: %w", currentNodeID, err)
 	}
 
-	err = RollbackNode(db, node.ID)
+	err = RollbackNode(ctx, store, node.ID)
 	if err != nil {
-		return fmt.Errorf("rollback failed for node %s: %v", currentNodeID, err)
+		return fmt.Errorf("rollback failed for node %s: %w", currentNodeID, err)
 	}
 
 	// Mark the workflow as "finished"
-	err = UpdateWorkflowStatus(db, workflowID, "finished")
+	err = store.UpdateWorkflowStatus(workflowID, "finished")
 	if err != nil {
-		return fmt.Errorf("failed to mark workflow %s as finished: %v", workflowID, err)
+		return fmt.Errorf("failed to mark workflow %s as finished: %w", workflowID, err)
 	}
 
-	fmt.Printf("Workflow %s has been finished\n", workflowID)
+	logger.Info("workflow has been finished")
 	return nil
 }
 
 // Helper function to perform rollback on a single node
-func RollbackNode(db *sql.DB, nodeID uuid.UUID) error {
-	fmt.Printf("Rolling back node %s\n", nodeID)
+func RollbackNode(ctx context.Context, store Store, nodeID uuid.UUID) error {
+	ctx, logger := withLogFields(ctx, "node_id", nodeID)
+	logger.Info("rolling back node")
 
 	// Perform rollback tasks for the node
-	tasks, err := GetNodeTasks(db, nodeID)
+	tasks, err := store.GetNodeTasks(nodeID)
 	if err != nil {
-		return fmt.Errorf("error retrieving tasks for node %s: %v", nodeID, err)
+		return fmt.Errorf("error retrieving tasks for node %s: %w", nodeID, err)
 	}
 
 	for _, task := range tasks {
-		err := rollbackTask(db, task.ID)
+		err := rollbackTask(ctx, store, task.ID)
 		if err != nil {
-			return fmt.Errorf("rollback failed for task %s: %v", task.ID, err)
+			return fmt.Errorf("rollback failed for task %s: %w", task.ID, err)
 		}
 	}
 
-	fmt.Printf("Rollback completed for node %s\n", nodeID)
+	logger.Info("rollback completed for node")
 	return nil
 }
 
 // Helper function to rollback a single task
-func rollbackTask(db *sql.DB, taskID uuid.UUID) error {
-	fmt.Printf("Rolling back task %s\n", taskID)
+func rollbackTask(ctx context.Context, store Store, taskID uuid.UUID) error {
+	logger := Logger(ctx).With("task_id", taskID)
+	logger.Info("rolling back task")
 
 	// Logic to revert task (could involve deleting records, undoing changes, etc.)
 	// Example: Mark task as reverted or execute rollback actions
-	err := UpdateTaskStatus(db, taskID, "reverted", 0)
+	err := store.UpdateTaskStatus(taskID, "reverted", 0)
+	if err != nil {
+		return fmt.Errorf("failed to mark task %s as reverted: %w", taskID, err)
+	}
+
+	logger.Info("task rolled back successfully")
+	return nil
+}
+
+// RollbackExecution rolls back the completed nodes of an execution in reverse order,
+// after rolling back its child executions. Rolling back a child execution a parent is
+// still waiting for fails the parent.
+func RollbackExecution(ctx context.Context, store Store, executionID uuid.UUID) error {
+	return rollbackExecution(ctx, store, executionID, false)
+}
+
+// rollbackExecution rolls back an execution; cascaded is set when its parent is being rolled back
+func rollbackExecution(ctx context.Context, store Store, executionID uuid.UUID, cascaded bool) error {
+	ctx, logger := withLogFields(ctx, "execution_id", executionID)
+
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return err
+	}
+	if execution.Status == "executing" {
+		return ErrExecutionRunning
+	}
+
+	logger.Info("rolling back execution")
+
+	err = store.WithTx(func(tx Store) error {
+		return CancelParkedNodes(tx, executionID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel parked nodes: %w", err)
+	}
+
+	children, err := store.ListChildExecutions(executionID)
+	if err != nil {
+		return err
+	}
+	for i := len(children) - 1; i >= 0; i-- {
+		if children[i].Status == "rolled_back" {
+			continue
+		}
+		if err := rollbackExecution(ctx, store, children[i].ID, true); err != nil {
+			return fmt.Errorf("rollback failed for child execution %s: %w", children[i].ID, err)
+		}
+	}
+
+	logs, err := store.GetExecutionLogs(executionID)
+	if err != nil {
+		return err
+	}
+
+	var completed []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, entry := range logs {
+		if entry.ActionType == ActionTypeNode && entry.Status == "completed" && entry.NodeID != nil && !seen[*entry.NodeID] {
+			seen[*entry.NodeID] = true
+			completed = append(completed, *entry.NodeID)
+		}
+	}
+
+	for i := len(completed) - 1; i >= 0; i-- {
+		nodeID := completed[i]
+		startedAt := time.Now()
+		err := store.WithTx(func(tx Store) error {
+			if err := RollbackNode(ctx, tx, nodeID); err != nil {
+				return fmt.Errorf("rollback failed for node %s: %w", nodeID, err)
+			}
+
+			err := tx.InsertWorkflowLog(WorkflowLog{
+				WorkflowID: execution.WorkflowID, ExecutionID: &executionID, NodeID: &nodeID, Status: "reverted", Message: "Node rolled back",
+				ActionType: ActionTypeRollback, ExecutedAt: startedAt, CompletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to log rollback: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The execution must not have been resumed while it was rolled back
+	err = transitionExecution(store, &execution, "rolled_back", nil, nil)
 	if err != nil {
-		return fmt.Errorf("failed to mark task %s as reverted: %v", taskID, err)
+		return err
 	}
 
-	fmt.Printf("Task %s rolled back successfully\n", taskID)
+	logger.Info("execution rolled back", "node_count", len(completed))
+
+	if execution.ParentExecutionID != nil && !cascaded {
+		parent, err := store.GetWorkflowExecutionByID(*execution.ParentExecutionID)
+		if err != nil {
+			return err
+		}
+		if parent.Status == WaitStatusWaiting {
+			return finishChildExecution(ctx, store, executionID, fmt.Errorf("execution was rolled back"))
+		}
+	}
 	return nil
 }
@@ -0,0 +1,294 @@
+package workflow
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// Misfire policies decide what happens to ticks missed while no scheduler was running
+const (
+	MisfireSkip    = "skip"     // Fire at most once for the missed ticks, only if still within the grace period
+	MisfireCatchUp = "catch_up" // Fire once for every missed tick
+)
+
+const defaultReferenceTemplate = "schedule-{{.ScheduleID}}-{{.ScheduledAt.Unix}}"
+
+type Schedule struct {
+	ID                uuid.UUID  `db:"id" json:"id"`                                 // Unique identifier for the schedule
+	WorkflowID        uuid.UUID  `db:"workflow_id" json:"workflow_id"`               // ID of the workflow to execute
+	CronExpression    string     `db:"cron_expression" json:"cron_expression"`       // Standard 5 field cron expression, or empty when using an interval
+	IntervalSeconds   int        `db:"interval_seconds" json:"interval_seconds"`     // Fixed interval between runs, or 0 when using a cron expression
+	Timezone          string     `db:"timezone" json:"timezone"`                     // IANA timezone the cron expression is evaluated in
+	PayloadTemplate   string     `db:"payload_template" json:"payload_template"`     // text/template rendering the execution data (JSON)
+	ReferenceTemplate string     `db:"reference_template" json:"reference_template"` // text/template rendering the execution reference number
+	MisfirePolicy     string     `db:"misfire_policy" json:"misfire_policy"`         // skip or catch_up
+	Enabled           bool       `db:"enabled" json:"enabled"`                       // Disabled schedules never fire
+	TenantID          string     `db:"tenant_id" json:"tenant_id"`                   // Tenant owning the schedule, the tenant of its workflow
+	NextRunAt         *time.Time `db:"next_run_at" json:"next_run_at"`               // Next tick the schedule fires at
+	LastRunAt         *time.Time `db:"last_run_at" json:"last_run_at"`               // Last tick the schedule fired at
+	CreatedAt         *time.Time `db:"created_at" json:"created_at"`                 // Creation timestamp
+	UpdatedAt         *time.Time `db:"updated_at" json:"updated_at"`                 // Update timestamp
+	DeletedAt         *time.Time `db:"deleted_at" json:"deleted_at"`                 // Deletion timestamp
+}
+
+// ScheduleTick is the data available to payload and reference templates
+type ScheduleTick struct {
+	ScheduleID  uuid.UUID
+	WorkflowID  uuid.UUID
+	ScheduledAt time.Time // Tick being fired, in the schedule's timezone
+	Now         time.Time // Actual time the tick is fired at
+}
+
+// Validate checks the schedule definition and fills in defaults
+func (s *Schedule) Validate() error {
+	if s.WorkflowID == uuid.Nil {
+		return invalidf("workflow_id is required")
+	}
+	if (s.CronExpression == "") == (s.IntervalSeconds <= 0) {
+		return invalidf("exactly one of cron_expression or interval_seconds is required")
+	}
+	if s.CronExpression != "" {
+		if _, err := cron.ParseStandard(s.CronExpression); err != nil {
+			return invalidf("invalid cron_expression: %v", err)
+		}
+	}
+
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return invalidf("invalid timezone: %v", err)
+	}
+
+	if s.MisfirePolicy == "" {
+		s.MisfirePolicy = MisfireSkip
+	}
+	if s.MisfirePolicy != MisfireSkip && s.MisfirePolicy != MisfireCatchUp {
+		return invalidf("misfire_policy must be %s or %s", MisfireSkip, MisfireCatchUp)
+	}
+
+	if s.ReferenceTemplate == "" {
+		s.ReferenceTemplate = defaultReferenceTemplate
+	}
+
+	// Render both templates once so broken templates are rejected up front
+	sample := ScheduleTick{ScheduleID: s.ID, WorkflowID: s.WorkflowID, ScheduledAt: time.Now(), Now: time.Now()}
+	if _, err := s.RenderReference(sample); err != nil {
+		return invalid(err)
+	}
+	if _, err := s.RenderPayload(sample); err != nil {
+		return invalid(err)
+	}
+
+	return nil
+}
+
+// Next returns the first tick strictly after the given time
+func (s Schedule) Next(after time.Time) (time.Time, error) {
+	if s.IntervalSeconds > 0 {
+		return after.Add(time.Duration(s.IntervalSeconds) * time.Second), nil
+	}
+
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone: %w", err)
+	}
+
+	schedule, err := cron.ParseStandard(s.CronExpression)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron_expression: %w", err)
+	}
+
+	return schedule.Next(after.In(location)), nil
+}
+
+func (s Schedule) RenderReference(tick ScheduleTick) (string, error) {
+	reference, err := renderTemplate("reference_template", s.ReferenceTemplate, tick)
+	if err != nil {
+		return "", err
+	}
+	if reference == "" {
+		return "", fmt.Errorf("reference_template rendered an empty reference number")
+	}
+	return reference, nil
+}
+
+func (s Schedule) RenderPayload(tick ScheduleTick) (json.RawMessage, error) {
+	if s.PayloadTemplate == "" {
+		return nil, nil
+	}
+
+	payload, err := renderTemplate("payload_template", s.PayloadTemplate, tick)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid([]byte(payload)) {
+		return nil, fmt.Errorf("payload_template did not render valid JSON")
+	}
+	return json.RawMessage(payload), nil
+}
+
+func renderTemplate(name, text string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return out.String(), nil
+}
+
+const scheduleColumns = `
+	id, workflow_id, COALESCE(cron_expression, ''), COALESCE(interval_seconds, 0), timezone, COALESCE(payload_template, ''),
+	COALESCE(reference_template, ''), misfire_policy, enabled, tenant_id, next_run_at, last_run_at, created_at, updated_at, deleted_at`
+
+func scanSchedule(row interface{ Scan(...interface{}) error }) (Schedule, error) {
+	var s Schedule
+	err := row.Scan(
+		&s.ID, &s.WorkflowID, &s.CronExpression, &s.IntervalSeconds, &s.Timezone, &s.PayloadTemplate,
+		&s.ReferenceTemplate, &s.MisfirePolicy, &s.Enabled, &s.TenantID, &s.NextRunAt, &s.LastRunAt, &s.CreatedAt, &s.UpdatedAt, &s.DeletedAt,
+	)
+	return s, err
+}
+
+// CreateSchedule creates a schedule owned by the tenant of its workflow. It returns
+// ErrWorkflowNotFound when the workflow does not exist in the tenant of the store.
+func (s *PostgresStore) CreateSchedule(schedule Schedule) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO workflow_schedules (workflow_id, cron_expression, interval_seconds, timezone, payload_template, reference_template, misfire_policy, enabled, next_run_at, tenant_id, created_at)
+		SELECT id, NULLIF($2, ''), NULLIF($3, 0), $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, tenant_id, NOW()
+		FROM workflows
+		WHERE id = $1 AND (tenant_id = $10 OR $10 = '')
+		RETURNING id
+	`, schedule.WorkflowID, schedule.CronExpression, schedule.IntervalSeconds, schedule.Timezone, schedule.PayloadTemplate, schedule.ReferenceTemplate, schedule.MisfirePolicy, schedule.Enabled, schedule.NextRunAt, s.tenant).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+func (s *PostgresStore) GetSchedule(scheduleID uuid.UUID) (Schedule, error) {
+	row := s.db.QueryRow(`SELECT `+scheduleColumns+` FROM workflow_schedules WHERE id = $1 AND (tenant_id = $2 OR $2 = '') AND deleted_at IS NULL`, scheduleID, s.tenant)
+	schedule, err := scanSchedule(row)
+	return schedule, noRows(err, "schedule", scheduleID)
+}
+
+// ListSchedules returns the schedules of a workflow, or every schedule when workflowID is Nil
+func (s *PostgresStore) ListSchedules(workflowID uuid.UUID) ([]Schedule, error) {
+	rows, err := s.db.Query(`
+		SELECT `+scheduleColumns+`
+		FROM workflow_schedules
+		WHERE deleted_at IS NULL AND ($1::uuid IS NULL OR workflow_id = $1::uuid) AND (tenant_id = $2 OR $2 = '')
+		ORDER BY created_at ASC
+	`, nullableID(workflowID), s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning schedule row: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *PostgresStore) UpdateSchedule(schedule Schedule) error {
+	result, err := s.db.Exec(`
+		UPDATE workflow_schedules
+		SET cron_expression = NULLIF($1, ''), interval_seconds = NULLIF($2, 0), timezone = $3, payload_template = NULLIF($4, ''),
+			reference_template = NULLIF($5, ''), misfire_policy = $6, enabled = $7, next_run_at = $8, updated_at = NOW()
+		WHERE id = $9 AND (tenant_id = $10 OR $10 = '') AND deleted_at IS NULL
+	`, schedule.CronExpression, schedule.IntervalSeconds, schedule.Timezone, schedule.PayloadTemplate, schedule.ReferenceTemplate, schedule.MisfirePolicy, schedule.Enabled, schedule.NextRunAt, schedule.ID, s.tenant)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, "schedule", schedule.ID)
+}
+
+func (s *PostgresStore) DeleteSchedule(scheduleID uuid.UUID) error {
+	result, err := s.db.Exec(`
+		UPDATE workflow_schedules
+		SET enabled = FALSE, deleted_at = NOW()
+		WHERE id = $1 AND (tenant_id = $2 OR $2 = '') AND deleted_at IS NULL
+	`, scheduleID, s.tenant)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result, "schedule", scheduleID)
+}
+
+// GetDueSchedules returns the enabled schedules whose next tick is not after now
+func (s *PostgresStore) GetDueSchedules(now time.Time) ([]Schedule, error) {
+	rows, err := s.db.Query(`
+		SELECT `+scheduleColumns+`
+		FROM workflow_schedules
+		WHERE enabled AND deleted_at IS NULL AND next_run_at <= $1 AND (tenant_id = $2 OR $2 = '')
+		ORDER BY next_run_at ASC
+	`, now, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching due schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning schedule row: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// ClaimScheduleTick moves next_run_at forward only if it still holds the value this
+// replica read. Exactly one replica wins each tick; the others get false.
+func (s *PostgresStore) ClaimScheduleTick(scheduleID uuid.UUID, expectedNextRunAt, nextRunAt time.Time, lastRunAt *time.Time) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE workflow_schedules
+		SET next_run_at = $1, last_run_at = COALESCE($2, last_run_at), updated_at = NOW()
+		WHERE id = $3 AND next_run_at = $4 AND enabled AND deleted_at IS NULL AND (tenant_id = $5 OR $5 = '')
+	`, nextRunAt, lastRunAt, scheduleID, expectedNextRunAt, s.tenant)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// expectAffected returns the notFound error of the resource when the statement changed no row
+func expectAffected(result sql.Result, resource string, id interface{}) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound(resource, id)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Scheduler struct {
+	Store        Store
+	PollInterval time.Duration // How often due schedules are checked
+	MaxCatchUp   int           // Most missed ticks a catch_up schedule fires in one poll
+
+	running sync.WaitGroup
+}
+
+func NewScheduler(store Store, pollInterval time.Duration) *Scheduler {
+	if pollInterval <= 0 {
+		pollInterval = 15 * time.Second
+	}
+	return &Scheduler{Store: store, PollInterval: pollInterval, MaxCatchUp: 100}
+}
+
+// Run polls for due schedules until ctx is cancelled, then waits for the executions it started
+func (s *Scheduler) Run(ctx context.Context) {
+	logger := Logger(ctx)
+	logger.Info("scheduler started", "poll_interval", s.PollInterval.String())
+
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Tick(ctx, time.Now()); err != nil {
+			logger.Error("scheduler tick failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.running.Wait()
+			logger.Info("scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick fires every schedule that is due at now
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) error {
+	schedules, err := s.Store.GetDueSchedules(now)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		if err := s.fire(ctx, schedule, now); err != nil {
+			Logger(ctx).Error("failed to fire schedule", "schedule_id", schedule.ID, "workflow_id", schedule.WorkflowID, "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) fire(ctx context.Context, schedule Schedule, now time.Time) error {
+	ctx, logger := withLogFields(ctx, "schedule_id", schedule.ID, "workflow_id", schedule.WorkflowID)
+
+	ticks, next, err := dueTicks(schedule, now, s.MaxCatchUp, 2*s.PollInterval)
+	if err != nil {
+		return err
+	}
+
+	var lastRunAt *time.Time
+	if len(ticks) > 0 {
+		lastRunAt = &ticks[len(ticks)-1]
+	}
+
+	// Render every tick first, so a template error leaves the schedule where it was
+	type firing struct {
+		tick      time.Time
+		reference string
+		payload   json.RawMessage
+	}
+	var firings []firing
+	for _, tick := range ticks {
+		data := ScheduleTick{ScheduleID: schedule.ID, WorkflowID: schedule.WorkflowID, ScheduledAt: tick, Now: now}
+
+		reference, err := schedule.RenderReference(data)
+		if err != nil {
+			return err
+		}
+		payload, err := schedule.RenderPayload(data)
+		if err != nil {
+			return err
+		}
+		firings = append(firings, firing{tick: tick, reference: reference, payload: payload})
+	}
+
+	// Only the replica that moves next_run_at forward fires the ticks. The executions are
+	// created in the same transaction, so a tick is never claimed without its execution.
+	claimed := false
+	var started []uuid.UUID
+	err = s.Store.WithTx(func(tx Store) error {
+		var err error
+		claimed, err = tx.ClaimScheduleTick(schedule.ID, *schedule.NextRunAt, next, lastRunAt)
+		if err != nil {
+			return fmt.Errorf("failed to claim schedule tick: %w", err)
+		}
+		if !claimed {
+			return nil
+		}
+
+		for _, f := range firings {
+			// Ticks over the quota of the tenant are dropped, the schedule has moved past them
+			err := CheckQuota(tx.ForTenant(schedule.TenantID), QuotaExecutions)
+			if errors.Is(err, ErrQuotaExceeded) {
+				logger.Warn("schedule tick not fired", "scheduled_at", f.tick, "error", err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			executionID, created, err := tx.CreateWorkflowExecution(schedule.WorkflowID, f.reference, f.payload, "")
+			if err != nil {
+				return fmt.Errorf("failed to create workflow execution: %w", err)
+			}
+			if !created {
+				logger.Info("schedule tick already has an execution", "execution_id", executionID, "reference_number", f.reference)
+				continue
+			}
+
+			execution, err := tx.GetWorkflowExecutionByID(executionID)
+			if err != nil {
+				return fmt.Errorf("failed to fetch workflow execution: %w", err)
+			}
+			err = auditSystem(tx, executionID, AuditEntry{
+				TenantID: schedule.TenantID, Action: "schedule fire", ResourceType: "execution", ResourceID: executionID.String(),
+				Reason: fmt.Sprintf("schedule %s ticked at %s", schedule.ID, f.tick.Format(time.RFC3339)), After: AuditState(execution),
+			})
+			if err != nil {
+				return err
+			}
+
+			logger.Info("schedule fired", "execution_id", executionID, "scheduled_at", f.tick, "reference_number", f.reference)
+			started = append(started, executionID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		logger.Debug("schedule tick claimed by another instance")
+		return nil
+	}
+
+	if len(ticks) == 0 {
+		logger.Info("skipped missed schedule ticks", "missed_since", *schedule.NextRunAt, "next_run_at", next)
+	}
+
+	for _, executionID := range started {
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			if err := ExecuteWorkflowByExecutionID(context.WithoutCancel(ctx), s.Store, executionID); err != nil {
+				logger.Error("scheduled execution failed", "execution_id", executionID, "error", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// dueTicks returns the ticks to fire at now and the next tick to wait for.
+// catch_up fires every missed tick (at most maxCatchUp per call, the rest are picked up by
+// the following calls); skip fires the latest missed tick only if it is within grace.
+func dueTicks(schedule Schedule, now time.Time, maxCatchUp int, grace time.Duration) ([]time.Time, time.Time, error) {
+	if schedule.NextRunAt == nil {
+		next, err := schedule.Next(now)
+		return nil, next.Truncate(time.Second), err
+	}
+
+	tick := *schedule.NextRunAt
+	var ticks []time.Time
+
+	if schedule.MisfirePolicy == MisfireCatchUp {
+		for !tick.After(now) && len(ticks) < maxCatchUp {
+			ticks = append(ticks, tick)
+
+			next, err := schedule.Next(tick)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			tick = next.Truncate(time.Second)
+		}
+		return ticks, tick, nil
+	}
+
+	// Find the latest missed tick; interval schedules jump there directly
+	latest := tick
+	if schedule.IntervalSeconds > 0 {
+		interval := time.Duration(schedule.IntervalSeconds) * time.Second
+		latest = tick.Add(now.Sub(tick) / interval * interval)
+	} else {
+		for {
+			next, err := schedule.Next(latest)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			if next.After(now) {
+				break
+			}
+			latest = next
+		}
+	}
+
+	if now.Sub(latest) <= grace {
+		ticks = append(ticks, latest)
+	}
+
+	next, err := schedule.Next(latest)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return ticks, next.Truncate(time.Second), nil
+}
@@ -0,0 +1,107 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule_Validate(t *testing.T) {
+	schedule := Schedule{WorkflowID: uuid.New(), CronExpression: "0 2 * * *", Timezone: "Asia/Jakarta"}
+	assert.NoError(t, schedule.Validate())
+	assert.Equal(t, MisfireSkip, schedule.MisfirePolicy)
+	assert.Equal(t, defaultReferenceTemplate, schedule.ReferenceTemplate)
+
+	both := Schedule{WorkflowID: uuid.New(), CronExpression: "0 2 * * *", IntervalSeconds: 60}
+	assert.Error(t, both.Validate())
+
+	badPayload := Schedule{WorkflowID: uuid.New(), IntervalSeconds: 60, PayloadTemplate: `{"date": {{.ScheduledAt.Unix}`}
+	assert.Error(t, badPayload.Validate())
+}
+
+func TestSchedule_NextUsesTimezone(t *testing.T) {
+	schedule := Schedule{CronExpression: "0 2 * * *", Timezone: "Asia/Jakarta"}
+
+	next, err := schedule.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 1, 19, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestDueTicks_CatchUp(t *testing.T) {
+	nextRunAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{IntervalSeconds: 3600, MisfirePolicy: MisfireCatchUp, NextRunAt: &nextRunAt}
+	now := nextRunAt.Add(150 * time.Minute)
+
+	ticks, next, err := dueTicks(schedule, now, 100, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{nextRunAt, nextRunAt.Add(time.Hour), nextRunAt.Add(2 * time.Hour)}, ticks)
+	assert.Equal(t, nextRunAt.Add(3*time.Hour), next)
+
+	ticks, next, err = dueTicks(schedule, now, 2, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, ticks, 2)
+	assert.Equal(t, nextRunAt.Add(2*time.Hour), next)
+}
+
+func TestDueTicks_Skip(t *testing.T) {
+	nextRunAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{CronExpression: "0 * * * *", Timezone: "UTC", MisfirePolicy: MisfireSkip, NextRunAt: &nextRunAt}
+
+	// The latest missed tick (02:00) is within the grace period and fires once
+	ticks, next, err := dueTicks(schedule, nextRunAt.Add(2*time.Hour+10*time.Second), 100, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{nextRunAt.Add(2 * time.Hour)}, ticks)
+	assert.Equal(t, nextRunAt.Add(3*time.Hour), next.UTC())
+
+	// Too late for the latest tick: nothing fires
+	ticks, next, err = dueTicks(schedule, nextRunAt.Add(2*time.Hour+30*time.Minute), 100, time.Minute)
+	assert.NoError(t, err)
+	assert.Empty(t, ticks)
+	assert.Equal(t, nextRunAt.Add(3*time.Hour), next.UTC())
+}
+
+// failingExecutions is a store whose executions cannot be created
+type failingExecutions struct {
+	Store
+}
+
+func (f failingExecutions) WithTx(fn func(tx Store) error) error {
+	return f.Store.WithTx(func(tx Store) error { return fn(failingExecutions{tx}) })
+}
+
+func (f failingExecutions) CreateWorkflowExecution(uuid.UUID, string, json.RawMessage, string) (uuid.UUID, bool, error) {
+	return uuid.Nil, false, errors.New("database is gone")
+}
+
+func TestSchedulerFire_KeepsTickWithoutExecution(t *testing.T) {
+	store := NewMemoryStore()
+	workflowID := newLinearWorkflow(t, store)
+	nextRunAt := time.Now().Add(-time.Second).Truncate(time.Second)
+	schedule := Schedule{WorkflowID: workflowID, IntervalSeconds: 3600, MisfirePolicy: MisfireCatchUp, Enabled: true, NextRunAt: &nextRunAt}
+	if err := schedule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	scheduleID, err := store.CreateSchedule(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tick stays due when its execution could not be created, for the next poll to fire
+	scheduler := NewScheduler(failingExecutions{store}, time.Minute)
+	assert.NoError(t, scheduler.Tick(context.Background(), time.Now()))
+	schedule, _ = store.GetSchedule(scheduleID)
+	assert.Equal(t, nextRunAt, schedule.NextRunAt.Truncate(time.Second))
+
+	scheduler = NewScheduler(store, time.Minute)
+	assert.NoError(t, scheduler.Tick(context.Background(), time.Now()))
+	scheduler.running.Wait()
+	schedule, _ = store.GetSchedule(scheduleID)
+	assert.True(t, schedule.NextRunAt.After(nextRunAt))
+	executions, _ := store.ListWorkflowExecutions(ExecutionFilter{WorkflowID: workflowID})
+	assert.Len(t, executions, 1)
+}
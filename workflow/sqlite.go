@@ -0,0 +1,174 @@
+package workflow
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+)
+
+// sqliteTimeLayout is how times are stored in SQLite. Times are stored in UTC, so they sort
+// and compare as text.
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+func init() {
+	// Postgres functions used by the queries and by the SQLite schema
+	sqlite.MustRegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(sqliteTimeLayout), nil
+	})
+	sqlite.MustRegisterScalarFunction("uuid_generate_v4", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("jsonb_concat", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return jsonbConcat(args[0], args[1])
+	})
+}
+
+// SQLiteStore is the Store backed by a SQLite database, for local development and tests.
+// It runs the PostgresStore queries, translated to SQLite.
+type SQLiteStore struct {
+	*PostgresStore
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{&PostgresStore{db: sqliteQueryer{db}, conn: db, sqlite: true}}
+}
+
+// OpenSQLite opens the SQLite database at path, ":memory:" for one living as long as the
+// returned DB. Foreign keys are enforced and transactions take the write lock up front, so
+// concurrent writers wait for each other instead of failing.
+func OpenSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite database path is required")
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+	if path != ":memory:" {
+		params.Add("_pragma", "journal_mode(WAL)")
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to :memory: opens a database of its own
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// sqliteQueryer runs the Postgres queries of PostgresStore on SQLite
+type sqliteQueryer struct {
+	q queryer
+}
+
+func (s sqliteQueryer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.q.Exec(sqliteQuery(query), sqliteArgs(args)...)
+}
+
+func (s sqliteQueryer) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.q.Query(sqliteQuery(query), sqliteArgs(args)...)
+}
+
+func (s sqliteQueryer) QueryRow(query string, args ...interface{}) *sql.Row {
+	return s.q.QueryRow(sqliteQuery(query), sqliteArgs(args)...)
+}
+
+// sqliteRewrites turn the Postgres specific parts of the queries into SQLite. Placeholders
+// ($1) and NOW() work as they are.
+var sqliteRewrites = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// jsonb || jsonb merges objects, in SQLite || concatenates strings
+	{regexp.MustCompile(`(COALESCE\([^()]*\)) \|\| (\$\d+)(::jsonb)?`), "jsonb_concat(${1}, ${2})"},
+	// Casts, SQLite is dynamically typed
+	{regexp.MustCompile(`::(uuid|jsonb|text)\b`), ""},
+	// Writers hold the database lock, so claimed rows cannot be claimed twice anyway
+	{regexp.MustCompile(`\s*FOR UPDATE SKIP LOCKED`), ""},
+}
+
+var sqliteQueries sync.Map
+
+func sqliteQuery(query string) string {
+	if translated, ok := sqliteQueries.Load(query); ok {
+		return translated.(string)
+	}
+
+	translated := query
+	for _, rewrite := range sqliteRewrites {
+		translated = rewrite.pattern.ReplaceAllString(translated, rewrite.replacement)
+	}
+	sqliteQueries.Store(query, translated)
+	return translated
+}
+
+// sqliteArgs stores times in the layout NOW() uses
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC().Format(sqliteTimeLayout)
+		case *time.Time:
+			if v != nil {
+				converted[i] = v.UTC().Format(sqliteTimeLayout)
+			}
+		case sql.NullTime:
+			if v.Valid {
+				converted[i] = v.Time.UTC().Format(sqliteTimeLayout)
+			}
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// jsonbConcat merges two JSON objects like jsonb || jsonb: fields of b replace those of a
+func jsonbConcat(a, b driver.Value) (driver.Value, error) {
+	if a == nil || b == nil {
+		return nil, nil
+	}
+
+	merged := map[string]json.RawMessage{}
+	for _, value := range []driver.Value{a, b} {
+		var data []byte
+		switch v := value.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			return nil, fmt.Errorf("jsonb_concat: %T is not JSON", value)
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("jsonb_concat: not a JSON object: %w", err)
+		}
+		for field, fieldValue := range fields {
+			merged[field] = fieldValue
+		}
+	}
+
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return string(out), nil
+}
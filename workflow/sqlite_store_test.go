@@ -0,0 +1,165 @@
+package workflow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kadzany/frosty/pqinit/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSQLiteStore returns a store on a fresh in-memory database with the schema applied
+func newSQLiteStore(t *testing.T) *SQLiteStore {
+	db, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLiteStore(db)
+}
+
+func TestSQLiteStoreExecution(t *testing.T) {
+	testStoreExecution(t, newSQLiteStore(t))
+}
+
+func TestSQLiteStoreClaims(t *testing.T) {
+	testStoreClaims(t, newSQLiteStore(t))
+}
+
+func TestSQLiteStoreClosure(t *testing.T) {
+	store := newSQLiteStore(t)
+
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	checkID, _ := store.CreateNode("Check", NodeTypeDecision, "", json.RawMessage(`{"field":"amount"}`))
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, checkID, ""))
+	assert.NoError(t, store.AddRelationship(checkID, endID, "{{gt .amount 10.0}}"))
+
+	children, err := store.GetChildren(checkID)
+	assert.NoError(t, err)
+	if assert.Len(t, children, 1) {
+		assert.Equal(t, endID, children[0].Descendant)
+		assert.Equal(t, "{{gt .amount 10.0}}", children[0].Condition)
+	}
+
+	node, err := store.GetNode(checkID)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"field":"amount"}`, string(node.Config))
+}
+
+func TestSQLiteStoreWithTx(t *testing.T) {
+	store := newSQLiteStore(t)
+	executionID, _, _ := store.CreateWorkflowExecution(newLinearWorkflow(t, store), "order-1", nil, "")
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+
+	failed := errors.New("log failed")
+	err := store.WithTx(func(tx Store) error {
+		if err := transitionExecution(tx, &execution, "executing", nil, nil); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	stored, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "pending", stored.Status)
+	events, _ := store.ListPendingOutboxEvents(10)
+	assert.Empty(t, events)
+
+	assert.NoError(t, store.UpdateWorkflowExecutionStatus(executionID, 0, "executing"))
+	assert.ErrorIs(t, store.UpdateWorkflowExecutionStatus(executionID, 0, "completed"), ErrExecutionConflict)
+}
+
+func TestSQLiteStoreOutboxRelay(t *testing.T) {
+	store := newSQLiteStore(t)
+	ctx := context.Background()
+	executionID, _, _ := store.CreateWorkflowExecution(newLinearWorkflow(t, store), "order-1", nil, "")
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, executionID))
+
+	publisher := &recordingPublisher{}
+	published, err := NewOutboxRelay(store, publisher, 0).Relay(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, published)
+
+	events, _ := store.ListPendingOutboxEvents(10)
+	assert.Empty(t, events)
+}
+
+func TestSQLiteStoreAPIKeys(t *testing.T) {
+	store := newSQLiteStore(t)
+
+	key, apiKey, err := GenerateAPIKey("ops", []string{RoleDesigner, RoleOperator})
+	assert.NoError(t, err)
+	id, err := store.CreateAPIKey(apiKey)
+	assert.NoError(t, err)
+
+	prefix, ok := ParseAPIKeyPrefix(key)
+	assert.True(t, ok)
+	stored, err := store.GetAPIKeyByPrefix(prefix)
+	assert.NoError(t, err)
+	assert.Equal(t, id, stored.ID)
+	assert.Equal(t, []string{RoleDesigner, RoleOperator}, stored.Roles)
+	assert.True(t, stored.Matches(key))
+	assert.False(t, stored.Matches(key+"0"))
+
+	assert.NoError(t, store.RevokeAPIKey(id))
+	assert.ErrorIs(t, store.RevokeAPIKey(id), sql.ErrNoRows)
+	stored, _ = store.GetAPIKeyByPrefix(prefix)
+	assert.False(t, stored.Matches(key))
+
+	keys, _ := store.ListAPIKeys()
+	assert.Len(t, keys, 1)
+}
+
+func TestSQLiteStoreGrants(t *testing.T) {
+	store := newSQLiteStore(t)
+	workflowID := newLinearWorkflow(t, store)
+
+	grantID, err := store.CreateWorkflowGrant(WorkflowGrant{WorkflowID: workflowID, Subject: "billing", Role: RoleOperator})
+	assert.NoError(t, err)
+	againID, _ := store.CreateWorkflowGrant(WorkflowGrant{WorkflowID: workflowID, Subject: "billing", Role: RoleOperator})
+	assert.Equal(t, grantID, againID)
+
+	granted, err := store.GetGrantedRoles(workflowID, "billing")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{RoleOperator}, granted)
+
+	grants, _ := store.ListWorkflowGrants(uuid.Nil)
+	assert.Len(t, grants, 1)
+	grants, _ = store.ListWorkflowGrants(uuid.New())
+	assert.Empty(t, grants)
+
+	assert.NoError(t, store.DeleteWorkflowGrant(grantID))
+	assert.ErrorIs(t, store.DeleteWorkflowGrant(grantID), sql.ErrNoRows)
+
+	assert.NoError(t, store.InsertAuditEntry(AuditEntry{Actor: "billing", Action: "POST /workflow", Outcome: AuditOutcomeDenied}))
+}
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	store := newSQLiteStore(t)
+	migrator, _ := migrations.New(store.conn, migrations.SQLite)
+
+	reverted, err := migrator.Down(len(migrator.Migrations))
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(migrator.Migrations))
+
+	_, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.NoError(t, migrator.Check())
+}
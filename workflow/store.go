@@ -0,0 +1,230 @@
+package workflow
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrExecutionConflict is returned when an execution changed since it was read, e.g. because
+// another worker is advancing it
+var ErrExecutionConflict = newError("workflow execution was changed by another worker", ErrConflict)
+
+// Store is everything the engine persists. PostgresStore is the production implementation,
+// MemoryStore keeps everything in process for tests and local runs.
+//
+// Lookups, updates and deletes of a single row return an error matching both ErrNotFound and
+// sql.ErrNoRows when it does not exist. AddRelationship returns an ErrCycle error when the
+// ancestor is reachable from the descendant.
+type Store interface {
+	// WithTx runs fn against a Store whose writes are committed together when fn returns
+	// nil and discarded otherwise. Calling WithTx on that Store joins the transaction.
+	WithTx(fn func(tx Store) error) error
+	// ForTenant returns a Store confined to tenant: lookups do not find the rows of other
+	// tenants and the rows it creates belong to tenant. Rows that hang off another row, like
+	// the executions of a workflow, belong to the tenant of that row. The Store of the empty
+	// tenant is not confined, it is what the engine workers use.
+	ForTenant(tenant string) Store
+	// Tenant returns the tenant the Store is confined to, empty when it is not
+	Tenant() string
+
+	NodeStore
+	ClosureStore
+	TaskStore
+	WorkflowStore
+	ExecutionStore
+	LogStore
+	WaitStore
+	TimerStore
+	ScheduleStore
+	TargetPolicyStore
+	OutboxStore
+	APIKeyStore
+	GrantStore
+	AuditStore
+	TenantStore
+}
+
+type NodeStore interface {
+	CreateNode(title, nodeType string, description string, config json.RawMessage) (uuid.UUID, error)
+	GetNode(nodeID uuid.UUID) (Node, error)
+}
+
+// ClosureStore holds the relationships between nodes. Direct relationships have depth 0.
+type ClosureStore interface {
+	AddRelationship(ancestor, descendant uuid.UUID, condition string) error
+	GetDescendants(ancestor uuid.UUID) ([]Node, error)
+	GetChildren(nodeID uuid.UUID) ([]NodeClosure, error)
+	GetImmediateAncestor(nodeID uuid.UUID) (Node, error)
+	// AllParentsCompleted tells whether every node with a direct relationship to nodeID
+	// completed in the execution
+	AllParentsCompleted(executionID, nodeID uuid.UUID) (bool, error)
+	ValidateClosure(startNode uuid.UUID) error
+}
+
+type TaskStore interface {
+	CreateTask(title, taskType, httpMethod, action, params string, maxRetries int) (uuid.UUID, error)
+	GetTask(taskID uuid.UUID) (Task, error)
+	AddTaskToNode(nodeID, taskID uuid.UUID, taskOrder int) error
+	GetNodeTasks(nodeID uuid.UUID) ([]NodeTask, error)
+	UpdateTaskStatus(taskID uuid.UUID, status string, retryCount int) error
+}
+
+type WorkflowStore interface {
+	CreateWorkflow(name, description string, startingNodeID uuid.UUID, uniqueReference bool) (uuid.UUID, error)
+	GetWorkflow(workflowID uuid.UUID) (Workflow, error)
+	GetWorkflowVersion(name string, version int) (Workflow, error)
+	ListWorkflows(filter WorkflowFilter) ([]Workflow, error)
+	GetStartingNode(workflowID uuid.UUID) (Node, error)
+	GetWorkflowNodes(workflowID uuid.UUID) ([]Node, error)
+	GetWorkflowEdges(workflowID uuid.UUID) ([]NodeClosure, error)
+	UpdateWorkflowStatus(workflowID uuid.UUID, status string) error
+}
+
+type ExecutionStore interface {
+	CreateWorkflowExecution(workflowID uuid.UUID, referenceNumber string, data json.RawMessage, idempotencyKey string) (uuid.UUID, bool, error)
+	CreateChildExecution(workflowID uuid.UUID, referenceNumber string, data json.RawMessage, parentExecutionID, parentNodeID uuid.UUID) (uuid.UUID, error)
+	GetWorkflowExecutionByID(executionID uuid.UUID) (WorkflowExecution, error)
+	ListWorkflowExecutions(filter ExecutionFilter) ([]WorkflowExecution, error)
+	ListChildExecutions(parentExecutionID uuid.UUID) ([]WorkflowExecution, error)
+	CancelChildExecutions(parentExecutionID uuid.UUID) ([]uuid.UUID, error)
+	MergeWorkflowExecutionData(executionID uuid.UUID, data json.RawMessage) error
+	// UpdateWorkflowExecutionStatus sets the status of an execution still at version and bumps
+	// the version. It returns ErrExecutionConflict when the execution is at another version.
+	UpdateWorkflowExecutionStatus(executionID uuid.UUID, version int, status string) error
+	RenewExecutionLease(executionID uuid.UUID, until time.Time) error
+	CountParkedNodes(executionID uuid.UUID) (int, error)
+}
+
+type LogStore interface {
+	LogWorkflowExecution(workflowID, nodeID uuid.UUID, taskID *uuid.UUID, status, message string, httpCode *int, response *string, errorMessage error) error
+	InsertWorkflowLog(entry WorkflowLog) error
+	GetExecutionLogs(executionID uuid.UUID) ([]WorkflowLog, error)
+	GetExecutedNodes(currentNode uuid.UUID) ([]Node, error)
+	CountNodeRollbacks(executionID, nodeID uuid.UUID) (int, error)
+}
+
+type WaitStore interface {
+	CreateExecutionWait(wait ExecutionWait) (uuid.UUID, error)
+	GetPendingWait(executionID uuid.UUID, signalName string) (ExecutionWait, error)
+	ResolveWait(waitID uuid.UUID, status string, payload json.RawMessage) (bool, error)
+	CancelExecutionWaits(executionID uuid.UUID) error
+	ClaimExpiredWaits(now time.Time, limit int) ([]ExecutionWait, error)
+	ClaimWaitResume(waitID uuid.UUID) (bool, error)
+	ListUnresumedWaits(resolvedBefore time.Time, limit int) ([]ExecutionWait, error)
+}
+
+type TimerStore interface {
+	CreateTimer(timer Timer) (uuid.UUID, error)
+	GetTimer(timerID uuid.UUID) (Timer, error)
+	ListTimers(executionID uuid.UUID, status string) ([]Timer, error)
+	ResolveTimer(timerID uuid.UUID, status string) (bool, error)
+	CancelExecutionTimers(executionID uuid.UUID) error
+	ClaimDueTimers(now time.Time, limit int) ([]Timer, error)
+	ClaimTimerResume(timerID uuid.UUID) (bool, error)
+	ListUnresumedTimers(resolvedBefore time.Time, limit int) ([]Timer, error)
+}
+
+type ScheduleStore interface {
+	CreateSchedule(schedule Schedule) (uuid.UUID, error)
+	GetSchedule(scheduleID uuid.UUID) (Schedule, error)
+	ListSchedules(workflowID uuid.UUID) ([]Schedule, error)
+	UpdateSchedule(schedule Schedule) error
+	DeleteSchedule(scheduleID uuid.UUID) error
+	GetDueSchedules(now time.Time) ([]Schedule, error)
+	ClaimScheduleTick(scheduleID uuid.UUID, expectedNextRunAt, nextRunAt time.Time, lastRunAt *time.Time) (bool, error)
+}
+
+type TargetPolicyStore interface {
+	ListTargetPolicies() ([]TargetPolicy, error)
+	SaveTargetPolicy(p TargetPolicy) (uuid.UUID, error)
+	DeleteTargetPolicy(policyID uuid.UUID) error
+}
+
+// OutboxStore holds the events written together with the state transitions they describe,
+// until the OutboxRelay published them
+type OutboxStore interface {
+	InsertOutboxEvent(event OutboxEvent) error
+	// ListPendingOutboxEvents returns the oldest unpublished events. Within a transaction they
+	// stay locked against other relays until it ends.
+	ListPendingOutboxEvents(limit int) ([]OutboxEvent, error)
+	// ClaimOutboxEvents leaves the events due at now to one relay until claimedUntil, so
+	// they are published outside of any transaction
+	ClaimOutboxEvents(now, claimedUntil time.Time, limit int) ([]OutboxEvent, error)
+	MarkOutboxEventPublished(eventID uuid.UUID) error
+	MarkOutboxEventFailed(eventID uuid.UUID, publishErr error, nextAttemptAt time.Time) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (uuid.UUID, error)
+	GetAPIKeyByPrefix(prefix string) (APIKey, error)
+	ListAPIKeys() ([]APIKey, error)
+	RevokeAPIKey(keyID uuid.UUID) error
+}
+
+type GrantStore interface {
+	CreateWorkflowGrant(grant WorkflowGrant) (uuid.UUID, error)
+	ListWorkflowGrants(workflowID uuid.UUID) ([]WorkflowGrant, error)
+	GetGrantedRoles(workflowID uuid.UUID, subject string) ([]string, error)
+	DeleteWorkflowGrant(grantID uuid.UUID) error
+}
+
+// AuditStore only appends: entries are never updated or deleted
+type AuditStore interface {
+	// InsertAuditEntry appends an entry, written for the tenant of the store unless it names one
+	InsertAuditEntry(entry AuditEntry) error
+	ListAuditEntries(filter AuditFilter) ([]AuditEntry, error)
+}
+
+type TenantStore interface {
+	// GetTenantQuota returns the quota of a tenant, an unlimited one when none was set
+	GetTenantQuota(tenantID string) (TenantQuota, error)
+	SaveTenantQuota(quota TenantQuota) error
+	ListTenantQuotas() ([]TenantQuota, error)
+	GetTenantUsage(tenantID string) (TenantUsage, error)
+}
+
+// PostgresStore is the Store backed by the Postgres schema in pqinit/migrations
+type PostgresStore struct {
+	db     queryer
+	conn   *sql.DB // nil within a transaction
+	sqlite bool    // queries are translated for SQLite, see SQLiteStore
+	tenant string  // tenant the store is confined to, empty for every tenant
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, conn: db}
+}
+
+func (s *PostgresStore) WithTx(fn func(tx Store) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+
+	tx, err := s.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var db queryer = tx
+	if s.sqlite {
+		db = sqliteQueryer{tx}
+	}
+	if err := fn(&PostgresStore{db: db, sqlite: s.sqlite, tenant: s.tenant}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
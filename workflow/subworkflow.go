@@ -0,0 +1,301 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxSubWorkflowDepth bounds the nesting of child executions, so a workflow calling itself fails instead of looping
+const maxSubWorkflowDepth = 10
+
+// SubWorkflowConfig is the config of a SubWorkflow node. The child workflow is referenced
+// either by ID or by name and version.
+type SubWorkflowConfig struct {
+	WorkflowID uuid.UUID         `json:"workflow_id,omitempty"` // ID of the child workflow
+	Workflow   string            `json:"workflow,omitempty"`    // Name of the child workflow
+	Version    int               `json:"version,omitempty"`     // Version of the named workflow, 0 for the latest
+	Input      map[string]string `json:"input,omitempty"`       // Child data field to dotted path in the parent data; the whole parent data when empty
+	Output     map[string]string `json:"output,omitempty"`      // Parent data field to dotted path in the child data
+}
+
+// ExecutionTree is an execution with the child executions started by its SubWorkflow nodes
+type ExecutionTree struct {
+	WorkflowExecution
+	Children []ExecutionTree `json:"children"`
+}
+
+type childExecutionsKey struct{}
+
+// SubWorkflowConfig parses the config of a SubWorkflow node
+func (n Node) SubWorkflowConfig() (SubWorkflowConfig, error) {
+	var config SubWorkflowConfig
+	if len(n.Config) > 0 {
+		if err := json.Unmarshal(n.Config, &config); err != nil {
+			return config, fmt.Errorf("invalid sub-workflow node config: %w", err)
+		}
+	}
+	if (config.WorkflowID == uuid.Nil) == (config.Workflow == "") {
+		return config, fmt.Errorf("sub-workflow node config requires exactly one of workflow_id or workflow")
+	}
+	if config.Version < 0 || (config.Version > 0 && config.Workflow == "") {
+		return config, fmt.Errorf("sub-workflow node version requires a workflow name and must not be negative")
+	}
+	return config, nil
+}
+
+func resolveSubWorkflow(store Store, config SubWorkflowConfig) (Workflow, error) {
+	if config.WorkflowID != uuid.Nil {
+		return store.GetWorkflow(config.WorkflowID)
+	}
+	return store.GetWorkflowVersion(config.Workflow, config.Version)
+}
+
+// parkSubWorkflow creates the child execution of a SubWorkflow node and parks the parent
+// execution until the child finishes. The child is started by runExecution once the
+// parent run settled.
+func parkSubWorkflow(ctx context.Context, store Store, node Node, workflowID, executionID uuid.UUID) error {
+	children, ok := ctx.Value(childExecutionsKey{}).(*[]uuid.UUID)
+	if executionID == uuid.Nil || !ok {
+		return fmt.Errorf("sub-workflow node %s requires a workflow execution", node.ID)
+	}
+
+	config, err := node.SubWorkflowConfig()
+	if err != nil {
+		return err
+	}
+
+	parent, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return err
+	}
+
+	depth, err := executionDepth(store, parent)
+	if err != nil {
+		return err
+	}
+	if depth >= maxSubWorkflowDepth {
+		return fmt.Errorf("sub-workflow node %s exceeds the maximum nesting of %d executions", node.ID, maxSubWorkflowDepth)
+	}
+
+	// Sub-workflows are looked up in the tenant of the parent, whichever store runs it
+	child, err := resolveSubWorkflow(store.ForTenant(parent.TenantID), config)
+	if err != nil {
+		return fmt.Errorf("error retrieving sub-workflow of node %s: %w", node.ID, err)
+	}
+
+	input := parent.Data
+	if len(config.Input) > 0 {
+		input, err = mapData(config.Input, parent.Data)
+		if err != nil {
+			return fmt.Errorf("failed to map sub-workflow input: %w", err)
+		}
+	}
+
+	reference := fmt.Sprintf("%s/%s", parent.ReferenceNumber, child.Name)
+	var childID uuid.UUID
+	err = store.WithTx(func(tx Store) error {
+		childID, err = tx.CreateChildExecution(child.ID, reference, input, executionID, node.ID)
+		if err != nil {
+			return fmt.Errorf("failed to create child execution: %w", err)
+		}
+
+		err = tx.InsertWorkflowLog(WorkflowLog{
+			WorkflowID: workflowID, ExecutionID: &executionID, NodeID: &node.ID, Status: WaitStatusWaiting,
+			Message:    fmt.Sprintf("Waiting for child execution %s of workflow \"%s\" v%d", childID, child.Name, child.Version),
+			ActionType: ActionTypeNode, ExecutedAt: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to log workflow node execution: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*children = append(*children, childID)
+
+	Logger(ctx).Info("node waiting for child execution", "child_execution_id", childID, "child_workflow_id", child.ID)
+	return ErrExecutionParked
+}
+
+// startChildExecutions runs the child executions queued by SubWorkflow nodes during a run
+func startChildExecutions(ctx context.Context, store Store, children []uuid.UUID) error {
+	for _, childID := range children {
+		if err := ExecuteWorkflowByExecutionID(ctx, store, childID); err != nil {
+			return fmt.Errorf("child execution %s failed: %w", childID, err)
+		}
+	}
+	return nil
+}
+
+// finishChildExecution hands the outcome of a child execution over to its parent: outputs
+// are mapped back and the parent resumes, or the parent fails with the child
+func finishChildExecution(ctx context.Context, store Store, childID uuid.UUID, childErr error) error {
+	child, err := store.GetWorkflowExecutionByID(childID)
+	if err != nil {
+		return err
+	}
+	if child.ParentExecutionID == nil || child.ParentNodeID == nil {
+		return nil
+	}
+	parentID, nodeID := *child.ParentExecutionID, *child.ParentNodeID
+
+	if childErr != nil {
+		err = logParkedNodeResolved(store, parentID, nodeID, child.CreatedAt, "failed", fmt.Sprintf("Child execution %s failed: %v", childID, childErr))
+		if err != nil {
+			return err
+		}
+
+		parent, err := store.GetWorkflowExecutionByID(parentID)
+		if err != nil {
+			return err
+		}
+		err = failExecution(ctx, store, parent, nodeID, child.CreatedAt, fmt.Errorf("child execution %s failed: %v", childID, childErr))
+		if err != nil {
+			return fmt.Errorf("failed to fail parent execution %s: %w", parentID, err)
+		}
+		return nil
+	}
+
+	node, err := store.GetNode(nodeID)
+	if err != nil {
+		return fmt.Errorf("error retrieving node %s: %w", nodeID, err)
+	}
+	config, err := node.SubWorkflowConfig()
+	if err != nil {
+		return err
+	}
+
+	err = store.WithTx(func(tx Store) error {
+		if len(config.Output) > 0 {
+			output, err := mapData(config.Output, child.Data)
+			if err != nil {
+				return fmt.Errorf("failed to map sub-workflow output: %w", err)
+			}
+			if err := tx.MergeWorkflowExecutionData(parentID, output); err != nil {
+				return fmt.Errorf("failed to merge sub-workflow output: %w", err)
+			}
+		}
+		return logParkedNodeResolved(tx, parentID, nodeID, child.CreatedAt, "completed", fmt.Sprintf("Child execution %s completed", childID))
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ResumeWorkflowExecution(ctx, store, parentID, nodeID, false); err != nil {
+		return fmt.Errorf("failed to resume parent execution %s: %w", parentID, err)
+	}
+	return nil
+}
+
+// executionDepth counts the ancestors of an execution
+func executionDepth(store Store, execution WorkflowExecution) (int, error) {
+	depth := 0
+	for execution.ParentExecutionID != nil {
+		depth++
+		if depth > maxSubWorkflowDepth {
+			break
+		}
+
+		var err error
+		execution, err = store.GetWorkflowExecutionByID(*execution.ParentExecutionID)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return depth, nil
+}
+
+// GetExecutionTree returns an execution with its child executions, recursively
+func GetExecutionTree(store Store, executionID uuid.UUID) (ExecutionTree, error) {
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return ExecutionTree{}, err
+	}
+	return buildExecutionTree(store, execution, 0)
+}
+
+func buildExecutionTree(store Store, execution WorkflowExecution, depth int) (ExecutionTree, error) {
+	tree := ExecutionTree{WorkflowExecution: execution, Children: []ExecutionTree{}}
+	if depth >= maxSubWorkflowDepth {
+		return tree, nil
+	}
+
+	children, err := store.ListChildExecutions(execution.ID)
+	if err != nil {
+		return ExecutionTree{}, err
+	}
+
+	for _, child := range children {
+		childTree, err := buildExecutionTree(store, child, depth+1)
+		if err != nil {
+			return ExecutionTree{}, err
+		}
+		tree.Children = append(tree.Children, childTree)
+	}
+	return tree, nil
+}
+
+// CancelChildExecutions cancels the pending and waiting child executions of an execution
+// and returns their IDs. What the children are parked on is left to CancelParkedNodes.
+func (s *PostgresStore) CancelChildExecutions(parentExecutionID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(`
+		UPDATE workflow_executions
+		SET status = 'cancelled', version = version + 1, updated_at = NOW()
+		WHERE parent_execution_id = $1 AND status IN ('pending', 'waiting') AND (tenant_id = $2 OR $2 = '')
+		RETURNING id
+	`, parentExecutionID, s.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var children []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		children = append(children, id)
+	}
+	return children, rows.Err()
+}
+
+// mapData builds a JSON object whose fields are looked up by dotted path in data.
+// Paths missing from data are left out.
+func mapData(mapping map[string]string, data json.RawMessage) (json.RawMessage, error) {
+	var values map[string]interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("execution data is not a JSON object: %w", err)
+		}
+	}
+
+	out := make(map[string]interface{}, len(mapping))
+	for field, path := range mapping {
+		if value, ok := lookupPath(values, path); ok {
+			out[field] = value
+		}
+	}
+	return json.Marshal(out)
+}
+
+func lookupPath(values map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = values
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
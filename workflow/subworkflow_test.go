@@ -0,0 +1,42 @@
+package workflow
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapData(t *testing.T) {
+	data := json.RawMessage(`{"customer":{"id":"c-1","address":{"city":"Jakarta"}},"order_id":"o-9"}`)
+
+	mapped, err := mapData(map[string]string{
+		"address":  "customer.address",
+		"order_id": "order_id",
+		"missing":  "customer.phone",
+	}, data)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"address":{"city":"Jakarta"},"order_id":"o-9"}`, string(mapped))
+
+	mapped, err = mapData(map[string]string{"city": "customer.address.city"}, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(mapped))
+
+	_, err = mapData(map[string]string{"city": "city"}, json.RawMessage(`[1, 2]`))
+	assert.Error(t, err)
+}
+
+func TestNodeSubWorkflowConfig(t *testing.T) {
+	byID := Node{Type: NodeTypeSubWorkflow, Config: json.RawMessage(`{"workflow_id":"` + uuid.NewString() + `"}`)}
+	assert.NoError(t, ValidateNodeConfig(byID))
+
+	byVersion := Node{Type: NodeTypeSubWorkflow, Config: json.RawMessage(`{"workflow":"address-validation","version":2,"output":{"address":"address"}}`)}
+	config, err := byVersion.SubWorkflowConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "address-validation", config.Workflow)
+	assert.Equal(t, 2, config.Version)
+
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeSubWorkflow}))
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeSubWorkflow, Config: json.RawMessage(`{"workflow_id":"` + uuid.NewString() + `","version":1}`)}))
+}
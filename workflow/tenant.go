@@ -0,0 +1,189 @@
+package workflow
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultTenant owns the rows created without a tenant, including every row from before
+// tenants existed. Its admins administer the whole deployment.
+const DefaultTenant = "default"
+
+// ErrQuotaExceeded is returned when a tenant is at one of the limits of its TenantQuota
+var ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+// QuotaResource is what a TenantQuota limits
+type QuotaResource string
+
+const (
+	QuotaExecutions QuotaResource = "concurrent executions" // Pending, executing and waiting executions
+	QuotaWorkflows  QuotaResource = "workflows"             // Stored workflow versions
+	QuotaNodes      QuotaResource = "nodes"                 // Stored nodes
+	QuotaTasks      QuotaResource = "tasks"                 // Stored tasks
+)
+
+// activeExecutionStatuses are the statuses counted against QuotaExecutions
+var activeExecutionStatuses = []string{"pending", "executing", WaitStatusWaiting}
+
+// TenantQuota limits what a tenant may run and store. Zero means unlimited.
+type TenantQuota struct {
+	TenantID                string     `db:"tenant_id" json:"tenant_id"`                                 // Tenant the quota applies to
+	MaxConcurrentExecutions int        `db:"max_concurrent_executions" json:"max_concurrent_executions"` // Executions pending, executing or waiting at once
+	MaxWorkflows            int        `db:"max_workflows" json:"max_workflows"`                         // Stored workflow versions
+	MaxNodes                int        `db:"max_nodes" json:"max_nodes"`                                 // Stored nodes
+	MaxTasks                int        `db:"max_tasks" json:"max_tasks"`                                 // Stored tasks
+	UpdatedAt               *time.Time `db:"updated_at" json:"updated_at"`                               // Update timestamp, nil when no quota was set
+}
+
+func (q TenantQuota) Validate() error {
+	if q.TenantID == "" {
+		return invalidf("tenant_id is required")
+	}
+	if q.MaxConcurrentExecutions < 0 || q.MaxWorkflows < 0 || q.MaxNodes < 0 || q.MaxTasks < 0 {
+		return invalidf("quota limits cannot be negative")
+	}
+	return nil
+}
+
+func (q TenantQuota) limit(resource QuotaResource) int {
+	switch resource {
+	case QuotaExecutions:
+		return q.MaxConcurrentExecutions
+	case QuotaWorkflows:
+		return q.MaxWorkflows
+	case QuotaNodes:
+		return q.MaxNodes
+	case QuotaTasks:
+		return q.MaxTasks
+	}
+	return 0
+}
+
+// TenantUsage is what a tenant currently runs and stores
+type TenantUsage struct {
+	ActiveExecutions int `json:"active_executions"` // Executions pending, executing or waiting
+	Workflows        int `json:"workflows"`         // Stored workflow versions
+	Nodes            int `json:"nodes"`             // Stored nodes
+	Tasks            int `json:"tasks"`             // Stored tasks
+}
+
+func (u TenantUsage) count(resource QuotaResource) int {
+	switch resource {
+	case QuotaExecutions:
+		return u.ActiveExecutions
+	case QuotaWorkflows:
+		return u.Workflows
+	case QuotaNodes:
+		return u.Nodes
+	case QuotaTasks:
+		return u.Tasks
+	}
+	return 0
+}
+
+// CheckQuota returns ErrQuotaExceeded (wrapped) when the tenant of store cannot create another
+// resource. Stores not confined to a tenant are never limited.
+//
+// The check is not atomic with the create that follows it, so concurrent requests can overshoot
+// a limit by the number of requests racing for the last slot.
+func CheckQuota(store Store, resource QuotaResource) error {
+	tenant := store.Tenant()
+	if tenant == "" {
+		return nil
+	}
+
+	quota, err := store.GetTenantQuota(tenant)
+	if err != nil {
+		return fmt.Errorf("failed to fetch quota of tenant %s: %w", tenant, err)
+	}
+	limit := quota.limit(resource)
+	if limit <= 0 {
+		return nil
+	}
+
+	usage, err := store.GetTenantUsage(tenant)
+	if err != nil {
+		return fmt.Errorf("failed to fetch usage of tenant %s: %w", tenant, err)
+	}
+	if usage.count(resource) >= limit {
+		return fmt.Errorf("%w: tenant %s is at its limit of %d %s", ErrQuotaExceeded, tenant, limit, resource)
+	}
+	return nil
+}
+
+// ForTenant returns the store confined to tenant, see Store
+func (s *PostgresStore) ForTenant(tenant string) Store {
+	return &PostgresStore{db: s.db, conn: s.conn, sqlite: s.sqlite, tenant: tenant}
+}
+
+func (s *PostgresStore) Tenant() string {
+	return s.tenant
+}
+
+// owner is the tenant of the rows the store creates
+func (s *PostgresStore) owner() string {
+	if s.tenant == "" {
+		return DefaultTenant
+	}
+	return s.tenant
+}
+
+const tenantQuotaColumns = `tenant_id, max_concurrent_executions, max_workflows, max_nodes, max_tasks, updated_at`
+
+// GetTenantQuota returns the quota of a tenant, an unlimited one when none was set
+func (s *PostgresStore) GetTenantQuota(tenantID string) (TenantQuota, error) {
+	q := TenantQuota{TenantID: tenantID}
+	err := s.db.QueryRow(`SELECT `+tenantQuotaColumns+` FROM tenant_quotas WHERE tenant_id = $1`, tenantID).
+		Scan(&q.TenantID, &q.MaxConcurrentExecutions, &q.MaxWorkflows, &q.MaxNodes, &q.MaxTasks, &q.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q, nil
+	}
+	return q, err
+}
+
+func (s *PostgresStore) SaveTenantQuota(q TenantQuota) error {
+	_, err := s.db.Exec(`
+		INSERT INTO tenant_quotas (tenant_id, max_concurrent_executions, max_workflows, max_nodes, max_tasks, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			max_concurrent_executions = EXCLUDED.max_concurrent_executions, max_workflows = EXCLUDED.max_workflows,
+			max_nodes = EXCLUDED.max_nodes, max_tasks = EXCLUDED.max_tasks, updated_at = NOW()
+	`, q.TenantID, q.MaxConcurrentExecutions, q.MaxWorkflows, q.MaxNodes, q.MaxTasks)
+	return err
+}
+
+func (s *PostgresStore) ListTenantQuotas() ([]TenantQuota, error) {
+	rows, err := s.db.Query(`SELECT ` + tenantQuotaColumns + ` FROM tenant_quotas ORDER BY tenant_id ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tenant quotas: %w", err)
+	}
+	defer rows.Close()
+
+	quotas := []TenantQuota{}
+	for rows.Next() {
+		var q TenantQuota
+		if err := rows.Scan(&q.TenantID, &q.MaxConcurrentExecutions, &q.MaxWorkflows, &q.MaxNodes, &q.MaxTasks, &q.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning tenant quota row: %w", err)
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, rows.Err()
+}
+
+func (s *PostgresStore) GetTenantUsage(tenantID string) (TenantUsage, error) {
+	var u TenantUsage
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM workflow_executions WHERE tenant_id = $1 AND status IN ($2, $3, $4)),
+			(SELECT COUNT(*) FROM workflows WHERE tenant_id = $1 AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM nodes WHERE tenant_id = $1 AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM tasks WHERE tenant_id = $1 AND deleted_at IS NULL)
+	`, tenantID, activeExecutionStatuses[0], activeExecutionStatuses[1], activeExecutionStatuses[2]).
+		Scan(&u.ActiveExecutions, &u.Workflows, &u.Nodes, &u.Tasks)
+	if err != nil {
+		return TenantUsage{}, fmt.Errorf("error fetching usage of tenant %s: %w", tenantID, err)
+	}
+	return u, nil
+}
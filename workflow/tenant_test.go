@@ -0,0 +1,234 @@
+package workflow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreTenants(t *testing.T) {
+	testStoreTenants(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreTenants(t *testing.T) {
+	testStoreTenants(t, newSQLiteStore(t))
+}
+
+func TestMemoryStoreCrossTenantExecution(t *testing.T) {
+	testStoreCrossTenantExecution(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreCrossTenantExecution(t *testing.T) {
+	testStoreCrossTenantExecution(t, newSQLiteStore(t))
+}
+
+func TestMemoryStoreQuotas(t *testing.T) {
+	testStoreQuotas(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreQuotas(t *testing.T) {
+	testStoreQuotas(t, newSQLiteStore(t))
+}
+
+// testStoreTenants checks that a store confined to a tenant neither finds nor references the
+// rows of another tenant
+func testStoreTenants(t *testing.T, store Store) {
+	acme, globex := store.ForTenant("acme"), store.ForTenant("globex")
+
+	startID, err := acme.CreateNode("Start", NodeTypeStart, "", nil)
+	assert.NoError(t, err)
+	endID, _ := acme.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, acme.AddRelationship(startID, endID, ""))
+	taskID, _ := acme.CreateTask("Charge", "API", "POST", "http://billing/charge", "", 0)
+	assert.NoError(t, acme.AddTaskToNode(endID, taskID, 1))
+	workflowID, err := acme.CreateWorkflow("checkout", "", startID, false)
+	assert.NoError(t, err)
+
+	// Every tenant numbers its own versions
+	globexStart, _ := globex.CreateNode("Start", NodeTypeStart, "", nil)
+	globexID, err := globex.CreateWorkflow("checkout", "", globexStart, false)
+	assert.NoError(t, err)
+	wf, err := globex.GetWorkflowVersion("checkout", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, globexID, wf.ID)
+	assert.Equal(t, 1, wf.Version)
+	assert.Equal(t, "globex", wf.TenantID)
+
+	executionID, created, err := acme.CreateWorkflowExecution(workflowID, "ORD-1", nil, "")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", execution.TenantID)
+
+	scheduleID, err := acme.CreateSchedule(Schedule{WorkflowID: workflowID, IntervalSeconds: 60, Timezone: "UTC", MisfirePolicy: MisfireSkip, Enabled: true, NextRunAt: timeRef(time.Now())})
+	assert.NoError(t, err)
+	_, err = acme.CreateTimer(Timer{ExecutionID: executionID, NodeID: endID, FireAt: time.Now()})
+	assert.NoError(t, err)
+
+	// Lookups from another tenant find nothing
+	_, err = globex.GetNode(startID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = globex.GetTask(taskID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = globex.GetWorkflow(workflowID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = globex.GetWorkflowExecutionByID(executionID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = globex.GetSchedule(scheduleID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, globex.DeleteSchedule(scheduleID), sql.ErrNoRows)
+	schedules, _ := globex.ListSchedules(uuid.Nil)
+	assert.Empty(t, schedules)
+	timers, _ := globex.ListTimers(uuid.Nil, TimerStatusPending)
+	assert.Empty(t, timers)
+
+	// Nor can another tenant reference them
+	_, _, err = globex.CreateWorkflowExecution(workflowID, "ORD-2", nil, "")
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+	_, err = globex.CreateWorkflow("stolen", "", startID, false)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, globex.AddRelationship(globexStart, endID, ""), sql.ErrNoRows)
+	_, err = globex.CreateSchedule(Schedule{WorkflowID: workflowID, IntervalSeconds: 60, Timezone: "UTC", MisfirePolicy: MisfireSkip})
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+
+	// The tenant itself and unconfined stores see the rows
+	_, err = acme.GetSchedule(scheduleID)
+	assert.NoError(t, err)
+	timers, _ = acme.ListTimers(uuid.Nil, TimerStatusPending)
+	assert.Len(t, timers, 1)
+	schedules, _ = store.ListSchedules(uuid.Nil)
+	assert.Len(t, schedules, 1)
+
+	// Rows created without a tenant belong to the default one
+	defaultStart, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	_, err = store.ForTenant(DefaultTenant).GetNode(defaultStart)
+	assert.NoError(t, err)
+	_, err = acme.GetNode(defaultStart)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// API keys are listed and revoked per tenant
+	_, key, _ := GenerateAPIKey("ci", []string{RoleOperator})
+	keyID, err := acme.CreateAPIKey(key)
+	assert.NoError(t, err)
+	keys, _ := globex.ListAPIKeys()
+	assert.Empty(t, keys)
+	assert.ErrorIs(t, globex.RevokeAPIKey(keyID), sql.ErrNoRows)
+	key, err = store.GetAPIKeyByPrefix(key.Prefix)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", key.TenantID)
+}
+
+func testStoreQuotas(t *testing.T, store Store) {
+	acme := store.ForTenant("acme")
+
+	quota, err := store.GetTenantQuota("acme")
+	assert.NoError(t, err)
+	assert.Nil(t, quota.UpdatedAt)
+	assert.NoError(t, CheckQuota(acme, QuotaNodes))
+
+	assert.NoError(t, store.SaveTenantQuota(TenantQuota{TenantID: "acme", MaxConcurrentExecutions: 1, MaxNodes: 2}))
+	quota, _ = store.GetTenantQuota("acme")
+	assert.Equal(t, 2, quota.MaxNodes)
+	assert.NotNil(t, quota.UpdatedAt)
+
+	startID, _ := acme.CreateNode("Start", NodeTypeStart, "", nil)
+	assert.NoError(t, CheckQuota(acme, QuotaNodes))
+	endID, _ := acme.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.ErrorIs(t, CheckQuota(acme, QuotaNodes), ErrQuotaExceeded)
+	assert.NoError(t, CheckQuota(store.ForTenant("globex"), QuotaNodes))
+	assert.NoError(t, CheckQuota(store, QuotaNodes), "unconfined stores are not limited")
+
+	// Only active executions count
+	assert.NoError(t, acme.AddRelationship(startID, endID, ""))
+	workflowID, _ := acme.CreateWorkflow("checkout", "", startID, false)
+	assert.NoError(t, CheckQuota(acme, QuotaWorkflows))
+	executionID, _, _ := acme.CreateWorkflowExecution(workflowID, "ORD-1", nil, "")
+	assert.ErrorIs(t, CheckQuota(acme, QuotaExecutions), ErrQuotaExceeded)
+
+	assert.NoError(t, acme.UpdateWorkflowExecutionStatus(executionID, 0, "completed"))
+	assert.NoError(t, CheckQuota(acme, QuotaExecutions))
+
+	usage, err := store.GetTenantUsage("acme")
+	assert.NoError(t, err)
+	assert.Equal(t, TenantUsage{ActiveExecutions: 0, Workflows: 1, Nodes: 2, Tasks: 0}, usage)
+
+	quotas, _ := store.ListTenantQuotas()
+	assert.Len(t, quotas, 1)
+}
+
+// testStoreCrossTenantExecution has a tenant execute, inspect and signal the workflow of
+// another, and checks it is told the workflow does not exist without learning its nodes
+func testStoreCrossTenantExecution(t *testing.T, store Store) {
+	ctx := context.Background()
+	acme, globex := store.ForTenant("acme"), store.ForTenant("globex")
+
+	startID, _ := acme.CreateNode("Start", NodeTypeStart, "", nil)
+	approvalID, _ := acme.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved"}`))
+	endID, _ := acme.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, acme.AddRelationship(startID, approvalID, ""))
+	assert.NoError(t, acme.AddRelationship(approvalID, endID, ""))
+	workflowID, err := acme.CreateWorkflow("approval", "", startID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executionID, _, err := acme.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, acme, executionID))
+
+	notFound := func(err error) {
+		t.Helper()
+		if assert.ErrorIs(t, err, ErrNotFound) {
+			for _, nodeID := range []uuid.UUID{startID, approvalID, endID} {
+				assert.NotContains(t, err.Error(), nodeID.String())
+			}
+		}
+	}
+
+	// Execute
+	notFound(ExecuteWorkflow(ctx, globex, workflowID))
+	notFound(ExecuteWorkflowByExecutionID(ctx, globex, executionID))
+	_, err = globex.GetStartingNode(workflowID)
+	notFound(err)
+
+	// Status
+	_, err = globex.GetWorkflowExecutionByID(executionID)
+	notFound(err)
+	nodes, _ := globex.GetWorkflowNodes(workflowID)
+	assert.Empty(t, nodes)
+	edges, _ := globex.GetWorkflowEdges(workflowID)
+	assert.Empty(t, edges)
+	descendants, _ := globex.GetDescendants(startID)
+	assert.Empty(t, descendants)
+
+	// Logs
+	logs, err := globex.GetExecutionLogs(executionID)
+	assert.NoError(t, err)
+	assert.Empty(t, logs)
+	logs, _ = acme.GetExecutionLogs(executionID)
+	assert.NotEmpty(t, logs)
+	notFound(globex.InsertWorkflowLog(WorkflowLog{WorkflowID: workflowID, ExecutionID: &executionID, Status: "success", ExecutedAt: time.Now()}))
+
+	// Signals, waits and timers
+	notFound(SignalWorkflowExecution(ctx, globex, executionID, "approved", nil))
+	_, err = globex.GetPendingWait(executionID, "approved")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = globex.CreateTimer(Timer{ExecutionID: executionID, NodeID: endID, FireAt: time.Now()})
+	notFound(err)
+	notFound(globex.MergeWorkflowExecutionData(executionID, json.RawMessage(`{"stolen":true}`)))
+
+	// The execution of acme was left alone
+	execution, _ := acme.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, WaitStatusWaiting, execution.Status)
+	assert.Nil(t, execution.Data)
+	wait, err := acme.GetPendingWait(executionID, "approved")
+	assert.NoError(t, err)
+	assert.Equal(t, WaitStatusWaiting, wait.Status)
+}
@@ -0,0 +1,444 @@
+package workflow
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Timeline struct {
+	ExecutionID          uuid.UUID      `json:"execution_id"`              // ID of the workflow execution
+	WorkflowID           uuid.UUID      `json:"workflow_id"`               // ID of the executed workflow
+	Status               string         `json:"status"`                    // Current status of the execution
+	StartedAt            *time.Time     `json:"started_at"`                // When the execution started
+	CompletedAt          *time.Time     `json:"completed_at"`              // When the execution finished, if it has
+	DurationMs           int64          `json:"duration_ms"`               // Wall clock duration of the execution
+	Nodes                []NodeTimeline `json:"nodes"`                     // Executed nodes in start order
+	CriticalPath         []uuid.UUID    `json:"critical_path"`             // Longest chain of dependent nodes
+	CriticalPathDuration int64          `json:"critical_path_duration_ms"` // Sum of node durations along the critical path
+}
+
+type NodeTimeline struct {
+	NodeID      uuid.UUID      `json:"node_id"`      // ID of the node
+	Title       string         `json:"title"`        // Title of the node
+	Type        string         `json:"type"`         // Type of the node
+	Status      string         `json:"status"`       // Outcome of the node: completed, failed or running
+	StartedAt   time.Time      `json:"started_at"`   // When the node started
+	CompletedAt *time.Time     `json:"completed_at"` // When the node finished, if it has
+	DurationMs  int64          `json:"duration_ms"`  // Duration of the node
+	Tasks       []TaskTimeline `json:"tasks"`        // Tasks executed by the node
+}
+
+type TaskTimeline struct {
+	TaskID   uuid.UUID         `json:"task_id"`  // ID of the task
+	Title    string            `json:"title"`    // Title of the task
+	Status   string            `json:"status"`   // Outcome of the last attempt
+	Attempts []AttemptTimeline `json:"attempts"` // Attempts in the order they were made
+}
+
+type AttemptTimeline struct {
+	Attempt     int       `json:"attempt"`      // Attempt number, starting at 1
+	Status      string    `json:"status"`       // Outcome of the attempt: completed or failed
+	HttpCode    *int      `json:"http_code"`    // HTTP status code returned by the task target
+	StartedAt   time.Time `json:"started_at"`   // When the request was sent
+	CompletedAt time.Time `json:"completed_at"` // When the response (or error) was received
+	DurationMs  int64     `json:"duration_ms"`  // Duration of the attempt
+	WaitMs      int64     `json:"wait_ms"`      // Time since the previous attempt finished
+	Error       *string   `json:"error,omitempty"`
+}
+
+// GetExecutionTimeline builds the timeline of an execution from its workflow_logs rows
+func GetExecutionTimeline(store Store, executionID uuid.UUID) (Timeline, error) {
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return Timeline{}, err
+	}
+
+	logs, err := store.GetExecutionLogs(executionID)
+	if err != nil {
+		return Timeline{}, err
+	}
+
+	edges, err := store.GetWorkflowEdges(execution.WorkflowID)
+	if err != nil {
+		return Timeline{}, err
+	}
+
+	nodes := make(map[uuid.UUID]Node)
+	tasks := make(map[uuid.UUID]Task)
+	for _, entry := range logs {
+		if entry.NodeID != nil {
+			if _, ok := nodes[*entry.NodeID]; !ok {
+				node, err := store.GetNode(*entry.NodeID)
+				if err != nil {
+					return Timeline{}, fmt.Errorf("error retrieving node %s: %w", *entry.NodeID, err)
+				}
+				nodes[node.ID] = node
+			}
+		}
+		if entry.TaskID != nil {
+			if _, ok := tasks[*entry.TaskID]; !ok {
+				task, err := store.GetTask(*entry.TaskID)
+				if err != nil {
+					return Timeline{}, fmt.Errorf("error retrieving task %s: %w", *entry.TaskID, err)
+				}
+				tasks[task.ID] = task
+			}
+		}
+	}
+
+	return BuildTimeline(execution, logs, nodes, tasks, edges), nil
+}
+
+// BuildTimeline assembles a timeline from log rows ordered by executed_at
+func BuildTimeline(execution WorkflowExecution, logs []WorkflowLog, nodes map[uuid.UUID]Node, tasks map[uuid.UUID]Task, edges []NodeClosure) Timeline {
+	timeline := Timeline{
+		ExecutionID: execution.ID,
+		WorkflowID:  execution.WorkflowID,
+		Status:      execution.Status,
+		Nodes:       []NodeTimeline{},
+	}
+
+	nodeIndex := make(map[uuid.UUID]int)
+	nodeTimeline := func(nodeID uuid.UUID, startedAt time.Time) *NodeTimeline {
+		if i, ok := nodeIndex[nodeID]; ok {
+			return &timeline.Nodes[i]
+		}
+		node := nodes[nodeID]
+		timeline.Nodes = append(timeline.Nodes, NodeTimeline{
+			NodeID: nodeID, Title: node.Title, Type: node.Type, Status: "running", StartedAt: startedAt, Tasks: []TaskTimeline{},
+		})
+		nodeIndex[nodeID] = len(timeline.Nodes) - 1
+		return &timeline.Nodes[len(timeline.Nodes)-1]
+	}
+
+	for _, entry := range logs {
+		switch entry.ActionType {
+		case ActionTypeExecution:
+			if timeline.StartedAt == nil || entry.ExecutedAt.Before(*timeline.StartedAt) {
+				startedAt := entry.ExecutedAt
+				timeline.StartedAt = &startedAt
+			}
+			if entry.CompletedAt.Valid {
+				completedAt := entry.CompletedAt.Time
+				timeline.CompletedAt = &completedAt
+			}
+
+		case ActionTypeNode:
+			if entry.NodeID == nil {
+				continue
+			}
+			node := nodeTimeline(*entry.NodeID, entry.ExecutedAt)
+			node.StartedAt = entry.ExecutedAt
+			node.Status = entry.Status
+			if entry.CompletedAt.Valid {
+				completedAt := entry.CompletedAt.Time
+				node.CompletedAt = &completedAt
+				node.DurationMs = completedAt.Sub(node.StartedAt).Milliseconds()
+			}
+
+		case ActionTypeTask:
+			if entry.NodeID == nil || entry.TaskID == nil || !entry.CompletedAt.Valid {
+				continue
+			}
+			node := nodeTimeline(*entry.NodeID, entry.ExecutedAt)
+
+			var task *TaskTimeline
+			for i := range node.Tasks {
+				if node.Tasks[i].TaskID == *entry.TaskID {
+					task = &node.Tasks[i]
+				}
+			}
+			if task == nil {
+				node.Tasks = append(node.Tasks, TaskTimeline{TaskID: *entry.TaskID, Title: tasks[*entry.TaskID].Title})
+				task = &node.Tasks[len(node.Tasks)-1]
+			}
+
+			attempt := AttemptTimeline{
+				Status:      entry.Status,
+				HttpCode:    entry.HttpCode,
+				StartedAt:   entry.ExecutedAt,
+				CompletedAt: entry.CompletedAt.Time,
+				DurationMs:  entry.CompletedAt.Time.Sub(entry.ExecutedAt).Milliseconds(),
+				Error:       entry.Error,
+			}
+			attempt.Attempt = len(task.Attempts) + 1
+			if entry.Attempt != nil {
+				attempt.Attempt = *entry.Attempt
+			}
+			if len(task.Attempts) > 0 {
+				previous := task.Attempts[len(task.Attempts)-1]
+				attempt.WaitMs = attempt.StartedAt.Sub(previous.CompletedAt).Milliseconds()
+			}
+			task.Attempts = append(task.Attempts, attempt)
+			task.Status = attempt.Status
+		}
+	}
+
+	if timeline.StartedAt != nil {
+		end := time.Now()
+		if timeline.CompletedAt != nil {
+			end = *timeline.CompletedAt
+		}
+		timeline.DurationMs = end.Sub(*timeline.StartedAt).Milliseconds()
+	}
+
+	timeline.CriticalPath, timeline.CriticalPathDuration = criticalPath(timeline.Nodes, edges)
+
+	return timeline
+}
+
+// criticalPath finds the chain of executed nodes with the largest total duration. Fork
+// branches compete with each other, so the slowest branch ends up on the path.
+func criticalPath(nodes []NodeTimeline, edges []NodeClosure) ([]uuid.UUID, int64) {
+	duration := make(map[uuid.UUID]int64)
+	for _, node := range nodes {
+		duration[node.NodeID] = node.DurationMs
+	}
+
+	// Only keep the edges between nodes that were actually executed
+	predecessors := make(map[uuid.UUID][]uuid.UUID)
+	successors := make(map[uuid.UUID][]uuid.UUID)
+	inDegree := make(map[uuid.UUID]int)
+	for _, edge := range edges {
+		_, fromExecuted := duration[edge.Ancestor]
+		_, toExecuted := duration[edge.Descendant]
+		if !fromExecuted || !toExecuted || edge.Ancestor == edge.Descendant {
+			continue
+		}
+		predecessors[edge.Descendant] = append(predecessors[edge.Descendant], edge.Ancestor)
+		successors[edge.Ancestor] = append(successors[edge.Ancestor], edge.Descendant)
+		inDegree[edge.Descendant]++
+	}
+
+	// Walk the nodes in topological order, breaking ties by start order
+	var queue []uuid.UUID
+	for _, node := range nodes {
+		if inDegree[node.NodeID] == 0 {
+			queue = append(queue, node.NodeID)
+		}
+	}
+
+	distance := make(map[uuid.UUID]int64)
+	previous := make(map[uuid.UUID]uuid.UUID)
+	var last uuid.UUID
+	var longest int64 = -1
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		distance[current] = duration[current]
+		for _, pred := range predecessors[current] {
+			if d := distance[pred] + duration[current]; d > distance[current] {
+				distance[current] = d
+				previous[current] = pred
+			}
+		}
+		if distance[current] > longest {
+			longest = distance[current]
+			last = current
+		}
+
+		for _, next := range successors[current] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if longest < 0 {
+		return []uuid.UUID{}, 0
+	}
+
+	path := []uuid.UUID{last}
+	for {
+		pred, ok := previous[path[0]]
+		if !ok {
+			break
+		}
+		path = append([]uuid.UUID{pred}, path...)
+	}
+
+	return path, longest
+}
+
+// RenderTimelineText writes a Gantt style plain text rendering of the timeline
+func RenderTimelineText(w io.Writer, timeline Timeline) error {
+	const width = 50
+
+	start, total := timelineBounds(timeline)
+	critical := make(map[uuid.UUID]bool)
+	for _, nodeID := range timeline.CriticalPath {
+		critical[nodeID] = true
+	}
+
+	fmt.Fprintf(w, "Execution %s (%s) %dms\n", timeline.ExecutionID, timeline.Status, timeline.DurationMs)
+	for _, row := range timelineRows(timeline) {
+		offset := int(float64(row.start.Sub(start)) / float64(total) * width)
+		length := int(float64(row.duration) / float64(total) * width)
+		if length < 1 {
+			length = 1
+		}
+		if offset+length > width {
+			offset = width - length
+		}
+
+		marker := " "
+		if critical[row.nodeID] && row.attempt == 0 {
+			marker = "*"
+		}
+
+		fmt.Fprintf(w, "%s %-40s |%s%s%s| %6dms %s\n", marker, truncate(row.label, 40),
+			strings.Repeat(" ", offset), strings.Repeat("#", length), strings.Repeat(" ", width-offset-length),
+			row.duration.Milliseconds(), row.status)
+	}
+	_, err := fmt.Fprintf(w, "Critical path: %dms across %d nodes (marked *)\n", timeline.CriticalPathDuration, len(timeline.CriticalPath))
+	return err
+}
+
+var timelineHTML = template.Must(template.New("timeline").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Execution {{.ExecutionID}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; width: 100%; }
+td { padding: 2px 6px; white-space: nowrap; }
+.bar { position: relative; height: 14px; width: 600px; background: #f3f3f3; }
+.bar div { position: absolute; height: 14px; background: #4a90d9; }
+.failed .bar div { background: #d9534f; }
+.critical td:first-child { font-weight: bold; }
+</style>
+</head>
+<body>
+<h3>Execution {{.ExecutionID}} &mdash; {{.Status}} &mdash; {{.DurationMs}}ms</h3>
+<table>
+{{range .Rows}}<tr class="{{.Status}}{{if .Critical}} critical{{end}}">
+<td>{{.Label}}</td>
+<td><div class="bar"><div style="left: {{.Offset}}%; width: {{.Width}}%"></div></div></td>
+<td>{{.DurationMs}}ms</td>
+<td>{{.Status}}</td>
+</tr>
+{{end}}</table>
+<p>Critical path: {{.CriticalPathDuration}}ms (bold rows)</p>
+</body>
+</html>
+`))
+
+// RenderTimelineHTML writes a self contained HTML page with one bar per node and task attempt
+func RenderTimelineHTML(w io.Writer, timeline Timeline) error {
+	type htmlRow struct {
+		Label      string
+		Status     string
+		Critical   bool
+		Offset     float64
+		Width      float64
+		DurationMs int64
+	}
+
+	start, total := timelineBounds(timeline)
+	critical := make(map[uuid.UUID]bool)
+	for _, nodeID := range timeline.CriticalPath {
+		critical[nodeID] = true
+	}
+
+	var rows []htmlRow
+	for _, row := range timelineRows(timeline) {
+		rows = append(rows, htmlRow{
+			Label:      row.label,
+			Status:     row.status,
+			Critical:   critical[row.nodeID] && row.attempt == 0,
+			Offset:     float64(row.start.Sub(start)) / float64(total) * 100,
+			Width:      float64(row.duration) / float64(total) * 100,
+			DurationMs: row.duration.Milliseconds(),
+		})
+	}
+
+	return timelineHTML.Execute(w, map[string]interface{}{
+		"ExecutionID":          timeline.ExecutionID,
+		"Status":               timeline.Status,
+		"DurationMs":           timeline.DurationMs,
+		"CriticalPathDuration": timeline.CriticalPathDuration,
+		"Rows":                 rows,
+	})
+}
+
+type timelineRow struct {
+	nodeID   uuid.UUID
+	attempt  int // 0 for the node row itself
+	label    string
+	status   string
+	start    time.Time
+	duration time.Duration
+}
+
+// timelineRows flattens the timeline into one row per node followed by its task attempts
+func timelineRows(timeline Timeline) []timelineRow {
+	var rows []timelineRow
+
+	nodes := append([]NodeTimeline(nil), timeline.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].StartedAt.Before(nodes[j].StartedAt) })
+
+	for _, node := range nodes {
+		rows = append(rows, timelineRow{
+			nodeID:   node.NodeID,
+			label:    fmt.Sprintf("%s [%s]", node.Title, node.Type),
+			status:   node.Status,
+			start:    node.StartedAt,
+			duration: time.Duration(node.DurationMs) * time.Millisecond,
+		})
+		for _, task := range node.Tasks {
+			for _, attempt := range task.Attempts {
+				rows = append(rows, timelineRow{
+					nodeID:   node.NodeID,
+					attempt:  attempt.Attempt,
+					label:    fmt.Sprintf("  %s #%d", task.Title, attempt.Attempt),
+					status:   attempt.Status,
+					start:    attempt.StartedAt,
+					duration: attempt.CompletedAt.Sub(attempt.StartedAt),
+				})
+			}
+		}
+	}
+
+	return rows
+}
+
+// timelineBounds returns the start of the timeline and its total length (never zero)
+func timelineBounds(timeline Timeline) (time.Time, time.Duration) {
+	var start, end time.Time
+	if timeline.StartedAt != nil {
+		start = *timeline.StartedAt
+		end = start.Add(time.Duration(timeline.DurationMs) * time.Millisecond)
+	}
+
+	for _, row := range timelineRows(timeline) {
+		if start.IsZero() || row.start.Before(start) {
+			start = row.start
+		}
+		if rowEnd := row.start.Add(row.duration); rowEnd.After(end) {
+			end = rowEnd
+		}
+	}
+
+	total := end.Sub(start)
+	if total <= 0 {
+		total = time.Millisecond
+	}
+	return start, total
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-1] + "…"
+}
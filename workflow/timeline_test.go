@@ -0,0 +1,70 @@
+package workflow
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	done := func(ms int) sql.NullTime { return sql.NullTime{Time: at(ms), Valid: true} }
+
+	start, fork, fast, slow, join := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	taskID := uuid.New()
+	execution := WorkflowExecution{ID: uuid.New(), WorkflowID: uuid.New(), Status: "completed"}
+
+	nodes := map[uuid.UUID]Node{
+		start: {ID: start, Title: "start", Type: NodeTypeStart},
+		fork:  {ID: fork, Title: "fork", Type: NodeTypeFork},
+		fast:  {ID: fast, Title: "fast", Type: NodeTypeTask},
+		slow:  {ID: slow, Title: "slow", Type: NodeTypeTask},
+		join:  {ID: join, Title: "join", Type: NodeTypeJoin},
+	}
+	tasks := map[uuid.UUID]Task{taskID: {ID: taskID, Title: "call partner"}}
+	edges := []NodeClosure{
+		{Ancestor: start, Descendant: fork}, {Ancestor: fork, Descendant: fast}, {Ancestor: fork, Descendant: slow},
+		{Ancestor: fast, Descendant: join}, {Ancestor: slow, Descendant: join},
+	}
+
+	logs := []WorkflowLog{
+		{ActionType: ActionTypeExecution, Status: "executing", NodeID: &start, ExecutedAt: at(0)},
+		{ActionType: ActionTypeNode, Status: "completed", NodeID: &start, ExecutedAt: at(0), CompletedAt: done(10)},
+		{ActionType: ActionTypeNode, Status: "completed", NodeID: &fork, ExecutedAt: at(10), CompletedAt: done(20)},
+		{ActionType: ActionTypeNode, Status: "completed", NodeID: &fast, ExecutedAt: at(20), CompletedAt: done(120)},
+		{ActionType: ActionTypeTask, Status: "failed", NodeID: &slow, TaskID: &taskID, Attempt: intPtr(1), ExecutedAt: at(120), CompletedAt: done(320)},
+		{ActionType: ActionTypeTask, Status: "completed", NodeID: &slow, TaskID: &taskID, Attempt: intPtr(2), ExecutedAt: at(420), CompletedAt: done(620)},
+		{ActionType: ActionTypeNode, Status: "completed", NodeID: &slow, ExecutedAt: at(120), CompletedAt: done(620)},
+		{ActionType: ActionTypeNode, Status: "completed", NodeID: &join, ExecutedAt: at(620), CompletedAt: done(630)},
+		{ActionType: ActionTypeExecution, Status: "completed", NodeID: &start, ExecutedAt: at(0), CompletedAt: done(640)},
+	}
+
+	timeline := BuildTimeline(execution, logs, nodes, tasks, edges)
+
+	assert.Equal(t, int64(640), timeline.DurationMs)
+	assert.Len(t, timeline.Nodes, 5)
+
+	slowNode := timeline.Nodes[3]
+	assert.Equal(t, slow, slowNode.NodeID)
+	assert.Equal(t, int64(500), slowNode.DurationMs)
+	assert.Len(t, slowNode.Tasks, 1)
+	assert.Equal(t, "completed", slowNode.Tasks[0].Status)
+	assert.Len(t, slowNode.Tasks[0].Attempts, 2)
+	assert.Equal(t, int64(100), slowNode.Tasks[0].Attempts[1].WaitMs)
+
+	assert.Equal(t, []uuid.UUID{start, fork, slow, join}, timeline.CriticalPath)
+	assert.Equal(t, int64(530), timeline.CriticalPathDuration)
+
+	var text bytes.Buffer
+	assert.NoError(t, RenderTimelineText(&text, timeline))
+	assert.Contains(t, text.String(), "call partner #2")
+
+	var html bytes.Buffer
+	assert.NoError(t, RenderTimelineHTML(&html, timeline))
+	assert.Contains(t, html.String(), "slow [Task]")
+}
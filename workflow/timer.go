@@ -0,0 +1,432 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a workflow timer
+const (
+	TimerStatusPending   = "pending"
+	TimerStatusFired     = "fired"
+	TimerStatusCancelled = "cancelled"
+)
+
+// ErrTimerNotPending is returned when cancelling a timer that already fired or was cancelled
+var ErrTimerNotPending = newError("timer is not pending", ErrInvalidTransition)
+
+// ErrNoPendingTimer is returned when resuming an execution that is not parked on a timer
+var ErrNoPendingTimer = newError("no pending timer, waits are resumed by their signal", ErrInvalidTransition)
+
+// TimerConfig is the config of a Timer node. Exactly one of Duration and Until is set.
+type TimerConfig struct {
+	Duration string `json:"duration,omitempty"` // Go duration to wait for, e.g. 72h
+	Until    string `json:"until,omitempty"`    // text/template over the execution data rendering an RFC 3339 time or a date
+	Offset   string `json:"offset,omitempty"`   // Optional Go duration added to Until, e.g. -24h
+}
+
+type Timer struct {
+	ID          uuid.UUID  `db:"id" json:"id"`                     // Unique identifier for the timer
+	ExecutionID uuid.UUID  `db:"execution_id" json:"execution_id"` // Execution being parked
+	NodeID      uuid.UUID  `db:"node_id" json:"node_id"`           // Timer node that parked the execution
+	FireAt      time.Time  `db:"fire_at" json:"fire_at"`           // When the execution resumes
+	Status      string     `db:"status" json:"status"`             // pending, fired or cancelled
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`     // When the execution was parked
+	ResolvedAt  *time.Time `db:"resolved_at" json:"resolved_at"`   // When the timer fired or was cancelled
+	ResumedAt   *time.Time `db:"resumed_at" json:"resumed_at"`     // When the execution continued after the fired timer
+}
+
+// TimerConfig parses the config of a Timer node
+func (n Node) TimerConfig() (TimerConfig, error) {
+	var config TimerConfig
+	if len(n.Config) > 0 {
+		if err := json.Unmarshal(n.Config, &config); err != nil {
+			return config, fmt.Errorf("invalid timer node config: %w", err)
+		}
+	}
+	if (config.Duration == "") == (config.Until == "") {
+		return config, fmt.Errorf("timer node config requires exactly one of duration or until")
+	}
+	if config.Duration != "" {
+		duration, err := time.ParseDuration(config.Duration)
+		if err != nil || duration < 0 {
+			return config, fmt.Errorf("timer node duration must be a non negative duration")
+		}
+	}
+	if config.Offset != "" {
+		if _, err := time.ParseDuration(config.Offset); err != nil {
+			return config, fmt.Errorf("timer node offset must be a duration")
+		}
+	}
+	return config, nil
+}
+
+// FireAt computes when the timer fires for an execution parked at now
+func (c TimerConfig) FireAt(now time.Time, data json.RawMessage) (time.Time, error) {
+	if c.Duration != "" {
+		duration, err := time.ParseDuration(c.Duration)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timer duration: %w", err)
+		}
+		return now.Add(duration), nil
+	}
+
+	var values map[string]interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return time.Time{}, fmt.Errorf("execution data is not a JSON object: %w", err)
+		}
+	}
+
+	rendered, err := renderTemplate("until", c.Until, values)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fireAt, err := parseTimerTime(strings.TrimSpace(rendered))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if c.Offset != "" {
+		offset, err := time.ParseDuration(c.Offset)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timer offset: %w", err)
+		}
+		fireAt = fireAt.Add(offset)
+	}
+	return fireAt, nil
+}
+
+func parseTimerTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("until rendered %q, which is not an RFC 3339 time or a date", value)
+}
+
+// parkTimer records a pending timer for a Timer node and parks the execution
+func parkTimer(ctx context.Context, store Store, node Node, workflowID, executionID uuid.UUID) error {
+	if executionID == uuid.Nil {
+		return fmt.Errorf("timer node %s requires a workflow execution", node.ID)
+	}
+
+	config, err := node.TimerConfig()
+	if err != nil {
+		return err
+	}
+
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch workflow execution: %w", err)
+	}
+
+	fireAt, err := config.FireAt(time.Now(), execution.Data)
+	if err != nil {
+		return fmt.Errorf("failed to compute timer for node %s: %w", node.ID, err)
+	}
+
+	var timerID uuid.UUID
+	err = store.WithTx(func(tx Store) error {
+		timerID, err = tx.CreateTimer(Timer{ExecutionID: executionID, NodeID: node.ID, FireAt: fireAt})
+		if err != nil {
+			return fmt.Errorf("failed to create timer: %w", err)
+		}
+
+		err = tx.InsertWorkflowLog(WorkflowLog{
+			WorkflowID: workflowID, ExecutionID: &executionID, NodeID: &node.ID, Status: WaitStatusWaiting,
+			Message: fmt.Sprintf("Waiting until %s", fireAt.Format(time.RFC3339)), ActionType: ActionTypeNode, ExecutedAt: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to log workflow node execution: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	Logger(ctx).Info("node waiting for timer", "timer_id", timerID, "fire_at", fireAt)
+	return ErrExecutionParked
+}
+
+// CancelTimer cancels a pending timer. The branch of the timer node ends there; when
+// nothing else is parked the execution is cancelled, failing its parent execution if any.
+func CancelTimer(ctx context.Context, store Store, timerID uuid.UUID) error {
+	timer, err := store.GetTimer(timerID)
+	if err != nil {
+		return err
+	}
+
+	_, logger := withLogFields(ctx, "execution_id", timer.ExecutionID, "node_id", timer.NodeID)
+
+	executionCancelled := false
+	err = store.WithTx(func(tx Store) error {
+		cancelled, err := tx.ResolveTimer(timerID, TimerStatusCancelled)
+		if err != nil {
+			return fmt.Errorf("failed to cancel timer: %w", err)
+		}
+		if !cancelled {
+			return ErrTimerNotPending
+		}
+
+		err = logParkedNodeResolved(tx, timer.ExecutionID, timer.NodeID, timer.CreatedAt, TimerStatusCancelled, "Timer cancelled")
+		if err != nil {
+			return err
+		}
+
+		// A running execution settles itself once its branches are done
+		execution, err := tx.GetWorkflowExecutionByID(timer.ExecutionID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch workflow execution: %w", err)
+		}
+		if execution.Status != WaitStatusWaiting {
+			return nil
+		}
+
+		pending, err := tx.CountParkedNodes(timer.ExecutionID)
+		if err != nil {
+			return fmt.Errorf("failed to count parked nodes: %w", err)
+		}
+		if pending > 0 {
+			return nil
+		}
+
+		executionCancelled = true
+		return transitionExecution(tx, &execution, "cancelled", nil, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("timer cancelled", "timer_id", timerID)
+	if !executionCancelled {
+		return nil
+	}
+	logger.Info("workflow execution cancelled")
+
+	// A cancelled child execution fails the SubWorkflow node waiting for it
+	return finishChildExecution(ctx, store, timer.ExecutionID, fmt.Errorf("timer %s was cancelled", timerID))
+}
+
+// FireExecutionTimers fires the pending timers of an execution now instead of at their fire
+// time, and resumes the execution after each of them
+func FireExecutionTimers(ctx context.Context, store Store, executionID uuid.UUID) error {
+	if _, err := store.GetWorkflowExecutionByID(executionID); err != nil {
+		return fmt.Errorf("failed to fetch workflow execution: %w", err)
+	}
+	timers, err := store.ListTimers(executionID, TimerStatusPending)
+	if err != nil {
+		return err
+	}
+	if len(timers) == 0 {
+		return ErrNoPendingTimer
+	}
+
+	// A timer the poller fired in the meantime is resumed by the poller
+	var fired []Timer
+	err = store.WithTx(func(tx Store) error {
+		for _, timer := range timers {
+			resolved, err := tx.ResolveTimer(timer.ID, TimerStatusFired)
+			if err != nil {
+				return fmt.Errorf("failed to fire timer: %w", err)
+			}
+			if !resolved {
+				continue
+			}
+			if err := logParkedNodeResolved(tx, timer.ExecutionID, timer.NodeID, timer.CreatedAt, "completed", "Timer fired early"); err != nil {
+				return err
+			}
+			fired = append(fired, timer)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger := Logger(ctx)
+	for _, timer := range fired {
+		logger.Info("timer fired early", "execution_id", executionID, "node_id", timer.NodeID, "timer_id", timer.ID)
+		err := resumeExecution(ctx, store, executionID, timer.NodeID, false, claimTimer(timer.ID))
+		if errors.Is(err, ErrExecutionConflict) {
+			logger.Warn("execution is busy, the poller resumes it", "execution_id", executionID, "node_id", timer.NodeID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) CreateTimer(timer Timer) (uuid.UUID, error) {
+	if err := s.checkTenant("workflow_executions", timer.ExecutionID); err != nil {
+		return uuid.Nil, err
+	}
+
+	var id uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO workflow_timers (execution_id, node_id, fire_at, status, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id
+	`, timer.ExecutionID, timer.NodeID, timer.FireAt, TimerStatusPending).Scan(&id)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+const timerColumns = `id, execution_id, node_id, fire_at, status, created_at, resolved_at, resumed_at`
+
+func scanTimer(row interface{ Scan(...interface{}) error }) (Timer, error) {
+	var timer Timer
+	err := row.Scan(&timer.ID, &timer.ExecutionID, &timer.NodeID, &timer.FireAt, &timer.Status, &timer.CreatedAt, &timer.ResolvedAt, &timer.ResumedAt)
+	return timer, err
+}
+
+func (s *PostgresStore) GetTimer(timerID uuid.UUID) (Timer, error) {
+	row := s.db.QueryRow(`SELECT `+timerColumns+` FROM workflow_timers WHERE id = $1 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $2) OR $2 = '')`, timerID, s.tenant)
+	timer, err := scanTimer(row)
+	return timer, noRows(err, "timer", timerID)
+}
+
+// ListTimers returns the timers with the given status, of one execution or of every
+// execution when executionID is Nil
+func (s *PostgresStore) ListTimers(executionID uuid.UUID, status string) ([]Timer, error) {
+	rows, err := s.db.Query(`
+		SELECT `+timerColumns+`
+		FROM workflow_timers
+		WHERE status = $1 AND ($2::uuid IS NULL OR execution_id = $2::uuid) AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $3) OR $3 = '')
+		ORDER BY fire_at ASC
+	`, status, nullableID(executionID), s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching timers: %w", err)
+	}
+	defer rows.Close()
+
+	timers := []Timer{}
+	for rows.Next() {
+		timer, err := scanTimer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning timer row: %w", err)
+		}
+		timers = append(timers, timer)
+	}
+	return timers, rows.Err()
+}
+
+// ResolveTimer moves a timer out of pending. It returns false when the timer was already resolved.
+func (s *PostgresStore) ResolveTimer(timerID uuid.UUID, status string) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE workflow_timers
+		SET status = $1, resolved_at = NOW()
+		WHERE id = $2 AND status = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+	`, status, timerID, TimerStatusPending, s.tenant)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// CancelExecutionTimers cancels every pending timer of an execution
+func (s *PostgresStore) CancelExecutionTimers(executionID uuid.UUID) error {
+	_, err := s.db.Exec(`
+		UPDATE workflow_timers
+		SET status = $1, resolved_at = NOW()
+		WHERE execution_id = $2 AND status = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+	`, TimerStatusCancelled, executionID, TimerStatusPending, s.tenant)
+	return err
+}
+
+// ClaimDueTimers marks up to limit timers due at now as fired and returns them.
+// Rows locked by another replica are skipped, so each timer fires exactly once.
+func (s *PostgresStore) ClaimDueTimers(now time.Time, limit int) ([]Timer, error) {
+	rows, err := s.db.Query(`
+		UPDATE workflow_timers
+		SET status = $1, resolved_at = NOW()
+		WHERE id IN (
+			SELECT id FROM workflow_timers
+			WHERE status = $2 AND fire_at <= $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $5) OR $5 = '')
+			ORDER BY fire_at ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+timerColumns+`
+	`, TimerStatusFired, TimerStatusPending, now, limit, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming due timers: %w", err)
+	}
+	defer rows.Close()
+
+	var timers []Timer
+	for rows.Next() {
+		timer, err := scanTimer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning timer row: %w", err)
+		}
+		timers = append(timers, timer)
+	}
+	return timers, rows.Err()
+}
+
+// ClaimTimerResume marks a fired timer as resumed. Run it in the transaction moving the
+// execution on; it returns false when the execution already continued after the timer.
+func (s *PostgresStore) ClaimTimerResume(timerID uuid.UUID) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE workflow_timers
+		SET resumed_at = NOW()
+		WHERE id = $1 AND status = $2 AND resumed_at IS NULL AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $3) OR $3 = '')
+	`, timerID, TimerStatusFired, s.tenant)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// ListUnresumedTimers returns up to limit timers fired before resolvedBefore whose execution
+// is still parked without having continued after them
+func (s *PostgresStore) ListUnresumedTimers(resolvedBefore time.Time, limit int) ([]Timer, error) {
+	rows, err := s.db.Query(`
+		SELECT `+timerColumns+`
+		FROM workflow_timers
+		WHERE status = $1 AND resumed_at IS NULL AND resolved_at <= $2
+			AND execution_id IN (SELECT id FROM workflow_executions WHERE status IN ('executing', 'waiting') AND (tenant_id = $4 OR $4 = ''))
+		ORDER BY resolved_at ASC
+		LIMIT $3
+	`, TimerStatusFired, resolvedBefore, limit, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching unresumed timers: %w", err)
+	}
+	defer rows.Close()
+
+	var timers []Timer
+	for rows.Next() {
+		timer, err := scanTimer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning timer row: %w", err)
+		}
+		timers = append(timers, timer)
+	}
+	return timers, rows.Err()
+}
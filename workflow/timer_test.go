@@ -0,0 +1,44 @@
+package workflow
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimerConfigFireAt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	delay := TimerConfig{Duration: "72h"}
+	fireAt, err := delay.FireAt(now, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(72*time.Hour), fireAt)
+
+	data := json.RawMessage(`{"contract":{"ends_at":"2024-04-01T00:00:00Z"},"grace_until":"2024-05-01"}`)
+
+	grace := TimerConfig{Until: "{{.contract.ends_at}}", Offset: "-24h"}
+	fireAt, err = grace.FireAt(now, data)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), fireAt)
+
+	date := TimerConfig{Until: "{{.grace_until}}"}
+	fireAt, err = date.FireAt(now, data)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), fireAt)
+
+	_, err = TimerConfig{Until: "{{.missing}}"}.FireAt(now, data)
+	assert.Error(t, err)
+
+	_, err = TimerConfig{Until: "{{.contract}}"}.FireAt(now, data)
+	assert.Error(t, err)
+}
+
+func TestNodeTimerConfig(t *testing.T) {
+	assert.NoError(t, ValidateNodeConfig(Node{Type: NodeTypeTimer, Config: json.RawMessage(`{"duration":"30m"}`)}))
+	assert.NoError(t, ValidateNodeConfig(Node{Type: NodeTypeTimer, Config: json.RawMessage(`{"until":"{{.ends_at}}","offset":"-1h"}`)}))
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeTimer}))
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeTimer, Config: json.RawMessage(`{"duration":"30m","until":"{{.ends_at}}"}`)}))
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeTimer, Config: json.RawMessage(`{"duration":"-5m"}`)}))
+}
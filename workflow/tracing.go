@@ -0,0 +1,32 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/kadzany/frosty/workflow")
+
+// withTraceFields adds the trace id of the active span to the logger carried by ctx
+func withTraceFields(ctx context.Context) context.Context {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ctx
+	}
+
+	ctx, _ = withLogFields(ctx, "trace_id", spanContext.TraceID().String())
+	return ctx
+}
+
+// endSpan records err on the span, if any, and ends it. Parking is not an error.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrExecutionParked) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
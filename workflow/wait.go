@@ -0,0 +1,398 @@
+package workflow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of an execution wait
+const (
+	WaitStatusWaiting   = "waiting"
+	WaitStatusSignaled  = "signaled"
+	WaitStatusTimedOut  = "timed_out"
+	WaitStatusCancelled = "cancelled"
+)
+
+// ConditionTimeout labels the relationship followed when a wait node times out
+const ConditionTimeout = "timeout"
+
+// ErrExecutionParked is returned by ExecuteNode when the node parked the execution
+var ErrExecutionParked = errors.New("execution parked")
+
+// ErrNoPendingWait is returned when a signal does not match any pending wait
+var ErrNoPendingWait = newError("no pending wait for signal", ErrNotFound)
+
+// WaitConfig is the config of a Wait node
+type WaitConfig struct {
+	Signal  string `json:"signal"`            // Name of the signal resuming the execution
+	Timeout string `json:"timeout,omitempty"` // Optional Go duration (e.g. 48h) after which the timeout branch is followed
+}
+
+type ExecutionWait struct {
+	ID          uuid.UUID       `db:"id" json:"id"`                     // Unique identifier for the wait
+	ExecutionID uuid.UUID       `db:"execution_id" json:"execution_id"` // Execution being parked
+	NodeID      uuid.UUID       `db:"node_id" json:"node_id"`           // Wait node that parked the execution
+	SignalName  string          `db:"signal_name" json:"signal_name"`   // Signal the wait is resolved by
+	Status      string          `db:"status" json:"status"`             // waiting, signaled, timed_out or cancelled
+	TimeoutAt   *time.Time      `db:"timeout_at" json:"timeout_at"`     // When the timeout branch is followed, if any
+	Payload     json.RawMessage `db:"payload" json:"payload,omitempty"` // Payload of the signal
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`     // When the execution was parked
+	ResolvedAt  *time.Time      `db:"resolved_at" json:"resolved_at"`   // When the wait was signaled, timed out or cancelled
+	ResumedAt   *time.Time      `db:"resumed_at" json:"resumed_at"`     // When the execution continued after the resolved wait
+}
+
+// WaitConfig parses the config of a Wait node
+func (n Node) WaitConfig() (WaitConfig, error) {
+	var config WaitConfig
+	if len(n.Config) > 0 {
+		if err := json.Unmarshal(n.Config, &config); err != nil {
+			return config, fmt.Errorf("invalid wait node config: %w", err)
+		}
+	}
+	if config.Signal == "" {
+		return config, fmt.Errorf("wait node config requires a signal")
+	}
+	if config.Timeout != "" {
+		timeout, err := time.ParseDuration(config.Timeout)
+		if err != nil || timeout <= 0 {
+			return config, fmt.Errorf("wait node timeout must be a positive duration")
+		}
+	}
+	return config, nil
+}
+
+// ValidateNodeConfig checks the type specific config of a node before it is created
+func ValidateNodeConfig(node Node) error {
+	if len(node.Config) > 0 && !json.Valid(node.Config) {
+		return invalidf("config must be valid JSON")
+	}
+	switch node.Type {
+	case NodeTypeWait:
+		_, err := node.WaitConfig()
+		return invalid(err)
+	case NodeTypeTimer:
+		_, err := node.TimerConfig()
+		return invalid(err)
+	case NodeTypeSubWorkflow:
+		_, err := node.SubWorkflowConfig()
+		return invalid(err)
+	}
+	return nil
+}
+
+// parkNode records a pending wait for a Wait node and parks the execution
+func parkNode(ctx context.Context, store Store, node Node, workflowID, executionID uuid.UUID) error {
+	if executionID == uuid.Nil {
+		return fmt.Errorf("wait node %s requires a workflow execution", node.ID)
+	}
+
+	config, err := node.WaitConfig()
+	if err != nil {
+		return err
+	}
+
+	wait := ExecutionWait{ExecutionID: executionID, NodeID: node.ID, SignalName: config.Signal}
+	if config.Timeout != "" {
+		timeout, _ := time.ParseDuration(config.Timeout)
+		timeoutAt := time.Now().Add(timeout)
+		wait.TimeoutAt = &timeoutAt
+	}
+
+	err = store.WithTx(func(tx Store) error {
+		wait.ID, err = tx.CreateExecutionWait(wait)
+		if err != nil {
+			return fmt.Errorf("failed to create execution wait: %w", err)
+		}
+
+		err = tx.InsertWorkflowLog(WorkflowLog{
+			WorkflowID: workflowID, ExecutionID: &executionID, NodeID: &node.ID, Status: WaitStatusWaiting,
+			Message: fmt.Sprintf("Waiting for signal \"%s\"", config.Signal), ActionType: ActionTypeNode, ExecutedAt: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to log workflow node execution: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	Logger(ctx).Info("node waiting for signal", "wait_id", wait.ID, "signal", config.Signal, "timeout_at", wait.TimeoutAt)
+	return ErrExecutionParked
+}
+
+// SignalWorkflowExecution resolves the pending wait for signalName, merges the payload
+// into the execution data and resumes the execution after the wait node
+func SignalWorkflowExecution(ctx context.Context, store Store, executionID uuid.UUID, signalName string, payload json.RawMessage) error {
+	wait, err := store.GetPendingWait(executionID, signalName)
+	if err == sql.ErrNoRows {
+		return ErrNoPendingWait
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch execution wait: %w", err)
+	}
+
+	// Only one of a signal and the timeout poller resolves the wait
+	err = store.WithTx(func(tx Store) error {
+		resolved, err := tx.ResolveWait(wait.ID, WaitStatusSignaled, payload)
+		if err != nil {
+			return fmt.Errorf("failed to resolve execution wait: %w", err)
+		}
+		if !resolved {
+			return ErrNoPendingWait
+		}
+
+		if len(payload) > 0 {
+			if err := tx.MergeWorkflowExecutionData(executionID, payload); err != nil {
+				return fmt.Errorf("failed to merge signal payload: %w", err)
+			}
+		}
+
+		return logParkedNodeResolved(tx, wait.ExecutionID, wait.NodeID, wait.CreatedAt, "completed", fmt.Sprintf("Received signal \"%s\"", signalName))
+	})
+	if err != nil {
+		return err
+	}
+
+	// The resume is claimed together with the execution, when it is lost the poller resumes the
+	// signaled wait again. The signal is accepted even if another worker holds on to the
+	// execution for longer than the resume waits.
+	logger := Logger(ctx)
+	logger.Info("execution signaled", "execution_id", executionID, "node_id", wait.NodeID, "signal", signalName)
+	err = resumeExecution(ctx, store, executionID, wait.NodeID, false, claimWait(wait.ID))
+	if errors.Is(err, ErrExecutionConflict) {
+		logger.Warn("signaled execution is busy, the poller resumes it", "execution_id", executionID, "node_id", wait.NodeID)
+		return nil
+	}
+	return err
+}
+
+// logParkedNodeResolved writes the node log row closing a wait or timer, spanning the time
+// the node was parked
+func logParkedNodeResolved(store Store, executionID, nodeID uuid.UUID, parkedAt time.Time, status, message string) error {
+	execution, err := store.GetWorkflowExecutionByID(executionID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch workflow execution: %w", err)
+	}
+
+	err = store.InsertWorkflowLog(WorkflowLog{
+		WorkflowID: execution.WorkflowID, ExecutionID: &executionID, NodeID: &nodeID, Status: status, Message: message,
+		ActionType: ActionTypeNode, ExecutedAt: parkedAt, CompletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to log workflow node execution: %w", err)
+	}
+	return nil
+}
+
+// selectBranch returns the descendants to follow after a node of nodeType: every branch of a
+// Fork node, the first branch of any other node. Relationships labelled timeout are only
+// followed when a wait node timed out, and then exclusively.
+func selectBranch(nodeType string, children []NodeClosure, timedOut bool) []uuid.UUID {
+	var next []uuid.UUID
+	for _, child := range children {
+		if (child.Condition == ConditionTimeout) == timedOut {
+			next = append(next, child.Descendant)
+		}
+	}
+	if nodeType != NodeTypeFork && len(next) > 1 {
+		return next[:1]
+	}
+	return next
+}
+
+func (s *PostgresStore) CreateExecutionWait(wait ExecutionWait) (uuid.UUID, error) {
+	if err := s.checkTenant("workflow_executions", wait.ExecutionID); err != nil {
+		return uuid.Nil, err
+	}
+
+	var id uuid.UUID
+	err := s.db.QueryRow(`
+		INSERT INTO execution_waits (execution_id, node_id, signal_name, status, timeout_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id
+	`, wait.ExecutionID, wait.NodeID, wait.SignalName, WaitStatusWaiting, wait.TimeoutAt).Scan(&id)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return id, nil
+}
+
+const waitColumns = `id, execution_id, node_id, signal_name, status, timeout_at, payload, created_at, resolved_at, resumed_at`
+
+func scanWait(row interface{ Scan(...interface{}) error }) (ExecutionWait, error) {
+	var wait ExecutionWait
+	var payload []byte
+	err := row.Scan(
+		&wait.ID, &wait.ExecutionID, &wait.NodeID, &wait.SignalName, &wait.Status, &wait.TimeoutAt, &payload, &wait.CreatedAt, &wait.ResolvedAt, &wait.ResumedAt,
+	)
+	wait.Payload = payload
+	return wait, err
+}
+
+// GetPendingWait returns the oldest pending wait of an execution for a signal
+func (s *PostgresStore) GetPendingWait(executionID uuid.UUID, signalName string) (ExecutionWait, error) {
+	row := s.db.QueryRow(`
+		SELECT `+waitColumns+`
+		FROM execution_waits
+		WHERE execution_id = $1 AND signal_name = $2 AND status = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+		ORDER BY created_at ASC
+		LIMIT 1
+	`, executionID, signalName, WaitStatusWaiting, s.tenant)
+	return scanWait(row)
+}
+
+// CountParkedNodes returns how many waits, timers and child executions of an execution are still pending
+func (s *PostgresStore) CountParkedNodes(executionID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM execution_waits WHERE execution_id = $1 AND status = $2 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = ''))
+			+ (SELECT COUNT(*) FROM workflow_timers WHERE execution_id = $1 AND status = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = ''))
+			+ (SELECT COUNT(*) FROM workflow_executions
+				WHERE parent_execution_id = $1 AND status IN ('pending', 'executing', 'waiting') AND (tenant_id = $4 OR $4 = ''))
+	`, executionID, WaitStatusWaiting, TimerStatusPending, s.tenant).Scan(&count)
+	return count, err
+}
+
+// CancelParkedNodes cancels every pending wait, timer and child execution of an execution,
+// together with everything the cancelled children are parked on. Run it within a transaction
+// so the cancelled events are only written with the cancellations.
+func CancelParkedNodes(store Store, executionID uuid.UUID) error {
+	if err := store.CancelExecutionWaits(executionID); err != nil {
+		return err
+	}
+	if err := store.CancelExecutionTimers(executionID); err != nil {
+		return err
+	}
+
+	children, err := store.CancelChildExecutions(executionID)
+	if err != nil {
+		return err
+	}
+	for _, childID := range children {
+		child, err := store.GetWorkflowExecutionByID(childID)
+		if err != nil {
+			return err
+		}
+		if err := emitExecutionEvent(store, child, child.Status, nil); err != nil {
+			return err
+		}
+		if err := CancelParkedNodes(store, childID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveWait moves a wait out of waiting. It returns false when the wait was already resolved.
+func (s *PostgresStore) ResolveWait(waitID uuid.UUID, status string, payload json.RawMessage) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE execution_waits
+		SET status = $1, payload = $2, resolved_at = NOW()
+		WHERE id = $3 AND status = $4 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $5) OR $5 = '')
+	`, status, nullableJSON(payload), waitID, WaitStatusWaiting, s.tenant)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// CancelExecutionWaits cancels every pending wait of an execution
+func (s *PostgresStore) CancelExecutionWaits(executionID uuid.UUID) error {
+	_, err := s.db.Exec(`
+		UPDATE execution_waits
+		SET status = $1, resolved_at = NOW()
+		WHERE execution_id = $2 AND status = $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $4) OR $4 = '')
+	`, WaitStatusCancelled, executionID, WaitStatusWaiting, s.tenant)
+	return err
+}
+
+// ClaimExpiredWaits marks up to limit waits whose timeout passed as timed out and returns them.
+// Rows locked by another replica are skipped, so each wait is claimed exactly once.
+func (s *PostgresStore) ClaimExpiredWaits(now time.Time, limit int) ([]ExecutionWait, error) {
+	rows, err := s.db.Query(`
+		UPDATE execution_waits
+		SET status = $1, resolved_at = NOW()
+		WHERE id IN (
+			SELECT id FROM execution_waits
+			WHERE status = $2 AND timeout_at <= $3 AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $5) OR $5 = '')
+			ORDER BY timeout_at ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+waitColumns+`
+	`, WaitStatusTimedOut, WaitStatusWaiting, now, limit, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming expired waits: %w", err)
+	}
+	defer rows.Close()
+
+	var waits []ExecutionWait
+	for rows.Next() {
+		wait, err := scanWait(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning execution wait row: %w", err)
+		}
+		waits = append(waits, wait)
+	}
+	return waits, rows.Err()
+}
+
+// ClaimWaitResume marks a resolved wait as resumed. Run it in the transaction moving the
+// execution on; it returns false when the execution already continued after the wait.
+func (s *PostgresStore) ClaimWaitResume(waitID uuid.UUID) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE execution_waits
+		SET resumed_at = NOW()
+		WHERE id = $1 AND status <> $2 AND resumed_at IS NULL AND (execution_id IN (SELECT id FROM workflow_executions WHERE tenant_id = $3) OR $3 = '')
+	`, waitID, WaitStatusWaiting, s.tenant)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// ListUnresumedWaits returns up to limit waits signaled or timed out before resolvedBefore
+// whose execution is still parked without having continued after them
+func (s *PostgresStore) ListUnresumedWaits(resolvedBefore time.Time, limit int) ([]ExecutionWait, error) {
+	rows, err := s.db.Query(`
+		SELECT `+waitColumns+`
+		FROM execution_waits
+		WHERE status IN ($1, $2) AND resumed_at IS NULL AND resolved_at <= $3
+			AND execution_id IN (SELECT id FROM workflow_executions WHERE status IN ('executing', 'waiting') AND (tenant_id = $5 OR $5 = ''))
+		ORDER BY resolved_at ASC
+		LIMIT $4
+	`, WaitStatusSignaled, WaitStatusTimedOut, resolvedBefore, limit, s.tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching unresumed waits: %w", err)
+	}
+	defer rows.Close()
+
+	var waits []ExecutionWait
+	for rows.Next() {
+		wait, err := scanWait(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning execution wait row: %w", err)
+		}
+		waits = append(waits, wait)
+	}
+	return waits, rows.Err()
+}
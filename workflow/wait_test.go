@@ -0,0 +1,141 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectBranch(t *testing.T) {
+	approved, escalate, audit := uuid.New(), uuid.New(), uuid.New()
+	children := []NodeClosure{
+		{Descendant: approved},
+		{Descendant: escalate, Condition: ConditionTimeout},
+		{Descendant: audit, Condition: "approved"},
+	}
+
+	assert.Equal(t, []uuid.UUID{approved, audit}, selectBranch(NodeTypeFork, children, false))
+	assert.Equal(t, []uuid.UUID{approved}, selectBranch(NodeTypeTask, children, false), "only Fork nodes follow several branches")
+	assert.Equal(t, []uuid.UUID{escalate}, selectBranch(NodeTypeWait, children, true))
+	assert.Empty(t, selectBranch(NodeTypeWait, children[:1], true))
+}
+
+func TestNodeWaitConfig(t *testing.T) {
+	node := Node{Type: NodeTypeWait, Config: json.RawMessage(`{"signal":"approved","timeout":"48h"}`)}
+	config, err := node.WaitConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, WaitConfig{Signal: "approved", Timeout: "48h"}, config)
+
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeWait}))
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeWait, Config: json.RawMessage(`{"signal":"approved","timeout":"soon"}`)}))
+	assert.Error(t, ValidateNodeConfig(Node{Type: NodeTypeTask, Config: json.RawMessage(`{`)}))
+	assert.NoError(t, ValidateNodeConfig(Node{Type: NodeTypeTask}))
+}
+
+func TestMemoryStoreForkResume(t *testing.T) {
+	testStoreForkResume(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreForkResume(t *testing.T) {
+	testStoreForkResume(t, newSQLiteStore(t))
+}
+
+// testStoreForkResume resumes an execution whose parked branch leads to a node another
+// branch already ran, and checks the node is not run again
+func testStoreForkResume(t *testing.T, store Store) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	forkID, _ := store.CreateNode("Fork", NodeTypeFork, "", nil)
+	approvalID, _ := store.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved"}`))
+	chargeID, _ := store.CreateNode("Charge", NodeTypeTask, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, forkID, ""))
+	assert.NoError(t, store.AddRelationship(forkID, approvalID, ""))
+	assert.NoError(t, store.AddRelationship(forkID, chargeID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, chargeID, ""))
+	taskID, _ := store.CreateTask("Charge", "http", http.MethodPost, server.URL+"/charge", `{}`, 0)
+	assert.NoError(t, store.AddTaskToNode(chargeID, taskID, 1))
+	workflowID, _ := store.CreateWorkflow("checkout", "", startID, false)
+
+	executionID, _, err := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, ExecuteWorkflowByExecutionID(context.Background(), store, executionID))
+	assert.EqualValues(t, 1, calls.Load())
+
+	assert.NoError(t, SignalWorkflowExecution(context.Background(), store, executionID, "approved", nil))
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "completed", execution.Status)
+	assert.EqualValues(t, 1, calls.Load(), "Charge completed before the execution was parked")
+}
+
+func TestMemoryStoreJoin(t *testing.T) {
+	testStoreJoin(t, NewMemoryStore())
+}
+
+func TestSQLiteStoreJoin(t *testing.T) {
+	testStoreJoin(t, newSQLiteStore(t))
+}
+
+// testStoreJoin checks that a Join node runs once, after the last of its branches completed,
+// even when that branch was parked
+func testStoreJoin(t *testing.T, store Store) {
+	ctx := context.Background()
+	startID, _ := store.CreateNode("Start", NodeTypeStart, "", nil)
+	forkID, _ := store.CreateNode("Fork", NodeTypeFork, "", nil)
+	approvalID, _ := store.CreateNode("Approval", NodeTypeWait, "", json.RawMessage(`{"signal":"approved"}`))
+	provisionID, _ := store.CreateNode("Provision", NodeTypeTask, "", nil)
+	reserveID, _ := store.CreateNode("Reserve", NodeTypeTask, "", nil)
+	joinID, _ := store.CreateNode("Join", NodeTypeJoin, "", nil)
+	endID, _ := store.CreateNode("End", NodeTypeEnd, "", nil)
+	assert.NoError(t, store.AddRelationship(startID, forkID, ""))
+	assert.NoError(t, store.AddRelationship(forkID, approvalID, ""))
+	assert.NoError(t, store.AddRelationship(forkID, reserveID, ""))
+	assert.NoError(t, store.AddRelationship(approvalID, provisionID, ""))
+	assert.NoError(t, store.AddRelationship(provisionID, joinID, ""))
+	assert.NoError(t, store.AddRelationship(reserveID, joinID, ""))
+	assert.NoError(t, store.AddRelationship(joinID, endID, ""))
+	workflowID, _ := store.CreateWorkflow("provisioning", "", startID, false)
+
+	executionID, _, err := store.CreateWorkflowExecution(workflowID, "order-1", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := func(nodeID uuid.UUID) int {
+		logs, _ := store.GetExecutionLogs(executionID)
+		count := 0
+		for _, entry := range logs {
+			if entry.NodeID != nil && *entry.NodeID == nodeID && entry.ActionType == ActionTypeNode && entry.Status == "completed" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Reserve completed, but the approval branch is parked, so the Join does not run yet
+	assert.NoError(t, ExecuteWorkflowByExecutionID(ctx, store, executionID))
+	assert.Equal(t, 1, completed(reserveID))
+	assert.Zero(t, completed(joinID))
+	ready, err := store.AllParentsCompleted(executionID, joinID)
+	assert.NoError(t, err)
+	assert.False(t, ready)
+
+	assert.NoError(t, SignalWorkflowExecution(ctx, store, executionID, "approved", nil))
+	execution, _ := store.GetWorkflowExecutionByID(executionID)
+	assert.Equal(t, "completed", execution.Status)
+	assert.Equal(t, 1, completed(joinID))
+	assert.Equal(t, 1, completed(endID))
+	assert.Equal(t, 1, completed(reserveID))
+}